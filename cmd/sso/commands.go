@@ -0,0 +1,227 @@
+package main
+
+import (
+	"SSO/internal/config"
+	"SSO/internal/service/admins"
+	"SSO/internal/service/apps"
+	"SSO/internal/service/audit"
+	"SSO/internal/service/users"
+	"SSO/internal/storage"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs an admin subcommand instead of the server.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "import":
+		return runImport(args)
+	case "export":
+		return runExport(args)
+	case "migrate":
+		return runMigrate(args)
+	case "admin":
+		return runAdmin(args)
+	}
+	return fmt.Errorf("unknown command %q, expected import, export, migrate or admin", name)
+}
+
+var errAdminUsage = errors.New("usage: sso admin bootstrap -login <login>")
+
+// runAdmin creates the first console admin, an owner, which then creates the others
+// in the console. The password is read from SSO_ADMIN_PASSWORD, or else from the first
+// line of stdin.
+func runAdmin(args []string) error {
+	if len(args) == 0 || args[0] != "bootstrap" {
+		return errAdminUsage
+	}
+	fs := flag.NewFlagSet("admin bootstrap", flag.ExitOnError)
+	login := fs.String("login", "", "login of the first admin")
+	_ = fs.Parse(args[1:])
+	if *login == "" {
+		return errAdminUsage
+	}
+	pass, ok := os.LookupEnv("SSO_ADMIN_PASSWORD")
+	if !ok {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		pass = strings.TrimRight(line, "\r\n")
+	}
+
+	cnf, err := config.GetConfig(configPath())
+	if err != nil {
+		return err
+	}
+	s, err := storage.New(&cnf.DBConfig)
+	if err != nil {
+		return err
+	}
+	if s.Migrator != nil {
+		if err := s.Migrator.Check(context.Background()); err != nil {
+			return err
+		}
+	}
+	l := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	svc := admins.New(l, s.Tx, s.Admins, s.AdminSessions, cnf.AdminConsole.SessionTTL)
+	admin, err := svc.Bootstrap(context.Background(), *login, pass)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created owner %s\n", admin.Login)
+	return nil
+}
+
+var errMigrateUsage = errors.New("usage: sso migrate up | down | status | to <version>")
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	cnf, err := config.GetConfig(configPath())
+	if err != nil {
+		return err
+	}
+	s, err := storage.New(&cnf.DBConfig)
+	if err != nil {
+		return err
+	}
+	m := s.Migrator
+	if m == nil {
+		return fmt.Errorf("driver %q has no schema to migrate", cnf.DBConfig.Driver)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		err = m.Up(ctx)
+	case "down":
+		err = m.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			return errMigrateUsage
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("bad version %q", args[1])
+		}
+		err = m.To(ctx, version)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.Applied {
+				applied = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-30s %s\n", st.Version, st.Name, applied)
+		}
+		return nil
+	default:
+		return errMigrateUsage
+	}
+	if err != nil {
+		return err
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version: %d (latest %d)\n", version, m.Latest())
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	clientId := fs.String("app", "", "app client id")
+	format := fs.String("format", users.FormatCSV, "input format: csv or jsonl")
+	file := fs.String("file", "", "input file, stdin when empty")
+	dryRun := fs.Bool("dry-run", false, "validate the input without importing it")
+	batch := fs.Int("batch", users.DefaultImportBatchSize, "users saved per transaction")
+	_ = fs.Parse(args)
+	if *clientId == "" {
+		return fmt.Errorf("-app is required")
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	svc, err := newUsersService()
+	if err != nil {
+		return err
+	}
+	res, err := svc.Import(context.Background(), []byte(*clientId), *format, in, users.ImportOptions{DryRun: *dryRun, BatchSize: *batch})
+	if err != nil {
+		return err
+	}
+	for _, e := range res.Errors {
+		fmt.Fprintf(os.Stderr, "line %d (%s): %s\n", e.Line, e.Login, e.Err)
+	}
+	fmt.Printf("total: %d, imported: %d, failed: %d\n", res.Total, res.Imported, res.Failed)
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	clientId := fs.String("app", "", "app client id")
+	format := fs.String("format", users.FormatCSV, "output format: csv or jsonl")
+	file := fs.String("out", "", "output file, stdout when empty")
+	_ = fs.Parse(args)
+	if *clientId == "" {
+		return fmt.Errorf("-app is required")
+	}
+
+	var out io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	svc, err := newUsersService()
+	if err != nil {
+		return err
+	}
+	n, err := svc.Export(context.Background(), []byte(*clientId), *format, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d users\n", n)
+	return nil
+}
+
+func newUsersService() (*users.Users, error) {
+	cnf, err := config.GetConfig(configPath())
+	if err != nil {
+		return nil, err
+	}
+	s, err := storage.New(&cnf.DBConfig)
+	if err != nil {
+		return nil, err
+	}
+	l := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	appsService := apps.New(l, s.Tx, s.AppStorage, s.AppArchive, cnf.AppSecretGracePeriod)
+	auditService := audit.New(l, s.Tx, s.AuthEvents, appsService, s.UserStorage, audit.NewStorageSink(s.AuthEvents))
+	return users.New(l, s.Tx, s.UserStorage, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, apps.ByClientId{Apps: appsService}, auditService), nil
+}
@@ -6,12 +6,40 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 )
 
-const ConfigPath = "config/config.yaml"
+// DefaultConfigPath is where the config is looked for, in the working directory
+// and then next to the binary, unless SSO_CONFIG names the file.
+const DefaultConfigPath = "config/config.yaml"
+
+// configPath finds the config, so the binary works whatever directory it is started from.
+func configPath() string {
+	if path := os.Getenv("SSO_CONFIG"); path != "" {
+		return path
+	}
+	if _, err := os.Stat(DefaultConfigPath); err == nil {
+		return DefaultConfigPath
+	}
+	if exe, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(exe), DefaultConfigPath)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return DefaultConfigPath
+}
 
 func main() {
-	cnf, err := config.GetConfig(ConfigPath)
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cnf, err := config.GetConfig(configPath())
 	if err != nil {
 		panic(err)
 	}
@@ -19,7 +47,7 @@ func main() {
 	l.Info(fmt.Sprintf("Config: %+v", cnf))
 	l.Info(fmt.Sprintf("PATH: %+v", os.Args[0]))
 	App := app.New(l, cnf)
-	defer App.GRPCApp.Stop()
+	defer App.Stop()
 
 	go func() {
 		if err := App.HTTPApp.Run(); err != nil {
@@ -28,6 +56,15 @@ func main() {
 		}
 	}()
 
+	if App.MetricsApp != nil {
+		go func() {
+			if err := App.MetricsApp.Run(); err != nil {
+				l.Error(err.Error())
+				panic(err)
+			}
+		}()
+	}
+
 	if err := App.GRPCApp.Run(); err != nil {
 		l.Error(err.Error())
 		panic(err)
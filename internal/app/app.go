@@ -4,33 +4,128 @@ import (
 	GrpcApp "SSO/internal/app/grpc"
 	HttpApp "SSO/internal/app/http"
 	"SSO/internal/config"
+	grpcAuth "SSO/internal/grpc/auth"
+	"SSO/internal/pkg/metrics"
+	"SSO/internal/pkg/tracing"
+	"SSO/internal/service/admins"
 	"SSO/internal/service/apps"
+	"SSO/internal/service/audit"
 	"SSO/internal/service/auth"
 	"SSO/internal/service/permissions"
+	"SSO/internal/service/users"
 	"SSO/internal/storage"
+	"SSO/internal/storage/cache"
+	"context"
 	"log/slog"
+	"net/http"
+	"time"
 )
 
 type App struct {
 	GRPCApp *GrpcApp.App
 	HTTPApp *HttpApp.App
+	// MetricsApp serves /metrics when it has an address of its own, it is nil otherwise.
+	MetricsApp *HttpApp.App
+
+	stopBackground context.CancelFunc
+	audit          *audit.Audit
+	stopTracing    func(context.Context) error
 }
 
 func New(l *slog.Logger, cnf *config.Config) *App {
+	stopTracing, err := tracing.Setup(context.Background(), cnf.Tracing)
+	if err != nil {
+		panic(err)
+	}
 	s, err := storage.New(&cnf.DBConfig)
 	if err != nil {
 		panic(err)
 	}
+	if s.Migrator != nil {
+		if cnf.DBConfig.AutoMigrate {
+			err = s.Migrator.Up(context.Background())
+		} else {
+			err = s.Migrator.Check(context.Background())
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
 
-	permService := permissions.New(l, s.PermissionsStorage)
-	authService := auth.New(l, s.UserStorage, s.AppStorage, permService, cnf.TokenTTL)
-	appsService := apps.New(l, s.AppStorage)
+	// Instances sharing a database tell each other about the apps they change.
+	// The memory driver's data can't be shared, so it has no feed for that.
+	followInvalidations := s.AppInvalidations != nil && cnf.AppCache.InvalidationInterval > 0
+	appCacheOpts := cache.AppOptions{
+		TTL:         cnf.AppCache.TTL,
+		NegativeTTL: cnf.AppCache.NegativeTTL,
+		MaxEntries:  cnf.AppCache.MaxEntries,
+		Tx:          s.Tx,
+	}
+	if followInvalidations {
+		appCacheOpts.OnInvalidate = cache.Publisher(l, s.AppInvalidations)
+	}
+	appStorage := cache.NewAppStorage(s.AppStorage, appCacheOpts)
 
-	grpcApp := GrpcApp.New(l, authService, appsService, permService, &cnf.GRPCBindConfig)
-	httpApp := HttpApp.NewHttpApp(appsService, &cnf.HttpBindConfig)
+	m := metrics.New()
+	if s.DB != nil {
+		m.RegisterDB(s.DB, cnf.DBConfig.DBName)
+	}
+	m.RegisterAppCache(appStorage)
+
+	appsService := apps.New(l, s.Tx, appStorage, s.AppArchive, cnf.AppSecretGracePeriod)
+	sinks, err := audit.NewSinks(cnf.Audit.Sinks, cnf.Audit.File, s.AuthEvents)
+	if err != nil {
+		panic(err)
+	}
+	auditService := audit.New(l, s.Tx, s.AuthEvents, appsService, s.UserStorage, sinks...)
+	permService := permissions.New(l, s.Tx, s.PermissionsStorage, s.PermissionAudit, s.AccessRequests, auditService, cnf.Scopes)
+	usersService := users.New(l, s.Tx, s.UserStorage, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, appsService, auditService)
+	authService := auth.New(l, s.Tx, s.UserStorage, s.UserSessions, appsService, permService, usersService, auditService, m, cnf.TokenTTL)
+	// The console is trusted to name apps by client id instead of their credential.
+	consoleApps := apps.ByClientId{Apps: appsService}
+	consoleUsers := users.New(l, s.Tx, s.UserStorage, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, consoleApps, auditService)
+	adminsService := admins.New(l, s.Tx, s.Admins, s.AdminSessions, cnf.AdminConsole.SessionTTL)
+
+	ssoServer := grpcAuth.NewServer(authService, appsService, permService)
+	grpcApp := GrpcApp.New(l, ssoServer, appsService, usersService, auditService, m, cnf.AdminKey, &cnf.GRPCBindConfig)
+	var httpMetrics http.Handler
+	var metricsApp *HttpApp.App
+	if cnf.Metrics.Enabled {
+		if cnf.Metrics.Bind.Port != "" {
+			metricsApp = HttpApp.NewMetricsApp(m.Handler(), &cnf.Metrics.Bind)
+		} else {
+			httpMetrics = m.Handler()
+		}
+	}
+	httpApp, err := HttpApp.NewHttpApp(l, ssoServer, grpcApp.UnaryInterceptor(), appsService, consoleUsers, permService, consoleApps, adminsService, httpMetrics, &cnf.HttpBindConfig, &cnf.AdminConsole)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go permService.RunSweeper(ctx, cnf.PermissionsSweepInterval)
+	go authService.RunPurger(ctx, cnf.UserPurgeInterval, cnf.UserRetention)
+	if followInvalidations {
+		go appStorage.RunFollower(ctx, l, s.AppInvalidations, cnf.AppCache.InvalidationInterval)
+	}
 
 	return &App{
-		GRPCApp: grpcApp,
-		HTTPApp: httpApp,
+		GRPCApp:        grpcApp,
+		HTTPApp:        httpApp,
+		MetricsApp:     metricsApp,
+		stopBackground: cancel,
+		audit:          auditService,
+		stopTracing:    stopTracing,
 	}
 }
+
+// Stop stops the gRPC server and background jobs, then closes the audit log and
+// flushes the spans not exported yet.
+func (a *App) Stop() {
+	a.stopBackground()
+	a.GRPCApp.Stop()
+	_ = a.audit.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = a.stopTracing(ctx)
+}
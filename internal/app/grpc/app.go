@@ -2,7 +2,11 @@ package grpc
 
 import (
 	"SSO/internal/config"
+	"SSO/internal/grpc/apps"
 	"SSO/internal/grpc/auth"
+	"SSO/internal/grpc/users"
+	"SSO/internal/pkg/metrics"
+	"SSO/internal/pkg/tracing"
 	"context"
 	"fmt"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
@@ -18,12 +22,19 @@ type App struct {
 	l          *slog.Logger
 	grpcServer *grpc.Server
 	bindCnf    *config.BindConfig
+	unary      grpc.UnaryServerInterceptor
 }
 
-func New(l *slog.Logger, authService auth.Auth, appsService auth.Apps, permService auth.Permissions, cnf *config.BindConfig) *App {
+// New serves ssoServer as the Auth and Permissions services next to the Users and Apps ones.
+// The Users service pages through authEvents too. Every RPC is traced, continuing
+// the caller's trace, and counted and timed by m. The app a request's key
+// authenticates with appsService is the actor its audit entries name.
+func New(l *slog.Logger, ssoServer *auth.SSOServer, appsService apps.Apps, usersService users.Users, authEvents users.AuthEvents, m *metrics.Metrics, adminKey string, cnf *config.BindConfig) *App {
+	// Payloads carry passwords, tokens and app credentials, so only the start
+	// and end of calls are logged.
 	loggingOpts := []logging.Option{
 		logging.WithLogOnEvents(
-			logging.PayloadReceived, logging.PayloadSent,
+			logging.StartCall, logging.FinishCall,
 		),
 	}
 
@@ -34,20 +45,42 @@ func New(l *slog.Logger, authService auth.Auth, appsService auth.Apps, permServi
 		}),
 	}
 
-	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+	unary := []grpc.UnaryServerInterceptor{
+		tracing.UnaryServerInterceptor(),
+		m.UnaryServerInterceptor(),
 		recovery.UnaryServerInterceptor(recoveryOpts...),
+		reqMetaInterceptor,
+		principalInterceptor(appsService),
 		logging.UnaryServerInterceptor(interceptorLog(l), loggingOpts...),
+	}
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(
+		tracing.StreamServerInterceptor(),
+		m.StreamServerInterceptor(),
+		recovery.StreamServerInterceptor(recoveryOpts...),
+		streamReqMetaInterceptor,
+		streamPrincipalInterceptor(appsService),
+		logging.StreamServerInterceptor(interceptorLog(l), loggingOpts...),
 	))
 
-	auth.RegisterServer(grpcServer, authService, appsService, permService)
+	auth.RegisterServer(grpcServer, ssoServer)
+	users.RegisterServer(grpcServer, usersService, authEvents)
+	apps.RegisterServer(grpcServer, appsService, adminKey)
 
 	return &App{
 		l:          l,
 		grpcServer: grpcServer,
 		bindCnf:    cnf,
+		unary:      chainUnary(unary),
 	}
 }
 
+// UnaryInterceptor runs a call through the interceptors of the server's unary RPCs,
+// for callers of the services in process to get the same recovery, request
+// metadata, metrics, spans and logs as remote ones.
+func (a *App) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return a.unary
+}
+
 func (a *App) Run() error {
 	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", a.bindCnf.Addr, a.bindCnf.Port))
 	if err != nil {
@@ -64,6 +97,21 @@ func (a *App) Stop() {
 	a.grpcServer.GracefulStop()
 }
 
+// chainUnary makes one interceptor of interceptors, the first being the outermost
+// as in grpc.ChainUnaryInterceptor.
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
 func interceptorLog(l *slog.Logger) logging.Logger {
 	return logging.LoggerFunc(func(ctx context.Context, level logging.Level, msg string, fields ...any) {
 		l.Log(ctx, slog.Level(level), msg, fields...)
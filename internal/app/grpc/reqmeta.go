@@ -0,0 +1,113 @@
+package grpc
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
+	"context"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// reqMetaInterceptor stores the caller's request id, the party it acts on behalf of,
+// its address and user agent in the context, generating a request id when the caller didn't send one. The
+// request id is sent back in the header and added to the RPC's span, to find the
+// trace of an audited event.
+func reqMetaInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, m := withReqMeta(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(reqmeta.RequestIdKey, m.RequestId))
+	return handler(ctx, req)
+}
+
+// streamReqMetaInterceptor is reqMetaInterceptor for streaming RPCs.
+func streamReqMetaInterceptor(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, m := withReqMeta(ss.Context())
+	_ = ss.SetHeader(metadata.Pairs(reqmeta.RequestIdKey, m.RequestId))
+	wrapped := middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = ctx
+	return handler(srv, wrapped)
+}
+
+func withReqMeta(ctx context.Context) (context.Context, reqmeta.Meta) {
+	var m reqmeta.Meta
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		m.RequestId = first(md.Get(reqmeta.RequestIdKey))
+		m.OnBehalfOf = first(md.Get(reqmeta.OnBehalfOfKey))
+		m.UserAgent = first(md.Get("user-agent"))
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		m.IP = reqmeta.Host(p.Addr.String())
+	}
+	if m.RequestId == "" {
+		m.RequestId = reqmeta.NewRequestId()
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("sso.request_id", m.RequestId))
+	return reqmeta.With(ctx, m), m
+}
+
+// AppsProvider authenticates the app key of a request.
+type AppsProvider interface {
+	GetByKey(ctx context.Context, key []byte) (models.App, error)
+}
+
+// appKeyRequest is a request carrying the key of the calling app.
+type appKeyRequest interface {
+	GetAppKey() []byte
+}
+
+// principalInterceptor makes the app a request's key authenticates the actor of the
+// call, so audit entries name who acted rather than who the caller claims to be.
+// Calls whose key doesn't authenticate get no actor and fail in the handler.
+func principalInterceptor(apps AppsProvider) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withPrincipal(ctx, apps, req), req)
+	}
+}
+
+// streamPrincipalInterceptor is principalInterceptor for streaming RPCs, which carry
+// the app key in their first message.
+func streamPrincipalInterceptor(apps AppsProvider) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := middleware.WrapServerStream(ss)
+		return handler(srv, &principalStream{WrappedServerStream: wrapped, apps: apps})
+	}
+}
+
+type principalStream struct {
+	*middleware.WrappedServerStream
+	apps     AppsProvider
+	received bool
+}
+
+func (s *principalStream) RecvMsg(m interface{}) error {
+	if err := s.WrappedServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if !s.received {
+		s.received = true
+		s.WrappedContext = withPrincipal(s.WrappedContext, s.apps, m)
+	}
+	return nil
+}
+
+func withPrincipal(ctx context.Context, apps AppsProvider, msg interface{}) context.Context {
+	req, ok := msg.(appKeyRequest)
+	if !ok || len(req.GetAppKey()) == 0 {
+		return ctx
+	}
+	app, err := apps.GetByKey(ctx, req.GetAppKey())
+	if err != nil {
+		return ctx
+	}
+	return reqmeta.WithActor(ctx, "app:"+app.ClientId)
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
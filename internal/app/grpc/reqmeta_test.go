@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
+	"SSO/internal/storage/storageErrors"
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+type fakeApps map[string]models.App
+
+func (a fakeApps) GetByKey(_ context.Context, key []byte) (models.App, error) {
+	app, ok := a[string(key)]
+	if !ok {
+		return models.App{}, storageErrors.ErrAppNotFound
+	}
+	return app, nil
+}
+
+var testApps = fakeApps{"c1.secret": {Id: 1, ClientId: "c1"}}
+
+func TestPrincipalInterceptor(t *testing.T) {
+	chain := chainUnary([]grpc.UnaryServerInterceptor{reqMetaInterceptor, principalInterceptor(testApps)})
+	call := func(req interface{}) reqmeta.Meta {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(reqmeta.OnBehalfOfKey, "alice"))
+		var m reqmeta.Meta
+		_, err := chain(ctx, req, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			m = reqmeta.From(ctx)
+			return nil, nil
+		})
+		require.NoError(t, err)
+		return m
+	}
+
+	m := call(&ssoV1.LoginRequest{AppKey: []byte("c1.secret")})
+	require.Equal(t, "app:c1", m.Actor)
+	require.Equal(t, "alice", m.OnBehalfOf, "x-actor is kept apart")
+	require.Empty(t, call(&ssoV1.LoginRequest{AppKey: []byte("c1.wrong")}).Actor)
+	require.Empty(t, call(&ssoV1.LoginRequest{}).Actor)
+	require.Empty(t, call(&ssoV1.ListAppsRequest{}).Actor)
+}
+
+// recvStream hands out msg on every receive.
+type recvStream struct {
+	grpc.ServerStream
+	msg proto.Message
+}
+
+func (s recvStream) Context() context.Context { return context.Background() }
+
+func (s recvStream) RecvMsg(m interface{}) error {
+	proto.Merge(m.(proto.Message), s.msg)
+	return nil
+}
+
+func TestStreamPrincipalInterceptor(t *testing.T) {
+	ss := recvStream{msg: &ssoV1.ImportUsersRequest{AppKey: []byte("c1.secret")}}
+	err := streamPrincipalInterceptor(testApps)(nil, ss, &grpc.StreamServerInfo{}, func(_ interface{}, stream grpc.ServerStream) error {
+		require.Empty(t, reqmeta.From(stream.Context()).Actor, "before the first message")
+		require.NoError(t, stream.RecvMsg(&ssoV1.ImportUsersRequest{}))
+		require.Equal(t, "app:c1", reqmeta.From(stream.Context()).Actor)
+		return nil
+	})
+	require.NoError(t, err)
+}
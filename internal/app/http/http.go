@@ -2,19 +2,59 @@ package http
 
 import (
 	"SSO/internal/config"
+	"SSO/internal/http/admin"
 	"SSO/internal/http/apps"
+	"SSO/internal/http/gateway"
+	"SSO/internal/http/users"
+	"SSO/web"
 	"fmt"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"log/slog"
+	"net/http"
 )
 
 type App struct {
 	server *apps.HttpServer
 }
 
-func NewHttpApp(appsServer apps.Apps, cnf *config.BindConfig) *App {
-	handler := apps.NewHandler(appsServer)
-	server := apps.NewHttpServer(fmt.Sprintf("%s:%s", cnf.Addr, cnf.Port), handler.GetMuxRouter())
+// NewHttpApp serves the admin console and the REST/JSON gateway to sso. Every console
+// page but the login one requires a signed-in admin, see admin.Guard; the gateway
+// authenticates like the gRPC services it calls and runs its calls through intercept,
+// the gRPC server's interceptors. A non-nil metrics is served at /metrics.
+// It fails when the console's dev directory can't be rendered.
+func NewHttpApp(l *slog.Logger, sso gateway.Server, intercept grpc.UnaryServerInterceptor, appsServer apps.Apps, usersServer users.Users, permServer users.Permissions, appsProvider users.AppsProvider, adminsServer admin.Admins, metrics http.Handler, cnf *config.BindConfig, console *config.ConsoleConfig) (*App, error) {
+	const op = "HttpApp.NewHttpApp"
+
+	site, err := web.New(console.DevDir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if console.DevDir != "" {
+		l.Warn(fmt.Sprintf("serving the console from %s", console.DevDir))
+	}
+	rtr := mux.NewRouter()
+	rtr.PathPrefix("/static/").Handler(http.StripPrefix("/static/", site.Static())).Methods("GET")
+	guard := admin.NewGuard(adminsServer)
+	admin.NewHandler(adminsServer, guard, site, console.SecureCookies).RegisterRoutes(rtr)
+	apps.NewHandler(appsServer, site).RegisterRoutes(rtr, guard)
+	users.NewHandler(usersServer, permServer, appsProvider).RegisterRoutes(rtr, guard)
+	gateway.New(l, sso, intercept).RegisterRoutes(rtr)
+	if metrics != nil {
+		rtr.Handle("/metrics", metrics).Methods("GET")
+	}
+	server := apps.NewHttpServer(fmt.Sprintf("%s:%s", cnf.Addr, cnf.Port), rtr)
 	return &App{
 		server: server,
+	}, nil
+}
+
+// NewMetricsApp serves metrics at /metrics on an address of its own.
+func NewMetricsApp(metrics http.Handler, cnf *config.BindConfig) *App {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	return &App{
+		server: apps.NewHttpServer(fmt.Sprintf("%s:%s", cnf.Addr, cnf.Port), mux),
 	}
 }
 
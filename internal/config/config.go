@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"time"
 )
@@ -8,8 +9,99 @@ import (
 type Config struct {
 	GRPCBindConfig BindConfig    `yaml:"bind_grpc"`
 	HttpBindConfig BindConfig    `yaml:"bind_http"`
+	AdminConsole   ConsoleConfig `yaml:"admin_console"`
 	DBConfig       DBConfig      `yaml:"DB"`
+	AppCache       CacheConfig   `yaml:"app_cache"`
+	Audit          AuditConfig   `yaml:"audit"`
+	Metrics        MetricsConfig `yaml:"metrics"`
+	Tracing        TracingConfig `yaml:"tracing"`
 	TokenTTL       time.Duration `yaml:"token_TTL"`
+	// PermissionsSweepInterval is how often expired permission grants are removed.
+	PermissionsSweepInterval time.Duration `yaml:"permissions_sweep_interval" env-default:"1m"`
+	// UserRetention is how long soft-deleted users can be restored before they are purged.
+	UserRetention     time.Duration `yaml:"user_retention" env-default:"720h"`
+	UserPurgeInterval time.Duration `yaml:"user_purge_interval" env-default:"1h"`
+	// AdminKey authorizes the app management RPCs. Empty disables them.
+	AdminKey string `yaml:"admin_key" env:"SSO_ADMIN_KEY"`
+	// AppSecretGracePeriod is how long a rotated app secret keeps working by default.
+	AppSecretGracePeriod time.Duration `yaml:"app_secret_grace_period" env-default:"168h"`
+	// Scopes maps scope names that can be requested at login to the permission bits they require.
+	Scopes map[string]int32 `yaml:"scopes"`
+}
+
+// String formats the config for logging with the admin key and the database
+// password redacted.
+func (c Config) String() string {
+	type plain Config
+	p := plain(c)
+	p.AdminKey = redact(p.AdminKey)
+	p.DBConfig.Password = redact(p.DBConfig.Password)
+	return fmt.Sprintf("%+v", p)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// CacheConfig bounds an in-process cache. With several instances keep TTL short,
+// as entries changed by another instance are only refreshed when they expire.
+type CacheConfig struct {
+	// TTL of cached entries, zero disables the cache.
+	TTL time.Duration `yaml:"ttl" env-default:"30s"`
+	// NegativeTTL is how long lookups of unknown keys are remembered.
+	NegativeTTL time.Duration `yaml:"negative_ttl" env-default:"5s"`
+	MaxEntries  int           `yaml:"max_entries" env-default:"10000"`
+	// InvalidationInterval is how often the apps changed by other instances sharing
+	// the database are looked up to drop them from the cache. Zero leaves it to the TTL.
+	InvalidationInterval time.Duration `yaml:"invalidation_interval" env-default:"2s"`
+}
+
+// ConsoleConfig configures the HTTP admin console.
+type ConsoleConfig struct {
+	// SessionTTL is how long an admin stays signed in.
+	SessionTTL time.Duration `yaml:"session_ttl" env-default:"12h"`
+	// SecureCookies marks the session cookies Secure. Set it when the console
+	// is served over HTTPS, browsers won't send them over plain HTTP then.
+	SecureCookies bool `yaml:"secure_cookies" env-default:"false"`
+	// DevDir, when set, serves the console's templates and static assets from this
+	// directory, re-read on every request, instead of the copies embedded in the
+	// binary. Point it at the repository's web directory while working on the console.
+	DevDir string `yaml:"dev_dir" env:"SSO_WEB_DEV_DIR"`
+}
+
+// AuditConfig chooses where authentication events are recorded.
+type AuditConfig struct {
+	// Sinks lists where events are written: "db", "file" and "stdout". Only
+	// events written to db can be queried with ListAuthEvents.
+	Sinks []string `yaml:"sinks" env:"SSO_AUDIT_SINKS" env-default:"db"`
+	// File is the JSON lines file of the file sink, appended to.
+	File string `yaml:"file" env-default:"audit.jsonl"`
+}
+
+// MetricsConfig configures the Prometheus /metrics endpoint.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled" env:"SSO_METRICS_ENABLED" env-default:"true"`
+	// Bind serves /metrics on an address of its own, keeping it off the HTTP server
+	// the console and the gateway are on. Without a port it's served by that server.
+	Bind BindConfig `yaml:"bind"`
+}
+
+// TracingConfig configures OpenTelemetry tracing.
+type TracingConfig struct {
+	// Exporter is where spans go: "otlp", "stdout" or "none", which disables tracing.
+	Exporter string `yaml:"exporter" env:"SSO_TRACING_EXPORTER" env-default:"none"`
+	// Endpoint is the host:port of the OTLP gRPC collector. When empty the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used, or localhost:4317.
+	Endpoint string `yaml:"endpoint" env:"SSO_TRACING_ENDPOINT"`
+	// Insecure connects to the collector without TLS.
+	Insecure    bool   `yaml:"insecure" env:"SSO_TRACING_INSECURE" env-default:"false"`
+	ServiceName string `yaml:"service_name" env-default:"sso"`
+	// SampleRatio is the share of the traces started here that are sampled,
+	// traces continued from a caller follow the caller's decision.
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
 }
 
 type BindConfig struct {
@@ -18,10 +110,18 @@ type BindConfig struct {
 }
 
 type DBConfig struct {
+	// Driver selects the storage backend: mysql, postgres, sqlite or memory.
+	Driver   string `yaml:"driver" env-default:"mysql"`
 	Server   string `yaml:"server"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
-	DBName   string `yaml:"db_name"`
+	// DBName is the database name, or the database file path for sqlite.
+	DBName string `yaml:"db_name"`
+	// SSLMode is passed to postgres as sslmode and ignored by the other drivers.
+	SSLMode string `yaml:"ssl_mode" env-default:"disable"`
+	// AutoMigrate applies pending migrations at startup. Without it the server
+	// refuses to start until `sso migrate up` has been run.
+	AutoMigrate bool `yaml:"auto_migrate" env-default:"false"`
 }
 
 func GetConfig(path string) (*Config, error) {
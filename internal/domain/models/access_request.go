@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+)
+
+type AccessRequest struct {
+	Id         int64
+	AppId      int32
+	UserId     int64
+	Login      string
+	Permission int32
+	Duration   time.Duration
+	Reason     string
+	Status     string
+	Approver   string
+	CreatedAt  time.Time
+	DecidedAt  time.Time
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Admin roles, each allowed everything the ones before it are.
+const (
+	// AdminViewer sees apps and users.
+	AdminViewer = "viewer"
+	// AdminOperator also creates apps, rotates their secrets and imports users.
+	AdminOperator = "operator"
+	// AdminOwner also deletes apps and manages admins.
+	AdminOwner = "owner"
+)
+
+var adminRoleRanks = map[string]int{
+	AdminViewer:   1,
+	AdminOperator: 2,
+	AdminOwner:    3,
+}
+
+// ValidAdminRole reports whether role is one of the admin roles.
+func ValidAdminRole(role string) bool {
+	return adminRoleRanks[role] != 0
+}
+
+// Admin is an account of the admin console.
+type Admin struct {
+	Id           int64
+	Login        string
+	PasswordHash []byte
+	Role         string
+	CreatedAt    time.Time
+}
+
+// Can reports whether the admin's role allows what role does.
+func (a Admin) Can(role string) bool {
+	rank := adminRoleRanks[a.Role]
+	return rank != 0 && rank >= adminRoleRanks[role]
+}
+
+// AdminSession is a signed-in admin console session. Only a hash of the token
+// the session cookie carries is stored. CSRFToken must come with every POST.
+type AdminSession struct {
+	TokenHash []byte
+	AdminId   int64
+	CSRFToken string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -1,6 +1,108 @@
 package models
 
+import "time"
+
+// App is a client application. Apps authenticate with their credential, the client
+// id and the secret joined by a dot. Only a hash of the secret is stored, and tokens
+// are signed with a separate key that never leaves the server.
 type App struct {
-	Id  int32  `json:"id"`
-	Key []byte `json:"key"`
+	Id         int32  `json:"id"`
+	ClientId   string `json:"client_id"`
+	SecretHash []byte `json:"-"`
+	SigningKey []byte `json:"-"`
+
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Owner       string `json:"owner"`
+	LogoURL     string `json:"logo_url"`
+	// RedirectURIs are where the app may send users back to after signing in.
+	RedirectURIs []string `json:"redirect_uris"`
+	// AllowedOrigins are the browser origins the app calls the server from.
+	AllowedOrigins []string  `json:"allowed_origins"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	Settings AppSettings `json:"settings"`
+
+	// SecretUsedAt is when the secret last authenticated, give or take a minute.
+	SecretUsedAt    time.Time `json:"secret_used_at"`
+	SecretRotatedAt time.Time `json:"secret_rotated_at"`
+	// PrevSecretHash is the secret the last rotation replaced. It keeps
+	// authenticating until PrevSecretExpiresAt. PrevSecretUsedAt is only set
+	// when a client used it after the rotation.
+	PrevSecretHash      []byte    `json:"-"`
+	PrevSecretExpiresAt time.Time `json:"prev_secret_expires_at"`
+	PrevSecretUsedAt    time.Time `json:"prev_secret_used_at"`
+	// PrevSigningKey is the signing key replaced last. Tokens it signed keep
+	// verifying until PrevSigningKeyExpiresAt, new ones are signed with SigningKey.
+	PrevSigningKey          []byte    `json:"-"`
+	PrevSigningKeyExpiresAt time.Time `json:"prev_signing_key_expires_at"`
+}
+
+// AppSettings change how users of the app register and sign in. The zero value
+// keeps the server defaults.
+type AppSettings struct {
+	// TokenTTL overrides the server's token TTL when set.
+	TokenTTL time.Duration `json:"token_ttl"`
+	// RegistrationClosed refuses new users, only imports can add them then.
+	RegistrationClosed bool `json:"registration_closed"`
+	// RequireMFA refuses logins of users that haven't enabled MFA.
+	RequireMFA     bool           `json:"require_mfa"`
+	PasswordPolicy PasswordPolicy `json:"password_policy"`
+}
+
+// PasswordPolicy is what passwords set at registration or on change must satisfy.
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+}
+
+// PrevSecretValid reports whether the previous secret still authenticates at now.
+func (a App) PrevSecretValid(now time.Time) bool {
+	return len(a.PrevSecretHash) != 0 && now.Before(a.PrevSecretExpiresAt)
+}
+
+// PrevSigningKeyValid reports whether tokens signed with the previous signing key
+// still verify at now.
+func (a App) PrevSigningKeyValid(now time.Time) bool {
+	return len(a.PrevSigningKey) != 0 && now.Before(a.PrevSigningKeyExpiresAt)
+}
+
+// PrevSecretInUse reports whether a client used the previous secret after the
+// rotation, i.e. not every consumer has switched to the new one yet.
+func (a App) PrevSecretInUse() bool {
+	return !a.PrevSecretUsedAt.IsZero()
+}
+
+// AppData counts what belongs to an app's users and is deleted together with the app.
+type AppData struct {
+	Users          int64 `json:"users"`
+	Permissions    int64 `json:"permissions"`
+	AccessRequests int64 `json:"access_requests"`
+	Attributes     int64 `json:"attributes"`
+	Sessions       int64 `json:"sessions"`
+}
+
+// DeletedApp is the archived record of a deleted app, kept for audit. App holds the
+// app as it was, without its credentials, and Data what was deleted along with it.
+type DeletedApp struct {
+	Id        int64     `json:"id"`
+	App       App       `json:"app"`
+	Data      AppData   `json:"data"`
+	Cascade   bool      `json:"cascade"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by"`
+	RequestId string    `json:"request_id"`
+	// OnBehalfOf is who the caller said it acted for, unverified.
+	OnBehalfOf string `json:"on_behalf_of"`
+}
+
+// AppInvalidation tells the instances sharing a database that an app changed.
+type AppInvalidation struct {
+	Id        int64
+	ClientId  string
+	CreatedAt time.Time
 }
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Types of AuthEvent.
+const (
+	AuthEventLogin            = "login"
+	AuthEventRegister         = "register"
+	AuthEventPasswordChange   = "password_change"
+	AuthEventLoginRename      = "login_rename"
+	AuthEventUserDelete       = "user_delete"
+	AuthEventTokenRevoke      = "token_revoke"
+	AuthEventPermissionChange = "permission_change"
+	AuthEventStatusChange     = "status_change"
+	AuthEventUserRestore      = "user_restore"
+	AuthEventMFAReset         = "mfa_reset"
+)
+
+// AuthEvent is one record of the authentication audit log. Detail says why a failed
+// event failed, or what a successful one changed. Events recorded by user id only,
+// such as permission changes, have no Login; storage fills it in from the user when listing.
+type AuthEvent struct {
+	Id        int64
+	Type      string
+	AppId     int32
+	UserId    int64
+	Login     string
+	Success   bool
+	Detail    string
+	Actor     string
+	IP        string
+	UserAgent string
+	RequestId string
+	CreatedAt time.Time
+	// OnBehalfOf is who the caller said it acted for, unverified.
+	OnBehalfOf string
+}
+
+// AuthEventFilter selects an app's events. UserId and Login both select events of
+// a user: UserId follows the user across renames, Login also matches events
+// recorded before the user was known, such as logins to unknown accounts.
+type AuthEventFilter struct {
+	AppId  int32
+	UserId int64
+	Login  string
+	Type   string
+	From   time.Time
+	To     time.Time
+	// BeforeId returns only events older than the given id, used as the page cursor.
+	BeforeId int64
+	Limit    int
+}
@@ -1,7 +1,14 @@
 package models
 
+import "time"
+
 type Permission struct {
-	Id     int
-	UserId int
-	Value  int16
+	UserId int64
+	Value  int32
+	// ExpiresAt is zero for grants that never expire.
+	ExpiresAt time.Time
+}
+
+func (p Permission) Expired(now time.Time) bool {
+	return !p.ExpiresAt.IsZero() && !now.Before(p.ExpiresAt)
 }
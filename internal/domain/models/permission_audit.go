@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+const (
+	PermissionGrant  = "grant"
+	PermissionRevoke = "revoke"
+	PermissionChange = "change"
+)
+
+// PermissionAuditEntry is one record of the append-only permission audit trail.
+// OldValue is meaningless for grants and NewValue for revokes.
+type PermissionAuditEntry struct {
+	Id           int64
+	AppId        int32
+	UserId       int64
+	Login        string
+	Actor        string
+	Action       string
+	OldValue     int32
+	NewValue     int32
+	NewExpiresAt time.Time
+	RequestId    string
+	CreatedAt    time.Time
+	// OnBehalfOf is who the caller said it acted for, unverified.
+	OnBehalfOf string
+}
+
+type PermissionAuditFilter struct {
+	AppId  int32
+	UserId int64
+	Actor  string
+	From   time.Time
+	To     time.Time
+	// BeforeId returns only entries older than the given id, used as the page cursor.
+	BeforeId int64
+	Limit    int
+}
@@ -0,0 +1,19 @@
+package models
+
+const (
+	AttributeString = "string"
+	AttributeInt    = "int"
+	AttributeBool   = "bool"
+)
+
+// AttributeDef describes one custom profile attribute of an app's users.
+type AttributeDef struct {
+	Name     string
+	Type     string
+	Required bool
+	Unique   bool
+	// Pattern is a regular expression the value must fully match, empty for none.
+	Pattern string
+	// Claim puts the attribute into issued tokens.
+	Claim bool
+}
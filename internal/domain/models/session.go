@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// UserSession is the server side record of a token issued at login.
+// Tokens carry its id, so revoking the session revokes the token.
+type UserSession struct {
+	Id        string
+	AppId     int32
+	UserId    int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// RevokedAt is zero for sessions that haven't been revoked.
+	RevokedAt time.Time
+}
+
+func (s UserSession) Active(now time.Time) bool {
+	return s.RevokedAt.IsZero() && now.Before(s.ExpiresAt)
+}
@@ -1,8 +1,72 @@
 package models
 
+import "time"
+
+const (
+	UserActive    = "active"
+	UserDisabled  = "disabled"
+	UserSuspended = "suspended"
+	UserDeleted   = "deleted"
+)
+
 type User struct {
 	Id           int64
 	AppId        int32
 	Login        string
+	Email        string
 	PasswordHash []byte
+	CreatedAt    time.Time
+	MFAEnabled   bool
+	// PasswordResetRequired refuses logins until the password is changed.
+	PasswordResetRequired bool
+
+	Status string
+	// SuspendedUntil is set for suspended users, DeletedAt for soft-deleted ones.
+	SuspendedUntil time.Time
+	DeletedAt      time.Time
+}
+
+// StatusAt returns the user's status at now, a suspension that has run out counting as active.
+func (u User) StatusAt(now time.Time) string {
+	if u.Status == UserSuspended && !now.Before(u.SuspendedUntil) {
+		return UserActive
+	}
+	return u.Status
+}
+
+// UserRecord is a user together with the role and profile attributes moved by bulk import and export.
+type UserRecord struct {
+	User       User
+	Role       *int32
+	Attributes map[string]string
+}
+
+const (
+	UserSortId        = "id"
+	UserSortLogin     = "login"
+	UserSortEmail     = "email"
+	UserSortCreatedAt = "created_at"
+)
+
+// UserFilter selects a page of an app's users. Nil pointers and zero times don't filter.
+type UserFilter struct {
+	AppId int32
+	// Search matches login or email by prefix, or anywhere in them when Substring is set.
+	Search      string
+	Substring   bool
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Status matches users by StatusAt. Empty matches everyone but soft-deleted users.
+	Status     string
+	MFAEnabled *bool
+	// Role matches users whose unexpired permission equals it.
+	Role *int32
+
+	SortBy string
+	Desc   bool
+	// AfterValue and AfterId are the sort key of the last user of the previous page.
+	// AfterValue is a string for login and email sorting and a time.Time for created_at.
+	AfterValue any
+	AfterId    int64
+	Limit      int
 }
@@ -0,0 +1,366 @@
+package apps
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
+	"SSO/internal/service/apps"
+	"SSO/internal/storage/storageErrors"
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+type AppsServer struct {
+	ssoV1.UnimplementedAppsServer
+
+	apps         Apps
+	adminKeyHash []byte
+}
+
+type Apps interface {
+	NewApp(ctx context.Context, info models.App) (models.App, string, error)
+	GetByKey(ctx context.Context, key []byte) (models.App, error)
+	GetByClientId(ctx context.Context, clientId string) (models.App, error)
+	GetAll(ctx context.Context) ([]*models.App, error)
+	UpdateApp(ctx context.Context, clientId string, upd apps.AppUpdate) (models.App, error)
+	DeleteApp(ctx context.Context, clientId string, opts apps.DeleteOptions) (models.DeletedApp, error)
+	DeletedApps(ctx context.Context, clientId string, limit int) ([]models.DeletedApp, error)
+	RotateSecret(ctx context.Context, clientId string, opts apps.RotateOptions) (models.App, string, error)
+	RotateOwnSecret(ctx context.Context, key []byte, opts apps.RotateOptions) (models.App, string, error)
+}
+
+// RegisterServer registers the apps server. adminKey authorizes the admin calls,
+// which are refused when it is empty.
+func RegisterServer(server *grpc.Server, apps Apps, adminKey string) {
+	s := &AppsServer{apps: apps}
+	if adminKey != "" {
+		s.adminKeyHash = hashKey(adminKey)
+	}
+	ssoV1.RegisterAppsServer(server, s)
+}
+
+var ErrNilRequest = errors.New("nil request")
+
+// adminActor is the actor of calls authorized by the admin key.
+const adminActor = "admin-key"
+
+func (s *AppsServer) CreateApp(ctx context.Context, in *ssoV1.CreateAppRequest) (*ssoV1.CreateAppResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	ctx, err := s.admin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	app, credential, err := s.apps.NewApp(ctx, models.App{
+		Name:           in.Name,
+		Description:    in.Description,
+		Owner:          in.Owner,
+		LogoURL:        in.LogoUrl,
+		RedirectURIs:   in.RedirectUris,
+		AllowedOrigins: in.AllowedOrigins,
+		Settings:       appSettings(in.Settings),
+	})
+	if err != nil {
+		return nil, appError(err, "failed to create app")
+	}
+	return &ssoV1.CreateAppResponse{App: appMessage(app), Credential: credential}, nil
+}
+
+func (s *AppsServer) GetApp(ctx context.Context, in *ssoV1.GetAppRequest) (*ssoV1.GetAppResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	ctx, err := s.admin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+	app, err := s.apps.GetByClientId(ctx, in.ClientId)
+	if err != nil {
+		return nil, appError(err, "failed to get app")
+	}
+	return &ssoV1.GetAppResponse{App: appMessage(app)}, nil
+}
+
+func (s *AppsServer) ListApps(ctx context.Context, in *ssoV1.ListAppsRequest) (*ssoV1.ListAppsResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	ctx, err := s.admin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.apps.GetAll(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list apps")
+	}
+	resp := &ssoV1.ListAppsResponse{Apps: make([]*ssoV1.App, 0, len(list))}
+	for _, app := range list {
+		resp.Apps = append(resp.Apps, appMessage(*app))
+	}
+	return resp, nil
+}
+
+func (s *AppsServer) UpdateApp(ctx context.Context, in *ssoV1.UpdateAppRequest) (*ssoV1.UpdateAppResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	ctx, err := s.admin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+	upd := apps.AppUpdate{
+		Name:        in.Name,
+		Description: in.Description,
+		Owner:       in.Owner,
+		LogoURL:     in.LogoUrl,
+	}
+	if in.RedirectUris != nil {
+		upd.RedirectURIs = &in.RedirectUris.Values
+	}
+	if in.AllowedOrigins != nil {
+		upd.AllowedOrigins = &in.AllowedOrigins.Values
+	}
+	if in.Settings != nil {
+		settings := appSettings(in.Settings)
+		upd.Settings = &settings
+	}
+	app, err := s.apps.UpdateApp(ctx, in.ClientId, upd)
+	if err != nil {
+		return nil, appError(err, "failed to update app")
+	}
+	return &ssoV1.UpdateAppResponse{App: appMessage(app)}, nil
+}
+
+func (s *AppsServer) DeleteApp(ctx context.Context, in *ssoV1.DeleteAppRequest) (*ssoV1.DeleteAppResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	ctx, err := s.admin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+	deleted, err := s.apps.DeleteApp(ctx, in.ClientId, apps.DeleteOptions{Cascade: in.Cascade, DryRun: in.DryRun})
+	if err != nil {
+		if errors.Is(err, apps.ErrAppHasUsers) {
+			return nil, status.Error(codes.FailedPrecondition, "app has users, delete them or set cascade")
+		}
+		return nil, appError(err, "failed to delete app")
+	}
+	return &ssoV1.DeleteAppResponse{Deleted: deletedAppMessage(deleted)}, nil
+}
+
+func (s *AppsServer) ListDeletedApps(ctx context.Context, in *ssoV1.ListDeletedAppsRequest) (*ssoV1.ListDeletedAppsResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	ctx, err := s.admin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if in.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	list, err := s.apps.DeletedApps(ctx, in.ClientId, int(in.Limit))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list deleted apps")
+	}
+	resp := &ssoV1.ListDeletedAppsResponse{Apps: make([]*ssoV1.DeletedApp, 0, len(list))}
+	for _, d := range list {
+		resp.Apps = append(resp.Apps, deletedAppMessage(d))
+	}
+	return resp, nil
+}
+
+// RotateSecret rotates the secret of the app the app key authenticates, or with the
+// admin key the one of the app given by client id.
+func (s *AppsServer) RotateSecret(ctx context.Context, in *ssoV1.RotateSecretRequest) (*ssoV1.RotateSecretResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 && in.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "app key or client id is required")
+	}
+	if in.GracePeriod < 0 {
+		return nil, status.Error(codes.InvalidArgument, "grace period must not be negative")
+	}
+	opts := apps.RotateOptions{
+		GracePeriod: time.Duration(in.GracePeriod) * time.Second,
+		Revoke:      in.Revoke,
+	}
+	var (
+		app        models.App
+		credential string
+		err        error
+	)
+	if in.ClientId != "" {
+		if ctx, err = s.admin(ctx); err != nil {
+			return nil, err
+		}
+		app, credential, err = s.apps.RotateSecret(ctx, in.ClientId, opts)
+	} else {
+		app, credential, err = s.apps.RotateOwnSecret(ctx, in.AppKey, opts)
+		if errors.Is(err, storageErrors.ErrAppNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid app key")
+		}
+	}
+	if err != nil {
+		if errors.Is(err, apps.ErrPrevSecret) {
+			return nil, status.Error(codes.PermissionDenied, "the previous secret can't rotate")
+		}
+		return nil, appError(err, "failed to rotate secret")
+	}
+	return &ssoV1.RotateSecretResponse{Credential: credential, Usage: secretUsage(app)}, nil
+}
+
+func (s *AppsServer) GetSecretUsage(ctx context.Context, in *ssoV1.GetSecretUsageRequest) (*ssoV1.GetSecretUsageResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	app, err := s.apps.GetByKey(ctx, in.AppKey)
+	if err != nil {
+		if errors.Is(err, storageErrors.ErrAppNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid app key")
+		}
+		return nil, status.Error(codes.Internal, "failed to get secret usage")
+	}
+	return &ssoV1.GetSecretUsageResponse{Usage: secretUsage(app)}, nil
+}
+
+// admin checks the call carries the admin key as "authorization: Bearer <key>" metadata
+// and returns ctx with the admin key as the actor.
+func (s *AppsServer) admin(ctx context.Context) (context.Context, error) {
+	if s.adminKeyHash == nil {
+		return ctx, status.Error(codes.PermissionDenied, "admin calls are disabled")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if !strings.HasPrefix(v, "Bearer ") {
+			continue
+		}
+		if subtle.ConstantTimeCompare(hashKey(strings.TrimPrefix(v, "Bearer ")), s.adminKeyHash) == 1 {
+			return reqmeta.WithActor(ctx, adminActor), nil
+		}
+	}
+	return ctx, status.Error(codes.Unauthenticated, "invalid admin key")
+}
+
+// appError maps app lookup failures to a status, hiding everything but a missing app.
+func appError(err error, msg string) error {
+	switch {
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, apps.ErrInvalidGracePeriod):
+		return status.Error(codes.InvalidArgument, "invalid grace period")
+	case errors.Is(err, apps.ErrInvalidApp):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func appMessage(app models.App) *ssoV1.App {
+	policy := app.Settings.PasswordPolicy
+	return &ssoV1.App{
+		Id:             app.Id,
+		ClientId:       app.ClientId,
+		Name:           app.Name,
+		Description:    app.Description,
+		Owner:          app.Owner,
+		LogoUrl:        app.LogoURL,
+		RedirectUris:   app.RedirectURIs,
+		AllowedOrigins: app.AllowedOrigins,
+		CreatedAt:      unix(app.CreatedAt),
+		UpdatedAt:      unix(app.UpdatedAt),
+		Settings: &ssoV1.AppSettings{
+			TokenTtl:           int64(app.Settings.TokenTTL / time.Second),
+			RegistrationClosed: app.Settings.RegistrationClosed,
+			RequireMfa:         app.Settings.RequireMFA,
+			PasswordPolicy: &ssoV1.PasswordPolicy{
+				MinLength:     int32(policy.MinLength),
+				RequireUpper:  policy.RequireUpper,
+				RequireLower:  policy.RequireLower,
+				RequireDigit:  policy.RequireDigit,
+				RequireSymbol: policy.RequireSymbol,
+			},
+		},
+		Usage: secretUsage(app),
+	}
+}
+
+func deletedAppMessage(d models.DeletedApp) *ssoV1.DeletedApp {
+	return &ssoV1.DeletedApp{
+		Id:  d.Id,
+		App: appMessage(d.App),
+		Data: &ssoV1.AppData{
+			Users:          d.Data.Users,
+			Permissions:    d.Data.Permissions,
+			AccessRequests: d.Data.AccessRequests,
+			Attributes:     d.Data.Attributes,
+			Sessions:       d.Data.Sessions,
+		},
+		Cascade:    d.Cascade,
+		DeletedAt:  unix(d.DeletedAt),
+		DeletedBy:  d.DeletedBy,
+		RequestId:  d.RequestId,
+		OnBehalfOf: d.OnBehalfOf,
+	}
+}
+
+func appSettings(in *ssoV1.AppSettings) models.AppSettings {
+	policy := in.GetPasswordPolicy()
+	return models.AppSettings{
+		TokenTTL:           time.Duration(in.GetTokenTtl()) * time.Second,
+		RegistrationClosed: in.GetRegistrationClosed(),
+		RequireMFA:         in.GetRequireMfa(),
+		PasswordPolicy: models.PasswordPolicy{
+			MinLength:     int(policy.GetMinLength()),
+			RequireUpper:  policy.GetRequireUpper(),
+			RequireLower:  policy.GetRequireLower(),
+			RequireDigit:  policy.GetRequireDigit(),
+			RequireSymbol: policy.GetRequireSymbol(),
+		},
+	}
+}
+
+func secretUsage(app models.App) *ssoV1.SecretUsage {
+	return &ssoV1.SecretUsage{
+		SecretUsedAt:        unix(app.SecretUsedAt),
+		SecretRotatedAt:     unix(app.SecretRotatedAt),
+		PrevSecretExpiresAt: unix(app.PrevSecretExpiresAt),
+		PrevSecretUsedAt:    unix(app.PrevSecretUsedAt),
+		PrevSecretInUse:     app.PrevSecretInUse(),
+	}
+}
+
+// hashKey lets keys of any length be compared in constant time.
+func hashKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
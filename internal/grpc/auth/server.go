@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"SSO/internal/domain/models"
 	"SSO/internal/service/auth"
+	"SSO/internal/service/permissions"
 	"SSO/internal/storage/storageErrors"
 	ssoV1 "SSO/pkg/proto/sso"
 	"errors"
@@ -9,6 +11,8 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"strconv"
+	"time"
 )
 
 type SSOServer struct {
@@ -23,11 +27,12 @@ type SSOServer struct {
 
 type Apps interface {
 	TestOnExist(ctx context.Context, key []byte) bool
+	GetByKey(ctx context.Context, key []byte) (models.App, error)
 }
 
 type Auth interface {
-	Register(ctx context.Context, appKey []byte, login string, password string) (err error)
-	Login(ctx context.Context, appKey []byte, login string, password string) (token string, err error)
+	Register(ctx context.Context, appKey []byte, login string, password string, email string) (err error)
+	Login(ctx context.Context, appKey []byte, login string, password string, scopes []string) (token string, granted []string, err error)
 	DeleteUser(ctx context.Context, appKey []byte, login string) (err error)
 	UpdateLogin(ctx context.Context, appKey []byte, login string, newLogin string) error
 	ChangePassword(ctx context.Context, appKey []byte, login string, newPass string) error
@@ -37,16 +42,25 @@ type Auth interface {
 }
 
 type Permissions interface {
-	SetUserPermission(ctx context.Context, userId int64, permission int32) (err error)
+	SetUserPermission(ctx context.Context, appId int32, userId int64, permission int32, expiresAt time.Time) (err error)
 	GetUserPermission(ctx context.Context, userId int64) (permission int32, err error)
+	RequestAccess(ctx context.Context, appId int32, userId int64, permission int32, duration time.Duration, reason string) (int64, error)
+	ApproveAccess(ctx context.Context, appId int32, requestId int64, approver string) (time.Time, error)
+	DenyAccess(ctx context.Context, appId int32, requestId int64, approver string) error
+	ListAccessRequests(ctx context.Context, appId int32, status string) ([]models.AccessRequest, error)
+	History(ctx context.Context, filter models.PermissionAuditFilter) ([]models.PermissionAuditEntry, error)
 }
 
-func RegisterServer(server *grpc.Server, auth Auth, apps Apps, permissions Permissions) {
-	ssoServer := &SSOServer{
+// NewServer returns the implementation of both the Auth and Permissions services.
+func NewServer(auth Auth, apps Apps, permissions Permissions) *SSOServer {
+	return &SSOServer{
 		auth:        auth,
 		permissions: permissions,
 		apps:        apps,
 	}
+}
+
+func RegisterServer(server *grpc.Server, ssoServer *SSOServer) {
 	ssoV1.RegisterAuthServer(server, ssoServer)
 	ssoV1.RegisterPermissionsServer(server, ssoServer)
 }
@@ -68,10 +82,15 @@ func (s *SSOServer) Register(ctx context.Context, in *ssoV1.RegisterRequest) (*s
 		return nil, status.Error(codes.InvalidArgument, "app key is required")
 	}
 
-	err := s.auth.Register(ctx, in.AppKey, in.Login, in.Password)
+	err := s.auth.Register(ctx, in.AppKey, in.Login, in.Password, in.Email)
 	if err != nil {
-		if errors.Is(err, storageErrors.ErrUserExists) {
+		switch {
+		case errors.Is(err, storageErrors.ErrUserExists):
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
+		case errors.Is(err, auth.ErrRegistrationClosed):
+			return nil, status.Error(codes.PermissionDenied, "registration is closed")
+		case errors.Is(err, auth.ErrWeakPassword):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
 
 		return nil, status.Error(codes.Internal, "failed to register user")
@@ -94,15 +113,24 @@ func (s *SSOServer) Login(ctx context.Context, in *ssoV1.LoginRequest) (*ssoV1.L
 		return nil, status.Error(codes.InvalidArgument, "app key is required")
 	}
 
-	token, err := s.auth.Login(ctx, in.AppKey, in.Login, in.Password)
+	token, scopes, err := s.auth.Login(ctx, in.AppKey, in.Login, in.Password, in.Scopes)
 	if err != nil {
-		if errors.Is(err, auth.ErrInvalidCredentials) {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
 			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
+		case errors.Is(err, auth.ErrUserDisabled):
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		case errors.Is(err, auth.ErrUserSuspended):
+			return nil, status.Error(codes.PermissionDenied, "user is suspended")
+		case errors.Is(err, auth.ErrMFARequired):
+			return nil, status.Error(codes.FailedPrecondition, "app requires MFA, enable it first")
+		case errors.Is(err, auth.ErrPasswordResetRequired):
+			return nil, status.Error(codes.FailedPrecondition, "password has to be changed first")
 		}
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
-	return &ssoV1.LoginResponse{Token: token}, nil
+	return &ssoV1.LoginResponse{Token: token, Scopes: scopes}, nil
 }
 
 func (s *SSOServer) DeleteUser(ctx context.Context, in *ssoV1.DeleteUserRequest) (*ssoV1.DeleteUserResponse, error) {
@@ -117,6 +145,9 @@ func (s *SSOServer) DeleteUser(ctx context.Context, in *ssoV1.DeleteUserRequest)
 	}
 	err := s.auth.DeleteUser(ctx, in.AppKey, in.Login)
 	if err != nil {
+		if errors.Is(err, storageErrors.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
 		return nil, status.Error(codes.Internal, "failed delete user")
 	}
 	return &ssoV1.DeleteUserResponse{}, err
@@ -137,6 +168,12 @@ func (s *SSOServer) UpdateLogin(ctx context.Context, in *ssoV1.UpdateLoginReques
 	}
 	err := s.auth.UpdateLogin(ctx, in.AppKey, in.Login, in.NewLogin)
 	if err != nil {
+		if errors.Is(err, storageErrors.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "user already exists")
+		}
+		if errors.Is(err, storageErrors.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
 		return nil, status.Error(codes.Internal, "failed update login")
 	}
 	return &ssoV1.UpdateLoginResponse{}, err
@@ -156,6 +193,9 @@ func (s *SSOServer) ChangePassword(ctx context.Context, in *ssoV1.ChangePassword
 		return nil, status.Error(codes.InvalidArgument, "new password is required")
 	}
 	if err := s.auth.ChangePassword(ctx, in.AppKey, in.Login, in.NewPassword); err != nil {
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, "failed change password")
 	}
 
@@ -215,6 +255,9 @@ func (s *SSOServer) GetUserPermission(ctx context.Context, in *ssoV1.GetUserPerm
 
 	perm, err := s.permissions.GetUserPermission(ctx, id)
 	if err != nil {
+		if errors.Is(err, storageErrors.ErrPermissionNotFound) {
+			return nil, status.Error(codes.NotFound, "permission not found")
+		}
 		return nil, status.Error(codes.Internal, "failed get user permission")
 	}
 	return &ssoV1.GetUserPermissionResponse{Permission: perm}, nil
@@ -230,7 +273,15 @@ func (s *SSOServer) SetUserPermission(ctx context.Context, in *ssoV1.SetUserPerm
 	if in.Login == "" {
 		return nil, status.Error(codes.InvalidArgument, "login is required")
 	}
-	if !s.apps.TestOnExist(ctx, in.AppKey) {
+	var expiresAt time.Time
+	if in.ExpiresAt != 0 {
+		expiresAt = time.Unix(in.ExpiresAt, 0)
+		if !expiresAt.After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expires_at must be in the future")
+		}
+	}
+	app, err := s.apps.GetByKey(ctx, in.AppKey)
+	if err != nil {
 		return nil, status.Error(codes.FailedPrecondition, "app not found")
 	}
 
@@ -239,8 +290,206 @@ func (s *SSOServer) SetUserPermission(ctx context.Context, in *ssoV1.SetUserPerm
 		return nil, status.Error(codes.Internal, "user not found")
 	}
 
-	if err := s.permissions.SetUserPermission(ctx, id, in.Permission); err != nil {
+	if err := s.permissions.SetUserPermission(ctx, app.Id, id, in.Permission, expiresAt); err != nil {
 		return nil, status.Error(codes.Internal, "failed set permission")
 	}
 	return &ssoV1.SetUserPermissionResponse{}, nil
 }
+
+func (s *SSOServer) RequestAccess(ctx context.Context, in *ssoV1.RequestAccessRequest) (*ssoV1.RequestAccessResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.Login == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+	if in.Duration <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration must be positive")
+	}
+	app, err := s.apps.GetByKey(ctx, in.AppKey)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "app not found")
+	}
+
+	id, err := s.auth.GetUserId(ctx, in.AppKey, in.Login)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "user not found")
+	}
+
+	reqId, err := s.permissions.RequestAccess(ctx, app.Id, id, in.Permission, time.Duration(in.Duration)*time.Second, in.Reason)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed request access")
+	}
+	return &ssoV1.RequestAccessResponse{RequestId: reqId}, nil
+}
+
+func (s *SSOServer) ApproveAccess(ctx context.Context, in *ssoV1.ApproveAccessRequest) (*ssoV1.ApproveAccessResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	app, err := s.apps.GetByKey(ctx, in.AppKey)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "app not found")
+	}
+
+	expiresAt, err := s.permissions.ApproveAccess(ctx, app.Id, in.RequestId, approver(app))
+	if err != nil {
+		return nil, accessRequestError(err, "failed approve access")
+	}
+	return &ssoV1.ApproveAccessResponse{ExpiresAt: expiresAt.Unix()}, nil
+}
+
+func (s *SSOServer) DenyAccess(ctx context.Context, in *ssoV1.DenyAccessRequest) (*ssoV1.DenyAccessResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	app, err := s.apps.GetByKey(ctx, in.AppKey)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "app not found")
+	}
+
+	if err := s.permissions.DenyAccess(ctx, app.Id, in.RequestId, approver(app)); err != nil {
+		return nil, accessRequestError(err, "failed deny access")
+	}
+	return &ssoV1.DenyAccessResponse{}, nil
+}
+
+func (s *SSOServer) ListAccessRequests(ctx context.Context, in *ssoV1.ListAccessRequestsRequest) (*ssoV1.ListAccessRequestsResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	app, err := s.apps.GetByKey(ctx, in.AppKey)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "app not found")
+	}
+
+	reqs, err := s.permissions.ListAccessRequests(ctx, app.Id, in.Status)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed list access requests")
+	}
+	resp := &ssoV1.ListAccessRequestsResponse{}
+	for _, req := range reqs {
+		var decidedAt int64
+		if !req.DecidedAt.IsZero() {
+			decidedAt = req.DecidedAt.Unix()
+		}
+		resp.Requests = append(resp.Requests, &ssoV1.AccessRequest{
+			Id:         req.Id,
+			Login:      req.Login,
+			Permission: req.Permission,
+			Duration:   int64(req.Duration / time.Second),
+			Reason:     req.Reason,
+			Status:     req.Status,
+			Approver:   req.Approver,
+			CreatedAt:  req.CreatedAt.Unix(),
+			DecidedAt:  decidedAt,
+		})
+	}
+	return resp, nil
+}
+
+func (s *SSOServer) History(ctx context.Context, in *ssoV1.HistoryRequest) (*ssoV1.HistoryResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	}
+	filter := models.PermissionAuditFilter{
+		Actor: in.Actor,
+		Limit: int(in.PageSize),
+	}
+	if filter.Limit == 0 {
+		filter.Limit = permissions.DefaultHistoryPageSize
+	}
+	if filter.Limit > permissions.MaxHistoryPageSize {
+		filter.Limit = permissions.MaxHistoryPageSize
+	}
+	if in.From != 0 {
+		filter.From = time.Unix(in.From, 0)
+	}
+	if in.To != 0 {
+		filter.To = time.Unix(in.To, 0)
+	}
+	if in.PageToken != "" {
+		beforeId, err := strconv.ParseInt(in.PageToken, 10, 64)
+		if err != nil || beforeId <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		filter.BeforeId = beforeId
+	}
+	app, err := s.apps.GetByKey(ctx, in.AppKey)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "app not found")
+	}
+	filter.AppId = app.Id
+	if in.Login != "" {
+		id, err := s.auth.GetUserId(ctx, in.AppKey, in.Login)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		filter.UserId = id
+	}
+
+	entries, err := s.permissions.History(ctx, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed get permission history")
+	}
+	resp := &ssoV1.HistoryResponse{}
+	for _, e := range entries {
+		var expiresAt int64
+		if !e.NewExpiresAt.IsZero() {
+			expiresAt = e.NewExpiresAt.Unix()
+		}
+		resp.Changes = append(resp.Changes, &ssoV1.PermissionChange{
+			Id:           e.Id,
+			Login:        e.Login,
+			Actor:        e.Actor,
+			Action:       e.Action,
+			OldValue:     e.OldValue,
+			NewValue:     e.NewValue,
+			NewExpiresAt: expiresAt,
+			RequestId:    e.RequestId,
+			CreatedAt:    e.CreatedAt.Unix(),
+			OnBehalfOf:   e.OnBehalfOf,
+		})
+	}
+	// A short page means the end was reached; a full one may have more behind it.
+	if len(entries) == filter.Limit {
+		resp.NextPageToken = strconv.FormatInt(entries[len(entries)-1].Id, 10)
+	}
+	return resp, nil
+}
+
+func accessRequestError(err error, msg string) error {
+	switch {
+	case errors.Is(err, storageErrors.ErrAccessRequestNotFound):
+		return status.Error(codes.NotFound, "access request not found")
+	case errors.Is(err, permissions.ErrRequestNotPending):
+		return status.Error(codes.FailedPrecondition, "access request is not pending")
+	case errors.Is(err, permissions.ErrConflictingGrant):
+		return status.Error(codes.FailedPrecondition, "user holds a permanent, broader or longer grant")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+// approver names the app the key authenticated as the one deciding access requests,
+// like the console names its admins.
+func approver(app models.App) string {
+	return "app:" + app.ClientId
+}
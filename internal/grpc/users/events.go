@@ -0,0 +1,70 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/audit"
+	"SSO/internal/storage/storageErrors"
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type AuthEvents interface {
+	List(ctx context.Context, appKey []byte, q audit.Query) ([]models.AuthEvent, string, error)
+}
+
+func (s *UsersServer) ListAuthEvents(ctx context.Context, in *ssoV1.ListAuthEventsRequest) (*ssoV1.ListAuthEventsResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	}
+	q := audit.Query{
+		Login:     in.Login,
+		Type:      in.Type,
+		PageSize:  int(in.PageSize),
+		PageToken: in.PageToken,
+	}
+	if in.From != 0 {
+		q.From = time.Unix(in.From, 0)
+	}
+	if in.To != 0 {
+		q.To = time.Unix(in.To, 0)
+	}
+
+	events, next, err := s.events.List(ctx, in.AppKey, q)
+	if err != nil {
+		switch {
+		case errors.Is(err, storageErrors.ErrAppNotFound):
+			return nil, status.Error(codes.FailedPrecondition, "app not found")
+		case errors.Is(err, audit.ErrInvalidPageToken):
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		return nil, status.Error(codes.Internal, "failed list auth events")
+	}
+	resp := &ssoV1.ListAuthEventsResponse{NextPageToken: next}
+	for _, e := range events {
+		resp.Events = append(resp.Events, &ssoV1.AuthEvent{
+			Id:         e.Id,
+			Type:       e.Type,
+			UserId:     e.UserId,
+			Login:      e.Login,
+			Success:    e.Success,
+			Detail:     e.Detail,
+			Actor:      e.Actor,
+			Ip:         e.IP,
+			UserAgent:  e.UserAgent,
+			RequestId:  e.RequestId,
+			CreatedAt:  e.CreatedAt.Unix(),
+			OnBehalfOf: e.OnBehalfOf,
+		})
+	}
+	return resp, nil
+}
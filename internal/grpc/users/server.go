@@ -0,0 +1,255 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/users"
+	"SSO/internal/storage/storageErrors"
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type UsersServer struct {
+	ssoV1.UnimplementedUsersServer
+
+	users  Users
+	events AuthEvents
+}
+
+type Users interface {
+	List(ctx context.Context, appKey []byte, q users.ListQuery) ([]models.User, string, error)
+	GetSchema(ctx context.Context, appKey []byte) ([]models.AttributeDef, error)
+	SetSchema(ctx context.Context, appKey []byte, defs []models.AttributeDef) error
+	GetProfile(ctx context.Context, appKey []byte, login string) (map[string]string, error)
+	UpdateProfile(ctx context.Context, appKey []byte, login string, attrs map[string]string) error
+	SetStatus(ctx context.Context, appKey []byte, login string, status string, suspendedUntil time.Time) error
+	Restore(ctx context.Context, appKey []byte, login string) error
+	Transfer
+}
+
+func RegisterServer(server *grpc.Server, users Users, events AuthEvents) {
+	ssoV1.RegisterUsersServer(server, &UsersServer{users: users, events: events})
+}
+
+var ErrNilRequest = errors.New("nil request")
+
+func (s *UsersServer) ListUsers(ctx context.Context, in *ssoV1.ListUsersRequest) (*ssoV1.ListUsersResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	}
+	q := users.ListQuery{
+		Search:     in.Search,
+		Substring:  in.Substring,
+		Status:     in.Status,
+		MFAEnabled: in.MfaEnabled,
+		Role:       in.Role,
+		SortBy:     in.SortBy,
+		Desc:       in.Desc,
+		PageSize:   int(in.PageSize),
+		PageToken:  in.PageToken,
+	}
+	if in.CreatedFrom != 0 {
+		q.CreatedFrom = time.Unix(in.CreatedFrom, 0)
+	}
+	if in.CreatedTo != 0 {
+		q.CreatedTo = time.Unix(in.CreatedTo, 0)
+	}
+
+	list, next, err := s.users.List(ctx, in.AppKey, q)
+	if err != nil {
+		switch {
+		case errors.Is(err, storageErrors.ErrAppNotFound):
+			return nil, status.Error(codes.FailedPrecondition, "app not found")
+		case errors.Is(err, users.ErrInvalidPageToken):
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		case errors.Is(err, users.ErrInvalidSortField):
+			return nil, status.Error(codes.InvalidArgument, "invalid sort field")
+		case errors.Is(err, users.ErrInvalidStatus):
+			return nil, status.Error(codes.InvalidArgument, "invalid status")
+		}
+		return nil, status.Error(codes.Internal, "failed list users")
+	}
+
+	resp := &ssoV1.ListUsersResponse{NextPageToken: next}
+	for _, u := range list {
+		resp.Users = append(resp.Users, UserToProto(u))
+	}
+	return resp, nil
+}
+
+func (s *UsersServer) GetProfileSchema(ctx context.Context, in *ssoV1.GetProfileSchemaRequest) (*ssoV1.GetProfileSchemaResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	defs, err := s.users.GetSchema(ctx, in.AppKey)
+	if err != nil {
+		return nil, profileError(err, "failed get profile schema")
+	}
+	resp := &ssoV1.GetProfileSchemaResponse{}
+	for _, d := range defs {
+		resp.Attributes = append(resp.Attributes, &ssoV1.AttributeDef{
+			Name:     d.Name,
+			Type:     d.Type,
+			Required: d.Required,
+			Unique:   d.Unique,
+			Pattern:  d.Pattern,
+			Claim:    d.Claim,
+		})
+	}
+	return resp, nil
+}
+
+func (s *UsersServer) SetProfileSchema(ctx context.Context, in *ssoV1.SetProfileSchemaRequest) (*ssoV1.SetProfileSchemaResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	defs := make([]models.AttributeDef, 0, len(in.Attributes))
+	for _, a := range in.Attributes {
+		defs = append(defs, models.AttributeDef{
+			Name:     a.GetName(),
+			Type:     a.GetType(),
+			Required: a.GetRequired(),
+			Unique:   a.GetUnique(),
+			Pattern:  a.GetPattern(),
+			Claim:    a.GetClaim(),
+		})
+	}
+	if err := s.users.SetSchema(ctx, in.AppKey, defs); err != nil {
+		return nil, profileError(err, "failed set profile schema")
+	}
+	return &ssoV1.SetProfileSchemaResponse{}, nil
+}
+
+func (s *UsersServer) GetProfile(ctx context.Context, in *ssoV1.GetProfileRequest) (*ssoV1.GetProfileResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.Login == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+	attrs, err := s.users.GetProfile(ctx, in.AppKey, in.Login)
+	if err != nil {
+		return nil, profileError(err, "failed get profile")
+	}
+	return &ssoV1.GetProfileResponse{Attributes: attrs}, nil
+}
+
+func (s *UsersServer) UpdateProfile(ctx context.Context, in *ssoV1.UpdateProfileRequest) (*ssoV1.UpdateProfileResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.Login == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+	if err := s.users.UpdateProfile(ctx, in.AppKey, in.Login, in.Attributes); err != nil {
+		return nil, profileError(err, "failed update profile")
+	}
+	return &ssoV1.UpdateProfileResponse{}, nil
+}
+
+func profileError(err error, msg string) error {
+	var validationErr *users.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return status.Error(codes.InvalidArgument, validationErr.Error())
+	case errors.Is(err, users.ErrInvalidSchema):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		return status.Error(codes.FailedPrecondition, "app not found")
+	case errors.Is(err, storageErrors.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func (s *UsersServer) SetUserStatus(ctx context.Context, in *ssoV1.SetUserStatusRequest) (*ssoV1.SetUserStatusResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.Login == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+	var until time.Time
+	if in.SuspendedUntil != 0 {
+		until = time.Unix(in.SuspendedUntil, 0)
+	}
+	if err := s.users.SetStatus(ctx, in.AppKey, in.Login, in.Status, until); err != nil {
+		if errors.Is(err, users.ErrInvalidStatus) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, statusError(err, "failed set user status")
+	}
+	return &ssoV1.SetUserStatusResponse{}, nil
+}
+
+func (s *UsersServer) RestoreUser(ctx context.Context, in *ssoV1.RestoreUserRequest) (*ssoV1.RestoreUserResponse, error) {
+	if in == nil {
+		return nil, ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app key is required")
+	}
+	if in.Login == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+	if err := s.users.Restore(ctx, in.AppKey, in.Login); err != nil {
+		if errors.Is(err, users.ErrNotDeleted) {
+			return nil, status.Error(codes.FailedPrecondition, "user is not deleted")
+		}
+		return nil, statusError(err, "failed restore user")
+	}
+	return &ssoV1.RestoreUserResponse{}, nil
+}
+
+func statusError(err error, msg string) error {
+	switch {
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		return status.Error(codes.FailedPrecondition, "app not found")
+	case errors.Is(err, storageErrors.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func UserToProto(u models.User) *ssoV1.User {
+	user := &ssoV1.User{
+		Id:         u.Id,
+		Login:      u.Login,
+		Email:      u.Email,
+		CreatedAt:  u.CreatedAt.Unix(),
+		MfaEnabled: u.MFAEnabled,
+		Status:     u.StatusAt(time.Now()),
+	}
+	if user.Status == models.UserSuspended {
+		user.SuspendedUntil = u.SuspendedUntil.Unix()
+	}
+	if !u.DeletedAt.IsZero() {
+		user.DeletedAt = u.DeletedAt.Unix()
+	}
+	return user
+}
@@ -0,0 +1,57 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/apps"
+	"SSO/internal/service/audit"
+	"SSO/internal/service/users"
+	"SSO/internal/storage"
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestListUsersPageToken(t *testing.T) {
+	ctx := context.Background()
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := storage.NewMemory()
+	appsService := apps.New(l, s.Tx, s.AppStorage, s.AppArchive, time.Hour)
+	server := &UsersServer{users: users.New(l, s.Tx, s.UserStorage, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, appsService, audit.New(l, s.Tx, s.AuthEvents, appsService, s.UserStorage))}
+	app, credential, err := appsService.NewApp(ctx, models.App{Name: "app"})
+	require.NoError(t, err)
+	for _, login := range []string{"alice", "bob", "carol"} {
+		require.NoError(t, s.UserStorage.Save(ctx, models.User{AppId: app.Id, Login: login, PasswordHash: []byte("hash"), CreatedAt: time.Now()}))
+	}
+
+	var logins []string
+	in := &ssoV1.ListUsersRequest{AppKey: []byte(credential), PageSize: 2}
+	for {
+		resp, err := server.ListUsers(ctx, in)
+		require.NoError(t, err)
+		for _, u := range resp.Users {
+			logins = append(logins, u.Login)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		in.PageToken = resp.NextPageToken
+	}
+	require.Equal(t, []string{"alice", "bob", "carol"}, logins)
+
+	resp, err := server.ListUsers(ctx, &ssoV1.ListUsersRequest{AppKey: []byte(credential), PageSize: 1})
+	require.NoError(t, err)
+	for _, in := range []*ssoV1.ListUsersRequest{
+		{AppKey: []byte(credential), PageToken: resp.NextPageToken, Search: "b"},
+		{AppKey: []byte(credential), PageToken: resp.NextPageToken, SortBy: models.UserSortEmail},
+		{AppKey: []byte(credential), PageToken: "garbage"},
+	} {
+		_, err := server.ListUsers(ctx, in)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "%v", err)
+	}
+}
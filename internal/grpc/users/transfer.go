@@ -0,0 +1,117 @@
+package users
+
+import (
+	"SSO/internal/service/users"
+	"SSO/internal/storage/storageErrors"
+	ssoV1 "SSO/pkg/proto/sso"
+	"bufio"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+)
+
+const exportChunkSize = 32 * 1024
+
+type Transfer interface {
+	Import(ctx context.Context, appKey []byte, format string, r io.Reader, opts users.ImportOptions) (users.ImportResult, error)
+	Export(ctx context.Context, appKey []byte, format string, w io.Writer) (int, error)
+}
+
+func (s *UsersServer) ImportUsers(stream ssoV1.Users_ImportUsersServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return status.Error(codes.InvalidArgument, "empty import")
+		}
+		return err
+	}
+	if len(first.AppKey) == 0 {
+		return status.Error(codes.InvalidArgument, "app key is required")
+	}
+
+	// Chunks are copied from the stream into a pipe the importer reads from.
+	pr, pw := io.Pipe()
+	go func() {
+		msg := first
+		for {
+			if len(msg.Chunk) != 0 {
+				if _, err := pw.Write(msg.Chunk); err != nil {
+					return
+				}
+			}
+			msg, err = stream.Recv()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	res, err := s.users.Import(stream.Context(), first.AppKey, first.Format, pr, users.ImportOptions{DryRun: first.DryRun})
+	_ = pr.Close()
+	if err != nil {
+		return transferError(err, "failed import users")
+	}
+
+	resp := &ssoV1.ImportUsersResponse{
+		Total:    int32(res.Total),
+		Imported: int32(res.Imported),
+		Failed:   int32(res.Failed),
+	}
+	for _, e := range res.Errors {
+		resp.Errors = append(resp.Errors, &ssoV1.ImportRowError{
+			Line:  int32(e.Line),
+			Login: e.Login,
+			Error: e.Err,
+		})
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *UsersServer) ExportUsers(in *ssoV1.ExportUsersRequest, stream ssoV1.Users_ExportUsersServer) error {
+	if in == nil {
+		return ErrNilRequest
+	}
+	if len(in.AppKey) == 0 {
+		return status.Error(codes.InvalidArgument, "app key is required")
+	}
+	w := bufio.NewWriterSize(chunkWriter{stream}, exportChunkSize)
+	if _, err := s.users.Export(stream.Context(), in.AppKey, in.Format, w); err != nil {
+		return transferError(err, "failed export users")
+	}
+	return w.Flush()
+}
+
+// chunkWriter sends every write as one ExportUsersResponse.
+type chunkWriter struct {
+	stream ssoV1.Users_ExportUsersServer
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	chunk := make([]byte, len(p))
+	copy(chunk, p)
+	if err := w.stream.Send(&ssoV1.ExportUsersResponse{Chunk: chunk}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func transferError(err error, msg string) error {
+	switch {
+	case errors.Is(err, users.ErrUnknownFormat):
+		return status.Error(codes.InvalidArgument, "format must be csv or jsonl")
+	case errors.Is(err, users.ErrMalformedInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		return status.Error(codes.FailedPrecondition, "app not found")
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, msg)
+}
@@ -0,0 +1,116 @@
+// Package admin signs admins in to the HTTP console and guards its handlers.
+package admin
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
+	"SSO/internal/service/admins"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+const (
+	sessionCookie   = "sso_admin_session"
+	loginCSRFCookie = "sso_login_csrf"
+	// csrfHeader carries the session's CSRF token on requests made by scripts,
+	// forms send it as the csrfField value.
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+)
+
+type Admins interface {
+	Login(ctx context.Context, login string, password string) (string, models.AdminSession, error)
+	Authenticate(ctx context.Context, token string) (models.Admin, models.AdminSession, error)
+	Logout(ctx context.Context, token string) error
+	List(ctx context.Context) ([]models.Admin, error)
+	Create(ctx context.Context, login string, password string, role string) (models.Admin, error)
+	SetRole(ctx context.Context, id int64, role string) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// Guard lets requests through to the console handlers only for signed-in admins
+// whose role allows them, and POST requests only with the session's CSRF token.
+type Guard struct {
+	admins Admins
+}
+
+func NewGuard(admins Admins) *Guard {
+	return &Guard{
+		admins: admins,
+	}
+}
+
+type ctxKey struct{}
+
+type signedIn struct {
+	admin   models.Admin
+	session models.AdminSession
+}
+
+// FromContext returns the admin a guarded request was made by and the CSRF
+// token of its session, which pages must send back with their POST requests.
+func FromContext(ctx context.Context) (admin models.Admin, csrfToken string, ok bool) {
+	s, ok := ctx.Value(ctxKey{}).(signedIn)
+	return s.admin, s.session.CSRFToken, ok
+}
+
+// Require guards h, letting through admins whose role allows role. GET requests
+// without a session are sent to the login page, other requests are refused.
+// The admin is the actor of what the request changes.
+func (g *Guard) Require(role string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin, session, err := g.authenticate(r)
+		switch {
+		case errors.Is(err, admins.ErrNoSession):
+			if r.Method == http.MethodGet {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			fail(w, http.StatusUnauthorized)
+			return
+		case err != nil:
+			fail(w, http.StatusInternalServerError)
+			return
+		}
+		if r.Method == http.MethodPost && !validCSRF(r, session.CSRFToken) {
+			fail(w, http.StatusForbidden)
+			return
+		}
+		if !admin.Can(role) {
+			fail(w, http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ctxKey{}, signedIn{admin: admin, session: session})
+		ctx = reqmeta.With(ctx, reqmeta.Meta{
+			RequestId: reqmeta.NewRequestId(),
+			Actor:     "admin:" + admin.Login,
+			IP:        reqmeta.Host(r.RemoteAddr),
+			UserAgent: r.UserAgent(),
+		})
+		h(w, r.WithContext(ctx))
+	})
+}
+
+func (g *Guard) authenticate(r *http.Request) (models.Admin, models.AdminSession, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return models.Admin{}, models.AdminSession{}, admins.ErrNoSession
+	}
+	return g.admins.Authenticate(r.Context(), cookie.Value)
+}
+
+// validCSRF checks the request carries want in the CSRF header or form field.
+func validCSRF(r *http.Request, want string) bool {
+	got := r.Header.Get(csrfHeader)
+	if got == "" {
+		got = r.PostFormValue(csrfField)
+	}
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func fail(w http.ResponseWriter, code int) {
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte("error"))
+}
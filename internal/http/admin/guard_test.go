@@ -0,0 +1,188 @@
+package admin_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/http/admin"
+	httpApps "SSO/internal/http/apps"
+	httpUsers "SSO/internal/http/users"
+	"SSO/internal/service/admins"
+	"SSO/internal/service/apps"
+	"SSO/internal/service/audit"
+	"SSO/internal/service/permissions"
+	"SSO/internal/service/users"
+	"SSO/internal/storage"
+	"SSO/web"
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// session is a signed-in admin's cookie and CSRF token.
+type session struct {
+	token string
+	csrf  string
+}
+
+// newConsole serves the console's routes on a memory storage and signs in an
+// admin of each role.
+func newConsole(t *testing.T) (http.Handler, map[string]session) {
+	t.Helper()
+	ctx := context.Background()
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := storage.NewMemory()
+	appsService := apps.New(l, s.Tx, s.AppStorage, s.AppArchive, time.Hour)
+	auditService := audit.New(l, s.Tx, s.AuthEvents, appsService, s.UserStorage)
+	consoleApps := apps.ByClientId{Apps: appsService}
+	consoleUsers := users.New(l, s.Tx, s.UserStorage, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, consoleApps, auditService)
+	permService := permissions.New(l, s.Tx, s.PermissionsStorage, s.PermissionAudit, s.AccessRequests, auditService, nil)
+	adminsService := admins.New(l, s.Tx, s.Admins, s.AdminSessions, time.Hour)
+	site, err := web.New("")
+	require.NoError(t, err)
+
+	rtr := mux.NewRouter()
+	guard := admin.NewGuard(adminsService)
+	admin.NewHandler(adminsService, guard, site, false).RegisterRoutes(rtr)
+	httpApps.NewHandler(appsService, site).RegisterRoutes(rtr, guard)
+	httpUsers.NewHandler(consoleUsers, permService, consoleApps).RegisterRoutes(rtr, guard)
+
+	_, err = adminsService.Bootstrap(ctx, models.AdminOwner, "password")
+	require.NoError(t, err)
+	for _, role := range []string{models.AdminOperator, models.AdminViewer} {
+		_, err := adminsService.Create(ctx, role, "password", role)
+		require.NoError(t, err)
+	}
+	sessions := make(map[string]session)
+	for _, role := range []string{models.AdminOwner, models.AdminOperator, models.AdminViewer} {
+		token, s, err := adminsService.Login(ctx, role, "password")
+		require.NoError(t, err)
+		sessions[role] = session{token: token, csrf: s.CSRFToken}
+	}
+	return rtr, sessions
+}
+
+// post sends an empty JSON object to path as the admin of s, with csrf as the CSRF header.
+func post(h http.Handler, path string, s session, csrf string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		r.AddCookie(&http.Cookie{Name: "sso_admin_session", Value: s.token})
+	}
+	if csrf != "" {
+		r.Header.Set("X-CSRF-Token", csrf)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRoles(t *testing.T) {
+	h, sessions := newConsole(t)
+	// routes are the console's POST routes that need more than a viewer.
+	routes := []struct {
+		path string
+		role string
+	}{
+		{"/new_app", models.AdminOperator},
+		{"/rotate_secret", models.AdminOperator},
+		{"/import_users", models.AdminOperator},
+		{"/set_user_status", models.AdminOperator},
+		{"/restore_user", models.AdminOperator},
+		{"/delete_user", models.AdminOperator},
+		{"/reset_user_mfa", models.AdminOperator},
+		{"/require_password_reset", models.AdminOperator},
+		{"/revoke_session", models.AdminOperator},
+		{"/revoke_sessions", models.AdminOperator},
+		{"/set_user_permission", models.AdminOperator},
+		{"/revoke_user_permission", models.AdminOperator},
+		{"/delete_app", models.AdminOwner},
+		{"/get_admins", models.AdminOwner},
+		{"/new_admin", models.AdminOwner},
+		{"/set_admin_role", models.AdminOwner},
+		{"/delete_admin", models.AdminOwner},
+	}
+	allowed := map[string][]string{
+		models.AdminOperator: {models.AdminOperator, models.AdminOwner},
+		models.AdminOwner:    {models.AdminOwner},
+	}
+	for _, route := range routes {
+		for _, role := range []string{models.AdminViewer, models.AdminOperator, models.AdminOwner} {
+			s := sessions[role]
+			w := post(h, route.path, s, s.csrf)
+			can := false
+			for _, r := range allowed[route.role] {
+				can = can || r == role
+			}
+			if !can {
+				require.Equal(t, http.StatusForbidden, w.Code, "%s as %s", route.path, role)
+				continue
+			}
+			// The handler is reached and rejects the empty request on its own terms.
+			require.NotContains(t, []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed},
+				w.Code, "%s as %s", route.path, role)
+		}
+	}
+
+	// Viewers read.
+	viewer := sessions[models.AdminViewer]
+	for _, path := range []string{"/get_apps", "/get_deleted_apps"} {
+		require.Equal(t, http.StatusOK, post(h, path, viewer, viewer.csrf).Code, path)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "sso_admin_session", Value: viewer.token})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), viewer.csrf, "the page carries the CSRF token")
+}
+
+func TestCSRF(t *testing.T) {
+	h, sessions := newConsole(t)
+	owner := sessions[models.AdminOwner]
+	operator := sessions[models.AdminOperator]
+
+	require.Equal(t, http.StatusOK, post(h, "/get_apps", owner, owner.csrf).Code)
+	require.Equal(t, http.StatusForbidden, post(h, "/get_apps", owner, "").Code, "missing token")
+	require.Equal(t, http.StatusForbidden, post(h, "/get_apps", owner, "wrong").Code, "wrong token")
+	require.Equal(t, http.StatusForbidden, post(h, "/get_apps", owner, owner.csrf[:len(owner.csrf)-1]).Code, "truncated token")
+	require.Equal(t, http.StatusForbidden, post(h, "/get_apps", owner, operator.csrf).Code, "token of another session")
+	require.Equal(t, http.StatusUnauthorized, post(h, "/get_apps", session{}, owner.csrf).Code, "no session")
+	require.Equal(t, http.StatusUnauthorized, post(h, "/get_apps", session{token: "unknown"}, owner.csrf).Code, "unknown session")
+
+	// Forms send the token as a field.
+	form := func(csrf string) int {
+		r := httptest.NewRequest(http.MethodPost, "/get_apps", strings.NewReader(url.Values{"csrf_token": {csrf}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: "sso_admin_session", Value: owner.token})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, form(owner.csrf))
+	require.Equal(t, http.StatusForbidden, form("wrong"))
+
+	// Signing in has no session yet, its token is checked against a cookie.
+	login := func(cookie string, field string) int {
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{
+			"csrf_token": {field}, "login": {models.AdminOwner}, "password": {"password"},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "sso_login_csrf", Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusSeeOther, login("token", "token"))
+	require.Equal(t, http.StatusForbidden, login("", "token"), "missing cookie")
+	require.Equal(t, http.StatusForbidden, login("token", ""), "missing field")
+	require.Equal(t, http.StatusForbidden, login("token", "other"), "mismatch")
+}
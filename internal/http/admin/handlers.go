@@ -0,0 +1,218 @@
+package admin
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/admins"
+	"SSO/internal/storage/storageErrors"
+	"SSO/web"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Handler serves the console's login page and the management of admins.
+type Handler struct {
+	admins        Admins
+	guard         *Guard
+	site          *web.Site
+	secureCookies bool
+}
+
+// NewHandler creates the handler, rendering the login page with site. secureCookies marks the cookies it sets Secure,
+// for consoles served over HTTPS.
+func NewHandler(admins Admins, guard *Guard, site *web.Site, secureCookies bool) *Handler {
+	return &Handler{
+		admins:        admins,
+		guard:         guard,
+		site:          site,
+		secureCookies: secureCookies,
+	}
+}
+
+func (h *Handler) RegisterRoutes(rtr *mux.Router) {
+	rtr.HandleFunc("/login", h.HandleLoginPage).Methods("GET")
+	rtr.HandleFunc("/login", h.HandleLogin).Methods("POST")
+	rtr.Handle("/logout", h.guard.Require(models.AdminViewer, h.HandleLogout)).Methods("POST")
+	rtr.Handle("/get_admins", h.guard.Require(models.AdminOwner, h.HandleGetAdmins)).Methods("POST")
+	rtr.Handle("/new_admin", h.guard.Require(models.AdminOwner, h.HandleNewAdmin)).Methods("POST")
+	rtr.Handle("/set_admin_role", h.guard.Require(models.AdminOwner, h.HandleSetAdminRole)).Methods("POST")
+	rtr.Handle("/delete_admin", h.guard.Require(models.AdminOwner, h.HandleDeleteAdmin)).Methods("POST")
+}
+
+type loginPageData struct {
+	CSRFToken string
+	Error     string
+}
+
+// HandleLoginPage shows the login form. The login POST has no session to take a
+// CSRF token from yet, so the form's token is checked against a cookie set here.
+func (h *Handler) HandleLoginPage(w http.ResponseWriter, r *http.Request) {
+	token, err := randomToken()
+	if err != nil {
+		fail(w, http.StatusInternalServerError)
+		return
+	}
+	h.setCookie(w, loginCSRFCookie, token, time.Now().Add(time.Hour))
+	h.renderLogin(w, http.StatusOK, loginPageData{CSRFToken: token})
+}
+
+// HandleLogin signs the admin of the "login" and "password" form values in and
+// sends them to the console.
+func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(loginCSRFCookie)
+	if err != nil || cookie.Value == "" ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostFormValue(csrfField))) != 1 {
+		fail(w, http.StatusForbidden)
+		return
+	}
+	token, session, err := h.admins.Login(r.Context(), r.PostFormValue("login"), r.PostFormValue("password"))
+	if err != nil {
+		code, msg := http.StatusInternalServerError, "Не удалось войти, попробуйте позже"
+		if errors.Is(err, admins.ErrInvalidCredentials) {
+			code, msg = http.StatusUnauthorized, "Неверный логин или пароль"
+		}
+		h.renderLogin(w, code, loginPageData{CSRFToken: cookie.Value, Error: msg})
+		return
+	}
+	h.setCookie(w, loginCSRFCookie, "", time.Unix(0, 0))
+	h.setCookie(w, sessionCookie, token, session.ExpiresAt)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// HandleLogout ends the session and sends the admin to the login page.
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if err := h.admins.Logout(r.Context(), cookie.Value); err != nil {
+			fail(w, http.StatusInternalServerError)
+			return
+		}
+	}
+	h.setCookie(w, sessionCookie, "", time.Unix(0, 0))
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+type adminResponseData struct {
+	Id        int64  `json:"id"`
+	Login     string `json:"login"`
+	Role      string `json:"role"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (h *Handler) HandleGetAdmins(w http.ResponseWriter, r *http.Request) {
+	list, err := h.admins.List(r.Context())
+	if err != nil {
+		fail(w, http.StatusInternalServerError)
+		return
+	}
+	resp := make([]adminResponseData, 0, len(list))
+	for _, a := range list {
+		resp = append(resp, adminData(a))
+	}
+	writeJSON(w, resp)
+}
+
+// HandleNewAdmin creates an admin from the "login", "password" and "role" form values.
+func (h *Handler) HandleNewAdmin(w http.ResponseWriter, r *http.Request) {
+	a, err := h.admins.Create(r.Context(), r.PostFormValue("login"), r.PostFormValue("password"), r.PostFormValue("role"))
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	writeJSON(w, adminData(a))
+}
+
+// HandleSetAdminRole gives the admin of the "id" form value the "role" form value.
+func (h *Handler) HandleSetAdminRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+	if err != nil {
+		fail(w, http.StatusBadRequest)
+		return
+	}
+	if err := h.admins.SetRole(r.Context(), id, r.PostFormValue("role")); err != nil {
+		adminError(w, err)
+	}
+}
+
+// HandleDeleteAdmin deletes the admin of the "id" form value.
+func (h *Handler) HandleDeleteAdmin(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+	if err != nil {
+		fail(w, http.StatusBadRequest)
+		return
+	}
+	if err := h.admins.Delete(r.Context(), id); err != nil {
+		adminError(w, err)
+	}
+}
+
+func adminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, admins.ErrInvalidLogin), errors.Is(err, admins.ErrInvalidRole), errors.Is(err, admins.ErrWeakPassword):
+		fail(w, http.StatusBadRequest)
+	case errors.Is(err, storageErrors.ErrAdminNotFound):
+		fail(w, http.StatusNotFound)
+	case errors.Is(err, storageErrors.ErrAdminExists), errors.Is(err, admins.ErrLastOwner):
+		fail(w, http.StatusConflict)
+	default:
+		fail(w, http.StatusInternalServerError)
+	}
+}
+
+func adminData(a models.Admin) adminResponseData {
+	return adminResponseData{Id: a.Id, Login: a.Login, Role: a.Role, CreatedAt: a.CreatedAt.Unix()}
+}
+
+func (h *Handler) renderLogin(w http.ResponseWriter, code int, data loginPageData) {
+	var buf bytes.Buffer
+	if err := h.site.Render(&buf, "login.html", data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = buf.WriteTo(w)
+}
+
+// setCookie sets a cookie scripts can't read and other sites can't send,
+// removing it when expires is in the past.
+func (h *Handler) setCookie(w http.ResponseWriter, name string, value string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   h.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		fail(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -2,73 +2,127 @@ package apps
 
 import (
 	"SSO/internal/domain/models"
+	"SSO/internal/http/admin"
+	"SSO/internal/service/apps"
+	"SSO/internal/storage/storageErrors"
+	"SSO/web"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
-	"html/template"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type Handler struct {
 	appsService Apps
+	site        *web.Site
 }
 
 type Apps interface {
-	NewApp(ctx context.Context) (key []byte, err error)
-	DeleteApp(ctx context.Context, key []byte) (err error)
+	NewApp(ctx context.Context, info models.App) (app models.App, credential string, err error)
+	DeleteApp(ctx context.Context, clientId string, opts apps.DeleteOptions) (deleted models.DeletedApp, err error)
+	RotateSecret(ctx context.Context, clientId string, opts apps.RotateOptions) (app models.App, credential string, err error)
 	GetAll(ctx context.Context) ([]*models.App, error)
+	DeletedApps(ctx context.Context, clientId string, limit int) ([]models.DeletedApp, error)
 }
 
-func NewHandler(appsService Apps) *Handler {
+func NewHandler(appsService Apps, site *web.Site) *Handler {
 	return &Handler{
 		appsService: appsService,
+		site:        site,
 	}
 }
 
-func (h *Handler) GetMuxRouter() *mux.Router {
-	rtr := mux.NewRouter()
-
-	rtr.HandleFunc("/", h.HandleIndex).Methods("GET")
-	rtr.HandleFunc("/new_app", h.HandleNewApp).Methods("POST")
-	rtr.HandleFunc("/get_apps", h.HandleGetAll).Methods("POST")
-	rtr.HandleFunc("/delete_app", h.HandleDeleteApp).Methods("POST")
+func (h *Handler) RegisterRoutes(rtr *mux.Router, guard *admin.Guard) {
+	rtr.Handle("/", guard.Require(models.AdminViewer, h.HandleIndex)).Methods("GET")
+	rtr.Handle("/new_app", guard.Require(models.AdminOperator, h.HandleNewApp)).Methods("POST")
+	rtr.Handle("/get_apps", guard.Require(models.AdminViewer, h.HandleGetAll)).Methods("POST")
+	rtr.Handle("/delete_app", guard.Require(models.AdminOwner, h.HandleDeleteApp)).Methods("POST")
+	rtr.Handle("/rotate_secret", guard.Require(models.AdminOperator, h.HandleRotateSecret)).Methods("POST")
+	rtr.Handle("/get_deleted_apps", guard.Require(models.AdminViewer, h.HandleGetDeletedApps)).Methods("POST")
+}
 
-	return rtr
+// indexData tells the page who is signed in, which actions to offer them and
+// the CSRF token its requests must carry.
+type indexData struct {
+	Login     string
+	Role      string
+	CSRFToken string
+	Operator  bool
+	Owner     bool
 }
 
 func (h *Handler) HandleIndex(w http.ResponseWriter, r *http.Request) {
-	tmp, err := template.ParseFiles("web/templates/index.html")
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte(err.Error()))
+	a, csrfToken, _ := admin.FromContext(r.Context())
+	data := indexData{
+		Login:     a.Login,
+		Role:      a.Role,
+		CSRFToken: csrfToken,
+		Operator:  a.Can(models.AdminOperator),
+		Owner:     a.Can(models.AdminOwner),
 	}
-	if err := tmp.Execute(w, nil); err != nil {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.site.Render(w, "index.html", data); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(err.Error()))
 	}
 }
 
+// newAppResponseData is the only time the credential is shown.
 type newAppResponseData struct {
-	Key string `json:"key"`
+	Id         int32  `json:"id"`
+	ClientId   string `json:"client_id"`
+	Credential string `json:"credential"`
 }
 
+// HandleNewApp creates an app named by the "name" form value.
 func (h *Handler) HandleNewApp(w http.ResponseWriter, r *http.Request) {
-	key, err := h.appsService.NewApp(r.Context())
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	app, credential, err := h.appsService.NewApp(r.Context(), models.App{Name: r.Form.Get("name")})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte("error"))
+		return
 	}
-	data, err := json.Marshal(newAppResponseData{Key: string(key)})
+	data, err := json.Marshal(newAppResponseData{Id: app.Id, ClientId: app.ClientId, Credential: credential})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte("error"))
+		return
 	}
 	_, _ = w.Write(data)
 }
 
+// appResponseData reports when each secret was last used, so the console shows
+// whether clients still use the previous secret. Times are unix seconds, 0 for never.
 type appResponseData struct {
-	Id  int32  `json:"id"`
-	Key string `json:"key"`
+	Id                  int32  `json:"id"`
+	ClientId            string `json:"client_id"`
+	Name                string `json:"name"`
+	SecretUsedAt        int64  `json:"secret_used_at"`
+	SecretRotatedAt     int64  `json:"secret_rotated_at"`
+	PrevSecretExpiresAt int64  `json:"prev_secret_expires_at"`
+	PrevSecretUsedAt    int64  `json:"prev_secret_used_at"`
+	PrevSecretValid     bool   `json:"prev_secret_valid"`
+}
+
+func appData(app *models.App) appResponseData {
+	return appResponseData{
+		Id:                  app.Id,
+		ClientId:            app.ClientId,
+		Name:                app.Name,
+		SecretUsedAt:        unix(app.SecretUsedAt),
+		SecretRotatedAt:     unix(app.SecretRotatedAt),
+		PrevSecretExpiresAt: unix(app.PrevSecretExpiresAt),
+		PrevSecretUsedAt:    unix(app.PrevSecretUsedAt),
+		PrevSecretValid:     app.PrevSecretValid(time.Now()),
+	}
 }
 
 func (h *Handler) HandleGetAll(w http.ResponseWriter, r *http.Request) {
@@ -76,31 +130,203 @@ func (h *Handler) HandleGetAll(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte("error"))
+		return
 	}
 	var reqApps []appResponseData
 	for _, app := range apps {
-		reqApps = append(reqApps, appResponseData{
-			Id:  app.Id,
-			Key: string(app.Key),
-		})
+		reqApps = append(reqApps, appData(app))
 	}
 
 	data, err := json.Marshal(reqApps)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte("error"))
+		return
 	}
 	_, _ = w.Write(data)
 }
 
+// deleteAppResponseData tells what was, or in a dry run would be, deleted with the app.
+type deleteAppResponseData struct {
+	ClientId  string         `json:"client_id"`
+	Name      string         `json:"name"`
+	Data      models.AppData `json:"data"`
+	Cascade   bool           `json:"cascade"`
+	DeletedAt int64          `json:"deleted_at"`
+}
+
+// HandleDeleteApp deletes the app of the "client_id" form value. An app with users is
+// only deleted, together with them, when "cascade" is true; otherwise the answer is
+// 409 Conflict. With "dry_run" true nothing is deleted, the answer only tells what would be.
 func (h *Handler) HandleDeleteApp(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	clientId := r.Form.Get("client_id")
+	var (
+		opts apps.DeleteOptions
+		err  error
+	)
+	if v := r.Form.Get("cascade"); v != "" {
+		opts.Cascade, err = strconv.ParseBool(v)
+	}
+	if v := r.Form.Get("dry_run"); v != "" && err == nil {
+		opts.DryRun, err = strconv.ParseBool(v)
+	}
+	if clientId == "" || err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+
+	deleted, err := h.appsService.DeleteApp(r.Context(), clientId, opts)
+	switch {
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("error"))
+		return
+	case errors.Is(err, apps.ErrAppHasUsers):
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte("error"))
+		return
+	case err != nil:
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte("error"))
+		return
 	}
-	key := r.Form.Get("key")
-	if err := h.appsService.DeleteApp(r.Context(), []byte(key)); err != nil {
+	data, err := json.Marshal(deleteAppResponseData{
+		ClientId:  deleted.App.ClientId,
+		Name:      deleted.App.Name,
+		Data:      deleted.Data,
+		Cascade:   deleted.Cascade,
+		DeletedAt: unix(deleted.DeletedAt),
+	})
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte("error"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+type deletedAppResponseData struct {
+	deleteAppResponseData
+	DeletedBy string `json:"deleted_by"`
+	RequestId string `json:"request_id"`
+}
+
+// HandleGetDeletedApps lists the archive of deleted apps, newest first. The "client_id"
+// form value keeps only the records of that app, "limit" caps how many are returned.
+func (h *Handler) HandleGetDeletedApps(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	var (
+		limit int
+		err   error
+	)
+	if v := r.Form.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+	}
+	if err != nil || limit < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	list, err := h.appsService.DeletedApps(r.Context(), r.Form.Get("client_id"), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	resp := []deletedAppResponseData{}
+	for _, d := range list {
+		resp = append(resp, deletedAppResponseData{
+			deleteAppResponseData: deleteAppResponseData{
+				ClientId:  d.App.ClientId,
+				Name:      d.App.Name,
+				Data:      d.Data,
+				Cascade:   d.Cascade,
+				DeletedAt: unix(d.DeletedAt),
+			},
+			DeletedBy: d.DeletedBy,
+			RequestId: d.RequestId,
+		})
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+type rotateSecretResponseData struct {
+	appResponseData
+	Credential string `json:"credential"`
+}
+
+// HandleRotateSecret gives the app of the "client_id" form value a new secret. The old one
+// keeps working for the "grace_period" form value, a duration such as "24h" that defaults
+// to the configured one, or stops working at once if "revoke" is true.
+func (h *Handler) HandleRotateSecret(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	clientId := r.Form.Get("client_id")
+	var (
+		opts apps.RotateOptions
+		err  error
+	)
+	if v := r.Form.Get("grace_period"); v != "" {
+		opts.GracePeriod, err = time.ParseDuration(v)
+	}
+	if v := r.Form.Get("revoke"); v != "" && err == nil {
+		opts.Revoke, err = strconv.ParseBool(v)
+	}
+	if clientId == "" || err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+
+	app, credential, err := h.appsService.RotateSecret(r.Context(), clientId, opts)
+	switch {
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("error"))
+		return
+	case errors.Is(err, apps.ErrInvalidGracePeriod):
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	data, err := json.Marshal(rotateSecretResponseData{appResponseData: appData(&app), Credential: credential})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
 	}
+	return t.Unix()
 }
@@ -0,0 +1,35 @@
+package apps_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/http/apps"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingApps fails every call.
+type failingApps struct {
+	apps.Apps
+}
+
+func (failingApps) GetAll(context.Context) ([]*models.App, error) {
+	return nil, errors.New("storage down")
+}
+
+func (failingApps) NewApp(context.Context, models.App) (models.App, string, error) {
+	return models.App{}, "", errors.New("storage down")
+}
+
+func TestHandlersStopAfterErrors(t *testing.T) {
+	h := apps.NewHandler(failingApps{}, nil)
+	for name, handle := range map[string]http.HandlerFunc{"get_apps": h.HandleGetAll, "new_app": h.HandleNewApp} {
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/"+name, nil))
+		require.Equal(t, http.StatusInternalServerError, w.Code, name)
+		require.Equal(t, "error", w.Body.String(), name)
+	}
+}
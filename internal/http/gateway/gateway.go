@@ -0,0 +1,368 @@
+// Package gateway exposes the Auth and Permissions gRPC services as REST/JSON.
+// Requests are transcoded into the RPC's request message and handed to the
+// service implementation in process, through the interceptors of the gRPC
+// server, so both transports share one behaviour.
+package gateway
+
+import (
+	"SSO/internal/pkg/reqmeta"
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// AppKeyHeader carries the app's credential. It fills the app_key field, which
+	// the JSON body would otherwise have to carry base64 encoded.
+	AppKeyHeader = "X-App-Key"
+	// RequestIdHeader and OnBehalfOfHeader mirror the gRPC request metadata. The
+	// actor of a call is the app its key authenticates, never OnBehalfOfHeader.
+	RequestIdHeader  = "X-Request-Id"
+	OnBehalfOfHeader = "X-Actor"
+
+	// OpenAPIPath serves the OpenAPI document describing the routes.
+	OpenAPIPath = "/v1/openapi.json"
+
+	maxBodyBytes = 1 << 20
+)
+
+var (
+	marshaler   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	unmarshaler = protojson.UnmarshalOptions{}
+)
+
+type Server interface {
+	ssoV1.AuthServer
+	ssoV1.PermissionsServer
+}
+
+type Gateway struct {
+	l         *slog.Logger
+	server    Server
+	intercept grpc.UnaryServerInterceptor
+	routes    []route
+	openAPI   []byte
+}
+
+// route binds an HTTP method and path to an RPC. Path variables and, for requests
+// without a body, query values fill the request fields of the same name.
+type route struct {
+	method  string
+	path    string
+	service string
+	rpc     string
+	summary string
+	in      protoreflect.MessageDescriptor
+	out     protoreflect.MessageDescriptor
+	newIn   func() protoreflect.Message
+	call    func(ctx context.Context, in proto.Message) (proto.Message, error)
+}
+
+func newRoute[Req proto.Message, Resp proto.Message](method string, path string, desc grpc.ServiceDesc, rpc string, summary string, call func(context.Context, Req) (Resp, error)) route {
+	var (
+		in  Req
+		out Resp
+	)
+	return route{
+		method:  method,
+		path:    path,
+		service: desc.ServiceName,
+		rpc:     rpc,
+		summary: summary,
+		in:      in.ProtoReflect().Descriptor(),
+		out:     out.ProtoReflect().Descriptor(),
+		newIn:   in.ProtoReflect().New,
+		call: func(ctx context.Context, in proto.Message) (proto.Message, error) {
+			return call(ctx, in.(Req))
+		},
+	}
+}
+
+// hasBody reports whether the request message comes in the body rather than the query.
+func (r route) hasBody() bool {
+	return r.method == http.MethodPost || r.method == http.MethodPut
+}
+
+// New maps every RPC of s to a REST route, see RegisterRoutes. Each call runs
+// through intercept as if it came in over gRPC.
+func New(l *slog.Logger, s Server, intercept grpc.UnaryServerInterceptor) *Gateway {
+	auth, perm := ssoV1.Auth_ServiceDesc, ssoV1.Permissions_ServiceDesc
+	g := &Gateway{
+		l:         l,
+		server:    s,
+		intercept: intercept,
+		routes: []route{
+			newRoute(http.MethodPost, "/v1/users", auth, "Register", "Register a user", s.Register),
+			newRoute(http.MethodPost, "/v1/login", auth, "Login", "Log a user in and issue a token", s.Login),
+			newRoute(http.MethodDelete, "/v1/users/{login}", auth, "DeleteUser", "Delete a user", s.DeleteUser),
+			newRoute(http.MethodGet, "/v1/users/{login}/exists", auth, "TestUserOnExist", "Check whether a user exists", s.TestUserOnExist),
+			newRoute(http.MethodPost, "/v1/tokens/parse", auth, "ParseToken", "Validate a token and return its login", s.ParseToken),
+			newRoute(http.MethodPut, "/v1/users/{login}/login", auth, "UpdateLogin", "Rename a user", s.UpdateLogin),
+			newRoute(http.MethodPut, "/v1/users/{login}/password", auth, "ChangePassword", "Change a user's password", s.ChangePassword),
+			newRoute(http.MethodGet, "/v1/users/{login}/permission", perm, "GetUserPermission", "Get a user's permission", s.GetUserPermission),
+			newRoute(http.MethodPut, "/v1/users/{login}/permission", perm, "SetUserPermission", "Grant a user a permission", s.SetUserPermission),
+			newRoute(http.MethodPost, "/v1/users/{login}/access-requests", perm, "RequestAccess", "Request temporary access", s.RequestAccess),
+			newRoute(http.MethodGet, "/v1/access-requests", perm, "ListAccessRequests", "List access requests", s.ListAccessRequests),
+			newRoute(http.MethodPost, "/v1/access-requests/{request_id}/approve", perm, "ApproveAccess", "Approve an access request", s.ApproveAccess),
+			newRoute(http.MethodPost, "/v1/access-requests/{request_id}/deny", perm, "DenyAccess", "Deny an access request", s.DenyAccess),
+			newRoute(http.MethodGet, "/v1/permissions/history", perm, "History", "Page through the permission audit trail", s.History),
+		},
+	}
+	doc, err := json.Marshal(openAPI(g.routes))
+	if err != nil {
+		// The document is built from compiled-in descriptors only.
+		panic(err)
+	}
+	g.openAPI = doc
+	return g
+}
+
+// RegisterRoutes registers the gateway routes and the OpenAPI document at OpenAPIPath.
+func (g *Gateway) RegisterRoutes(rtr *mux.Router) {
+	rtr.HandleFunc(OpenAPIPath, g.HandleOpenAPI).Methods(http.MethodGet)
+	for _, rt := range g.routes {
+		rtr.Handle(rt.path, g.handler(rt)).Methods(rt.method)
+	}
+}
+
+func (g *Gateway) HandleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(g.openAPI)
+}
+
+func (g *Gateway) handler(rt route) http.HandlerFunc {
+	info := &grpc.UnaryServerInfo{Server: g.server, FullMethod: "/" + rt.service + "/" + rt.rpc}
+	call := func(ctx context.Context, in interface{}) (interface{}, error) {
+		return rt.call(ctx, in.(proto.Message))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(RequestIdHeader)
+		if requestId == "" {
+			requestId = reqmeta.NewRequestId()
+		}
+		w.Header().Set(RequestIdHeader, requestId)
+
+		in, err := decode(rt, w, r)
+		if err != nil {
+			writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+		resp, err := g.intercept(incomingContext(r, requestId), in.Interface(), info, call)
+		if err != nil {
+			if _, ok := status.FromError(err); !ok {
+				g.l.Error(fmt.Sprintf("gateway: %s/%s: %s", rt.service, rt.rpc, err))
+			}
+			writeError(w, err)
+			return
+		}
+		data, err := marshaler.Marshal(resp.(proto.Message))
+		if err != nil {
+			g.l.Error(fmt.Sprintf("gateway: %s/%s: %s", rt.service, rt.rpc, err))
+			writeError(w, status.Error(codes.Internal, "failed to encode response"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// incomingContext gives the request's context what a gRPC server's would hold:
+// the request id, who the caller acts on behalf of, the user agent and trace
+// headers as incoming metadata and the client's address as the peer.
+func incomingContext(r *http.Request, requestId string) context.Context {
+	md := metadata.Pairs(reqmeta.RequestIdKey, requestId, "user-agent", r.UserAgent())
+	if onBehalfOf := r.Header.Get(OnBehalfOfHeader); onBehalfOf != "" {
+		md.Set(reqmeta.OnBehalfOfKey, onBehalfOf)
+	}
+	for _, key := range otel.GetTextMapPropagator().Fields() {
+		if v := r.Header.Get(key); v != "" {
+			md.Set(key, v)
+		}
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	return peer.NewContext(ctx, &peer.Peer{Addr: remoteAddr(r.RemoteAddr)})
+}
+
+// remoteAddr is the client's address of an HTTP request as a net.Addr.
+type remoteAddr string
+
+func (a remoteAddr) Network() string { return "tcp" }
+func (a remoteAddr) String() string  { return string(a) }
+
+// decode builds the request message from the body or the query, then the path
+// variables and the app key header, each overriding what came before.
+func decode(rt route, w http.ResponseWriter, r *http.Request) (protoreflect.Message, error) {
+	in := rt.newIn()
+	if rt.hasBody() {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			return nil, err
+		}
+		if len(body) != 0 {
+			if err := unmarshaler.Unmarshal(body, in.Interface()); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for name, values := range r.URL.Query() {
+			if err := setField(in, name, values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name, value := range mux.Vars(r) {
+		if err := setField(in, name, []string{value}); err != nil {
+			return nil, err
+		}
+	}
+	if key := r.Header.Get(AppKeyHeader); key != "" {
+		if fd := in.Descriptor().Fields().ByName("app_key"); fd != nil {
+			in.Set(fd, protoreflect.ValueOfBytes([]byte(key)))
+		}
+	}
+	return in, nil
+}
+
+// setField sets the scalar field of msg named name, appending every value to repeated fields.
+func setField(msg protoreflect.Message, name string, values []string) error {
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil || fd.IsMap() || fd.Message() != nil {
+		return fmt.Errorf("unknown parameter %q", name)
+	}
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, v := range values {
+			value, err := parseScalar(fd, v)
+			if err != nil {
+				return err
+			}
+			list.Append(value)
+		}
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	value, err := parseScalar(fd, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, value)
+	return nil
+}
+
+func parseScalar(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	var (
+		v   protoreflect.Value
+		err error
+	)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(s)
+	case protoreflect.BytesKind:
+		v = protoreflect.ValueOfBytes([]byte(s))
+	case protoreflect.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 32)
+		v = protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 64)
+		v = protoreflect.ValueOfInt64(n)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, 32)
+		v = protoreflect.ValueOfUint32(uint32(n))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, 64)
+		v = protoreflect.ValueOfUint64(n)
+	case protoreflect.FloatKind:
+		var f float64
+		f, err = strconv.ParseFloat(s, 32)
+		v = protoreflect.ValueOfFloat32(float32(f))
+	case protoreflect.DoubleKind:
+		var f float64
+		f, err = strconv.ParseFloat(s, 64)
+		v = protoreflect.ValueOfFloat64(f)
+	case protoreflect.EnumKind:
+		ev := fd.Enum().Values().ByName(protoreflect.Name(s))
+		if ev == nil {
+			return v, fmt.Errorf("invalid value %q for parameter %q", s, fd.Name())
+		}
+		v = protoreflect.ValueOfEnum(ev.Number())
+	default:
+		return v, fmt.Errorf("unsupported parameter %q", fd.Name())
+	}
+	if err != nil {
+		return v, fmt.Errorf("invalid value %q for parameter %q", s, fd.Name())
+	}
+	return v, nil
+}
+
+// errorBody is what failed calls answer, the gRPC code next to its message.
+type errorBody struct {
+	Code    codes.Code `json:"code"`
+	Status  string     `json:"status"`
+	Message string     `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		st = status.New(codes.Internal, "internal error")
+	}
+	data, _ := json.Marshal(errorBody{Code: st.Code(), Status: st.Code().String(), Message: st.Message()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatus(st.Code()))
+	_, _ = w.Write(data)
+}
+
+// HTTPStatus maps a gRPC code to the HTTP status the gateway answers with.
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		// 499 Client Closed Request has no constant in net/http.
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,91 @@
+package gateway_test
+
+import (
+	"SSO/internal/http/gateway"
+	"SSO/internal/pkg/reqmeta"
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type server struct {
+	ssoV1.UnimplementedAuthServer
+	ssoV1.UnimplementedPermissionsServer
+}
+
+func (server) Login(ctx context.Context, in *ssoV1.LoginRequest) (*ssoV1.LoginResponse, error) {
+	if in.Login == "panic" {
+		panic("login")
+	}
+	m := reqmeta.From(ctx)
+	return &ssoV1.LoginResponse{Token: in.Login + ":" + m.Actor + ":" + m.OnBehalfOf}, nil
+}
+
+func TestCallsRunThroughInterceptor(t *testing.T) {
+	// tracing.Setup installs the propagator in the app.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	var (
+		info *grpc.UnaryServerInfo
+		md   metadata.MD
+		addr string
+	)
+	// intercept stands in for the gRPC server's chain: it fills the request
+	// metadata from the incoming context and recovers panics.
+	intercept := func(ctx context.Context, req interface{}, i *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		info = i
+		md, _ = metadata.FromIncomingContext(ctx)
+		if p, ok := peer.FromContext(ctx); ok {
+			addr = p.Addr.String()
+		}
+		defer func() {
+			if recover() != nil {
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		return handler(reqmeta.With(ctx, reqmeta.Meta{OnBehalfOf: md.Get(reqmeta.OnBehalfOfKey)[0]}), req)
+	}
+	rtr := mux.NewRouter()
+	gateway.New(slog.New(slog.NewTextHandler(io.Discard, nil)), server{}, intercept).RegisterRoutes(rtr)
+
+	call := func(login string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(`{"login":"`+login+`"}`))
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set(gateway.OnBehalfOfHeader, "admin:root")
+		r.Header.Set(gateway.RequestIdHeader, "req-1")
+		r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		r.Header.Set("User-Agent", "test")
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call("alice")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"token":"alice::admin:root"`, "the header names who the call is on behalf of, not the actor")
+	require.Equal(t, []string{"admin:root"}, md.Get(reqmeta.OnBehalfOfKey))
+	require.Equal(t, "req-1", w.Header().Get(gateway.RequestIdHeader))
+	require.Equal(t, "/sso.Auth/Login", info.FullMethod)
+	require.Equal(t, server{}, info.Server)
+	require.Equal(t, []string{"req-1"}, md.Get(reqmeta.RequestIdKey))
+	require.Equal(t, []string{"test"}, md.Get("user-agent"))
+	require.Equal(t, []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, md.Get("traceparent"))
+	require.Equal(t, "192.0.2.1:1234", addr)
+
+	w = call("panic")
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), `"status":"Internal"`)
+}
@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// openAPIVersion is the version of the API the document describes.
+const openAPIVersion = "1.0.0"
+
+var pathParam = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// openAPI describes routes as an OpenAPI 3 document. Schemas are derived from the
+// message descriptors, following the protojson mapping the gateway speaks.
+func openAPI(routes []route) map[string]any {
+	schemas := map[string]any{
+		"Error": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"code":    map[string]any{"type": "integer", "description": "gRPC status code"},
+				"status":  map[string]any{"type": "string", "description": "gRPC status code name"},
+				"message": map[string]any{"type": "string"},
+			},
+		},
+	}
+	paths := map[string]any{}
+	for _, rt := range routes {
+		addSchema(schemas, rt.out)
+		item, _ := paths[rt.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = operation(rt, schemas)
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "SSO",
+			"version":     openAPIVersion,
+			"description": "REST/JSON gateway to the Auth and Permissions gRPC services. Fields use their proto names; 64-bit integers are strings.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"appKey": map[string]any{"type": "apiKey", "in": "header", "name": AppKeyHeader},
+			},
+		},
+	}
+}
+
+func operation(rt route, schemas map[string]any) map[string]any {
+	inPath := map[string]bool{}
+	var params []any
+	for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+		inPath[m[1]] = true
+		fd := rt.in.Fields().ByName(protoreflect.Name(m[1]))
+		params = append(params, map[string]any{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   fieldSchema(fd, schemas),
+		})
+	}
+	params = append(params, map[string]any{
+		"name":   RequestIdHeader,
+		"in":     "header",
+		"schema": map[string]any{"type": "string"},
+	}, map[string]any{
+		"name":        OnBehalfOfHeader,
+		"in":          "header",
+		"description": "Who the call is made on behalf of, recorded next to the authenticated app without being checked.",
+		"schema":      map[string]any{"type": "string"},
+	})
+
+	op := map[string]any{
+		"operationId": rt.service[strings.LastIndex(rt.service, ".")+1:] + "_" + rt.rpc,
+		"summary":     rt.summary,
+		"tags":        []string{rt.service},
+		"responses": map[string]any{
+			"200": jsonContent("OK", ref(rt.out)),
+			"default": jsonContent("Error", map[string]any{
+				"$ref": "#/components/schemas/Error",
+			}),
+		},
+	}
+	if rt.in.Fields().ByName("app_key") != nil {
+		op["security"] = []any{map[string]any{"appKey": []string{}}}
+	}
+
+	// Fields that aren't path parameters come in the body, or in the query when there is none.
+	body := map[string]any{}
+	fields := rt.in.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := string(fd.Name())
+		if inPath[name] || name == "app_key" {
+			continue
+		}
+		if rt.hasBody() {
+			body[name] = fieldSchema(fd, schemas)
+			continue
+		}
+		params = append(params, map[string]any{
+			"name":   name,
+			"in":     "query",
+			"schema": fieldSchema(fd, schemas),
+		})
+	}
+	op["parameters"] = params
+	if rt.hasBody() {
+		op["requestBody"] = map[string]any{
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{"type": "object", "properties": body},
+				},
+			},
+		}
+	}
+	if rt.method == http.MethodDelete {
+		op["description"] = "Parameters other than the path ones come in the query."
+	}
+	return op
+}
+
+func jsonContent(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": schema},
+		},
+	}
+}
+
+func ref(md protoreflect.MessageDescriptor) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + string(md.Name())}
+}
+
+// addSchema adds the schema of md, and of the messages it refers to, to schemas.
+func addSchema(schemas map[string]any, md protoreflect.MessageDescriptor) {
+	name := string(md.Name())
+	if _, ok := schemas[name]; ok {
+		return
+	}
+	props := map[string]any{}
+	schemas[name] = map[string]any{"type": "object", "properties": props}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		props[string(fd.Name())] = fieldSchema(fd, schemas)
+	}
+}
+
+func fieldSchema(fd protoreflect.FieldDescriptor, schemas map[string]any) map[string]any {
+	if fd.IsMap() {
+		return map[string]any{"type": "object", "additionalProperties": kindSchema(fd.MapValue(), schemas)}
+	}
+	s := kindSchema(fd, schemas)
+	if fd.IsList() {
+		return map[string]any{"type": "array", "items": s}
+	}
+	return s
+}
+
+func kindSchema(fd protoreflect.FieldDescriptor, schemas map[string]any) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer", "format": "int64", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]any{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind:
+		return map[string]any{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]any{"type": "number", "format": "double"}
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		var names []string
+		values := fd.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			names = append(names, string(values.Get(i).Name()))
+		}
+		return map[string]any{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		addSchema(schemas, fd.Message())
+		return ref(fd.Message())
+	}
+	return map[string]any{"type": "string"}
+}
@@ -0,0 +1,288 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/http/admin"
+	"SSO/internal/service/users"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Handler serves the users part of the admin console. The console identifies apps
+// by client id, so the users service and apps provider must resolve them with apps.ByClientId.
+type Handler struct {
+	usersService Users
+	permService  Permissions
+	appsProvider AppsProvider
+}
+
+type Users interface {
+	List(ctx context.Context, appKey []byte, q users.ListQuery) ([]models.User, string, error)
+	Import(ctx context.Context, appKey []byte, format string, r io.Reader, opts users.ImportOptions) (users.ImportResult, error)
+	Export(ctx context.Context, appKey []byte, format string, w io.Writer) (int, error)
+	Get(ctx context.Context, appKey []byte, login string) (models.User, error)
+	GetProfile(ctx context.Context, appKey []byte, login string) (map[string]string, error)
+	SetStatus(ctx context.Context, appKey []byte, login string, status string, suspendedUntil time.Time) error
+	Restore(ctx context.Context, appKey []byte, login string) error
+	Delete(ctx context.Context, appKey []byte, login string) error
+	ResetMFA(ctx context.Context, appKey []byte, login string) error
+	RequirePasswordReset(ctx context.Context, appKey []byte, login string) error
+	Sessions(ctx context.Context, appKey []byte, login string) ([]models.UserSession, error)
+	RevokeSession(ctx context.Context, appKey []byte, login string, sessionId string) error
+	RevokeSessions(ctx context.Context, appKey []byte, login string) (int64, error)
+}
+
+type Permissions interface {
+	SetUserPermission(ctx context.Context, appId int32, userId int64, permission int32, expiresAt time.Time) error
+	GetUserPermission(ctx context.Context, userId int64) (int32, error)
+	Delete(ctx context.Context, appId int32, userId int64) error
+	History(ctx context.Context, filter models.PermissionAuditFilter) ([]models.PermissionAuditEntry, error)
+}
+
+type AppsProvider interface {
+	GetByKey(ctx context.Context, key []byte) (models.App, error)
+}
+
+func NewHandler(usersService Users, permService Permissions, appsProvider AppsProvider) *Handler {
+	return &Handler{
+		usersService: usersService,
+		permService:  permService,
+		appsProvider: appsProvider,
+	}
+}
+
+func (h *Handler) RegisterRoutes(rtr *mux.Router, guard *admin.Guard) {
+	rtr.Handle("/get_users", guard.Require(models.AdminViewer, h.HandleGetUsers)).Methods("POST")
+	rtr.Handle("/import_users", guard.Require(models.AdminOperator, h.HandleImportUsers)).Methods("POST")
+	rtr.Handle("/export_users", guard.Require(models.AdminViewer, h.HandleExportUsers)).Methods("POST")
+	rtr.Handle("/get_user", guard.Require(models.AdminViewer, h.HandleGetUser)).Methods("POST")
+	rtr.Handle("/set_user_status", guard.Require(models.AdminOperator, h.HandleSetUserStatus)).Methods("POST")
+	rtr.Handle("/restore_user", guard.Require(models.AdminOperator, h.HandleRestoreUser)).Methods("POST")
+	rtr.Handle("/delete_user", guard.Require(models.AdminOperator, h.HandleDeleteUser)).Methods("POST")
+	rtr.Handle("/reset_user_mfa", guard.Require(models.AdminOperator, h.HandleResetMFA)).Methods("POST")
+	rtr.Handle("/require_password_reset", guard.Require(models.AdminOperator, h.HandleRequirePasswordReset)).Methods("POST")
+	rtr.Handle("/revoke_session", guard.Require(models.AdminOperator, h.HandleRevokeSession)).Methods("POST")
+	rtr.Handle("/revoke_sessions", guard.Require(models.AdminOperator, h.HandleRevokeSessions)).Methods("POST")
+	rtr.Handle("/set_user_permission", guard.Require(models.AdminOperator, h.HandleSetUserPermission)).Methods("POST")
+	rtr.Handle("/revoke_user_permission", guard.Require(models.AdminOperator, h.HandleRevokeUserPermission)).Methods("POST")
+	rtr.Handle("/get_audit", guard.Require(models.AdminViewer, h.HandleGetAudit)).Methods("POST")
+}
+
+type userResponseData struct {
+	Id         int64  `json:"id"`
+	Login      string `json:"login"`
+	Email      string `json:"email"`
+	CreatedAt  int64  `json:"created_at"`
+	Status     string `json:"status"`
+	MFAEnabled bool   `json:"mfa_enabled"`
+}
+
+type usersResponseData struct {
+	Users         []userResponseData `json:"users"`
+	NextPageToken string             `json:"next_page_token"`
+}
+
+// HandleGetUsers lists the users of the app given by the "client_id" form value.
+// The other form values mirror the ListUsers RPC fields.
+func (h *Handler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	clientId := r.Form.Get("client_id")
+	q, err := parseListQuery(r)
+	if clientId == "" || err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+
+	list, next, err := h.usersService.List(r.Context(), []byte(clientId), q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	resp := usersResponseData{Users: []userResponseData{}, NextPageToken: next}
+	for _, u := range list {
+		resp.Users = append(resp.Users, userResponseData{
+			Id:         u.Id,
+			Login:      u.Login,
+			Email:      u.Email,
+			CreatedAt:  u.CreatedAt.Unix(),
+			Status:     u.StatusAt(time.Now()),
+			MFAEnabled: u.MFAEnabled,
+		})
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+type rowErrorData struct {
+	Line  int    `json:"line"`
+	Login string `json:"login"`
+	Error string `json:"error"`
+}
+
+type importResponseData struct {
+	Total    int            `json:"total"`
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Errors   []rowErrorData `json:"errors"`
+}
+
+// HandleImportUsers imports the file sent as the "file" field of a multipart form,
+// or as the raw request body. The app, format and dry run come from the "client_id",
+// "format" and "dry_run" query values.
+func (h *Handler) HandleImportUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	clientId := query.Get("client_id")
+	if clientId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	var body io.Reader = r.Body
+	if file, _, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		body = file
+	}
+
+	res, err := h.usersService.Import(r.Context(), []byte(clientId), query.Get("format"), body, users.ImportOptions{
+		DryRun: query.Get("dry_run") == "true",
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	resp := importResponseData{
+		Total:    res.Total,
+		Imported: res.Imported,
+		Failed:   res.Failed,
+		Errors:   []rowErrorData{},
+	}
+	for _, e := range res.Errors {
+		resp.Errors = append(resp.Errors, rowErrorData{Line: e.Line, Login: e.Login, Error: e.Err})
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// HandleExportUsers sends the users of the app given by the "client_id" form value
+// as a file in the "format" form value.
+func (h *Handler) HandleExportUsers(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	clientId, format := r.Form.Get("client_id"), r.Form.Get("format")
+	if clientId == "" || (format != users.FormatCSV && format != users.FormatJSONL) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("error"))
+		return
+	}
+	contentType := "text/csv"
+	if format == users.FormatJSONL {
+		contentType = "application/jsonl"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=users."+format)
+	cw := &countingWriter{w: w}
+	if _, err := h.usersService.Export(r.Context(), []byte(clientId), format, cw); err != nil && cw.n == 0 {
+		// Once the body started streaming the status can't change, a later failure just truncates the file.
+		w.Header().Del("Content-Disposition")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("error"))
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func parseListQuery(r *http.Request) (users.ListQuery, error) {
+	q := users.ListQuery{
+		Search:    r.Form.Get("search"),
+		Substring: r.Form.Get("substring") == "true",
+		SortBy:    r.Form.Get("sort_by"),
+		Desc:      r.Form.Get("desc") == "true",
+		Status:    r.Form.Get("status"),
+		PageToken: r.Form.Get("page_token"),
+	}
+	var err error
+	if v := r.Form.Get("page_size"); v != "" {
+		if q.PageSize, err = strconv.Atoi(v); err != nil {
+			return q, err
+		}
+	}
+	if q.MFAEnabled, err = formBool(r, "mfa_enabled"); err != nil {
+		return q, err
+	}
+	if v := r.Form.Get("role"); v != "" {
+		role, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return q, err
+		}
+		r := int32(role)
+		q.Role = &r
+	}
+	if q.CreatedFrom, err = formUnix(r, "created_from"); err != nil {
+		return q, err
+	}
+	if q.CreatedTo, err = formUnix(r, "created_to"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func formBool(r *http.Request, name string) (*bool, error) {
+	v := r.Form.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func formUnix(r *http.Request, name string) (time.Time, error) {
+	v := r.Form.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
@@ -0,0 +1,367 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/permissions"
+	"SSO/internal/service/users"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type sessionResponseData struct {
+	Id        string `json:"id"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// userDetailsResponseData is everything the console shows about one user.
+// Permission is null for users without an unexpired one; soft-deleted users have no sessions.
+type userDetailsResponseData struct {
+	userResponseData
+	PasswordResetRequired bool                  `json:"password_reset_required"`
+	SuspendedUntil        int64                 `json:"suspended_until"`
+	DeletedAt             int64                 `json:"deleted_at"`
+	Profile               map[string]string     `json:"profile"`
+	Permission            *int32                `json:"permission"`
+	Sessions              []sessionResponseData `json:"sessions"`
+}
+
+// HandleGetUser describes the user of the "client_id" and "login" form values.
+func (h *Handler) HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	clientId, login, ok := userForm(r)
+	if !ok {
+		writeError(w, errBadRequest)
+		return
+	}
+	ctx := r.Context()
+	u, err := h.usersService.Get(ctx, []byte(clientId), login)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	profile, err := h.usersService.GetProfile(ctx, []byte(clientId), login)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := userDetailsResponseData{
+		userResponseData: userResponseData{
+			Id:         u.Id,
+			Login:      u.Login,
+			Email:      u.Email,
+			CreatedAt:  u.CreatedAt.Unix(),
+			Status:     u.StatusAt(time.Now()),
+			MFAEnabled: u.MFAEnabled,
+		},
+		PasswordResetRequired: u.PasswordResetRequired,
+		SuspendedUntil:        unix(u.SuspendedUntil),
+		DeletedAt:             unix(u.DeletedAt),
+		Profile:               profile,
+		Sessions:              []sessionResponseData{},
+	}
+	perm, err := h.permService.GetUserPermission(ctx, u.Id)
+	switch {
+	case err == nil:
+		resp.Permission = &perm
+	case !errors.Is(err, storageErrors.ErrPermissionNotFound):
+		writeError(w, err)
+		return
+	}
+	if u.Status != models.UserDeleted {
+		sessions, err := h.usersService.Sessions(ctx, []byte(clientId), login)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, s := range sessions {
+			resp.Sessions = append(resp.Sessions, sessionResponseData{
+				Id:        s.Id,
+				CreatedAt: s.CreatedAt.Unix(),
+				ExpiresAt: s.ExpiresAt.Unix(),
+			})
+		}
+	}
+	writeJSON(w, resp)
+}
+
+// HandleSetUserStatus sets the "status" form value, suspending the user until
+// the "suspended_until" unix time for the suspended status.
+func (h *Handler) HandleSetUserStatus(w http.ResponseWriter, r *http.Request) {
+	clientId, login, ok := userForm(r)
+	if !ok {
+		writeError(w, errBadRequest)
+		return
+	}
+	until, err := formUnix(r, "suspended_until")
+	if err != nil {
+		writeError(w, errBadRequest)
+		return
+	}
+	if err := h.usersService.SetStatus(r.Context(), []byte(clientId), login, r.Form.Get("status"), until); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (h *Handler) HandleRestoreUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.usersService.Restore)
+}
+
+// HandleDeleteUser soft-deletes the user, who can be restored until purged.
+func (h *Handler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.usersService.Delete)
+}
+
+func (h *Handler) HandleResetMFA(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.usersService.ResetMFA)
+}
+
+// HandleRequirePasswordReset signs the user out everywhere and refuses logins until the password is changed.
+func (h *Handler) HandleRequirePasswordReset(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.usersService.RequirePasswordReset)
+}
+
+// HandleRevokeSession revokes the user's session of the "session_id" form value.
+func (h *Handler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	clientId, login, ok := userForm(r)
+	sessionId := r.Form.Get("session_id")
+	if !ok || sessionId == "" {
+		writeError(w, errBadRequest)
+		return
+	}
+	if err := h.usersService.RevokeSession(r.Context(), []byte(clientId), login, sessionId); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+type revokeSessionsResponseData struct {
+	Revoked int64 `json:"revoked"`
+}
+
+func (h *Handler) HandleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	clientId, login, ok := userForm(r)
+	if !ok {
+		writeError(w, errBadRequest)
+		return
+	}
+	n, err := h.usersService.RevokeSessions(r.Context(), []byte(clientId), login)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, revokeSessionsResponseData{Revoked: n})
+}
+
+// HandleSetUserPermission grants the user the "permission" form value until the
+// "expires_at" unix time, or for good when it is empty.
+func (h *Handler) HandleSetUserPermission(w http.ResponseWriter, r *http.Request) {
+	clientId, login, ok := userForm(r)
+	if !ok {
+		writeError(w, errBadRequest)
+		return
+	}
+	perm, err := strconv.ParseInt(r.Form.Get("permission"), 10, 32)
+	if err != nil {
+		writeError(w, errBadRequest)
+		return
+	}
+	expiresAt, err := formUnix(r, "expires_at")
+	if err != nil || (!expiresAt.IsZero() && !expiresAt.After(time.Now())) {
+		writeError(w, errBadRequest)
+		return
+	}
+	u, err := h.liveUser(r, clientId, login)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.permService.SetUserPermission(r.Context(), u.AppId, u.Id, int32(perm), expiresAt); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (h *Handler) HandleRevokeUserPermission(w http.ResponseWriter, r *http.Request) {
+	clientId, login, ok := userForm(r)
+	if !ok {
+		writeError(w, errBadRequest)
+		return
+	}
+	u, err := h.liveUser(r, clientId, login)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.permService.Delete(r.Context(), u.AppId, u.Id); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+type auditEntryResponseData struct {
+	Id           int64  `json:"id"`
+	Login        string `json:"login"`
+	Actor        string `json:"actor"`
+	Action       string `json:"action"`
+	OldValue     int32  `json:"old_value"`
+	NewValue     int32  `json:"new_value"`
+	NewExpiresAt int64  `json:"new_expires_at"`
+	RequestId    string `json:"request_id"`
+	CreatedAt    int64  `json:"created_at"`
+	OnBehalfOf   string `json:"on_behalf_of"`
+}
+
+type auditResponseData struct {
+	Entries       []auditEntryResponseData `json:"entries"`
+	NextPageToken string                   `json:"next_page_token"`
+}
+
+// HandleGetAudit pages through the permission audit trail of the "client_id" app, newest
+// first. "login" and "actor" narrow it down, "page_token" is the previous page's next one.
+func (h *Handler) HandleGetAudit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, errBadRequest)
+		return
+	}
+	clientId := r.Form.Get("client_id")
+	filter := models.PermissionAuditFilter{
+		Actor: r.Form.Get("actor"),
+		Limit: permissions.DefaultHistoryPageSize,
+	}
+	var err error
+	if v := r.Form.Get("page_size"); v != "" {
+		filter.Limit, err = strconv.Atoi(v)
+		if filter.Limit <= 0 || filter.Limit > permissions.MaxHistoryPageSize {
+			err = errBadRequest
+		}
+	}
+	if v := r.Form.Get("page_token"); v != "" && err == nil {
+		filter.BeforeId, err = strconv.ParseInt(v, 10, 64)
+	}
+	if clientId == "" || err != nil {
+		writeError(w, errBadRequest)
+		return
+	}
+	app, err := h.appsProvider.GetByKey(r.Context(), []byte(clientId))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	filter.AppId = app.Id
+	if login := r.Form.Get("login"); login != "" {
+		u, err := h.usersService.Get(r.Context(), []byte(clientId), login)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		filter.UserId = u.Id
+	}
+
+	entries, err := h.permService.History(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := auditResponseData{Entries: []auditEntryResponseData{}}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, auditEntryResponseData{
+			Id:           e.Id,
+			Login:        e.Login,
+			Actor:        e.Actor,
+			Action:       e.Action,
+			OldValue:     e.OldValue,
+			NewValue:     e.NewValue,
+			NewExpiresAt: unix(e.NewExpiresAt),
+			RequestId:    e.RequestId,
+			CreatedAt:    e.CreatedAt.Unix(),
+			OnBehalfOf:   e.OnBehalfOf,
+		})
+	}
+	if len(entries) == filter.Limit {
+		resp.NextPageToken = strconv.FormatInt(entries[len(entries)-1].Id, 10)
+	}
+	writeJSON(w, resp)
+}
+
+// userAction runs action on the user of the "client_id" and "login" form values.
+func (h *Handler) userAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, appKey []byte, login string) error) {
+	clientId, login, ok := userForm(r)
+	if !ok {
+		writeError(w, errBadRequest)
+		return
+	}
+	if err := action(r.Context(), []byte(clientId), login); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+// liveUser gets the user, treating soft-deleted users as missing.
+func (h *Handler) liveUser(r *http.Request, clientId string, login string) (models.User, error) {
+	u, err := h.usersService.Get(r.Context(), []byte(clientId), login)
+	if err != nil {
+		return u, err
+	}
+	if u.Status == models.UserDeleted {
+		return models.User{}, storageErrors.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func userForm(r *http.Request) (clientId string, login string, ok bool) {
+	if err := r.ParseForm(); err != nil {
+		return "", "", false
+	}
+	clientId, login = r.Form.Get("client_id"), r.Form.Get("login")
+	return clientId, login, clientId != "" && login != ""
+}
+
+var errBadRequest = errors.New("bad request")
+
+// writeError answers "error" with the status err maps to.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, users.ErrInvalidStatus):
+		code = http.StatusBadRequest
+	case errors.Is(err, storageErrors.ErrAppNotFound), errors.Is(err, storageErrors.ErrUserNotFound),
+		errors.Is(err, storageErrors.ErrSessionNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, users.ErrNotDeleted):
+		code = http.StatusConflict
+	}
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte("error"))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func writeOK(w http.ResponseWriter) {
+	_, _ = w.Write([]byte("ok"))
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -4,6 +4,7 @@ import (
 	"SSO/internal/domain/models"
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
+	"strings"
 	"time"
 )
 
@@ -11,33 +12,68 @@ var (
 	ErrExpired = errors.New("token has expired")
 )
 
-func NewToken(user models.User, app models.App, TTL time.Duration) (string, error) {
+// Claims holds the optional claims embedded next to login and exp.
+type Claims struct {
+	// Scopes are written space separated to the "scope" claim, Permissions to "permissions".
+	// Both are left out when no scope was granted.
+	Scopes      []string
+	Permissions int32
+	// Profile holds the user attributes chosen as claims, written to the "profile" claim when not empty.
+	Profile map[string]any
+	// SessionId is written to the "sid" claim when set.
+	SessionId string
+}
+
+func NewToken(user models.User, app models.App, TTL time.Duration, extra Claims) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
 
 	claims["login"] = user.Login
 	claims["exp"] = time.Now().Add(TTL).Unix()
+	if len(extra.Scopes) != 0 {
+		claims["scope"] = strings.Join(extra.Scopes, " ")
+		claims["permissions"] = extra.Permissions
+	}
+	if len(extra.Profile) != 0 {
+		claims["profile"] = extra.Profile
+	}
+	if extra.SessionId != "" {
+		claims["sid"] = extra.SessionId
+	}
 
-	tokenStr, err := token.SignedString(app.Key)
+	tokenStr, err := token.SignedString(app.SigningKey)
 	if err != nil {
 		return "", err
 	}
 	return tokenStr, nil
 }
 
-func ParseToken(strToken string, key []byte) (string, error) {
-	token, err := jwt.Parse(strToken, func(token *jwt.Token) (interface{}, error) {
-		return key, nil
-	})
+// ParseToken returns the token's login and session id, which is empty for tokens issued without one.
+// The token must be signed with one of keys, tried in order.
+func ParseToken(strToken string, keys ...[]byte) (login string, sessionId string, err error) {
+	var token *jwt.Token
+	for _, key := range keys {
+		key := key
+		token, err = jwt.Parse(strToken, func(token *jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			break
+		}
+	}
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return "", "", ErrExpired
+	}
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	claims := token.Claims.(jwt.MapClaims)
-	login := claims["login"].(string)
+	login = claims["login"].(string)
 	exp := int64(claims["exp"].(float64))
 	if time.Now().Unix() > exp {
-		return "", ErrExpired
+		return "", "", ErrExpired
 	}
-	return login, err
+	sessionId, _ = claims["sid"].(string)
+	return login, sessionId, nil
 }
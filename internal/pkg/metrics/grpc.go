@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// Values of the grpc_type label.
+const (
+	typeUnary        = "unary"
+	typeClientStream = "client_stream"
+	typeServerStream = "server_stream"
+	typeBidiStream   = "bidi_stream"
+)
+
+// UnaryServerInterceptor counts and times unary RPCs. Chain it first, so that
+// panics turned into errors by the interceptors after it are counted too.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done := m.startRPC(typeUnary, info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor counts and times streaming RPCs, from start to the handler's return.
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		rpcType := typeBidiStream
+		switch {
+		case info.IsClientStream && !info.IsServerStream:
+			rpcType = typeClientStream
+		case !info.IsClientStream && info.IsServerStream:
+			rpcType = typeServerStream
+		}
+		done := m.startRPC(rpcType, info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+// startRPC counts the RPC as started and returns the func that records its end.
+func (m *Metrics) startRPC(rpcType string, fullMethod string) func(err error) {
+	service, method := splitMethod(fullMethod)
+	m.rpcStarted.WithLabelValues(rpcType, service, method).Inc()
+	start := time.Now()
+	return func(err error) {
+		m.rpcHandled.WithLabelValues(rpcType, service, method, status.Code(err).String()).Inc()
+		m.rpcDuration.WithLabelValues(rpcType, service, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// splitMethod splits "/package.Service/Method" into the service and the method.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
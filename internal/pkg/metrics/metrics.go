@@ -0,0 +1,157 @@
+// Package metrics exports Prometheus metrics: per-RPC gRPC server metrics, business
+// counters of the auth service, database pool stats and app cache stats.
+package metrics
+
+import (
+	"SSO/internal/storage/cache"
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "sso"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	rpcStarted  *prometheus.CounterVec
+	rpcHandled  *prometheus.CounterVec
+	rpcDuration *prometheus.HistogramVec
+
+	logins           *prometheus.CounterVec
+	registrations    *prometheus.CounterVec
+	tokenValidations *prometheus.CounterVec
+	lockouts         *prometheus.CounterVec
+}
+
+// New creates the metrics in a registry of their own, which also exports the Go
+// runtime and process metrics.
+func New() *Metrics {
+	rpcLabels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		rpcStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "RPCs started on the server.",
+		}, rpcLabels),
+		rpcHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "RPCs completed on the server, by status code.",
+		}, append(rpcLabels, "grpc_code")),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time the server took to handle RPCs.",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, rpcLabels),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts, by outcome.",
+		}, []string{"outcome"}),
+		registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "registrations_total",
+			Help:      "Registration attempts, by outcome.",
+		}, []string{"outcome"}),
+		tokenValidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validations_total",
+			Help:      "Token validations, by result.",
+		}, []string{"result"}),
+		lockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lockouts_total",
+			Help:      "Logins with the right password refused because the user is disabled or suspended, by reason.",
+		}, []string{"reason"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.rpcStarted, m.rpcHandled, m.rpcDuration,
+		m.logins, m.registrations, m.tokenValidations, m.lockouts,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) Login(outcome string) {
+	m.logins.WithLabelValues(outcome).Inc()
+}
+
+func (m *Metrics) Registration(outcome string) {
+	m.registrations.WithLabelValues(outcome).Inc()
+}
+
+func (m *Metrics) TokenValidation(result string) {
+	m.tokenValidations.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) Lockout(reason string) {
+	m.lockouts.WithLabelValues(reason).Inc()
+}
+
+// RegisterDB exports the connection pool stats of db, labelled with dbName.
+func (m *Metrics) RegisterDB(db *sql.DB, dbName string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// AppCache is the app cache whose stats are exported.
+type AppCache interface {
+	Stats() cache.AppStats
+}
+
+// RegisterAppCache exports the lookup stats of c.
+func (m *Metrics) RegisterAppCache(c AppCache) {
+	m.registry.MustRegister(newAppCacheCollector(c))
+}
+
+// appCacheCollector reads the cache's stats on every scrape.
+type appCacheCollector struct {
+	cache     AppCache
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+	entries   *prometheus.Desc
+	hitRatio  *prometheus.Desc
+}
+
+func newAppCacheCollector(c AppCache) *appCacheCollector {
+	name := func(n string) string {
+		return prometheus.BuildFQName(namespace, "app_cache", n)
+	}
+	return &appCacheCollector{
+		cache:     c,
+		hits:      prometheus.NewDesc(name("hits_total"), "App lookups served from the cache.", nil, nil),
+		misses:    prometheus.NewDesc(name("misses_total"), "App lookups passed on to the database.", nil, nil),
+		evictions: prometheus.NewDesc(name("evictions_total"), "Apps evicted to keep the cache within its size.", nil, nil),
+		entries:   prometheus.NewDesc(name("entries"), "Apps and unknown keys in the cache.", nil, nil),
+		hitRatio:  prometheus.NewDesc(name("hit_ratio"), "Share of app lookups served from the cache since start, 0 before any lookup.", nil, nil),
+	}
+}
+
+func (c *appCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.entries
+	ch <- c.hitRatio
+}
+
+func (c *appCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	var ratio float64
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		ratio = float64(stats.Hits) / float64(lookups)
+	}
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(c.hitRatio, prometheus.GaugeValue, ratio)
+}
@@ -0,0 +1,124 @@
+// Package password hashes new passwords with bcrypt and verifies both bcrypt
+// hashes and argon2 hashes in PHC string format, which imported users may carry.
+package password
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Bounds of the argon2 parameters accepted from imported hashes. Verifying a hash
+// costs what its parameters ask for, so they are capped to keep a crafted hash
+// from exhausting memory or CPU on every login.
+const (
+	argon2MaxMemory  = 256 * 1024 // KiB
+	argon2MaxTime    = 10
+	argon2MaxThreads = 16
+	argon2MinSalt    = 8
+	argon2MaxSalt    = 64
+	argon2MinKey     = 16
+	argon2MaxKey     = 64
+)
+
+var (
+	ErrMismatch        = errors.New("password doesn't match")
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+)
+
+func Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// Compare returns nil when password matches hash and ErrMismatch when it doesn't.
+func Compare(hash []byte, password string) error {
+	if isBcrypt(hash) {
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return ErrMismatch
+			}
+			return err
+		}
+		return nil
+	}
+	p, err := parseArgon2(string(hash))
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(p.derive(password), p.key) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// Validate checks that hash is a bcrypt or argon2 PHC hash this package can verify.
+func Validate(hash []byte) error {
+	if isBcrypt(hash) {
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return fmt.Errorf("%w: %s", ErrUnsupportedHash, err.Error())
+		}
+		return nil
+	}
+	_, err := parseArgon2(string(hash))
+	return err
+}
+
+func isBcrypt(hash []byte) bool {
+	s := string(hash)
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+type argon2Params struct {
+	variant string
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (p argon2Params) derive(password string) []byte {
+	if p.variant == "argon2i" {
+		return argon2.Key([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	}
+	return argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+}
+
+// parseArgon2 parses $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>, salt and hash being unpadded base64.
+// Hashes whose parameters exceed the bounds are rejected by Validate on import and by Compare alike.
+func parseArgon2(s string) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(s, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return p, ErrUnsupportedHash
+	}
+	p.variant = parts[1]
+	if p.variant != "argon2id" && p.variant != "argon2i" {
+		return p, ErrUnsupportedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, fmt.Errorf("%w: argon2 version", ErrUnsupportedHash)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil ||
+		parts[3] != fmt.Sprintf("m=%d,t=%d,p=%d", p.memory, p.time, p.threads) {
+		return p, fmt.Errorf("%w: argon2 parameters", ErrUnsupportedHash)
+	}
+	// argon2 itself needs at least 8 KiB of memory per thread.
+	if p.time == 0 || p.time > argon2MaxTime || p.threads == 0 || p.threads > argon2MaxThreads ||
+		p.memory < 8*uint32(p.threads) || p.memory > argon2MaxMemory {
+		return p, fmt.Errorf("%w: argon2 parameters out of bounds", ErrUnsupportedHash)
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(p.salt) < argon2MinSalt || len(p.salt) > argon2MaxSalt {
+		return p, fmt.Errorf("%w: argon2 salt", ErrUnsupportedHash)
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) < argon2MinKey || len(p.key) > argon2MaxKey {
+		return p, fmt.Errorf("%w: argon2 hash", ErrUnsupportedHash)
+	}
+	return p, nil
+}
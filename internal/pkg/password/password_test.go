@@ -0,0 +1,119 @@
+package password_test
+
+import (
+	"SSO/internal/pkg/password"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+var (
+	salt = []byte("0123456789abcdef")
+	b64  = base64.RawStdEncoding.EncodeToString
+)
+
+// phc formats an argon2 hash of pass the way parseArgon2 expects it.
+func phc(variant, pass string, m, t uint32, p uint8) string {
+	var key []byte
+	if variant == "argon2i" {
+		key = argon2.Key([]byte(pass), salt, t, m, p, 32)
+	} else {
+		key = argon2.IDKey([]byte(pass), salt, t, m, p, 32)
+	}
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", variant, argon2.Version, m, t, p, b64(salt), b64(key))
+}
+
+func TestCompare(t *testing.T) {
+	hashed, err := password.Hash("secret")
+	require.NoError(t, err)
+	minCost, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		hash    string
+		pass    string
+		wantErr error
+	}{
+		{name: "bcrypt", hash: string(hashed), pass: "secret"},
+		{name: "bcrypt mismatch", hash: string(hashed), pass: "Secret", wantErr: password.ErrMismatch},
+		{name: "bcrypt $2y$", hash: "$2y$" + strings.TrimPrefix(string(minCost), "$2a$"), pass: "secret"},
+		{name: "argon2id", hash: phc("argon2id", "secret", 64, 1, 1), pass: "secret"},
+		{name: "argon2id mismatch", hash: phc("argon2id", "secret", 64, 1, 1), pass: "secret ", wantErr: password.ErrMismatch},
+		{name: "argon2i", hash: phc("argon2i", "secret", 64, 2, 2), pass: "secret"},
+		{name: "argon2 over memory bound", hash: phc("argon2id", "secret", 256*1024+1, 1, 1), pass: "secret", wantErr: password.ErrUnsupportedHash},
+		{name: "plain text", hash: "secret", pass: "secret", wantErr: password.ErrUnsupportedHash},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := password.Compare([]byte(tt.hash), tt.pass)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key := b64(make([]byte, 32))
+	params := func(m, t, p string) string {
+		return fmt.Sprintf("$argon2id$v=19$m=%s,t=%s,p=%s$%s$%s", m, t, p, b64(salt), key)
+	}
+	valid, err := password.Hash("secret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		hash  string
+		valid bool
+	}{
+		{name: "bcrypt", hash: string(valid), valid: true},
+		{name: "bcrypt truncated", hash: string(valid[:20])},
+		{name: "bcrypt unknown prefix", hash: "$2x$" + string(valid[4:])},
+		{name: "argon2id", hash: params("65536", "3", "4"), valid: true},
+		{name: "argon2 at the bounds", hash: params("262144", "10", "16"), valid: true},
+		{name: "argon2 minimal memory", hash: params("32", "1", "4"), valid: true},
+		{name: "empty", hash: ""},
+		{name: "unknown variant", hash: strings.Replace(params("64", "1", "1"), "argon2id", "argon2d", 1)},
+		{name: "unknown version", hash: strings.Replace(params("64", "1", "1"), "v=19", "v=16", 1)},
+		{name: "missing field", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s", key)},
+		{name: "extra field", hash: params("64", "1", "1") + "$x"},
+		{name: "no leading $", hash: strings.TrimPrefix(params("64", "1", "1"), "$")},
+		{name: "parameters out of order", hash: fmt.Sprintf("$argon2id$v=19$t=1,m=64,p=1$%s$%s", b64(salt), key)},
+		{name: "trailing parameter", hash: params("64", "1", "1,x=1")},
+		{name: "negative memory", hash: params("-64", "1", "1")},
+		{name: "memory over bound", hash: params("262145", "1", "1")},
+		{name: "memory overflowing uint32", hash: params("4294967296", "1", "1")},
+		{name: "memory under 8 KiB per thread", hash: params("31", "1", "4")},
+		{name: "zero time", hash: params("64", "0", "1")},
+		{name: "time over bound", hash: params("64", "11", "1")},
+		{name: "zero threads", hash: params("64", "1", "0")},
+		{name: "threads over bound", hash: params("1024", "1", "17")},
+		{name: "threads overflowing uint8", hash: params("65536", "1", "256")},
+		{name: "padded salt", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s", base64.StdEncoding.EncodeToString(salt[:10]), key)},
+		{name: "short salt", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s", b64(salt[:7]), key)},
+		{name: "long salt", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s", b64(make([]byte, 65)), key)},
+		{name: "empty hash", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$", b64(salt))},
+		{name: "short hash", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s", b64(salt), b64(make([]byte, 15)))},
+		{name: "long hash", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s", b64(salt), b64(make([]byte, 65)))},
+		{name: "hash not base64", hash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s", b64(salt), "!!!!")},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := password.Validate([]byte(tt.hash))
+			if tt.valid {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, password.ErrUnsupportedHash)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Package reqmeta carries per-request metadata such as the request id, the
+// acting principal and the client's address through the context.
+package reqmeta
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+)
+
+const (
+	RequestIdKey = "x-request-id"
+	// OnBehalfOfKey is the metadata naming who the caller acts on behalf of, such as
+	// the end user of an app's admin panel. It is taken as given, never as the actor.
+	OnBehalfOfKey = "x-actor"
+)
+
+type Meta struct {
+	RequestId string
+	// Actor is the authenticated principal: "app:<client id>" for calls with an
+	// app key, "admin-key" for calls with the admin key, "admin:<login>" in the console.
+	Actor string
+	// OnBehalfOf is who the caller says it acts for, unverified.
+	OnBehalfOf string
+	// IP is the address of the directly connected client, proxies aren't looked through.
+	IP        string
+	UserAgent string
+}
+
+type ctxKey struct{}
+
+func With(ctx context.Context, m Meta) context.Context {
+	return context.WithValue(ctx, ctxKey{}, m)
+}
+
+func From(ctx context.Context) Meta {
+	m, _ := ctx.Value(ctxKey{}).(Meta)
+	return m
+}
+
+// WithActor returns a copy of ctx whose metadata has actor replaced.
+func WithActor(ctx context.Context, actor string) context.Context {
+	m := From(ctx)
+	m.Actor = actor
+	return With(ctx, m)
+}
+
+func NewRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Host returns the host of a host:port address, or addr itself when it has no port.
+func Host(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
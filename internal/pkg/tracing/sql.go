@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// Database systems of SQL.
+var (
+	DBMySQL    = semconv.DBSystemMySQL
+	DBPostgres = semconv.DBSystemPostgreSQL
+	DBSQLite   = semconv.DBSystemSqlite
+)
+
+// SQLExecutor runs queries, like *sql.DB and *sql.Tx.
+type SQLExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQL wraps e to run every query in a client span of its own, named after the
+// statement's operation. The span of QueryContext ends when the query returns,
+// before its rows are read. Arguments aren't recorded, only the statement.
+func SQL(system attribute.KeyValue, e SQLExecutor) SQLExecutor {
+	return sqlExecutor{system: system, next: e}
+}
+
+type sqlExecutor struct {
+	system attribute.KeyValue
+	next   SQLExecutor
+}
+
+func (e sqlExecutor) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := e.start(ctx, query)
+	res, err := e.next.ExecContext(ctx, query, args...)
+	endSQL(span, err)
+	return res, err
+}
+
+func (e sqlExecutor) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := e.start(ctx, query)
+	rows, err := e.next.QueryContext(ctx, query, args...)
+	endSQL(span, err)
+	return rows, err
+}
+
+func (e sqlExecutor) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := e.start(ctx, query)
+	row := e.next.QueryRowContext(ctx, query, args...)
+	// sql.ErrNoRows only shows when the row is scanned, and isn't a failure.
+	endSQL(span, row.Err())
+	return row
+}
+
+func (e sqlExecutor) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(operation)
+	return tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(e.system, semconv.DBOperation(operation), semconv.DBStatement(query)),
+	)
+}
+
+func endSQL(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
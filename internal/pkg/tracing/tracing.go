@@ -0,0 +1,70 @@
+// Package tracing sets up OpenTelemetry tracing and instruments the gRPC server
+// and SQL calls. Services start their spans with the global tracer provider.
+package tracing
+
+import (
+	"SSO/internal/config"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"os"
+)
+
+// Exporters of TracingConfig.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+const instrumentationName = "SSO/internal/pkg/tracing"
+
+// Setup installs the W3C trace context and baggage propagators and, unless the
+// exporter is none, a global tracer provider exporting spans to it. The returned
+// func flushes the spans not exported yet and stops the exporter.
+func Setup(ctx context.Context, cnf config.TracingConfig) (shutdown func(context.Context) error, err error) {
+	const op = "tracing.Setup"
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch cnf.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		// Unset options fall back to the OTEL_EXPORTER_OTLP_* environment variables.
+		var opts []otlptracegrpc.Option
+		if cnf.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cnf.Endpoint))
+		}
+		if cnf.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("%s: unknown exporter %q, expected otlp, stdout or none", op, cnf.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cnf.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// Traces continued from a caller keep the caller's sampling decision.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cnf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
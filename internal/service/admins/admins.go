@@ -0,0 +1,297 @@
+// Package admins manages the accounts and sessions of the admin console.
+package admins
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/password"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenBytes        = 32
+	minPasswordLength = 8
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid login or password")
+	ErrNoSession           = errors.New("no admin session")
+	ErrAlreadyBootstrapped = errors.New("admins already exist")
+	ErrInvalidLogin        = errors.New("invalid login")
+	ErrInvalidRole         = errors.New("invalid admin role")
+	ErrWeakPassword        = errors.New("password is too short")
+	ErrLastOwner           = errors.New("the last owner can't be removed or demoted")
+)
+
+type Admins struct {
+	l          *slog.Logger
+	tx         storage.Transactor
+	admins     storage.AdminStorage
+	sessions   storage.AdminSessionStorage
+	sessionTTL time.Duration
+}
+
+// New creates the admins service. Sessions last sessionTTL from sign-in.
+func New(l *slog.Logger, tx storage.Transactor, admins storage.AdminStorage, sessions storage.AdminSessionStorage, sessionTTL time.Duration) *Admins {
+	return &Admins{
+		l:          l,
+		tx:         tx,
+		admins:     admins,
+		sessions:   sessions,
+		sessionTTL: sessionTTL,
+	}
+}
+
+// Bootstrap creates the first admin, an owner. It fails with ErrAlreadyBootstrapped
+// once there is any admin: the others are created by owners in the console. The
+// bootstrap is claimed in the transaction creating the admin, so of concurrent
+// bootstraps only one creates an owner.
+func (a *Admins) Bootstrap(ctx context.Context, login string, pass string) (models.Admin, error) {
+	var admin models.Admin
+	err := a.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := a.admins.ClaimBootstrap(ctx, time.Now()); err != nil {
+			if errors.Is(err, storageErrors.ErrAdminsBootstrapped) {
+				return ErrAlreadyBootstrapped
+			}
+			return err
+		}
+		list, err := a.admins.List(ctx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 0 {
+			return ErrAlreadyBootstrapped
+		}
+		admin, err = a.Create(ctx, login, pass, models.AdminOwner)
+		return err
+	})
+	return admin, err
+}
+
+// Create creates an admin with the given role. A taken login is reported as
+// storageErrors.ErrAdminExists.
+func (a *Admins) Create(ctx context.Context, login string, pass string, role string) (models.Admin, error) {
+	const op = "service.admins.Create"
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return models.Admin{}, ErrInvalidLogin
+	}
+	if !models.ValidAdminRole(role) {
+		return models.Admin{}, ErrInvalidRole
+	}
+	if len(pass) < minPasswordLength {
+		return models.Admin{}, fmt.Errorf("%w: at least %d characters are required", ErrWeakPassword, minPasswordLength)
+	}
+	hash, err := password.Hash(pass)
+	if err != nil {
+		return models.Admin{}, fmt.Errorf("%s: %w", op, err)
+	}
+	admin := models.Admin{Login: login, PasswordHash: hash, Role: role, CreatedAt: time.Now()}
+	admin.Id, err = a.admins.Save(ctx, admin)
+	if err != nil {
+		if !errors.Is(err, storageErrors.ErrAdminExists) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return models.Admin{}, err
+	}
+	a.l.Info("admin created", slog.String("login", login), slog.String("role", role))
+	return admin, nil
+}
+
+// Login checks the admin's password and starts a session. The returned token
+// identifies it and is only available here: the storage keeps just its hash.
+func (a *Admins) Login(ctx context.Context, login string, pass string) (string, models.AdminSession, error) {
+	const op = "service.admins.Login"
+	// Expired sessions are only removed here, sign-ins being rare enough.
+	if _, err := a.sessions.DeleteExpired(ctx, time.Now()); err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+	}
+	admin, err := a.admins.GetByLogin(ctx, login)
+	if err != nil {
+		if !errors.Is(err, storageErrors.ErrAdminNotFound) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+			return "", models.AdminSession{}, err
+		}
+		// Spend the time of a comparison so unknown logins can't be told apart.
+		_ = password.Compare(dummyHash(), pass)
+		return "", models.AdminSession{}, ErrInvalidCredentials
+	}
+	if err := password.Compare(admin.PasswordHash, pass); err != nil {
+		if !errors.Is(err, password.ErrMismatch) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return "", models.AdminSession{}, ErrInvalidCredentials
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", models.AdminSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", models.AdminSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+	now := time.Now()
+	session := models.AdminSession{
+		TokenHash: hashToken(token),
+		AdminId:   admin.Id,
+		CSRFToken: csrf,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.sessionTTL),
+	}
+	if err := a.sessions.Save(ctx, session); err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return "", models.AdminSession{}, err
+	}
+	a.l.Info("admin signed in", slog.String("login", admin.Login))
+	return token, session, nil
+}
+
+// Authenticate returns the admin and the session of token, or ErrNoSession when
+// there is no such session or it expired.
+func (a *Admins) Authenticate(ctx context.Context, token string) (models.Admin, models.AdminSession, error) {
+	const op = "service.admins.Authenticate"
+	session, err := a.sessions.Get(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storageErrors.ErrAdminSessionNotFound) {
+			return models.Admin{}, models.AdminSession{}, ErrNoSession
+		}
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return models.Admin{}, models.AdminSession{}, err
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		return models.Admin{}, models.AdminSession{}, ErrNoSession
+	}
+	// The admin is read on every request, so role changes apply at once.
+	admin, err := a.admins.GetById(ctx, session.AdminId)
+	if err != nil {
+		if errors.Is(err, storageErrors.ErrAdminNotFound) {
+			return models.Admin{}, models.AdminSession{}, ErrNoSession
+		}
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return models.Admin{}, models.AdminSession{}, err
+	}
+	return admin, session, nil
+}
+
+// Logout ends the session of token.
+func (a *Admins) Logout(ctx context.Context, token string) error {
+	const op = "service.admins.Logout"
+	if err := a.sessions.Delete(ctx, hashToken(token)); err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	return nil
+}
+
+func (a *Admins) List(ctx context.Context) ([]models.Admin, error) {
+	const op = "service.admins.List"
+	list, err := a.admins.List(ctx)
+	if err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, err
+	}
+	return list, nil
+}
+
+// SetRole changes the admin's role. The last owner can't be demoted.
+func (a *Admins) SetRole(ctx context.Context, id int64, role string) error {
+	const op = "service.admins.SetRole"
+	if !models.ValidAdminRole(role) {
+		return ErrInvalidRole
+	}
+	err := a.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if role != models.AdminOwner {
+			if err := a.keepOwner(ctx, id); err != nil {
+				return err
+			}
+		}
+		return a.admins.UpdateRole(ctx, id, role)
+	})
+	if err != nil {
+		if !isExpected(err) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return err
+	}
+	a.l.Info("admin role changed", slog.Int64("id", id), slog.String("role", role))
+	return nil
+}
+
+// Delete deletes the admin and ends its sessions. The last owner can't be deleted.
+func (a *Admins) Delete(ctx context.Context, id int64) error {
+	const op = "service.admins.Delete"
+	err := a.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := a.keepOwner(ctx, id); err != nil {
+			return err
+		}
+		return a.admins.Delete(ctx, id)
+	})
+	if err != nil {
+		if !isExpected(err) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return err
+	}
+	a.l.Info("admin deleted", slog.Int64("id", id))
+	return nil
+}
+
+// keepOwner returns ErrLastOwner when id is the only owner.
+func (a *Admins) keepOwner(ctx context.Context, id int64) error {
+	list, err := a.admins.List(ctx)
+	if err != nil {
+		return err
+	}
+	owners, isOwner := 0, false
+	for _, admin := range list {
+		if admin.Role == models.AdminOwner {
+			owners++
+			isOwner = isOwner || admin.Id == id
+		}
+	}
+	if isOwner && owners == 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func isExpected(err error) bool {
+	return errors.Is(err, ErrLastOwner) || errors.Is(err, storageErrors.ErrAdminNotFound)
+}
+
+var (
+	dummyOnce sync.Once
+	dummy     []byte
+)
+
+// dummyHash is a password hash no password is checked against for real.
+func dummyHash() []byte {
+	dummyOnce.Do(func() {
+		dummy, _ = password.Hash("no admin has this password")
+	})
+	return dummy
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
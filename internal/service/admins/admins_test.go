@@ -0,0 +1,63 @@
+package admins_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/admins"
+	"SSO/internal/storage"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newService(s *storage.Storage) *admins.Admins {
+	return admins.New(slog.New(slog.NewTextHandler(io.Discard, nil)), s.Tx, s.Admins, s.AdminSessions, time.Hour)
+}
+
+func TestBootstrap(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemory()
+	a := newService(s)
+
+	_, err := a.Bootstrap(ctx, "root", "short")
+	require.ErrorIs(t, err, admins.ErrWeakPassword)
+	_, err = a.Bootstrap(ctx, " ", "password")
+	require.ErrorIs(t, err, admins.ErrInvalidLogin)
+
+	// Of concurrent bootstraps exactly one creates an owner, a failed one doesn't count.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created []models.Admin
+	)
+	for i := 0; i < 8; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			admin, err := a.Bootstrap(ctx, fmt.Sprintf("root%d", i), "password")
+			if err != nil {
+				require.ErrorIs(t, err, admins.ErrAlreadyBootstrapped)
+				return
+			}
+			mu.Lock()
+			created = append(created, admin)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	require.Len(t, created, 1)
+	require.Equal(t, models.AdminOwner, created[0].Role)
+	list, err := a.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	// Removing every admin behind the service doesn't open the bootstrap again.
+	require.NoError(t, s.Admins.Delete(ctx, created[0].Id))
+	_, err = a.Bootstrap(ctx, "root", "password")
+	require.ErrorIs(t, err, admins.ErrAlreadyBootstrapped)
+}
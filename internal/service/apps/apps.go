@@ -2,61 +2,472 @@ package apps
 
 import (
 	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
 	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"bytes"
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
 	"log/slog"
-	"strconv"
-	"sync"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// legacyClientIdPrefix starts the client ids the migration gave apps created before client ids.
+const legacyClientIdPrefix = "legacy-"
+
+const (
+	clientIdBytes   = 8
+	secretBytes     = 32
+	signingKeyBytes = 32
+)
+
+// DeletedApps returns DefaultDeletedAppsLimit records when not given a limit, and
+// never more than maxDeletedAppsLimit.
+const (
+	DefaultDeletedAppsLimit = 50
+	maxDeletedAppsLimit     = 500
+)
+
+// secretUsageResolution bounds how often the use of a secret is written to the storage.
+const secretUsageResolution = time.Minute
+
+var (
+	ErrInvalidApp         = errors.New("invalid app")
+	ErrInvalidGracePeriod = errors.New("invalid grace period")
+	ErrPrevSecret         = errors.New("previous secret can't rotate")
+	ErrAppHasUsers        = errors.New("app has users")
+)
+
+var tracer = otel.Tracer("SSO/internal/service/apps")
+
 type Apps struct {
 	l           *slog.Logger
+	tx          storage.Transactor
 	appsStorage storage.AppsStorage
+	archive     storage.AppArchiveStorage
+	gracePeriod time.Duration
 }
 
-func New(l *slog.Logger, appsStorage storage.AppsStorage) *Apps {
+// New creates the apps service. gracePeriod is how long a rotated secret keeps
+// working when RotateSecret isn't given one.
+func New(l *slog.Logger, tx storage.Transactor, appsStorage storage.AppsStorage, archive storage.AppArchiveStorage, gracePeriod time.Duration) *Apps {
 	return &Apps{
 		l:           l,
+		tx:          tx,
 		appsStorage: appsStorage,
+		archive:     archive,
+		gracePeriod: gracePeriod,
 	}
 }
 
-func (a *Apps) NewApp(ctx context.Context) ([]byte, error) {
-	key := GenerateUniqueString()
-	if err := a.appsStorage.Save(ctx, key); err != nil {
+type RotateOptions struct {
+	// GracePeriod is how long the replaced secret keeps working. Zero uses the default.
+	GracePeriod time.Duration
+	// Revoke makes the replaced secret, and the tokens signed with the replaced key,
+	// stop working at once, e.g. when the secret leaked.
+	Revoke bool
+}
+
+// DeleteOptions choose what DeleteApp does with an app that still has users.
+type DeleteOptions struct {
+	// Cascade deletes the users together with the app. Without it an app with
+	// users isn't deleted and DeleteApp returns ErrAppHasUsers.
+	Cascade bool
+	// DryRun only reports what would be deleted.
+	DryRun bool
+}
+
+// AppUpdate holds the fields UpdateApp changes, nil ones are kept.
+type AppUpdate struct {
+	Name           *string
+	Description    *string
+	Owner          *string
+	LogoURL        *string
+	RedirectURIs   *[]string
+	AllowedOrigins *[]string
+	Settings       *models.AppSettings
+}
+
+// NewApp creates an app with the descriptive fields and settings of info and returns
+// it with its credential. The credential is only available here: the storage keeps
+// just a hash of the secret in it. Invalid fields are reported as ErrInvalidApp.
+func (a *Apps) NewApp(ctx context.Context, info models.App) (models.App, string, error) {
+	const op = "service.apps.NewApp"
+	ctx, span := tracer.Start(ctx, "apps.NewApp")
+	defer span.End()
+	if err := validate(info); err != nil {
+		return models.App{}, "", err
+	}
+	clientId, err := randomBytes(clientIdBytes)
+	if err != nil {
+		return models.App{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return models.App{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	signingKey, err := randomBytes(signingKeyBytes)
+	if err != nil {
+		return models.App{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	app := info
+	app.ClientId = hex.EncodeToString(clientId)
+	app.SecretHash = hashSecret(secret)
+	app.SigningKey = signingKey
+	app.CreatedAt = time.Now()
+	app.UpdatedAt = app.CreatedAt
+	app.Id, err = a.appsStorage.Save(ctx, app)
+	if err != nil {
 		a.l.Error(err.Error())
-		return nil, err
+		return models.App{}, "", err
+	}
+	return app, Credential(app.ClientId, secret), nil
+}
+
+// RotateSecret gives the app a new secret and signing key and returns the app with its
+// new credential. The old secret keeps working for the grace period, and so do the
+// tokens signed with the old key. The app's usage times tell whether clients still
+// use the old secret. Rotating again within the grace period ends the one of the
+// secret rotated before.
+func (a *Apps) RotateSecret(ctx context.Context, clientId string, opts RotateOptions) (models.App, string, error) {
+	const op = "service.apps.RotateSecret"
+	ctx, span := tracer.Start(ctx, "apps.RotateSecret")
+	defer span.End()
+	if opts.GracePeriod < 0 {
+		return models.App{}, "", ErrInvalidGracePeriod
+	}
+	grace := opts.GracePeriod
+	if grace == 0 {
+		grace = a.gracePeriod
+	}
+	if opts.Revoke {
+		grace = 0
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return models.App{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	signingKey, err := randomBytes(signingKeyBytes)
+	if err != nil {
+		return models.App{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	now := time.Now()
+	if err := a.appsStorage.RotateSecret(ctx, clientId, hashSecret(secret), signingKey, now, now.Add(grace)); err != nil {
+		if !errors.Is(err, storageErrors.ErrAppNotFound) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return models.App{}, "", err
+	}
+	app, err := a.appsStorage.GetByClientId(ctx, clientId)
+	if err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return models.App{}, "", err
+	}
+	a.l.Info("app secret rotated", slog.String("client_id", clientId), slog.Time("prev_secret_expires_at", app.PrevSecretExpiresAt))
+	// The old credential of apps created before client ids has no client id, the new one has.
+	return app, Credential(clientId, secret), nil
+}
+
+// UpdateApp changes the app's descriptive fields and settings. Invalid ones are
+// reported as ErrInvalidApp.
+func (a *Apps) UpdateApp(ctx context.Context, clientId string, upd AppUpdate) (models.App, error) {
+	const op = "service.apps.UpdateApp"
+	ctx, span := tracer.Start(ctx, "apps.UpdateApp")
+	defer span.End()
+	app, err := a.appsStorage.GetByClientId(ctx, clientId)
+	if err != nil {
+		if !errors.Is(err, storageErrors.ErrAppNotFound) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return models.App{}, err
+	}
+	if upd.Name != nil {
+		app.Name = *upd.Name
+	}
+	if upd.Description != nil {
+		app.Description = *upd.Description
+	}
+	if upd.Owner != nil {
+		app.Owner = *upd.Owner
+	}
+	if upd.LogoURL != nil {
+		app.LogoURL = *upd.LogoURL
+	}
+	if upd.RedirectURIs != nil {
+		app.RedirectURIs = *upd.RedirectURIs
+	}
+	if upd.AllowedOrigins != nil {
+		app.AllowedOrigins = *upd.AllowedOrigins
+	}
+	if upd.Settings != nil {
+		app.Settings = *upd.Settings
+	}
+	if err := validate(app); err != nil {
+		return models.App{}, err
+	}
+	app.UpdatedAt = time.Now()
+	if err := a.appsStorage.Update(ctx, app); err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return models.App{}, err
+	}
+	return app, nil
+}
+
+// DeleteApp deletes the app and archives its record, which it returns. The users of
+// the app, their permissions, profiles and access requests go with it when opts.Cascade
+// is set, and so do the tokens they hold, as the app's signing key is deleted. The
+// permission audit trail is kept. A dry run returns the record without deleting or
+// archiving anything, whatever the app has.
+func (a *Apps) DeleteApp(ctx context.Context, clientId string, opts DeleteOptions) (models.DeletedApp, error) {
+	const op = "service.apps.DeleteApp"
+	ctx, span := tracer.Start(ctx, "apps.DeleteApp")
+	defer span.End()
+	var deleted models.DeletedApp
+	err := a.tx.WithinTx(ctx, func(ctx context.Context) error {
+		app, err := a.appsStorage.GetByClientId(ctx, clientId)
+		if err != nil {
+			return err
+		}
+		data, err := a.appsStorage.CountData(ctx, app.Id)
+		if err != nil {
+			return err
+		}
+		meta := reqmeta.From(ctx)
+		deleted = models.DeletedApp{
+			App:        app,
+			Data:       data,
+			Cascade:    opts.Cascade,
+			DeletedBy:  meta.Actor,
+			RequestId:  meta.RequestId,
+			OnBehalfOf: meta.OnBehalfOf,
+		}
+		deleted.App.SecretHash, deleted.App.SigningKey, deleted.App.PrevSecretHash, deleted.App.PrevSigningKey = nil, nil, nil, nil
+		if opts.DryRun {
+			return nil
+		}
+		if data.Users != 0 && !opts.Cascade {
+			return ErrAppHasUsers
+		}
+		deleted.DeletedAt = time.Now()
+		if err := a.appsStorage.DeleteByClientId(ctx, clientId); err != nil {
+			return err
+		}
+		return a.archive.Save(ctx, deleted)
+	})
+	if err != nil {
+		if !errors.Is(err, storageErrors.ErrAppNotFound) && !errors.Is(err, ErrAppHasUsers) {
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return models.DeletedApp{}, err
 	}
-	return key, nil
+	if !opts.DryRun {
+		a.l.Info("app deleted", slog.String("client_id", clientId), slog.Bool("cascade", opts.Cascade),
+			slog.Int64("users", deleted.Data.Users), slog.String("actor", deleted.DeletedBy))
+	}
+	return deleted, nil
 }
 
-func (a *Apps) DeleteApp(ctx context.Context, key []byte) error {
-	return a.appsStorage.DeleteByKey(ctx, key)
+// DeletedApps returns up to limit archived records of deleted apps, newest first,
+// only those of clientId when it is set.
+func (a *Apps) DeletedApps(ctx context.Context, clientId string, limit int) ([]models.DeletedApp, error) {
+	const op = "service.apps.DeletedApps"
+	ctx, span := tracer.Start(ctx, "apps.DeletedApps")
+	defer span.End()
+	if limit <= 0 {
+		limit = DefaultDeletedAppsLimit
+	}
+	if limit > maxDeletedAppsLimit {
+		limit = maxDeletedAppsLimit
+	}
+	list, err := a.archive.List(ctx, clientId, limit)
+	if err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, err
+	}
+	return list, nil
 }
 
 func (a *Apps) TestOnExist(ctx context.Context, key []byte) bool {
-	return a.appsStorage.TestOnExist(ctx, key)
+	ctx, span := tracer.Start(ctx, "apps.TestOnExist")
+	defer span.End()
+	_, err := a.GetByKey(ctx, key)
+	return err == nil
+}
+
+// RotateOwnSecret rotates the secret of the app key authenticates. Only the current
+// secret can, so a replaced secret can't take the app over during its grace period.
+func (a *Apps) RotateOwnSecret(ctx context.Context, key []byte, opts RotateOptions) (models.App, string, error) {
+	ctx, span := tracer.Start(ctx, "apps.RotateOwnSecret")
+	defer span.End()
+	app, previous, err := a.authenticate(ctx, key)
+	if err != nil {
+		return models.App{}, "", err
+	}
+	if previous {
+		return models.App{}, "", ErrPrevSecret
+	}
+	return a.RotateSecret(ctx, app.ClientId, opts)
+}
+
+// GetByKey returns the app the credential key belongs to, or storageErrors.ErrAppNotFound
+// when it doesn't match any app. The previous secret of a rotated app matches until it expires.
+func (a *Apps) GetByKey(ctx context.Context, key []byte) (models.App, error) {
+	ctx, span := tracer.Start(ctx, "apps.GetByKey")
+	defer span.End()
+	app, _, err := a.authenticate(ctx, key)
+	return app, err
+}
+
+// authenticate is GetByKey also reporting whether key holds the previous secret.
+func (a *Apps) authenticate(ctx context.Context, key []byte) (models.App, bool, error) {
+	var (
+		app    models.App
+		secret []byte
+		err    error
+	)
+	if clientId, s, ok := bytes.Cut(key, []byte(".")); ok {
+		app, err = a.appsStorage.GetByClientId(ctx, string(clientId))
+		secret = s
+	} else {
+		// Apps created before client ids authenticate with the bare secret.
+		app, err = a.appsStorage.GetBySecretHash(ctx, hashSecret(string(key)))
+		secret = key
+		if err == nil && !strings.HasPrefix(app.ClientId, legacyClientIdPrefix) {
+			err = storageErrors.ErrAppNotFound
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, storageErrors.ErrAppNotFound) {
+			a.l.Error(err.Error())
+		}
+		return models.App{}, false, err
+	}
+
+	now := time.Now()
+	hash := hashSecret(string(secret))
+	switch {
+	case subtle.ConstantTimeCompare(hash, app.SecretHash) == 1:
+		a.secretUsed(ctx, app.ClientId, false, &app.SecretUsedAt, now)
+		return app, false, nil
+	case app.PrevSecretValid(now) && subtle.ConstantTimeCompare(hash, app.PrevSecretHash) == 1:
+		a.secretUsed(ctx, app.ClientId, true, &app.PrevSecretUsedAt, now)
+		return app, true, nil
+	}
+	return models.App{}, false, storageErrors.ErrAppNotFound
+}
+
+// secretUsed records the use of a secret in the storage and in usedAt, unless it was
+// recorded recently. Failing to record it doesn't fail the authentication.
+func (a *Apps) secretUsed(ctx context.Context, clientId string, previous bool, usedAt *time.Time, now time.Time) {
+	const op = "service.apps.secretUsed"
+	if now.Sub(*usedAt) < secretUsageResolution {
+		return
+	}
+	if err := a.appsStorage.SetSecretUsed(ctx, clientId, previous, now); err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return
+	}
+	*usedAt = now
+}
+
+// GetByClientId returns the app without checking its secret. It is for admin
+// surfaces that are trusted on their own.
+func (a *Apps) GetByClientId(ctx context.Context, clientId string) (models.App, error) {
+	ctx, span := tracer.Start(ctx, "apps.GetByClientId")
+	defer span.End()
+	return a.appsStorage.GetByClientId(ctx, clientId)
 }
 
 func (a *Apps) GetAll(ctx context.Context) ([]*models.App, error) {
+	ctx, span := tracer.Start(ctx, "apps.GetAll")
+	defer span.End()
 	return a.appsStorage.GetAll(ctx)
 }
 
-var mu sync.Mutex
+// ByClientId resolves apps by client id alone in place of the credential, for
+// admin surfaces such as the web console and the CLI.
+type ByClientId struct {
+	Apps *Apps
+}
+
+func (b ByClientId) GetByKey(ctx context.Context, clientId []byte) (models.App, error) {
+	return b.Apps.GetByClientId(ctx, string(clientId))
+}
+
+// validate checks the descriptive fields and settings of app.
+func validate(app models.App) error {
+	if app.LogoURL != "" {
+		if err := checkURL(app.LogoURL); err != nil {
+			return fmt.Errorf("%w: logo url: %s", ErrInvalidApp, err.Error())
+		}
+	}
+	for _, uri := range app.RedirectURIs {
+		if err := checkURL(uri); err != nil {
+			return fmt.Errorf("%w: redirect uri %q: %s", ErrInvalidApp, uri, err.Error())
+		}
+	}
+	for _, origin := range app.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("%w: allowed origin %q: must be scheme://host[:port]", ErrInvalidApp, origin)
+		}
+	}
+	if app.Settings.TokenTTL < 0 {
+		return fmt.Errorf("%w: token ttl must not be negative", ErrInvalidApp)
+	}
+	if app.Settings.PasswordPolicy.MinLength < 0 {
+		return fmt.Errorf("%w: password min length must not be negative", ErrInvalidApp)
+	}
+	return nil
+}
+
+// checkURL accepts absolute URLs without a fragment.
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return errors.New("must be absolute")
+	}
+	if u.Fragment != "" {
+		return errors.New("must not have a fragment")
+	}
+	return nil
+}
 
-func GenerateUniqueString() []byte {
-	mu.Lock()
-	num := time.Now().UnixNano()
-	mu.Unlock()
-	hash := sha256.New()
+// Credential joins the client id and the secret into the key apps authenticate with.
+func Credential(clientId string, secret string) string {
+	return clientId + "." + secret
+}
 
-	hash.Write([]byte(strconv.Itoa(int(num))))
-	b := hash.Sum(nil)
+func newSecret() (string, error) {
+	secret, err := randomBytes(secretBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
 
-	buf := make([]byte, len(b)*2)
-	hex.Encode(buf, b)
-	return buf
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
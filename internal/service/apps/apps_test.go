@@ -0,0 +1,213 @@
+package apps_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
+	"SSO/internal/service/apps"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"crypto/sha256"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newService(t *testing.T) (*apps.Apps, *storage.Storage) {
+	t.Helper()
+	s := storage.NewMemory()
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return apps.New(l, s.Tx, s.AppStorage, s.AppArchive, time.Hour), s
+}
+
+func TestNewAppValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		app   models.App
+		valid bool
+	}{
+		{name: "bare", app: models.App{Name: "app"}, valid: true},
+		{name: "full", valid: true, app: models.App{
+			Name:           "app",
+			LogoURL:        "https://example.com/logo.png",
+			RedirectURIs:   []string{"https://example.com/callback", "myapp://callback?x=1"},
+			AllowedOrigins: []string{"https://example.com", "http://localhost:8080/"},
+			Settings:       models.AppSettings{TokenTTL: time.Minute, PasswordPolicy: models.PasswordPolicy{MinLength: 8}},
+		}},
+		{name: "relative logo url", app: models.App{LogoURL: "/logo.png"}},
+		{name: "redirect uri with fragment", app: models.App{RedirectURIs: []string{"https://example.com/cb#x"}}},
+		{name: "redirect uri without host", app: models.App{RedirectURIs: []string{"https:///cb"}}},
+		{name: "origin with path", app: models.App{AllowedOrigins: []string{"https://example.com/app"}}},
+		{name: "origin with query", app: models.App{AllowedOrigins: []string{"https://example.com?x=1"}}},
+		{name: "origin without scheme", app: models.App{AllowedOrigins: []string{"example.com"}}},
+		{name: "negative token ttl", app: models.App{Settings: models.AppSettings{TokenTTL: -time.Second}}},
+		{name: "negative min length", app: models.App{Settings: models.AppSettings{PasswordPolicy: models.PasswordPolicy{MinLength: -1}}}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, s := newService(t)
+			app, credential, err := a.NewApp(ctx, tt.app)
+			if !tt.valid {
+				require.ErrorIs(t, err, apps.ErrInvalidApp)
+				all, err := s.AppStorage.GetAll(ctx)
+				require.NoError(t, err)
+				require.Empty(t, all, "invalid app saved")
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(credential, app.ClientId+"."))
+			got, err := a.GetByKey(ctx, []byte(credential))
+			require.NoError(t, err)
+			require.Equal(t, app.Id, got.Id)
+			require.Equal(t, tt.app.Settings, got.Settings)
+		})
+	}
+}
+
+func TestGetByKey(t *testing.T) {
+	ctx := context.Background()
+	a, s := newService(t)
+	app, credential, err := a.NewApp(ctx, models.App{Name: "app"})
+	require.NoError(t, err)
+	secret := strings.TrimPrefix(credential, app.ClientId+".")
+	sum := sha256.Sum256([]byte("legacy secret"))
+	legacyId, err := s.AppStorage.Save(ctx, models.App{ClientId: "legacy-1", SecretHash: sum[:], CreatedAt: time.Now()})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		key    string
+		wantId int32
+	}{
+		{name: "credential", key: credential, wantId: app.Id},
+		{name: "wrong secret", key: app.ClientId + ".wrong"},
+		{name: "secret of another client id", key: "legacy-1." + secret},
+		{name: "unknown client id", key: "unknown." + secret},
+		{name: "bare secret", key: secret},
+		{name: "empty", key: ""},
+		{name: "bare secret of a legacy app", key: "legacy secret", wantId: legacyId},
+		{name: "legacy app with its client id", key: "legacy-1.legacy secret", wantId: legacyId},
+	}
+	for _, tt := range tests {
+		got, err := a.GetByKey(ctx, []byte(tt.key))
+		if tt.wantId == 0 {
+			require.ErrorIs(t, err, storageErrors.ErrAppNotFound, tt.name)
+			require.False(t, a.TestOnExist(ctx, []byte(tt.key)), tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		require.Equal(t, tt.wantId, got.Id, tt.name)
+	}
+
+	got, err := a.GetByClientId(ctx, app.ClientId)
+	require.NoError(t, err)
+	require.False(t, got.SecretUsedAt.IsZero(), "use of the secret recorded")
+}
+
+func TestRotateSecret(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newService(t)
+	app, oldCredential, err := a.NewApp(ctx, models.App{Name: "app"})
+	require.NoError(t, err)
+
+	_, _, err = a.RotateSecret(ctx, app.ClientId, apps.RotateOptions{GracePeriod: -time.Second})
+	require.ErrorIs(t, err, apps.ErrInvalidGracePeriod)
+	_, _, err = a.RotateSecret(ctx, "unknown", apps.RotateOptions{})
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+
+	rotated, credential, err := a.RotateSecret(ctx, app.ClientId, apps.RotateOptions{})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Hour), rotated.PrevSecretExpiresAt, 5*time.Second, "default grace period")
+	require.NotEqual(t, app.SigningKey, rotated.SigningKey)
+	for _, key := range []string{oldCredential, credential} {
+		got, err := a.GetByKey(ctx, []byte(key))
+		require.NoError(t, err)
+		require.Equal(t, app.Id, got.Id)
+	}
+
+	// Only the current secret rotates the app's own.
+	_, _, err = a.RotateOwnSecret(ctx, []byte(oldCredential), apps.RotateOptions{})
+	require.ErrorIs(t, err, apps.ErrPrevSecret)
+	_, _, err = a.RotateOwnSecret(ctx, []byte("unknown.secret"), apps.RotateOptions{})
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	_, newCredential, err := a.RotateOwnSecret(ctx, []byte(credential), apps.RotateOptions{Revoke: true})
+	require.NoError(t, err)
+	for _, key := range []string{oldCredential, credential} {
+		_, err := a.GetByKey(ctx, []byte(key))
+		require.ErrorIs(t, err, storageErrors.ErrAppNotFound, "revoked")
+	}
+	_, err = a.GetByKey(ctx, []byte(newCredential))
+	require.NoError(t, err)
+}
+
+func TestUpdateApp(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newService(t)
+	app, _, err := a.NewApp(ctx, models.App{Name: "app", Owner: "team", RedirectURIs: []string{"https://example.com/cb"}})
+	require.NoError(t, err)
+
+	name := "renamed"
+	settings := models.AppSettings{RegistrationClosed: true}
+	updated, err := a.UpdateApp(ctx, app.ClientId, apps.AppUpdate{Name: &name, Settings: &settings})
+	require.NoError(t, err)
+	require.Equal(t, "renamed", updated.Name)
+	require.Equal(t, "team", updated.Owner, "nil fields are kept")
+	require.Equal(t, app.RedirectURIs, updated.RedirectURIs)
+	require.Equal(t, settings, updated.Settings)
+
+	uris := []string{"relative"}
+	_, err = a.UpdateApp(ctx, app.ClientId, apps.AppUpdate{Name: &name, RedirectURIs: &uris})
+	require.ErrorIs(t, err, apps.ErrInvalidApp)
+	got, err := a.GetByClientId(ctx, app.ClientId)
+	require.NoError(t, err)
+	require.Equal(t, app.RedirectURIs, got.RedirectURIs, "invalid update not stored")
+
+	_, err = a.UpdateApp(ctx, "unknown", apps.AppUpdate{Name: &name})
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+}
+
+func TestDeleteApp(t *testing.T) {
+	ctx := reqmeta.With(context.Background(), reqmeta.Meta{Actor: "admin:root", RequestId: "req-1"})
+	a, s := newService(t)
+	app, credential, err := a.NewApp(ctx, models.App{Name: "app"})
+	require.NoError(t, err)
+	require.NoError(t, s.UserStorage.Save(ctx, models.User{AppId: app.Id, Login: "alice", PasswordHash: []byte("hash"), CreatedAt: time.Now()}))
+
+	_, err = a.DeleteApp(ctx, "unknown", apps.DeleteOptions{})
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	_, err = a.DeleteApp(ctx, app.ClientId, apps.DeleteOptions{})
+	require.ErrorIs(t, err, apps.ErrAppHasUsers)
+
+	dry, err := a.DeleteApp(ctx, app.ClientId, apps.DeleteOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), dry.Data.Users)
+	require.True(t, dry.DeletedAt.IsZero())
+	require.Nil(t, dry.App.SecretHash, "credentials aren't returned")
+	_, err = a.GetByKey(ctx, []byte(credential))
+	require.NoError(t, err, "dry run deleted the app")
+
+	deleted, err := a.DeleteApp(ctx, app.ClientId, apps.DeleteOptions{Cascade: true})
+	require.NoError(t, err)
+	require.Equal(t, "admin:root", deleted.DeletedBy)
+	require.Equal(t, "req-1", deleted.RequestId)
+	require.True(t, deleted.Cascade)
+	_, err = a.GetByKey(ctx, []byte(credential))
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	_, err = s.UserStorage.Get(ctx, app.Id, "alice")
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+
+	archived, err := a.DeletedApps(ctx, app.ClientId, 0)
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	require.Equal(t, "app", archived[0].App.Name)
+	require.Nil(t, archived[0].App.SigningKey)
+	require.Equal(t, int64(1), archived[0].Data.Users)
+	archived, err = a.DeletedApps(ctx, "other", 0)
+	require.NoError(t, err)
+	require.Empty(t, archived)
+}
@@ -0,0 +1,176 @@
+// Package audit records authentication events to pluggable sinks and pages
+// through those kept in the database.
+package audit
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+const (
+	// DefaultPageSize is used when List is called without a page size.
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Field lengths events are cut to, the narrowest columns of any backend.
+const (
+	maxDetailLen    = 1024
+	maxUserAgentLen = 512
+)
+
+// Sink is where recorded events go.
+type Sink interface {
+	Write(ctx context.Context, event models.AuthEvent) error
+}
+
+type AppsProvider interface {
+	GetByKey(ctx context.Context, key []byte) (models.App, error)
+}
+
+type UserProvider interface {
+	Get(ctx context.Context, appId int32, login string) (models.User, error)
+}
+
+type Audit struct {
+	l            *slog.Logger
+	tx           storage.Transactor
+	sinks        []Sink
+	events       storage.AuthEventStorage
+	appsProvider AppsProvider
+	users        UserProvider
+}
+
+// New creates the service writing every event to each of sinks. List reads events
+// from the database, so it only finds them when a StorageSink is among sinks.
+func New(l *slog.Logger, tx storage.Transactor, events storage.AuthEventStorage, appsProvider AppsProvider, users UserProvider, sinks ...Sink) *Audit {
+	return &Audit{
+		l:            l,
+		tx:           tx,
+		sinks:        sinks,
+		events:       events,
+		appsProvider: appsProvider,
+		users:        users,
+	}
+}
+
+// Record writes event to every sink, filling in the time and the request's metadata.
+// Failing sinks are logged: the audit log never fails the operation it records.
+// Within a transaction, the event is written once it commits and dropped when it
+// rolls back, so no sink reports a change that didn't happen or joins the transaction.
+func (a *Audit) Record(ctx context.Context, event models.AuthEvent) {
+	const op = "service.audit.Record"
+	meta := reqmeta.From(ctx)
+	event.Actor = meta.Actor
+	event.OnBehalfOf = meta.OnBehalfOf
+	event.IP = meta.IP
+	event.UserAgent = truncate(meta.UserAgent, maxUserAgentLen)
+	event.RequestId = meta.RequestId
+	event.Detail = truncate(event.Detail, maxDetailLen)
+	event.CreatedAt = time.Now()
+	a.tx.AfterCommit(ctx, func(ctx context.Context) {
+		for _, sink := range a.sinks {
+			if err := sink.Write(ctx, event); err != nil {
+				a.l.Error(fmt.Errorf("%s: %w", op, err).Error(), slog.String("type", event.Type), slog.String("request_id", event.RequestId))
+			}
+		}
+	})
+}
+
+// Close closes the sinks that hold a file open, returning the first error.
+func (a *Audit) Close() error {
+	var first error
+	for _, sink := range a.sinks {
+		if c, ok := sink.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Query selects the events List returns. Login narrows them down to a user's,
+// following the user across renames. From and To are optional, To is exclusive.
+type Query struct {
+	Login     string
+	Type      string
+	From      time.Time
+	To        time.Time
+	PageSize  int
+	PageToken string
+}
+
+// List pages through the app's events, newest first. The returned token fetches
+// the next page and is empty on the last one.
+func (a *Audit) List(ctx context.Context, appKey []byte, q Query) ([]models.AuthEvent, string, error) {
+	const op = "service.audit.List"
+	app, err := a.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return nil, "", err
+	}
+	filter := models.AuthEventFilter{
+		AppId: app.Id,
+		Login: q.Login,
+		Type:  q.Type,
+		From:  q.From,
+		To:    q.To,
+		Limit: q.PageSize,
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageSize
+	}
+	if filter.Limit > MaxPageSize {
+		filter.Limit = MaxPageSize
+	}
+	if q.PageToken != "" {
+		filter.BeforeId, err = strconv.ParseInt(q.PageToken, 10, 64)
+		if err != nil || filter.BeforeId <= 0 {
+			return nil, "", ErrInvalidPageToken
+		}
+	}
+	if q.Login != "" {
+		user, err := a.users.Get(ctx, app.Id, q.Login)
+		switch {
+		case err == nil:
+			filter.UserId = user.Id
+		case !errors.Is(err, storageErrors.ErrUserNotFound):
+			a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+			return nil, "", err
+		}
+	}
+
+	events, err := a.events.List(ctx, filter)
+	if err != nil {
+		a.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, "", err
+	}
+	var next string
+	if len(events) == filter.Limit {
+		next = strconv.FormatInt(events[len(events)-1].Id, 10)
+	}
+	return events, next, nil
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
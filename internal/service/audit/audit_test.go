@@ -0,0 +1,52 @@
+package audit_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/audit"
+	"SSO/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRecordWaitsForCommit(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemory()
+	var out bytes.Buffer
+	a := audit.New(slog.New(slog.NewTextHandler(io.Discard, nil)), s.Tx, s.AuthEvents, nil, nil,
+		audit.NewStorageSink(s.AuthEvents), audit.NewJSONSink(&out))
+	stored := func() []models.AuthEvent {
+		events, err := s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: 1, Limit: 10})
+		require.NoError(t, err)
+		return events
+	}
+
+	errAbort := errors.New("abort")
+	err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		a.Record(ctx, models.AuthEvent{Type: models.AuthEventUserDelete, AppId: 1, Login: "rolled-back", Success: true})
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+	require.Empty(t, stored())
+	require.Zero(t, out.Len())
+
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		a.Record(ctx, models.AuthEvent{Type: models.AuthEventUserDelete, AppId: 1, Login: "committed", Success: true})
+		require.Zero(t, out.Len(), "written before the commit")
+		return nil
+	})
+	require.NoError(t, err)
+	events := stored()
+	require.Len(t, events, 1)
+	require.Equal(t, "committed", events[0].Login)
+	require.Equal(t, 1, strings.Count(out.String(), "\n"))
+	require.Contains(t, out.String(), `"login":"committed"`)
+
+	a.Record(ctx, models.AuthEvent{Type: models.AuthEventLogin, AppId: 1, Login: "no tx"})
+	require.Len(t, stored(), 2, "written right away outside of a transaction")
+}
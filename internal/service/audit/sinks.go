@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink names, as configured.
+const (
+	SinkDB     = "db"
+	SinkFile   = "file"
+	SinkStdout = "stdout"
+)
+
+// NewSinks creates the sinks named by names, file being the path of the file sink.
+func NewSinks(names []string, file string, events storage.AuthEventStorage) ([]Sink, error) {
+	const op = "audit.NewSinks"
+	var sinks []Sink
+	for _, name := range names {
+		switch name {
+		case SinkDB:
+			sinks = append(sinks, NewStorageSink(events))
+		case SinkFile:
+			sink, err := OpenFileSink(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			sinks = append(sinks, sink)
+		case SinkStdout:
+			sinks = append(sinks, NewJSONSink(os.Stdout))
+		default:
+			return nil, fmt.Errorf("%s: unknown sink %q, expected %s, %s or %s", op, name, SinkDB, SinkFile, SinkStdout)
+		}
+	}
+	return sinks, nil
+}
+
+// StorageSink saves events to the database, where List finds them.
+type StorageSink struct {
+	events storage.AuthEventStorage
+}
+
+func NewStorageSink(events storage.AuthEventStorage) *StorageSink {
+	return &StorageSink{events: events}
+}
+
+func (s *StorageSink) Write(ctx context.Context, event models.AuthEvent) error {
+	return s.events.Save(ctx, event)
+}
+
+// JSONSink writes events to w as JSON lines.
+type JSONSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is the file of sinks opened with OpenFileSink.
+	file *os.File
+}
+
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+// OpenFileSink appends events to the JSON lines file at path, creating it when missing.
+func OpenFileSink(path string) (*JSONSink, error) {
+	const op = "audit.OpenFileSink"
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &JSONSink{w: f, file: f}, nil
+}
+
+// Close closes the file of a sink opened with OpenFileSink, other writers are left open.
+func (s *JSONSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+type eventJSON struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	AppId      int32     `json:"app_id"`
+	UserId     int64     `json:"user_id,omitempty"`
+	Login      string    `json:"login,omitempty"`
+	Success    bool      `json:"success"`
+	Detail     string    `json:"detail,omitempty"`
+	Actor      string    `json:"actor,omitempty"`
+	OnBehalfOf string    `json:"on_behalf_of,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	RequestId  string    `json:"request_id,omitempty"`
+}
+
+func (s *JSONSink) Write(_ context.Context, e models.AuthEvent) error {
+	line, err := json.Marshal(eventJSON{
+		Time:       e.CreatedAt.UTC(),
+		Type:       e.Type,
+		AppId:      e.AppId,
+		UserId:     e.UserId,
+		Login:      e.Login,
+		Success:    e.Success,
+		Detail:     e.Detail,
+		Actor:      e.Actor,
+		OnBehalfOf: e.OnBehalfOf,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		RequestId:  e.RequestId,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
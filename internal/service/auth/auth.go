@@ -3,117 +3,297 @@ package auth
 import (
 	"SSO/internal/domain/models"
 	"SSO/internal/pkg/jwt"
+	"SSO/internal/pkg/password"
 	"SSO/internal/storage"
 	"SSO/internal/storage/storageErrors"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"golang.org/x/crypto/bcrypt"
+	"fmt"
+	"go.opentelemetry.io/otel"
 	"log/slog"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserIsExist        = errors.New("user is exist")
+	ErrUserDisabled       = errors.New("user is disabled")
+	ErrUserSuspended      = errors.New("user is suspended")
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrWeakPassword       = errors.New("password doesn't satisfy the app's policy")
+	ErrMFARequired        = errors.New("app requires MFA")
+	// ErrPasswordResetRequired is returned at login until the user changes the password an admin reset.
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrSessionRevoked        = errors.New("session has been revoked")
 )
 
+// purgeBatchSize is how many soft-deleted users a purge pass loads at once.
+const purgeBatchSize = 100
+
+var tracer = otel.Tracer("SSO/internal/service/auth")
+
 type AppsProvider interface {
 	GetByKey(ctx context.Context, key []byte) (models.App, error)
 }
 
-type PermDeleter interface {
-	Delete(ctx context.Context, userId int64) error
+type Permissions interface {
+	Delete(ctx context.Context, appId int32, userId int64) error
+	GrantedScopes(ctx context.Context, userId int64, requested []string) (scopes []string, permissions int32, err error)
+}
+
+type ProfileProvider interface {
+	ClaimAttributes(ctx context.Context, appId int32, userId int64) (map[string]any, error)
+}
+
+// Auditor records authentication events.
+type Auditor interface {
+	Record(ctx context.Context, event models.AuthEvent)
+}
+
+// Metrics counts authentication outcomes, see outcome for their values.
+// Lockouts are logins refused with the right password because of the user's status.
+type Metrics interface {
+	Login(outcome string)
+	Registration(outcome string)
+	TokenValidation(result string)
+	Lockout(reason string)
 }
 
 type Auth struct {
 	l            *slog.Logger
+	tx           storage.Transactor
 	userStorage  storage.UserStorage
+	sessions     storage.UserSessionStorage
 	appsProvider AppsProvider
-	perm         PermDeleter
+	perm         Permissions
+	profile      ProfileProvider
+	audit        Auditor
+	metrics      Metrics
 	tokenTTL     time.Duration
 }
 
-func New(l *slog.Logger, userStorage storage.UserStorage, appProvider AppsProvider, perm PermDeleter, tokenTTL time.Duration) *Auth {
+func New(l *slog.Logger, tx storage.Transactor, userStorage storage.UserStorage, sessions storage.UserSessionStorage, appProvider AppsProvider, perm Permissions, profile ProfileProvider, audit Auditor, metrics Metrics, tokenTTL time.Duration) *Auth {
 	return &Auth{
 		l:            l,
+		tx:           tx,
 		userStorage:  userStorage,
+		sessions:     sessions,
 		appsProvider: appProvider,
 		tokenTTL:     tokenTTL,
 		perm:         perm,
+		profile:      profile,
+		audit:        audit,
+		metrics:      metrics,
 	}
 }
 
-func (a *Auth) Register(ctx context.Context, appKey []byte, login string, password string) error {
-	passHash, err := a.HashPassword(password)
-	if err != nil {
-		return err
-	}
+// Register creates the user. A taken login is reported as storageErrors.ErrUserExists.
+// Apps can close registration and set a policy the password must satisfy.
+func (a *Auth) Register(ctx context.Context, appKey []byte, login string, password string, email string) (err error) {
+	ctx, span := tracer.Start(ctx, "auth.Register")
+	defer span.End()
+	defer func() { a.metrics.Registration(outcome(err)) }()
 	app, err := a.appsProvider.GetByKey(ctx, appKey)
 	if err != nil {
 		a.l.Error("failed get app", Err(err))
 		return err
 	}
-	if _, err := a.userStorage.Get(ctx, app.Id, login); err == nil {
-		a.l.Error("error register", Err(ErrUserIsExist))
-		return ErrUserIsExist
+	event := models.AuthEvent{Type: models.AuthEventRegister, AppId: app.Id, Login: login}
+	defer func() { a.record(ctx, event, err) }()
+	if app.Settings.RegistrationClosed {
+		return ErrRegistrationClosed
+	}
+	if err := checkPassword(app.Settings.PasswordPolicy, password); err != nil {
+		return err
+	}
+	passHash, err := a.HashPassword(password)
+	if err != nil {
+		return err
 	}
-	if err := a.userStorage.Save(ctx, app.Id, login, passHash); err != nil {
+	if err := a.userStorage.Save(ctx, models.User{
+		AppId:        app.Id,
+		Login:        login,
+		Email:        email,
+		PasswordHash: passHash,
+		CreatedAt:    time.Now(),
+	}); err != nil {
+		if !errors.Is(err, storageErrors.ErrUserExists) {
+			a.l.Error("failed save user", Err(err))
+		}
 		return err
 	}
-	a.l.Info("register user %s", login)
+	// The id lets the event follow the user across renames.
+	if user, err := a.userStorage.Get(ctx, app.Id, login); err == nil {
+		event.UserId = user.Id
+	}
+	a.l.Info("user registered", slog.String("login", login), slog.Int("app_id", int(app.Id)))
 	return nil
 }
 
-func (a *Auth) Login(ctx context.Context, appKey []byte, login string, password string) (string, error) {
+// Login checks the credentials and issues a token carrying the subset of scopes the user is allowed.
+// Every token gets a session of its own, which can be revoked before the token expires.
+// Failed logins are audited with the reason, which callers are only told when they know the password.
+func (a *Auth) Login(ctx context.Context, appKey []byte, login string, pass string, scopes []string) (token string, granted []string, err error) {
+	ctx, span := tracer.Start(ctx, "auth.Login")
+	defer span.End()
+	defer func() { a.metrics.Login(outcome(err)) }()
 	app, err := a.appsProvider.GetByKey(ctx, appKey)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
+	event := models.AuthEvent{Type: models.AuthEventLogin, AppId: app.Id, Login: login}
+	defer func() { a.record(ctx, event, err) }()
 
-	user, err := a.userStorage.Get(ctx, app.Id, login)
+	user, err := a.user(ctx, app.Id, login)
 	if err != nil {
 		if errors.Is(err, storageErrors.ErrUserNotFound) {
-			a.l.Info("user %s, app:%d not found", login, app.Id)
-			return "", ErrInvalidCredentials
+			event.Detail = "unknown login"
+			return "", nil, ErrInvalidCredentials
 		}
-		return "", err
+		return "", nil, err
 	}
+	event.UserId = user.Id
 
-	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
-		return "", ErrInvalidCredentials
+	if err := password.Compare(user.PasswordHash, pass); err != nil {
+		if !errors.Is(err, password.ErrMismatch) {
+			a.l.Error("failed compare password", Err(err))
+		}
+		event.Detail = "wrong password"
+		return "", nil, ErrInvalidCredentials
+	}
+	// The status is only revealed to callers who know the password.
+	if err := checkStatus(user); err != nil {
+		a.metrics.Lockout(outcome(err))
+		return "", nil, err
+	}
+	if app.Settings.RequireMFA && !user.MFAEnabled {
+		return "", nil, ErrMFARequired
+	}
+	if user.PasswordResetRequired {
+		return "", nil, ErrPasswordResetRequired
 	}
 
-	token, err := jwt.NewToken(user, app, a.tokenTTL)
+	granted, perm, err := a.perm.GrantedScopes(ctx, user.Id, scopes)
+	if err != nil {
+		a.l.Error("failed get granted scopes", Err(err))
+		return "", nil, err
+	}
+
+	profile, err := a.profile.ClaimAttributes(ctx, app.Id, user.Id)
+	if err != nil {
+		a.l.Error("failed get profile claims", Err(err))
+		return "", nil, err
+	}
+
+	ttl := a.tokenTTL
+	if app.Settings.TokenTTL > 0 {
+		ttl = app.Settings.TokenTTL
+	}
+	sessionId, err := newSessionId()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	session := models.UserSession{
+		Id:        sessionId,
+		AppId:     app.Id,
+		UserId:    user.Id,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := a.sessions.Save(ctx, session); err != nil {
+		a.l.Error("failed save session", Err(err))
+		return "", nil, err
+	}
+	token, err = jwt.NewToken(user, app, ttl, jwt.Claims{Scopes: granted, Permissions: perm, Profile: profile, SessionId: session.Id})
 	if err != nil {
 		a.l.Error("failed generate token", Err(err))
-		return "", err
+		return "", nil, err
 	}
-	return token, nil
+	event.Detail = "session " + session.Id
+	return token, granted, nil
 }
 
-func (a *Auth) DeleteUser(ctx context.Context, appKey []byte, login string) error {
+// DeleteUser soft-deletes the user. The user and its permission are removed for good
+// by the purger once the retention window has passed, until then it can be restored.
+func (a *Auth) DeleteUser(ctx context.Context, appKey []byte, login string) (err error) {
+	ctx, span := tracer.Start(ctx, "auth.DeleteUser")
+	defer span.End()
 	app, err := a.appsProvider.GetByKey(ctx, appKey)
 	if err != nil {
 		a.l.Error("failed get app", Err(err))
 		return err
 	}
-	user, err := a.userStorage.Get(ctx, app.Id, login)
+	event := models.AuthEvent{Type: models.AuthEventUserDelete, AppId: app.Id, Login: login}
+	defer func() { a.record(ctx, event, err) }()
+	user, err := a.user(ctx, app.Id, login)
 	if err != nil {
 		a.l.Error("failed get user", Err(err))
 		return err
 	}
-	if err := a.userStorage.Delete(ctx, app.Id, login); err != nil {
+	event.UserId = user.Id
+	if err := a.userStorage.UpdateStatus(ctx, app.Id, login, models.UserDeleted, time.Time{}, time.Now()); err != nil {
 		a.l.Error("failed delete user", Err(err))
 		return err
 	}
-	if err := a.perm.Delete(ctx, user.Id); err != nil {
-		a.l.Error("failed delete permission", Err(err))
-		return err
-	}
 	return nil
 }
 
+// Purge permanently removes users soft-deleted before the given time together with their permissions.
+func (a *Auth) Purge(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := tracer.Start(ctx, "auth.Purge")
+	defer span.End()
+	purged := 0
+	for {
+		users, err := a.userStorage.ListDeleted(ctx, before, purgeBatchSize)
+		if err != nil {
+			a.l.Error("failed list deleted users", Err(err))
+			return purged, err
+		}
+		for _, user := range users {
+			if err := a.tx.WithinTx(ctx, func(ctx context.Context) error {
+				if err := a.userStorage.Delete(ctx, user.AppId, user.Login); err != nil {
+					return err
+				}
+				return a.perm.Delete(ctx, user.AppId, user.Id)
+			}); err != nil {
+				a.l.Error("failed purge user", Err(err))
+				return purged, err
+			}
+			purged++
+		}
+		if len(users) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// RunPurger purges users soft-deleted more than retention ago every interval until ctx is done.
+// Expired sessions are deleted on the way.
+func (a *Auth) RunPurger(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n, err := a.Purge(ctx, now.Add(-retention)); err == nil && n > 0 {
+				a.l.Info("deleted users purged", slog.Int("count", n))
+			}
+			if _, err := a.sessions.DeleteExpired(ctx, now); err != nil {
+				a.l.Error("failed delete expired sessions", Err(err))
+			}
+		}
+	}
+}
+
 func (a *Auth) TestOnExist(ctx context.Context, appKey []byte, login string) bool {
+	ctx, span := tracer.Start(ctx, "auth.TestOnExist")
+	defer span.End()
 	app, err := a.appsProvider.GetByKey(ctx, appKey)
 	if err != nil {
 		a.l.Error("failed get app", Err(err))
@@ -127,29 +307,52 @@ func (a *Auth) TestOnExist(ctx context.Context, appKey []byte, login string) boo
 	return exist
 }
 
-func (a *Auth) UpdateLogin(ctx context.Context, appKey []byte, login string, newLogin string) error {
+// UpdateLogin renames the user. A taken login is reported as storageErrors.ErrUserExists.
+func (a *Auth) UpdateLogin(ctx context.Context, appKey []byte, login string, newLogin string) (err error) {
+	ctx, span := tracer.Start(ctx, "auth.UpdateLogin")
+	defer span.End()
 	app, err := a.appsProvider.GetByKey(ctx, appKey)
 	if err != nil {
 		a.l.Error("failed get app", Err(err))
 		return err
 	}
-	if _, err := a.userStorage.Get(ctx, app.Id, newLogin); err == nil {
-		a.l.Error("error update", Err(ErrUserIsExist))
-		return ErrUserIsExist
+	event := models.AuthEvent{Type: models.AuthEventLoginRename, AppId: app.Id, Login: login}
+	defer func() { a.record(ctx, event, err) }()
+	user, err := a.user(ctx, app.Id, login)
+	if err != nil {
+		a.l.Error("failed get user", Err(err))
+		return err
 	}
+	event.UserId = user.Id
 	if err := a.userStorage.UpdateLogin(ctx, app.Id, login, newLogin); err != nil {
-		a.l.Error("failed update login", Err(err))
+		if !errors.Is(err, storageErrors.ErrUserExists) {
+			a.l.Error("failed update login", Err(err))
+		}
 		return err
 	}
+	event.Detail = "renamed to " + newLogin
 	return nil
 }
 
-func (a *Auth) ChangePassword(ctx context.Context, appKey []byte, login string, newPass string) error {
+func (a *Auth) ChangePassword(ctx context.Context, appKey []byte, login string, newPass string) (err error) {
+	ctx, span := tracer.Start(ctx, "auth.ChangePassword")
+	defer span.End()
 	app, err := a.appsProvider.GetByKey(ctx, appKey)
 	if err != nil {
 		a.l.Error("failed get app", Err(err))
 		return err
 	}
+	event := models.AuthEvent{Type: models.AuthEventPasswordChange, AppId: app.Id, Login: login}
+	defer func() { a.record(ctx, event, err) }()
+	user, err := a.user(ctx, app.Id, login)
+	if err != nil {
+		a.l.Error("failed get user", Err(err))
+		return err
+	}
+	event.UserId = user.Id
+	if err := checkPassword(app.Settings.PasswordPolicy, newPass); err != nil {
+		return err
+	}
 	passHash, err := a.HashPassword(newPass)
 	if err != nil {
 		return err
@@ -162,12 +365,14 @@ func (a *Auth) ChangePassword(ctx context.Context, appKey []byte, login string,
 }
 
 func (a *Auth) GetUserId(ctx context.Context, appKey []byte, login string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "auth.GetUserId")
+	defer span.End()
 	app, err := a.appsProvider.GetByKey(ctx, appKey)
 	if err != nil {
 		a.l.Error("failed get app", Err(err))
 		return 0, err
 	}
-	user, err := a.userStorage.Get(ctx, app.Id, login)
+	user, err := a.user(ctx, app.Id, login)
 	if err != nil {
 		a.l.Error("failed test user on exist", Err(err))
 		return 0, err
@@ -175,17 +380,163 @@ func (a *Auth) GetUserId(ctx context.Context, appKey []byte, login string) (int6
 	return user.Id, nil
 }
 
-func (a *Auth) ParseToken(ctx context.Context, appKey []byte, token string) (string, error) {
-	login, err := jwt.ParseToken(token, appKey)
+// ParseToken validates the token and returns its login, rejecting tokens of users
+// that have since been disabled, suspended or deleted, and tokens whose session was revoked.
+// Tokens issued before sessions were recorded carry none and stay valid until they expire.
+func (a *Auth) ParseToken(ctx context.Context, appKey []byte, token string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "auth.ParseToken")
+	defer span.End()
+	invalid := false
+	defer func() {
+		result := outcome(err)
+		if invalid {
+			result = "invalid"
+		}
+		a.metrics.TokenValidation(result)
+	}()
+	app, err := a.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		a.l.Error("failed get app", Err(err))
+		return "", err
+	}
+	keys := [][]byte{app.SigningKey}
+	if app.PrevSigningKeyValid(time.Now()) {
+		keys = append(keys, app.PrevSigningKey)
+	}
+	login, sessionId, err := jwt.ParseToken(token, keys...)
 	if err != nil {
 		a.l.Warn(err.Error())
+		invalid = !errors.Is(err, jwt.ErrExpired)
+		return "", err
+	}
+	user, err := a.user(ctx, app.Id, login)
+	if err != nil {
 		return "", err
 	}
+	if err := checkStatus(user); err != nil {
+		return "", err
+	}
+	if sessionId != "" {
+		session, err := a.sessions.Get(ctx, sessionId)
+		if err != nil {
+			if errors.Is(err, storageErrors.ErrSessionNotFound) {
+				return "", ErrSessionRevoked
+			}
+			return "", err
+		}
+		if session.UserId != user.Id || !session.RevokedAt.IsZero() {
+			return "", ErrSessionRevoked
+		}
+	}
 	return login, nil
 }
 
-func (a *Auth) HashPassword(password string) (passwordHash []byte, err error) {
-	passwordHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// record audits event with the outcome of err. Failed events say why in Detail,
+// the error's text unless the caller set a reason already.
+func (a *Auth) record(ctx context.Context, event models.AuthEvent, err error) {
+	event.Success = err == nil
+	if err != nil && event.Detail == "" {
+		event.Detail = err.Error()
+	}
+	a.audit.Record(ctx, event)
+}
+
+// outcome names the result of err for Metrics.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrUserDisabled):
+		return "disabled"
+	case errors.Is(err, ErrUserSuspended):
+		return "suspended"
+	case errors.Is(err, ErrMFARequired):
+		return "mfa_required"
+	case errors.Is(err, ErrPasswordResetRequired):
+		return "password_reset_required"
+	case errors.Is(err, ErrRegistrationClosed):
+		return "registration_closed"
+	case errors.Is(err, ErrWeakPassword):
+		return "weak_password"
+	case errors.Is(err, ErrSessionRevoked):
+		return "revoked"
+	case errors.Is(err, jwt.ErrExpired):
+		return "expired"
+	case errors.Is(err, storageErrors.ErrUserExists):
+		return "login_taken"
+	case errors.Is(err, storageErrors.ErrUserNotFound):
+		return "unknown_user"
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		return "unknown_app"
+	}
+	return "error"
+}
+
+// user gets the user by login, treating soft-deleted users as missing.
+func (a *Auth) user(ctx context.Context, appId int32, login string) (models.User, error) {
+	user, err := a.userStorage.Get(ctx, appId, login)
+	if err != nil {
+		return user, err
+	}
+	if user.Status == models.UserDeleted {
+		return models.User{}, storageErrors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func checkStatus(user models.User) error {
+	switch user.StatusAt(time.Now()) {
+	case models.UserDisabled:
+		return ErrUserDisabled
+	case models.UserSuspended:
+		return ErrUserSuspended
+	}
+	return nil
+}
+
+// checkPassword reports the first rule of policy pass breaks as ErrWeakPassword.
+func checkPassword(policy models.PasswordPolicy, pass string) error {
+	if n := utf8.RuneCountInString(pass); n < policy.MinLength {
+		return fmt.Errorf("%w: at least %d characters required", ErrWeakPassword, policy.MinLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range pass {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	switch {
+	case policy.RequireUpper && !upper:
+		return fmt.Errorf("%w: an upper case letter required", ErrWeakPassword)
+	case policy.RequireLower && !lower:
+		return fmt.Errorf("%w: a lower case letter required", ErrWeakPassword)
+	case policy.RequireDigit && !digit:
+		return fmt.Errorf("%w: a digit required", ErrWeakPassword)
+	case policy.RequireSymbol && !symbol:
+		return fmt.Errorf("%w: a symbol required", ErrWeakPassword)
+	}
+	return nil
+}
+
+func newSessionId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (a *Auth) HashPassword(pass string) (passwordHash []byte, err error) {
+	passwordHash, err = password.Hash(pass)
 	if err != nil {
 		return nil, err
 	}
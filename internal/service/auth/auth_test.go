@@ -0,0 +1,311 @@
+package auth_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/apps"
+	"SSO/internal/service/audit"
+	"SSO/internal/service/auth"
+	"SSO/internal/service/permissions"
+	"SSO/internal/service/users"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type noMetrics struct{}
+
+func (noMetrics) Login(string)           {}
+func (noMetrics) Registration(string)    {}
+func (noMetrics) TokenValidation(string) {}
+func (noMetrics) Lockout(string)         {}
+
+const pass = "correct horse battery"
+
+type services struct {
+	auth    *auth.Auth
+	apps    *apps.Apps
+	users   *users.Users
+	storage *storage.Storage
+}
+
+// newServices wires the auth service to the other services on a memory storage,
+// auditing to the storage.
+func newServices(t *testing.T) services {
+	t.Helper()
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := storage.NewMemory()
+	appsService := apps.New(l, s.Tx, s.AppStorage, s.AppArchive, time.Hour)
+	auditService := audit.New(l, s.Tx, s.AuthEvents, appsService, s.UserStorage, audit.NewStorageSink(s.AuthEvents))
+	permService := permissions.New(l, s.Tx, s.PermissionsStorage, s.PermissionAudit, s.AccessRequests, auditService, map[string]int32{"read": 1, "write": 2})
+	usersService := users.New(l, s.Tx, s.UserStorage, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, appsService, auditService)
+	authService := auth.New(l, s.Tx, s.UserStorage, s.UserSessions, appsService, permService, usersService, auditService, noMetrics{}, time.Hour)
+	return services{auth: authService, apps: appsService, users: usersService, storage: s}
+}
+
+// newApp creates an app with settings and returns its key.
+func (s services) newApp(t *testing.T, settings models.AppSettings) []byte {
+	t.Helper()
+	_, credential, err := s.apps.NewApp(context.Background(), models.App{Name: t.Name(), Settings: settings})
+	require.NoError(t, err)
+	return []byte(credential)
+}
+
+// register registers login with pass and returns its id.
+func (s services) register(t *testing.T, appKey []byte, login string) int64 {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, s.auth.Register(ctx, appKey, login, pass, login+"@example.com"))
+	id, err := s.auth.GetUserId(ctx, appKey, login)
+	require.NoError(t, err)
+	return id
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	s := newServices(t)
+	appKey := s.newApp(t, models.AppSettings{})
+	closed := s.newApp(t, models.AppSettings{RegistrationClosed: true})
+	strict := s.newApp(t, models.AppSettings{PasswordPolicy: models.PasswordPolicy{MinLength: 12, RequireDigit: true}})
+
+	tests := []struct {
+		name    string
+		appKey  []byte
+		login   string
+		pass    string
+		wantErr error
+	}{
+		{name: "ok", appKey: appKey, login: "alice", pass: pass},
+		{name: "login taken", appKey: appKey, login: "alice", pass: pass, wantErr: storageErrors.ErrUserExists},
+		{name: "unknown app", appKey: []byte("unknown.secret"), login: "bob", pass: pass, wantErr: storageErrors.ErrAppNotFound},
+		{name: "registration closed", appKey: closed, login: "bob", pass: pass, wantErr: auth.ErrRegistrationClosed},
+		{name: "weak password", appKey: strict, login: "bob", pass: pass, wantErr: auth.ErrWeakPassword},
+		{name: "password satisfying the policy", appKey: strict, login: "bob", pass: pass + " 2"},
+	}
+	for _, tt := range tests {
+		err := s.auth.Register(ctx, tt.appKey, tt.login, tt.pass, "")
+		if tt.wantErr != nil {
+			require.ErrorIs(t, err, tt.wantErr, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		require.True(t, s.auth.TestOnExist(ctx, tt.appKey, tt.login), tt.name)
+	}
+	require.False(t, s.auth.TestOnExist(ctx, closed, "bob"))
+
+	app, err := s.apps.GetByKey(ctx, appKey)
+	require.NoError(t, err)
+	events, err := s.storage.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Type: models.AuthEventRegister, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.False(t, events[0].Success, "newest first")
+	require.True(t, events[1].Success)
+	require.NotZero(t, events[1].UserId)
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newServices(t)
+	appKey := s.newApp(t, models.AppSettings{})
+	userId := s.register(t, appKey, "alice")
+	app, err := s.apps.GetByKey(ctx, appKey)
+	require.NoError(t, err)
+
+	_, _, err = s.auth.Login(ctx, appKey, "alice", "wrong", nil)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, _, err = s.auth.Login(ctx, appKey, "nobody", pass, nil)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	events, err := s.storage.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Type: models.AuthEventLogin, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, "unknown login", events[0].Detail)
+	require.Equal(t, "wrong password", events[1].Detail)
+	require.Equal(t, userId, events[1].UserId)
+
+	// Scopes are granted as far as the user's permission covers them.
+	token, granted, err := s.auth.Login(ctx, appKey, "alice", pass, []string{"read", "write"})
+	require.NoError(t, err)
+	require.Empty(t, granted)
+	require.NoError(t, s.storage.PermissionsStorage.Save(ctx, userId, 1, time.Time{}))
+	_, granted, err = s.auth.Login(ctx, appKey, "alice", pass, []string{"read", "write"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"read"}, granted)
+	login, err := s.auth.ParseToken(ctx, appKey, token)
+	require.NoError(t, err)
+	require.Equal(t, "alice", login)
+
+	// The status is only revealed with the right password.
+	require.NoError(t, s.users.SetStatus(ctx, appKey, "alice", models.UserDisabled, time.Time{}))
+	_, _, err = s.auth.Login(ctx, appKey, "alice", "wrong", nil)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass, nil)
+	require.ErrorIs(t, err, auth.ErrUserDisabled)
+	require.NoError(t, s.users.SetStatus(ctx, appKey, "alice", models.UserSuspended, time.Now().Add(time.Hour)))
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass, nil)
+	require.ErrorIs(t, err, auth.ErrUserSuspended)
+	require.NoError(t, s.users.SetStatus(ctx, appKey, "alice", models.UserActive, time.Time{}))
+
+	// A reset password has to be changed before the next login.
+	require.NoError(t, s.users.RequirePasswordReset(ctx, appKey, "alice"))
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass, nil)
+	require.ErrorIs(t, err, auth.ErrPasswordResetRequired)
+	require.NoError(t, s.auth.ChangePassword(ctx, appKey, "alice", pass+"!"))
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass, nil)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials, "old password")
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass+"!", nil)
+	require.NoError(t, err)
+
+	settings := models.AppSettings{RequireMFA: true}
+	_, err = s.apps.UpdateApp(ctx, app.ClientId, apps.AppUpdate{Settings: &settings})
+	require.NoError(t, err)
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass+"!", nil)
+	require.ErrorIs(t, err, auth.ErrMFARequired)
+	require.NoError(t, s.storage.UserStorage.SetMFAEnabled(ctx, app.Id, "alice", true))
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass+"!", nil)
+	require.NoError(t, err)
+}
+
+func TestParseToken(t *testing.T) {
+	ctx := context.Background()
+	s := newServices(t)
+	appKey := s.newApp(t, models.AppSettings{})
+	otherKey := s.newApp(t, models.AppSettings{})
+	login := func(login string) string {
+		t.Helper()
+		s.register(t, appKey, login)
+		token, _, err := s.auth.Login(ctx, appKey, login, pass, nil)
+		require.NoError(t, err)
+		return token
+	}
+
+	token := login("alice")
+	_, err := s.auth.ParseToken(ctx, otherKey, token)
+	require.Error(t, err, "token of another app")
+	_, err = s.auth.ParseToken(ctx, appKey, "garbage")
+	require.Error(t, err)
+
+	require.NoError(t, s.users.SetStatus(ctx, appKey, "alice", models.UserDisabled, time.Time{}))
+	_, err = s.auth.ParseToken(ctx, appKey, token)
+	require.ErrorIs(t, err, auth.ErrUserDisabled)
+	require.NoError(t, s.users.SetStatus(ctx, appKey, "alice", models.UserActive, time.Time{}))
+	_, err = s.auth.ParseToken(ctx, appKey, token)
+	require.NoError(t, err)
+
+	n, err := s.users.RevokeSessions(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	_, err = s.auth.ParseToken(ctx, appKey, token)
+	require.ErrorIs(t, err, auth.ErrSessionRevoked)
+
+	token = login("bob")
+	require.NoError(t, s.auth.DeleteUser(ctx, appKey, "bob"))
+	_, err = s.auth.ParseToken(ctx, appKey, token)
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+}
+
+func TestUpdateLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newServices(t)
+	appKey := s.newApp(t, models.AppSettings{})
+	aliceId := s.register(t, appKey, "alice")
+	s.register(t, appKey, "bob")
+
+	require.ErrorIs(t, s.auth.UpdateLogin(ctx, appKey, "alice", "bob"), storageErrors.ErrUserExists)
+	require.ErrorIs(t, s.auth.UpdateLogin(ctx, appKey, "nobody", "carol"), storageErrors.ErrUserNotFound)
+	require.NoError(t, s.auth.UpdateLogin(ctx, appKey, "alice", "carol"))
+	require.False(t, s.auth.TestOnExist(ctx, appKey, "alice"))
+	id, err := s.auth.GetUserId(ctx, appKey, "carol")
+	require.NoError(t, err)
+	require.Equal(t, aliceId, id)
+	_, _, err = s.auth.Login(ctx, appKey, "carol", pass, nil)
+	require.NoError(t, err)
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	s := newServices(t)
+	appKey := s.newApp(t, models.AppSettings{PasswordPolicy: models.PasswordPolicy{MinLength: 8}})
+	s.register(t, appKey, "alice")
+
+	require.ErrorIs(t, s.auth.ChangePassword(ctx, appKey, "alice", "short"), auth.ErrWeakPassword)
+	_, _, err := s.auth.Login(ctx, appKey, "alice", pass, nil)
+	require.NoError(t, err, "a refused change keeps the password")
+	require.ErrorIs(t, s.auth.ChangePassword(ctx, appKey, "nobody", "long enough"), storageErrors.ErrUserNotFound)
+	require.NoError(t, s.auth.ChangePassword(ctx, appKey, "alice", "long enough"))
+	_, _, err = s.auth.Login(ctx, appKey, "alice", "long enough", nil)
+	require.NoError(t, err)
+}
+
+func TestDeleteRestorePurge(t *testing.T) {
+	ctx := context.Background()
+	s := newServices(t)
+	appKey := s.newApp(t, models.AppSettings{})
+	aliceId := s.register(t, appKey, "alice")
+	s.register(t, appKey, "bob")
+	require.NoError(t, s.storage.PermissionsStorage.Save(ctx, aliceId, 3, time.Time{}))
+
+	require.NoError(t, s.auth.DeleteUser(ctx, appKey, "alice"))
+	require.ErrorIs(t, s.auth.DeleteUser(ctx, appKey, "alice"), storageErrors.ErrUserNotFound, "already deleted")
+	_, _, err := s.auth.Login(ctx, appKey, "alice", pass, nil)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	require.NoError(t, s.users.Restore(ctx, appKey, "alice"))
+	_, _, err = s.auth.Login(ctx, appKey, "alice", pass, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.auth.DeleteUser(ctx, appKey, "alice"))
+	n, err := s.auth.Purge(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, n, "deleted within the retention window")
+	n, err = s.auth.Purge(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.ErrorIs(t, s.users.Restore(ctx, appKey, "alice"), storageErrors.ErrUserNotFound)
+	_, err = s.storage.PermissionsStorage.Get(ctx, aliceId)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound)
+	require.True(t, s.auth.TestOnExist(ctx, appKey, "bob"))
+}
+
+func TestParseTokenAfterRotation(t *testing.T) {
+	const grace = 200 * time.Millisecond
+	ctx := context.Background()
+	s := newServices(t)
+	app, credential, err := s.apps.NewApp(ctx, models.App{Name: "rotated"})
+	require.NoError(t, err)
+	require.NoError(t, s.auth.Register(ctx, []byte(credential), "alice", pass, ""))
+	oldToken, _, err := s.auth.Login(ctx, []byte(credential), "alice", pass, nil)
+	require.NoError(t, err)
+
+	_, credential, err = s.apps.RotateSecret(ctx, app.ClientId, apps.RotateOptions{GracePeriod: grace})
+	require.NoError(t, err)
+	newToken, _, err := s.auth.Login(ctx, []byte(credential), "alice", pass, nil)
+	require.NoError(t, err)
+
+	login, err := s.auth.ParseToken(ctx, []byte(credential), oldToken)
+	require.NoError(t, err, "token signed with the old key within the grace period")
+	require.Equal(t, "alice", login)
+
+	time.Sleep(grace)
+	_, err = s.auth.ParseToken(ctx, []byte(credential), oldToken)
+	require.Error(t, err, "token signed with the old key after the grace period")
+	_, err = s.auth.ParseToken(ctx, []byte(credential), newToken)
+	require.NoError(t, err)
+}
+
+func TestParseTokenAfterRevokingRotation(t *testing.T) {
+	ctx := context.Background()
+	s := newServices(t)
+	app, credential, err := s.apps.NewApp(ctx, models.App{Name: "revoked"})
+	require.NoError(t, err)
+	require.NoError(t, s.auth.Register(ctx, []byte(credential), "bob", pass, ""))
+	oldToken, _, err := s.auth.Login(ctx, []byte(credential), "bob", pass, nil)
+	require.NoError(t, err)
+
+	_, credential, err = s.apps.RotateSecret(ctx, app.ClientId, apps.RotateOptions{Revoke: true})
+	require.NoError(t, err)
+	_, err = s.auth.ParseToken(ctx, []byte(credential), oldToken)
+	require.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"SSO/internal/domain/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	all := models.PasswordPolicy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name   string
+		policy models.PasswordPolicy
+		pass   string
+		// broken is the rule reported as broken, empty when pass satisfies policy.
+		broken string
+	}{
+		{name: "no policy", pass: ""},
+		{name: "one short of min length", policy: models.PasswordPolicy{MinLength: 8}, pass: "1234567", broken: "at least 8 characters"},
+		{name: "exactly min length", policy: models.PasswordPolicy{MinLength: 8}, pass: "12345678"},
+		{name: "over min length", policy: models.PasswordPolicy{MinLength: 8}, pass: "123456789"},
+		{name: "empty with min length", policy: models.PasswordPolicy{MinLength: 1}, pass: "", broken: "at least 1 characters"},
+		{name: "length counts characters, not bytes", policy: models.PasswordPolicy{MinLength: 4}, pass: "пар", broken: "at least 4 characters"},
+		{name: "multibyte at min length", policy: models.PasswordPolicy{MinLength: 4}, pass: "паро"},
+		{name: "upper missing", policy: models.PasswordPolicy{RequireUpper: true}, pass: "password1!", broken: "upper case"},
+		{name: "upper", policy: models.PasswordPolicy{RequireUpper: true}, pass: "Password"},
+		{name: "non-ASCII upper", policy: models.PasswordPolicy{RequireUpper: true}, pass: "Ärger"},
+		{name: "lower missing", policy: models.PasswordPolicy{RequireLower: true}, pass: "PASSWORD1!", broken: "lower case"},
+		{name: "lower", policy: models.PasswordPolicy{RequireLower: true}, pass: "PASSWORd"},
+		{name: "digit missing", policy: models.PasswordPolicy{RequireDigit: true}, pass: "Password!", broken: "digit"},
+		{name: "digit", policy: models.PasswordPolicy{RequireDigit: true}, pass: "passw0rd"},
+		{name: "symbol missing", policy: models.PasswordPolicy{RequireSymbol: true}, pass: "Password1", broken: "symbol"},
+		{name: "space is no symbol", policy: models.PasswordPolicy{RequireSymbol: true}, pass: "pass word", broken: "symbol"},
+		{name: "punctuation", policy: models.PasswordPolicy{RequireSymbol: true}, pass: "password!"},
+		{name: "symbol", policy: models.PasswordPolicy{RequireSymbol: true}, pass: "pass+word"},
+		{name: "every rule", policy: all, pass: "Passw0rd!"},
+		{name: "length is checked first", policy: all, pass: "pass", broken: "at least 8 characters"},
+		{name: "every rule but upper", policy: all, pass: "passw0rd!", broken: "upper case"},
+		{name: "every rule but symbol", policy: all, pass: "Passw0rdX", broken: "symbol"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPassword(tt.policy, tt.pass)
+			if tt.broken == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrWeakPassword)
+			require.Contains(t, err.Error(), tt.broken)
+		})
+	}
+}
@@ -1,61 +1,400 @@
 package permissions
 
 import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
 	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
 	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel"
 	"log/slog"
+	"time"
 )
 
+// Auditor records authentication events.
+type Auditor interface {
+	Record(ctx context.Context, event models.AuthEvent)
+}
+
+var (
+	ErrRequestNotPending = errors.New("access request is not pending")
+	ErrInvalidDuration   = errors.New("invalid access duration")
+	// ErrConflictingGrant refuses approvals that would take away part of the user's
+	// current grant: a permanent one, one with bits the request lacks, or one
+	// lasting longer than the request.
+	ErrConflictingGrant = errors.New("user holds a permanent, broader or longer grant")
+)
+
+const (
+	// DefaultHistoryPageSize is used when History is called without a limit.
+	DefaultHistoryPageSize = 50
+	MaxHistoryPageSize     = 500
+)
+
+var tracer = otel.Tracer("SSO/internal/service/permissions")
+
 type Permissions struct {
-	l           *slog.Logger
-	permStorage storage.PermissionsStorage
+	l              *slog.Logger
+	tx             storage.Transactor
+	permStorage    storage.PermissionsStorage
+	audit          storage.PermissionAuditStorage
+	accessRequests storage.AccessRequestsStorage
+	events         Auditor
+	scopes         map[string]int32
 }
 
-func New(l *slog.Logger, permStorage storage.PermissionsStorage) *Permissions {
+// New creates the permissions service. scopes maps scope names to the permission bits they require.
+// Besides the permission audit trail, changes are recorded as authentication events with events.
+func New(l *slog.Logger, tx storage.Transactor, permStorage storage.PermissionsStorage, audit storage.PermissionAuditStorage, accessRequests storage.AccessRequestsStorage, events Auditor, scopes map[string]int32) *Permissions {
 	return &Permissions{
-		l:           l,
-		permStorage: permStorage,
+		l:              l,
+		tx:             tx,
+		permStorage:    permStorage,
+		audit:          audit,
+		accessRequests: accessRequests,
+		events:         events,
+		scopes:         scopes,
 	}
 }
 
-func (p *Permissions) SetUserPermission(ctx context.Context, userId int64, permission int32) (err error) {
+// SetUserPermission grants permission to the user. A zero expiresAt makes the grant permanent.
+// The change and its audit entry are written in one transaction.
+func (p *Permissions) SetUserPermission(ctx context.Context, appId int32, userId int64, permission int32, expiresAt time.Time) (err error) {
 	const op = "service.permissions.SetUserPermission"
-	if permNow, err := p.permStorage.Get(ctx, userId); err != nil {
-		if err := p.permStorage.Save(ctx, userId, permission); err != nil {
-			p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+	ctx, span := tracer.Start(ctx, "permissions.SetUserPermission")
+	defer span.End()
+	entry := models.PermissionAuditEntry{
+		AppId:        appId,
+		UserId:       userId,
+		NewValue:     permission,
+		NewExpiresAt: expiresAt,
+	}
+	err = p.tx.WithinTx(ctx, func(ctx context.Context) error {
+		permNow, err := p.permStorage.Get(ctx, userId)
+		switch {
+		case errors.Is(err, storageErrors.ErrPermissionNotFound):
+			if err := p.permStorage.Save(ctx, userId, permission, expiresAt); err != nil {
+				return err
+			}
+			entry.Action = models.PermissionGrant
+		case err != nil:
 			return err
-		}
-
-	} else {
-		if permNow != permission {
-			if err := p.permStorage.Update(ctx, userId, permission); err != nil {
-				p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		default:
+			if permNow.Value == permission && permNow.ExpiresAt.Equal(expiresAt) {
+				return nil
+			}
+			if err := p.permStorage.Update(ctx, userId, permission, expiresAt); err != nil {
 				return err
 			}
+			entry.Action = models.PermissionChange
+			entry.OldValue = permNow.Value
 		}
+		return p.record(ctx, entry)
+	})
+	if err != nil {
+		p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	if entry.Action != "" {
+		p.recordEvent(ctx, entry)
 	}
 	return nil
 }
 
+// GetUserPermission returns the user's permission. Expired grants are reported as storageErrors.ErrPermissionNotFound.
 func (p *Permissions) GetUserPermission(ctx context.Context, userId int64) (permission int32, err error) {
 	const op = "service.permissions.GetUserPermission"
+	ctx, span := tracer.Start(ctx, "permissions.GetUserPermission")
+	defer span.End()
 	perm, err := p.permStorage.Get(ctx, userId)
 	if err != nil {
-		p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
-		return perm, err
+		if !errors.Is(err, storageErrors.ErrPermissionNotFound) {
+			p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return 0, err
+	}
+	if perm.Expired(time.Now()) {
+		return 0, storageErrors.ErrPermissionNotFound
 	}
-	return perm, nil
+	return perm.Value, nil
 }
 
-func (p *Permissions) Delete(ctx context.Context, userId int64) error {
+// GrantedScopes negotiates the requested scopes against the user's effective permission.
+// It returns the requested scopes whose bits the user holds, in request order, together
+// with the union of their bits. Unknown scopes and users without a permission get nothing.
+func (p *Permissions) GrantedScopes(ctx context.Context, userId int64, requested []string) ([]string, int32, error) {
+	ctx, span := tracer.Start(ctx, "permissions.GrantedScopes")
+	defer span.End()
+	if len(requested) == 0 {
+		return nil, 0, nil
+	}
+	perm, err := p.GetUserPermission(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storageErrors.ErrPermissionNotFound) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	var (
+		granted []string
+		mask    int32
+	)
+	seen := make(map[string]bool, len(requested))
+	for _, scope := range requested {
+		bits, ok := p.scopes[scope]
+		if !ok || seen[scope] || perm&bits != bits {
+			continue
+		}
+		seen[scope] = true
+		granted = append(granted, scope)
+		mask |= bits
+	}
+	return granted, mask, nil
+}
+
+// Delete removes the user's permission, if any, together with writing its revoke audit entry.
+func (p *Permissions) Delete(ctx context.Context, appId int32, userId int64) error {
 	const op = "service.permissions.Delete"
-	if _, err := p.permStorage.Get(ctx, userId); err != nil {
-		return nil
+	ctx, span := tracer.Start(ctx, "permissions.Delete")
+	defer span.End()
+	var entry models.PermissionAuditEntry
+	err := p.tx.WithinTx(ctx, func(ctx context.Context) error {
+		permNow, err := p.permStorage.Get(ctx, userId)
+		if err != nil {
+			if errors.Is(err, storageErrors.ErrPermissionNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err := p.permStorage.Delete(ctx, userId); err != nil {
+			return err
+		}
+		entry = models.PermissionAuditEntry{
+			AppId:    appId,
+			UserId:   userId,
+			Action:   models.PermissionRevoke,
+			OldValue: permNow.Value,
+		}
+		return p.record(ctx, entry)
+	})
+	if err != nil {
+		p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	if entry.Action != "" {
+		p.recordEvent(ctx, entry)
+	}
+	return nil
+}
+
+// History returns audit entries matching filter, newest first.
+func (p *Permissions) History(ctx context.Context, filter models.PermissionAuditFilter) ([]models.PermissionAuditEntry, error) {
+	const op = "service.permissions.History"
+	ctx, span := tracer.Start(ctx, "permissions.History")
+	defer span.End()
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultHistoryPageSize
+	}
+	if filter.Limit > MaxHistoryPageSize {
+		filter.Limit = MaxHistoryPageSize
+	}
+	entries, err := p.audit.List(ctx, filter)
+	if err != nil {
+		p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, err
+	}
+	return entries, nil
+}
+
+// record appends entry to the audit trail, filling actor, on-behalf-of and request id from ctx.
+// Callers write it in the same transaction as the change it describes.
+func (p *Permissions) record(ctx context.Context, entry models.PermissionAuditEntry) error {
+	const op = "service.permissions.record"
+	meta := reqmeta.From(ctx)
+	entry.Actor = meta.Actor
+	entry.OnBehalfOf = meta.OnBehalfOf
+	entry.RequestId = meta.RequestId
+	entry.CreatedAt = time.Now()
+	if err := p.audit.Save(ctx, entry); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	if err := p.permStorage.Delete(ctx, userId); err != nil {
+	return nil
+}
+
+// recordEvent records the committed change of entry as an authentication event.
+func (p *Permissions) recordEvent(ctx context.Context, entry models.PermissionAuditEntry) {
+	detail := fmt.Sprintf("%s %d", entry.Action, entry.NewValue)
+	switch entry.Action {
+	case models.PermissionChange:
+		detail = fmt.Sprintf("%s %d to %d", entry.Action, entry.OldValue, entry.NewValue)
+	case models.PermissionRevoke:
+		detail = fmt.Sprintf("%s %d", entry.Action, entry.OldValue)
+	}
+	if !entry.NewExpiresAt.IsZero() && entry.Action != models.PermissionRevoke {
+		detail += " until " + entry.NewExpiresAt.UTC().Format(time.RFC3339)
+	}
+	p.events.Record(ctx, models.AuthEvent{
+		Type:    models.AuthEventPermissionChange,
+		AppId:   entry.AppId,
+		UserId:  entry.UserId,
+		Success: true,
+		Detail:  detail,
+	})
+}
+
+// RunSweeper periodically removes expired grants until ctx is done.
+// Sweeps aren't audited: the grant entry already records when it expires.
+func (p *Permissions) RunSweeper(ctx context.Context, interval time.Duration) {
+	const op = "service.permissions.RunSweeper"
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := p.permStorage.DeleteExpired(ctx, now)
+			if err != nil {
+				p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+				continue
+			}
+			if n > 0 {
+				p.l.Info("expired permissions removed", slog.Int64("count", n))
+			}
+		}
+	}
+}
+
+func (p *Permissions) RequestAccess(ctx context.Context, appId int32, userId int64, permission int32, duration time.Duration, reason string) (int64, error) {
+	const op = "service.permissions.RequestAccess"
+	ctx, span := tracer.Start(ctx, "permissions.RequestAccess")
+	defer span.End()
+	if duration <= 0 {
+		return 0, ErrInvalidDuration
+	}
+	id, err := p.accessRequests.Save(ctx, models.AccessRequest{
+		AppId:      appId,
+		UserId:     userId,
+		Permission: permission,
+		Duration:   duration,
+		Reason:     reason,
+		Status:     models.AccessRequestPending,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
 		p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return 0, err
+	}
+	return id, nil
+}
+
+// ApproveAccess grants the requested permission for the requested duration and returns when it expires.
+// A running grant of the same permission keeps its later expiry. Approvals that would narrow or cut
+// short the user's grant are refused with ErrConflictingGrant, and the request stays pending.
+// The request is decided in the same transaction, so of concurrent decisions only one succeeds.
+func (p *Permissions) ApproveAccess(ctx context.Context, appId int32, requestId int64, approver string) (time.Time, error) {
+	const op = "service.permissions.ApproveAccess"
+	ctx, span := tracer.Start(ctx, "permissions.ApproveAccess")
+	defer span.End()
+	var expiresAt time.Time
+	err := p.tx.WithinTx(ctx, func(ctx context.Context) error {
+		req, err := p.pendingRequest(ctx, appId, requestId)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		expiresAt = now.Add(req.Duration)
+		current, err := p.permStorage.Get(ctx, req.UserId)
+		switch {
+		case errors.Is(err, storageErrors.ErrPermissionNotFound):
+		case err != nil:
+			return err
+		case !current.ExpiresAt.IsZero() && !current.ExpiresAt.After(now):
+			// An expired grant is replaced.
+		case current.ExpiresAt.IsZero() || current.Value&^req.Permission != 0:
+			return ErrConflictingGrant
+		case current.ExpiresAt.After(expiresAt):
+			// The same grant is kept until the later expiry, a broader one would
+			// end the current bits early or outlast the requested duration.
+			if current.Value != req.Permission {
+				return ErrConflictingGrant
+			}
+			expiresAt = current.ExpiresAt
+		}
+		if err := p.decide(ctx, requestId, models.AccessRequestApproved, approver, now); err != nil {
+			return err
+		}
+		return p.SetUserPermission(reqmeta.WithActor(ctx, approver), appId, req.UserId, req.Permission, expiresAt)
+	})
+	if err != nil {
+		if !isRequestError(err) {
+			p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return time.Time{}, err
+	}
+	return expiresAt, nil
+}
+
+func (p *Permissions) DenyAccess(ctx context.Context, appId int32, requestId int64, approver string) error {
+	const op = "service.permissions.DenyAccess"
+	ctx, span := tracer.Start(ctx, "permissions.DenyAccess")
+	defer span.End()
+	err := p.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := p.pendingRequest(ctx, appId, requestId); err != nil {
+			return err
+		}
+		return p.decide(ctx, requestId, models.AccessRequestDenied, approver, time.Now())
+	})
+	if err != nil {
+		if !isRequestError(err) {
+			p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
 		return err
 	}
 	return nil
 }
+
+func (p *Permissions) ListAccessRequests(ctx context.Context, appId int32, status string) ([]models.AccessRequest, error) {
+	const op = "service.permissions.ListAccessRequests"
+	ctx, span := tracer.Start(ctx, "permissions.ListAccessRequests")
+	defer span.End()
+	reqs, err := p.accessRequests.GetByApp(ctx, appId, status)
+	if err != nil {
+		p.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// decide sets the status of the pending request, reporting ErrRequestNotPending when
+// another decision came first.
+func (p *Permissions) decide(ctx context.Context, requestId int64, status string, approver string, at time.Time) error {
+	err := p.accessRequests.Decide(ctx, requestId, status, approver, at)
+	if errors.Is(err, storageErrors.ErrAccessRequestDecided) {
+		return ErrRequestNotPending
+	}
+	return err
+}
+
+// isRequestError reports whether err is the caller's, not worth logging.
+func isRequestError(err error) bool {
+	return errors.Is(err, storageErrors.ErrAccessRequestNotFound) || errors.Is(err, ErrRequestNotPending) || errors.Is(err, ErrConflictingGrant)
+}
+
+func (p *Permissions) pendingRequest(ctx context.Context, appId int32, requestId int64) (models.AccessRequest, error) {
+	req, err := p.accessRequests.Get(ctx, requestId)
+	if err != nil {
+		return req, err
+	}
+	// Requests of other apps are reported as missing so ids can't be probed across apps.
+	if req.AppId != appId {
+		return req, storageErrors.ErrAccessRequestNotFound
+	}
+	if req.Status != models.AccessRequestPending {
+		return req, ErrRequestNotPending
+	}
+	return req, nil
+}
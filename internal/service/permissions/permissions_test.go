@@ -0,0 +1,273 @@
+package permissions_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/reqmeta"
+	"SSO/internal/service/permissions"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+type noEvents struct{}
+
+func (noEvents) Record(context.Context, models.AuthEvent) {}
+
+// events records the authentication events it is given.
+type events struct {
+	recorded []models.AuthEvent
+}
+
+func (e *events) Record(_ context.Context, event models.AuthEvent) {
+	e.recorded = append(e.recorded, event)
+}
+
+var scopes = map[string]int32{"read": 1, "write": 2, "admin": 4, "editor": 3}
+
+func newService(t *testing.T) (*permissions.Permissions, *storage.Storage) {
+	t.Helper()
+	s := storage.NewMemory()
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return permissions.New(l, s.Tx, s.PermissionsStorage, s.PermissionAudit, s.AccessRequests, noEvents{}, scopes), s
+}
+
+// newUser stores a user of a new app and returns the app id and the user id.
+func newUser(t *testing.T, s *storage.Storage) (int32, int64) {
+	t.Helper()
+	ctx := context.Background()
+	appId, err := s.AppStorage.Save(ctx, models.App{ClientId: t.Name(), CreatedAt: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, s.UserStorage.Save(ctx, models.User{AppId: appId, Login: "alice", PasswordHash: []byte("hash"), CreatedAt: time.Now()}))
+	user, err := s.UserStorage.Get(ctx, appId, "alice")
+	require.NoError(t, err)
+	return appId, user.Id
+}
+
+func TestGrantedScopes(t *testing.T) {
+	tests := []struct {
+		name        string
+		perm        *models.Permission
+		requested   []string
+		wantGranted []string
+		wantMask    int32
+	}{
+		{name: "nothing requested", perm: &models.Permission{Value: 7}, requested: nil},
+		{name: "empty request", perm: &models.Permission{Value: 7}, requested: []string{}},
+		{name: "no permission", requested: []string{"read"}},
+		{name: "empty permission", perm: &models.Permission{Value: 0}, requested: []string{"read"}},
+		{name: "all granted", perm: &models.Permission{Value: 7}, requested: []string{"write", "read"},
+			wantGranted: []string{"write", "read"}, wantMask: 3},
+		{name: "requested beyond the permission", perm: &models.Permission{Value: 1}, requested: []string{"read", "write", "admin"},
+			wantGranted: []string{"read"}, wantMask: 1},
+		{name: "none of the requested held", perm: &models.Permission{Value: 4}, requested: []string{"read", "write"}},
+		{name: "scope of several bits needs them all", perm: &models.Permission{Value: 1}, requested: []string{"editor"}},
+		{name: "scope of several bits", perm: &models.Permission{Value: 3}, requested: []string{"editor", "admin"},
+			wantGranted: []string{"editor"}, wantMask: 3},
+		{name: "unknown scope", perm: &models.Permission{Value: 7}, requested: []string{"delete", "read"},
+			wantGranted: []string{"read"}, wantMask: 1},
+		{name: "duplicate scope", perm: &models.Permission{Value: 7}, requested: []string{"read", "read"},
+			wantGranted: []string{"read"}, wantMask: 1},
+		{name: "running temporary grant", perm: &models.Permission{Value: 2, ExpiresAt: time.Now().Add(time.Hour)}, requested: []string{"write"},
+			wantGranted: []string{"write"}, wantMask: 2},
+		{name: "expired grant", perm: &models.Permission{Value: 7, ExpiresAt: time.Now().Add(-time.Second)}, requested: []string{"read"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p, s := newService(t)
+			_, userId := newUser(t, s)
+			if tt.perm != nil {
+				require.NoError(t, s.PermissionsStorage.Save(ctx, userId, tt.perm.Value, tt.perm.ExpiresAt))
+			}
+			granted, mask, err := p.GrantedScopes(ctx, userId, tt.requested)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantGranted, granted)
+			require.Equal(t, tt.wantMask, mask)
+		})
+	}
+}
+
+func TestApproveAccess(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		current   *models.Permission
+		requested int32
+		duration  time.Duration
+		wantErr   error
+		// wantValue and wantExpiresIn describe the grant after the approval.
+		wantValue     int32
+		wantExpiresIn time.Duration
+	}{
+		{name: "no grant", requested: 2, duration: time.Hour, wantValue: 2, wantExpiresIn: time.Hour},
+		{name: "expired grant", current: &models.Permission{Value: 7, ExpiresAt: now.Add(-time.Minute)},
+			requested: 2, duration: time.Hour, wantValue: 2, wantExpiresIn: time.Hour},
+		{name: "permanent grant", current: &models.Permission{Value: 1},
+			requested: 3, duration: time.Hour, wantErr: permissions.ErrConflictingGrant, wantValue: 1},
+		{name: "permanent grant covering the request", current: &models.Permission{Value: 7},
+			requested: 2, duration: time.Hour, wantErr: permissions.ErrConflictingGrant, wantValue: 7},
+		{name: "broader temporary grant", current: &models.Permission{Value: 6, ExpiresAt: now.Add(time.Minute)},
+			requested: 2, duration: time.Hour, wantErr: permissions.ErrConflictingGrant, wantValue: 6, wantExpiresIn: time.Minute},
+		{name: "shorter temporary grant the request covers", current: &models.Permission{Value: 1, ExpiresAt: now.Add(time.Minute)},
+			requested: 3, duration: time.Hour, wantValue: 3, wantExpiresIn: time.Hour},
+		{name: "longer temporary grant of the same permission", current: &models.Permission{Value: 2, ExpiresAt: now.Add(2 * time.Hour)},
+			requested: 2, duration: time.Hour, wantValue: 2, wantExpiresIn: 2 * time.Hour},
+		{name: "longer temporary grant the request widens", current: &models.Permission{Value: 1, ExpiresAt: now.Add(2 * time.Hour)},
+			requested: 3, duration: time.Hour, wantErr: permissions.ErrConflictingGrant, wantValue: 1, wantExpiresIn: 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p, s := newService(t)
+			appId, userId := newUser(t, s)
+			if tt.current != nil {
+				require.NoError(t, s.PermissionsStorage.Save(ctx, userId, tt.current.Value, tt.current.ExpiresAt))
+			}
+			requestId, err := p.RequestAccess(ctx, appId, userId, tt.requested, tt.duration, "on call")
+			require.NoError(t, err)
+
+			expiresAt, err := p.ApproveAccess(ctx, appId, requestId, "app:test")
+			req, getErr := s.AccessRequests.Get(ctx, requestId)
+			require.NoError(t, getErr)
+			perm, getErr := s.PermissionsStorage.Get(ctx, userId)
+			require.NoError(t, getErr)
+			require.Equal(t, tt.wantValue, perm.Value)
+			if tt.wantExpiresIn == 0 {
+				require.True(t, perm.ExpiresAt.IsZero(), "grant expires at %v, want permanent", perm.ExpiresAt)
+			} else {
+				require.WithinDuration(t, now.Add(tt.wantExpiresIn), perm.ExpiresAt, 5*time.Second)
+			}
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				require.Equal(t, models.AccessRequestPending, req.Status)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, expiresAt.Equal(perm.ExpiresAt), "returned expiry %v, stored %v", expiresAt, perm.ExpiresAt)
+			require.Equal(t, models.AccessRequestApproved, req.Status)
+			require.Equal(t, "app:test", req.Approver)
+		})
+	}
+}
+
+func TestDecideAccessOnce(t *testing.T) {
+	ctx := context.Background()
+	p, s := newService(t)
+	appId, userId := newUser(t, s)
+	requestId, err := p.RequestAccess(ctx, appId, userId, 2, time.Hour, "on call")
+	require.NoError(t, err)
+
+	_, err = p.ApproveAccess(ctx, appId+1, requestId, "app:other")
+	require.ErrorIs(t, err, storageErrors.ErrAccessRequestNotFound, "request of another app")
+
+	// Of concurrent decisions exactly one wins, the others find the request decided.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		decided int
+	)
+	for i := 0; i < 8; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = p.ApproveAccess(ctx, appId, requestId, "app:test")
+			} else {
+				err = p.DenyAccess(ctx, appId, requestId, "app:test")
+			}
+			if err == nil {
+				mu.Lock()
+				decided++
+				mu.Unlock()
+				return
+			}
+			require.ErrorIs(t, err, permissions.ErrRequestNotPending)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 1, decided)
+
+	require.ErrorIs(t, p.DenyAccess(ctx, appId, requestId, "app:test"), permissions.ErrRequestNotPending)
+}
+
+func TestSetUserPermission(t *testing.T) {
+	ctx := reqmeta.With(context.Background(), reqmeta.Meta{Actor: "app:test", OnBehalfOf: "alice", RequestId: "req-1"})
+	s := storage.NewMemory()
+	e := &events{}
+	p := permissions.New(slog.New(slog.NewTextHandler(io.Discard, nil)), s.Tx, s.PermissionsStorage, s.PermissionAudit, s.AccessRequests, e, scopes)
+	appId, userId := newUser(t, s)
+
+	_, err := p.GetUserPermission(ctx, userId)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound)
+	require.NoError(t, p.SetUserPermission(ctx, appId, userId, 1, time.Time{}))
+	require.NoError(t, p.SetUserPermission(ctx, appId, userId, 1, time.Time{}), "unchanged")
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, p.SetUserPermission(ctx, appId, userId, 3, expiresAt))
+	perm, err := p.GetUserPermission(ctx, userId)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), perm)
+
+	require.NoError(t, p.SetUserPermission(ctx, appId, userId, 3, time.Now().Add(-time.Second)))
+	_, err = p.GetUserPermission(ctx, userId)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound, "expired grant")
+
+	require.NoError(t, p.Delete(ctx, appId, userId))
+	require.NoError(t, p.Delete(ctx, appId, userId), "nothing to delete")
+
+	history, err := p.History(ctx, models.PermissionAuditFilter{AppId: appId, UserId: userId})
+	require.NoError(t, err)
+	actions := make([]string, 0, len(history))
+	for _, entry := range history {
+		require.Equal(t, "app:test", entry.Actor)
+		require.Equal(t, "alice", entry.OnBehalfOf)
+		require.Equal(t, "req-1", entry.RequestId)
+		actions = append(actions, entry.Action)
+	}
+	require.Equal(t, []string{models.PermissionRevoke, models.PermissionChange, models.PermissionChange, models.PermissionGrant}, actions, "newest first, the unchanged grant not recorded")
+	require.Equal(t, int32(1), history[2].OldValue)
+	require.True(t, history[2].NewExpiresAt.Equal(expiresAt))
+	require.Len(t, e.recorded, 4)
+	require.Equal(t, "revoke 3", e.recorded[3].Detail)
+
+	history, err = p.History(ctx, models.PermissionAuditFilter{Actor: "alice"})
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func TestRequestAccess(t *testing.T) {
+	ctx := context.Background()
+	p, s := newService(t)
+	appId, userId := newUser(t, s)
+
+	for _, d := range []time.Duration{0, -time.Hour} {
+		_, err := p.RequestAccess(ctx, appId, userId, 2, d, "on call")
+		require.ErrorIs(t, err, permissions.ErrInvalidDuration)
+	}
+	first, err := p.RequestAccess(ctx, appId, userId, 2, time.Hour, "on call")
+	require.NoError(t, err)
+	second, err := p.RequestAccess(ctx, appId, userId, 4, time.Hour, "incident")
+	require.NoError(t, err)
+	require.NoError(t, p.DenyAccess(ctx, appId, first, "app:test"))
+
+	pending, err := p.ListAccessRequests(ctx, appId, models.AccessRequestPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, second, pending[0].Id)
+	require.Equal(t, "incident", pending[0].Reason)
+	denied, err := p.ListAccessRequests(ctx, appId, models.AccessRequestDenied)
+	require.NoError(t, err)
+	require.Len(t, denied, 1)
+	require.Equal(t, "app:test", denied[0].Approver)
+	_, err = s.PermissionsStorage.Get(ctx, userId)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound, "denial grants nothing")
+}
@@ -0,0 +1,243 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var ErrInvalidSchema = errors.New("invalid attribute schema")
+
+// ValidationError reports why a profile update was rejected.
+type ValidationError struct {
+	Attribute string
+	Reason    string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("attribute %s: %s", e.Attribute, e.Reason)
+}
+
+var attributeName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+func (u *Users) GetSchema(ctx context.Context, appKey []byte) ([]models.AttributeDef, error) {
+	const op = "service.users.GetSchema"
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := u.profileStorage.GetSchema(ctx, app.Id)
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, err
+	}
+	return defs, nil
+}
+
+// SetSchema replaces the app's attribute schema. Values of attributes dropped
+// from the schema are kept but no longer returned.
+func (u *Users) SetSchema(ctx context.Context, appKey []byte, defs []models.AttributeDef) error {
+	const op = "service.users.SetSchema"
+	seen := make(map[string]bool, len(defs))
+	for _, d := range defs {
+		if !attributeName.MatchString(d.Name) {
+			return fmt.Errorf("%w: bad name %q", ErrInvalidSchema, d.Name)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("%w: duplicate attribute %q", ErrInvalidSchema, d.Name)
+		}
+		seen[d.Name] = true
+		switch d.Type {
+		case models.AttributeString, models.AttributeInt, models.AttributeBool:
+		default:
+			return fmt.Errorf("%w: attribute %q has unknown type %q", ErrInvalidSchema, d.Name, d.Type)
+		}
+		if _, err := compilePattern(d.Pattern); err != nil {
+			return fmt.Errorf("%w: attribute %q: %s", ErrInvalidSchema, d.Name, err.Error())
+		}
+	}
+
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return err
+	}
+	if err := u.profileStorage.SaveSchema(ctx, app.Id, defs); err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	return nil
+}
+
+// GetProfile returns the user's attributes that are part of the app's schema.
+func (u *Users) GetProfile(ctx context.Context, appKey []byte, login string) (map[string]string, error) {
+	const op = "service.users.GetProfile"
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return nil, err
+	}
+	user, err := u.userStorage.Get(ctx, app.Id, login)
+	if err != nil {
+		return nil, err
+	}
+	defs, attrs, err := u.profile(ctx, app.Id, user.Id)
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, err
+	}
+	profile := make(map[string]string, len(defs))
+	for _, d := range defs {
+		if v, ok := attrs[d.Name]; ok {
+			profile[d.Name] = v
+		}
+	}
+	return profile, nil
+}
+
+// UpdateProfile merges attrs into the user's profile; an empty value removes the attribute.
+// The merged profile must satisfy the app's schema, otherwise a *ValidationError is returned.
+func (u *Users) UpdateProfile(ctx context.Context, appKey []byte, login string, attrs map[string]string) error {
+	const op = "service.users.UpdateProfile"
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return err
+	}
+	user, err := u.userStorage.Get(ctx, app.Id, login)
+	if err != nil {
+		return err
+	}
+	defs, current, err := u.profile(ctx, app.Id, user.Id)
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	if err := u.validateProfile(ctx, app.Id, user.Id, defs, current, attrs); err != nil {
+		return err
+	}
+	if err := u.profileStorage.SetAttributes(ctx, app.Id, user.Id, attrs); err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	return nil
+}
+
+// ClaimAttributes returns the user's attributes marked as token claims, typed per the schema.
+func (u *Users) ClaimAttributes(ctx context.Context, appId int32, userId int64) (map[string]any, error) {
+	defs, attrs, err := u.profile(ctx, appId, userId)
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	for _, d := range defs {
+		v, ok := attrs[d.Name]
+		if !d.Claim || !ok {
+			continue
+		}
+		if claims == nil {
+			claims = make(map[string]any)
+		}
+		claims[d.Name] = typedValue(d.Type, v)
+	}
+	return claims, nil
+}
+
+func (u *Users) profile(ctx context.Context, appId int32, userId int64) ([]models.AttributeDef, map[string]string, error) {
+	defs, err := u.profileStorage.GetSchema(ctx, appId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(defs) == 0 {
+		return nil, nil, nil
+	}
+	attrs, err := u.profileStorage.GetAttributes(ctx, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return defs, attrs, nil
+}
+
+func (u *Users) validateProfile(ctx context.Context, appId int32, userId int64, defs []models.AttributeDef, current, update map[string]string) error {
+	byName := make(map[string]models.AttributeDef, len(defs))
+	for _, d := range defs {
+		byName[d.Name] = d
+	}
+	for name, value := range update {
+		d, ok := byName[name]
+		if !ok {
+			return &ValidationError{Attribute: name, Reason: "not in schema"}
+		}
+		if value == "" {
+			continue
+		}
+		if err := checkValue(d, value); err != nil {
+			return err
+		}
+		if d.Unique && value != current[name] {
+			taken, err := u.profileStorage.ValueTaken(ctx, appId, name, value, userId)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return &ValidationError{Attribute: name, Reason: "value is already taken"}
+			}
+		}
+	}
+	for _, d := range defs {
+		if !d.Required {
+			continue
+		}
+		v, ok := update[d.Name]
+		if !ok {
+			v = current[d.Name]
+		}
+		if v == "" {
+			return &ValidationError{Attribute: d.Name, Reason: "is required"}
+		}
+	}
+	return nil
+}
+
+func checkValue(d models.AttributeDef, value string) error {
+	switch d.Type {
+	case models.AttributeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return &ValidationError{Attribute: d.Name, Reason: "must be an integer"}
+		}
+	case models.AttributeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return &ValidationError{Attribute: d.Name, Reason: "must be a boolean"}
+		}
+	}
+	re, err := compilePattern(d.Pattern)
+	if err != nil {
+		return err
+	}
+	if re != nil && !re.MatchString(value) {
+		return &ValidationError{Attribute: d.Name, Reason: "doesn't match pattern"}
+	}
+	return nil
+}
+
+// compilePattern anchors pattern so it has to match the whole value.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+func typedValue(typ string, value string) any {
+	switch typ {
+	case models.AttributeInt:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case models.AttributeBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sessions returns the user's sessions that are neither revoked nor expired, newest first.
+func (u *Users) Sessions(ctx context.Context, appKey []byte, login string) ([]models.UserSession, error) {
+	const op = "service.users.Sessions"
+	_, user, err := u.liveUser(ctx, appKey, login)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := u.sessions.ListActive(ctx, user.Id, time.Now())
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one of the user's sessions. Sessions of other users and
+// ones already revoked are reported as storageErrors.ErrSessionNotFound.
+func (u *Users) RevokeSession(ctx context.Context, appKey []byte, login string, sessionId string) error {
+	const op = "service.users.RevokeSession"
+	_, user, err := u.liveUser(ctx, appKey, login)
+	if err != nil {
+		return err
+	}
+	if err := u.sessions.Revoke(ctx, user.Id, sessionId, time.Now()); err != nil {
+		if !errors.Is(err, storageErrors.ErrSessionNotFound) {
+			u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+		return err
+	}
+	u.recordEvent(ctx, models.AuthEventTokenRevoke, user, "session "+sessionId)
+	return nil
+}
+
+// RevokeSessions revokes every session of the user and returns how many there were.
+func (u *Users) RevokeSessions(ctx context.Context, appKey []byte, login string) (int64, error) {
+	const op = "service.users.RevokeSessions"
+	_, user, err := u.liveUser(ctx, appKey, login)
+	if err != nil {
+		return 0, err
+	}
+	n, err := u.sessions.RevokeAll(ctx, user.Id, time.Now())
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return 0, err
+	}
+	u.recordEvent(ctx, models.AuthEventTokenRevoke, user, fmt.Sprintf("%d sessions revoked", n))
+	return n, nil
+}
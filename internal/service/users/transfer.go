@@ -0,0 +1,508 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/password"
+	"SSO/internal/pkg/reqmeta"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	DefaultImportBatchSize = 500
+
+	// csvAttrPrefix marks CSV columns holding profile attributes, e.g. "attr.locale".
+	csvAttrPrefix = "attr."
+)
+
+var (
+	ErrUnknownFormat  = errors.New("unknown format")
+	ErrMalformedInput = errors.New("malformed input")
+)
+
+type ImportOptions struct {
+	// DryRun validates every row without writing anything.
+	DryRun    bool
+	BatchSize int
+}
+
+type RowError struct {
+	// Line is the 1-based line of the row in the input, the CSV header being line 1.
+	Line  int
+	Login string
+	Err   string
+}
+
+type ImportResult struct {
+	Total    int
+	Imported int
+	Failed   int
+	Errors   []RowError
+}
+
+// jsonRecord is one line of the JSON Lines format.
+type jsonRecord struct {
+	Login        string            `json:"login"`
+	Email        string            `json:"email,omitempty"`
+	PasswordHash string            `json:"password_hash"`
+	Role         *int32            `json:"role,omitempty"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+type importRow struct {
+	line   int
+	record models.UserRecord
+	err    error
+}
+
+// Import reads users in format from r and saves them to the app in batches, each batch in one transaction
+// together with the audit entries of the roles it grants. Invalid rows are skipped and reported in the
+// result; if a batch fails to save, its rows are saved one by one and only those failing are reported.
+func (u *Users) Import(ctx context.Context, appKey []byte, format string, r io.Reader, opts ImportOptions) (ImportResult, error) {
+	const op = "service.users.Import"
+	var res ImportResult
+	next, err := newRowReader(format, r)
+	if err != nil {
+		return res, err
+	}
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return res, err
+	}
+	defs, err := u.profileStorage.GetSchema(ctx, app.Id)
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return res, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatchSize
+	}
+
+	v := &importValidator{
+		users:  u,
+		appId:  app.Id,
+		defs:   defs,
+		logins: make(map[string]bool),
+		unique: make(map[string]bool),
+	}
+	var (
+		batch []models.UserRecord
+		lines []int
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := u.saveBatch(ctx, batch); err != nil {
+			u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+			for i, rec := range batch {
+				if err := u.saveBatch(ctx, batch[i:i+1]); err != nil {
+					res.addError(lines[i], rec.User.Login, err)
+					continue
+				}
+				res.Imported++
+			}
+		} else {
+			res.Imported += len(batch)
+		}
+		batch, lines = batch[:0], lines[:0]
+	}
+
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Total++
+		if row.err == nil {
+			row.record.User.AppId = app.Id
+			row.err = v.validate(ctx, &row.record)
+		}
+		if row.err != nil {
+			res.addError(row.line, row.record.User.Login, row.err)
+			continue
+		}
+		if opts.DryRun {
+			continue
+		}
+		batch = append(batch, row.record)
+		lines = append(lines, row.line)
+		if len(batch) == opts.BatchSize {
+			flush()
+		}
+	}
+	flush()
+	return res, nil
+}
+
+// saveBatch saves records in one transaction with a grant entry in the permission
+// audit trail for each role, and records the grants as authentication events.
+func (u *Users) saveBatch(ctx context.Context, records []models.UserRecord) error {
+	meta := reqmeta.From(ctx)
+	now := time.Now()
+	var ids []int64
+	err := u.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		ids, err = u.userStorage.SaveBatch(ctx, records)
+		if err != nil {
+			return err
+		}
+		for i, rec := range records {
+			if rec.Role == nil {
+				continue
+			}
+			if err := u.permAudit.Save(ctx, models.PermissionAuditEntry{
+				AppId:      rec.User.AppId,
+				UserId:     ids[i],
+				Actor:      meta.Actor,
+				OnBehalfOf: meta.OnBehalfOf,
+				Action:     models.PermissionGrant,
+				NewValue:   *rec.Role,
+				RequestId:  meta.RequestId,
+				CreatedAt:  now,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, rec := range records {
+		if rec.Role == nil {
+			continue
+		}
+		user := rec.User
+		user.Id = ids[i]
+		u.recordEvent(ctx, models.AuthEventPermissionChange, user, fmt.Sprintf("%s %d", models.PermissionGrant, *rec.Role))
+	}
+	return nil
+}
+
+func (r *ImportResult) addError(line int, login string, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, RowError{Line: line, Login: login, Err: err.Error()})
+}
+
+type importValidator struct {
+	users *Users
+	appId int32
+	defs  []models.AttributeDef
+	// logins and unique remember values seen earlier in the input.
+	logins map[string]bool
+	unique map[string]bool
+}
+
+func (v *importValidator) validate(ctx context.Context, rec *models.UserRecord) error {
+	user := &rec.User
+	if user.Login == "" {
+		return errors.New("login is required")
+	}
+	if err := password.Validate(user.PasswordHash); err != nil {
+		return err
+	}
+	if v.logins[user.Login] {
+		return errors.New("duplicate login in input")
+	}
+	exist, err := v.users.userStorage.TestOnExist(ctx, v.appId, user.Login)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errors.New("user already exists")
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	for name, value := range rec.Attributes {
+		if value == "" {
+			delete(rec.Attributes, name)
+		}
+	}
+	byName := make(map[string]models.AttributeDef, len(v.defs))
+	for _, d := range v.defs {
+		byName[d.Name] = d
+		if d.Required && rec.Attributes[d.Name] == "" {
+			return &ValidationError{Attribute: d.Name, Reason: "is required"}
+		}
+	}
+	var uniqueKeys []string
+	for name, value := range rec.Attributes {
+		d, ok := byName[name]
+		if !ok {
+			return &ValidationError{Attribute: name, Reason: "not in schema"}
+		}
+		if err := checkValue(d, value); err != nil {
+			return err
+		}
+		if !d.Unique {
+			continue
+		}
+		key := name + "\x00" + value
+		taken, err := v.users.profileStorage.ValueTaken(ctx, v.appId, name, value, 0)
+		if err != nil {
+			return err
+		}
+		if taken || v.unique[key] {
+			return &ValidationError{Attribute: name, Reason: "value is already taken"}
+		}
+		uniqueKeys = append(uniqueKeys, key)
+	}
+
+	v.logins[user.Login] = true
+	for _, key := range uniqueKeys {
+		v.unique[key] = true
+	}
+	return nil
+}
+
+// newRowReader returns a function yielding the input rows one by one and io.EOF at the end.
+// Rows that can't be decoded are returned with err set; a returned error stops the import.
+func newRowReader(format string, r io.Reader) (func() (importRow, error), error) {
+	switch format {
+	case FormatCSV:
+		return csvRowReader(r), nil
+	case FormatJSONL:
+		return jsonlRowReader(r), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+func csvRowReader(r io.Reader) func() (importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	var header []string
+	line := 1
+	return func() (importRow, error) {
+		if header == nil {
+			h, err := cr.Read()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return importRow{}, err
+				}
+				return importRow{}, fmt.Errorf("%w: csv header: %s", ErrMalformedInput, err.Error())
+			}
+			header = h
+		}
+		fields, err := cr.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.StartLine
+				return importRow{line: line, err: err}, nil
+			}
+			return importRow{}, err
+		}
+		line, _ = cr.FieldPos(0)
+		row := importRow{line: line}
+		if len(fields) != len(header) {
+			row.err = fmt.Errorf("expected %d fields, got %d", len(header), len(fields))
+			return row, nil
+		}
+		rec := &row.record
+		for i, name := range header {
+			value := fields[i]
+			switch {
+			case name == "login":
+				rec.User.Login = value
+			case name == "email":
+				rec.User.Email = value
+			case name == "password_hash":
+				rec.User.PasswordHash = []byte(value)
+			case name == "role":
+				if value == "" {
+					continue
+				}
+				role, err := strconv.ParseInt(value, 10, 32)
+				if err != nil {
+					row.err = fmt.Errorf("invalid role %q", value)
+					return row, nil
+				}
+				r := int32(role)
+				rec.Role = &r
+			case name == "created_at":
+				if value == "" {
+					continue
+				}
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					row.err = fmt.Errorf("invalid created_at %q", value)
+					return row, nil
+				}
+				rec.User.CreatedAt = t
+			case strings.HasPrefix(name, csvAttrPrefix):
+				if rec.Attributes == nil {
+					rec.Attributes = make(map[string]string)
+				}
+				rec.Attributes[strings.TrimPrefix(name, csvAttrPrefix)] = value
+			default:
+				row.err = fmt.Errorf("unknown column %q", name)
+				return row, nil
+			}
+		}
+		return row, nil
+	}
+}
+
+func jsonlRowReader(r io.Reader) func() (importRow, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	return func() (importRow, error) {
+		for sc.Scan() {
+			line++
+			if strings.TrimSpace(sc.Text()) == "" {
+				continue
+			}
+			row := importRow{line: line}
+			var jr jsonRecord
+			if err := json.Unmarshal(sc.Bytes(), &jr); err != nil {
+				row.err = err
+				return row, nil
+			}
+			row.record = models.UserRecord{
+				User: models.User{
+					Login:        jr.Login,
+					Email:        jr.Email,
+					PasswordHash: []byte(jr.PasswordHash),
+				},
+				Role:       jr.Role,
+				Attributes: jr.Attributes,
+			}
+			if jr.CreatedAt != nil {
+				row.record.User.CreatedAt = *jr.CreatedAt
+			}
+			return row, nil
+		}
+		if err := sc.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return importRow{}, fmt.Errorf("%w: line %d is too long", ErrMalformedInput, line+1)
+			}
+			return importRow{}, err
+		}
+		return importRow{}, io.EOF
+	}
+}
+
+// Export writes every user of the app to w in format and returns how many were written.
+// CSV output has one attr.<name> column per attribute of the app's schema.
+func (u *Users) Export(ctx context.Context, appKey []byte, format string, w io.Writer) (int, error) {
+	const op = "service.users.Export"
+	if format != FormatCSV && format != FormatJSONL {
+		return 0, ErrUnknownFormat
+	}
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return 0, err
+	}
+	defs, err := u.profileStorage.GetSchema(ctx, app.Id)
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return 0, err
+	}
+	attrNames := make([]string, 0, len(defs))
+	for _, d := range defs {
+		attrNames = append(attrNames, d.Name)
+	}
+	sort.Strings(attrNames)
+
+	var write func(rec models.UserRecord) error
+	if format == FormatCSV {
+		cw := csv.NewWriter(w)
+		defer cw.Flush()
+		header := []string{"login", "email", "password_hash", "role", "created_at"}
+		for _, name := range attrNames {
+			header = append(header, csvAttrPrefix+name)
+		}
+		if err := cw.Write(header); err != nil {
+			return 0, err
+		}
+		write = func(rec models.UserRecord) error {
+			role := ""
+			if rec.Role != nil {
+				role = strconv.Itoa(int(*rec.Role))
+			}
+			fields := []string{rec.User.Login, rec.User.Email, string(rec.User.PasswordHash), role, rec.User.CreatedAt.UTC().Format(time.RFC3339)}
+			for _, name := range attrNames {
+				fields = append(fields, rec.Attributes[name])
+			}
+			return cw.Write(fields)
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(rec models.UserRecord) error {
+			createdAt := rec.User.CreatedAt.UTC()
+			jr := jsonRecord{
+				Login:        rec.User.Login,
+				Email:        rec.User.Email,
+				PasswordHash: string(rec.User.PasswordHash),
+				Role:         rec.Role,
+				CreatedAt:    &createdAt,
+				Attributes:   make(map[string]string),
+			}
+			for _, name := range attrNames {
+				if v, ok := rec.Attributes[name]; ok {
+					jr.Attributes[name] = v
+				}
+			}
+			return enc.Encode(jr)
+		}
+	}
+
+	filter := models.UserFilter{AppId: app.Id, SortBy: models.UserSortId, Limit: MaxPageSize}
+	count := 0
+	for {
+		page, err := u.userStorage.List(ctx, filter)
+		if err != nil {
+			u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+			return count, err
+		}
+		for _, user := range page {
+			rec, err := u.record(ctx, user, len(attrNames) != 0)
+			if err != nil {
+				u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+				return count, err
+			}
+			if err := write(rec); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(page) < filter.Limit {
+			return count, nil
+		}
+		filter.AfterId = page[len(page)-1].Id
+	}
+}
+
+func (u *Users) record(ctx context.Context, user models.User, withAttrs bool) (models.UserRecord, error) {
+	rec := models.UserRecord{User: user}
+	perm, err := u.permStorage.Get(ctx, user.Id)
+	if err == nil && !perm.Expired(time.Now()) {
+		rec.Role = &perm.Value
+	}
+	if withAttrs {
+		if rec.Attributes, err = u.profileStorage.GetAttributes(ctx, user.Id); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
@@ -0,0 +1,248 @@
+package users_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/pkg/password"
+	"SSO/internal/pkg/reqmeta"
+	"SSO/internal/service/apps"
+	"SSO/internal/service/audit"
+	"SSO/internal/service/users"
+	"SSO/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newUsers returns the users service on a memory storage and the key of an app
+// whose schema has an integer employee_id attribute.
+func newUsers(t *testing.T) (*users.Users, *storage.Storage, []byte) {
+	t.Helper()
+	ctx := context.Background()
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := storage.NewMemory()
+	appsService := apps.New(l, s.Tx, s.AppStorage, s.AppArchive, time.Hour)
+	usersService := users.New(l, s.Tx, s.UserStorage, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, appsService, audit.New(l, s.Tx, s.AuthEvents, appsService, s.UserStorage, audit.NewStorageSink(s.AuthEvents)))
+	_, credential, err := appsService.NewApp(ctx, models.App{Name: "import"})
+	require.NoError(t, err)
+	appKey := []byte(credential)
+	require.NoError(t, usersService.SetSchema(ctx, appKey, []models.AttributeDef{{Name: "employee_id", Type: models.AttributeInt, Unique: true}}))
+	return usersService, s, appKey
+}
+
+func bcryptHash(t *testing.T) string {
+	t.Helper()
+	hash, err := password.Hash("secret")
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	hash := bcryptHash(t)
+	input := strings.Join([]string{
+		"login,email,password_hash,role,created_at,attr.employee_id",
+		"alice,alice@example.com," + hash + ",3,2020-01-02T03:04:05Z,1",
+		"bob,," + hash + ",admin,,",
+		"alice,," + hash + ",,,",
+		"carol,,plaintext,,,",
+		"dave," + hash,
+		"erin,," + hash + ",,,E-7",
+		"frank,," + hash + ",,yesterday,",
+		",," + hash + ",,,",
+		"hank,," + hash + ",,,1",
+		"ivan,," + hash + ",,,2",
+		// An unterminated quote runs to the end of the input.
+		"gina,,\"" + hash + ",,,",
+	}, "\n") + "\n"
+
+	res, err := u.Import(ctx, appKey, users.FormatCSV, strings.NewReader(input), users.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Imported)
+	require.Equal(t, res.Total, res.Imported+res.Failed)
+	want := map[int]string{
+		3:  "invalid role",
+		4:  "duplicate login in input",
+		5:  "unsupported password hash",
+		6:  "expected 6 fields, got 2",
+		7:  "must be an integer",
+		8:  "invalid created_at",
+		9:  "login is required",
+		10: "value is already taken",
+		12: "quote",
+	}
+	got := make(map[int]string, len(res.Errors))
+	for _, e := range res.Errors {
+		got[e.Line] = e.Err
+	}
+	require.Len(t, got, len(want), "errors %+v", res.Errors)
+	for line, msg := range want {
+		require.Contains(t, got[line], msg, "line %d", line)
+	}
+
+	alice, err := u.Get(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.Equal(t, "alice@example.com", alice.Email)
+	require.True(t, alice.CreatedAt.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	perm, err := s.PermissionsStorage.Get(ctx, alice.Id)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), perm.Value)
+	profile, err := u.GetProfile(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"employee_id": "1"}, profile)
+	require.NoError(t, password.Compare(alice.PasswordHash, "secret"))
+
+	_, err = u.Get(ctx, appKey, "ivan")
+	require.NoError(t, err)
+}
+
+func TestImportCSVUnknownColumn(t *testing.T) {
+	u, _, appKey := newUsers(t)
+	input := "login,password_hash,nickname\nalice," + bcryptHash(t) + ",al\n"
+	res, err := u.Import(context.Background(), appKey, users.FormatCSV, strings.NewReader(input), users.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, users.ImportResult{Total: 1, Failed: 1, Errors: []users.RowError{
+		{Line: 2, Login: "alice", Err: `unknown column "nickname"`},
+	}}, res)
+}
+
+func TestImportJSONL(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	hash := bcryptHash(t)
+	argon2Hash := "$argon2id$v=19$m=65536,t=3,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG"
+	input := strings.Join([]string{
+		fmt.Sprintf(`{"login":"alice","password_hash":%q,"role":2,"attributes":{"employee_id":"1"}}`, hash),
+		"",
+		`{"login":"bob",`,
+		fmt.Sprintf(`{"password_hash":%q}`, hash),
+		fmt.Sprintf(`{"login":"carol","password_hash":%q,"created_at":"2021-05-06T07:08:09Z"}`, argon2Hash),
+		fmt.Sprintf(`{"login":"dave","password_hash":%q,"attributes":{"badge":"x"}}`, hash),
+		fmt.Sprintf(`{"login":"erin","password_hash":%q,"role":"admin"}`, hash),
+		`{"login":"frank","password_hash":"$argon2id$v=19$m=1048576,t=3,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG"}`,
+	}, "\n")
+
+	res, err := u.Import(ctx, appKey, users.FormatJSONL, strings.NewReader(input), users.ImportOptions{BatchSize: 1})
+	require.NoError(t, err)
+	require.Equal(t, 7, res.Total, "the blank line is not a row")
+	require.Equal(t, 2, res.Imported)
+	lines := make([]int, 0, len(res.Errors))
+	for _, e := range res.Errors {
+		lines = append(lines, e.Line)
+	}
+	require.Equal(t, []int{3, 4, 6, 7, 8}, lines)
+	require.Equal(t, "login is required", res.Errors[1].Err)
+	require.Equal(t, "dave", res.Errors[2].Login)
+	require.Contains(t, res.Errors[2].Err, "not in schema")
+	require.Contains(t, res.Errors[4].Err, "out of bounds")
+
+	alice, err := u.Get(ctx, appKey, "alice")
+	require.NoError(t, err)
+	perm, err := s.PermissionsStorage.Get(ctx, alice.Id)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), perm.Value)
+	carol, err := u.Get(ctx, appKey, "carol")
+	require.NoError(t, err)
+	require.True(t, carol.CreatedAt.Equal(time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)))
+	require.Equal(t, argon2Hash, string(carol.PasswordHash))
+}
+
+func TestImportDryRun(t *testing.T) {
+	ctx := context.Background()
+	u, _, appKey := newUsers(t)
+	input := "login,password_hash\nalice," + bcryptHash(t) + "\nalice," + bcryptHash(t) + "\n"
+	res, err := u.Import(ctx, appKey, users.FormatCSV, strings.NewReader(input), users.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Total)
+	require.Equal(t, 0, res.Imported)
+	require.Equal(t, []users.RowError{{Line: 3, Login: "alice", Err: "duplicate login in input"}}, res.Errors)
+	_, err = u.Get(ctx, appKey, "alice")
+	require.Error(t, err, "dry run saved a user")
+}
+
+// failingBatches fails every batch holding the user with login.
+type failingBatches struct {
+	storage.UserStorage
+	login string
+}
+
+func (f failingBatches) SaveBatch(ctx context.Context, records []models.UserRecord) ([]int64, error) {
+	for _, r := range records {
+		if r.User.Login == f.login {
+			return nil, errors.New("batch failed on " + f.login)
+		}
+	}
+	return f.UserStorage.SaveBatch(ctx, records)
+}
+
+func TestImportBatchFallback(t *testing.T) {
+	ctx := reqmeta.With(context.Background(), reqmeta.Meta{Actor: "app:import", RequestId: "req-1"})
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := storage.NewMemory()
+	appsService := apps.New(l, s.Tx, s.AppStorage, s.AppArchive, time.Hour)
+	auditService := audit.New(l, s.Tx, s.AuthEvents, appsService, s.UserStorage, audit.NewStorageSink(s.AuthEvents))
+	u := users.New(l, s.Tx, failingBatches{UserStorage: s.UserStorage, login: "carol"}, s.UserSessions, s.ProfileStorage, s.PermissionsStorage, s.PermissionAudit, appsService, auditService)
+	app, credential, err := appsService.NewApp(ctx, models.App{Name: "import"})
+	require.NoError(t, err)
+	appKey := []byte(credential)
+
+	hash := bcryptHash(t)
+	input := "login,password_hash,role\nalice," + hash + ",2\nbob," + hash + ",\ncarol," + hash + ",1\n"
+	res, err := u.Import(ctx, appKey, users.FormatCSV, strings.NewReader(input), users.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Imported, "the rows of the failed batch are saved one by one")
+	require.Equal(t, []users.RowError{{Line: 4, Login: "carol", Err: "batch failed on carol"}}, res.Errors)
+
+	alice, err := u.Get(ctx, appKey, "alice")
+	require.NoError(t, err)
+	entries, err := s.PermissionAudit.List(ctx, models.PermissionAuditFilter{AppId: app.Id, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "only imported roles are audited")
+	require.Equal(t, alice.Id, entries[0].UserId)
+	require.Equal(t, models.PermissionGrant, entries[0].Action)
+	require.Equal(t, int32(2), entries[0].NewValue)
+	require.Equal(t, "app:import", entries[0].Actor)
+	require.Equal(t, "req-1", entries[0].RequestId)
+
+	events, err := s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Type: models.AuthEventPermissionChange, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, alice.Id, events[0].UserId)
+	require.Equal(t, "grant 2", events[0].Detail)
+}
+
+func TestImportMalformedInput(t *testing.T) {
+	u, _, appKey := newUsers(t)
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		wantErr error
+	}{
+		{name: "unknown format", format: "xml", input: "<users/>", wantErr: users.ErrUnknownFormat},
+		{name: "csv header", format: users.FormatCSV, input: "login,\"password_hash\n", wantErr: users.ErrMalformedInput},
+		{name: "jsonl line too long", format: users.FormatJSONL, input: "{}\n" + strings.Repeat("x", 1024*1024+1), wantErr: users.ErrMalformedInput},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := u.Import(context.Background(), appKey, tt.format, strings.NewReader(tt.input), users.ImportOptions{})
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestImportEmpty(t *testing.T) {
+	u, _, appKey := newUsers(t)
+	for _, format := range []string{users.FormatCSV, users.FormatJSONL} {
+		res, err := u.Import(context.Background(), appKey, format, strings.NewReader(""), users.ImportOptions{})
+		require.NoError(t, err, format)
+		require.Equal(t, users.ImportResult{}, res, format)
+	}
+}
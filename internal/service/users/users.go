@@ -0,0 +1,374 @@
+package users
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+var (
+	ErrInvalidPageToken = errors.New("invalid page token")
+	ErrInvalidSortField = errors.New("invalid sort field")
+	ErrInvalidStatus    = errors.New("invalid status")
+	ErrNotDeleted       = errors.New("user is not deleted")
+)
+
+type AppsProvider interface {
+	GetByKey(ctx context.Context, key []byte) (models.App, error)
+}
+
+// Auditor records authentication events.
+type Auditor interface {
+	Record(ctx context.Context, event models.AuthEvent)
+}
+
+type Users struct {
+	l              *slog.Logger
+	tx             storage.Transactor
+	userStorage    storage.UserStorage
+	sessions       storage.UserSessionStorage
+	profileStorage storage.ProfileStorage
+	permStorage    storage.PermissionsStorage
+	permAudit      storage.PermissionAuditStorage
+	appsProvider   AppsProvider
+	audit          Auditor
+}
+
+// New creates the service. Deletions and revoked sessions are recorded with audit,
+// roles granted by imports also in permAudit.
+func New(l *slog.Logger, tx storage.Transactor, userStorage storage.UserStorage, sessions storage.UserSessionStorage, profileStorage storage.ProfileStorage, permStorage storage.PermissionsStorage, permAudit storage.PermissionAuditStorage, appsProvider AppsProvider, audit Auditor) *Users {
+	return &Users{
+		l:              l,
+		tx:             tx,
+		userStorage:    userStorage,
+		sessions:       sessions,
+		profileStorage: profileStorage,
+		permStorage:    permStorage,
+		permAudit:      permAudit,
+		appsProvider:   appsProvider,
+		audit:          audit,
+	}
+}
+
+// ListQuery describes one page of a user listing. Zero values don't filter.
+type ListQuery struct {
+	Search      string
+	Substring   bool
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Status is one of the models.User* statuses. Empty lists everyone but soft-deleted users.
+	Status     string
+	MFAEnabled *bool
+	Role       *int32
+	// SortBy is one of the models.UserSort* fields, login by default.
+	SortBy    string
+	Desc      bool
+	PageSize  int
+	PageToken string
+}
+
+// List returns a page of the app's users and the token of the next page,
+// which is empty when there are no more users. A token is only valid with the
+// sort and filter of the query that returned it, others get ErrInvalidPageToken.
+func (u *Users) List(ctx context.Context, appKey []byte, q ListQuery) ([]models.User, string, error) {
+	const op = "service.users.List"
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch q.Status {
+	case "", models.UserActive, models.UserDisabled, models.UserSuspended, models.UserDeleted:
+	default:
+		return nil, "", ErrInvalidStatus
+	}
+	if q.SortBy == "" {
+		q.SortBy = models.UserSortLogin
+	}
+	switch q.SortBy {
+	case models.UserSortId, models.UserSortLogin, models.UserSortEmail, models.UserSortCreatedAt:
+	default:
+		return nil, "", ErrInvalidSortField
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = DefaultPageSize
+	}
+	if q.PageSize > MaxPageSize {
+		q.PageSize = MaxPageSize
+	}
+
+	filter := models.UserFilter{
+		AppId:       app.Id,
+		Search:      q.Search,
+		Substring:   q.Substring,
+		CreatedFrom: q.CreatedFrom,
+		CreatedTo:   q.CreatedTo,
+		Status:      q.Status,
+		MFAEnabled:  q.MFAEnabled,
+		Role:        q.Role,
+		SortBy:      q.SortBy,
+		Desc:        q.Desc,
+		Limit:       q.PageSize,
+	}
+	if q.PageToken != "" {
+		c, err := decodeCursor(q.PageToken)
+		if err != nil || c.SortBy != q.SortBy || c.Desc != q.Desc || c.Filter != q.filterHash() {
+			return nil, "", ErrInvalidPageToken
+		}
+		filter.AfterId = c.Id
+		switch q.SortBy {
+		case models.UserSortLogin, models.UserSortEmail:
+			filter.AfterValue = c.Value
+		case models.UserSortCreatedAt:
+			filter.AfterValue = time.Unix(0, c.Time)
+		}
+	}
+
+	users, err := u.userStorage.List(ctx, filter)
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return nil, "", err
+	}
+	if len(users) < q.PageSize {
+		return users, "", nil
+	}
+
+	last := users[len(users)-1]
+	c := cursor{SortBy: q.SortBy, Desc: q.Desc, Filter: q.filterHash(), Id: last.Id}
+	switch q.SortBy {
+	case models.UserSortLogin:
+		c.Value = last.Login
+	case models.UserSortEmail:
+		c.Value = last.Email
+	case models.UserSortCreatedAt:
+		c.Time = last.CreatedAt.UnixNano()
+	}
+	return users, c.encode(), nil
+}
+
+// SetStatus activates, disables or suspends the user until suspendedUntil.
+// Soft-deleted users have to be restored first.
+func (u *Users) SetStatus(ctx context.Context, appKey []byte, login string, status string, suspendedUntil time.Time) error {
+	const op = "service.users.SetStatus"
+	switch status {
+	case models.UserActive, models.UserDisabled:
+		suspendedUntil = time.Time{}
+	case models.UserSuspended:
+		if !suspendedUntil.After(time.Now()) {
+			return fmt.Errorf("%w: suspension must end in the future", ErrInvalidStatus)
+		}
+	default:
+		return ErrInvalidStatus
+	}
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return err
+	}
+	// The status is checked in the transaction so that a concurrent Delete isn't undone.
+	var user models.User
+	err = u.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if user, err = u.userStorage.Get(ctx, app.Id, login); err != nil {
+			return err
+		}
+		if user.Status == models.UserDeleted {
+			return storageErrors.ErrUserNotFound
+		}
+		return u.userStorage.UpdateStatus(ctx, app.Id, login, status, suspendedUntil, time.Time{})
+	})
+	if errors.Is(err, storageErrors.ErrUserNotFound) {
+		return err
+	}
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	detail := status
+	if status == models.UserSuspended {
+		detail += " until " + suspendedUntil.UTC().Format(time.RFC3339)
+	}
+	u.recordEvent(ctx, models.AuthEventStatusChange, user, detail)
+	return nil
+}
+
+// Restore reactivates a soft-deleted user that hasn't been purged yet.
+func (u *Users) Restore(ctx context.Context, appKey []byte, login string) error {
+	const op = "service.users.Restore"
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return err
+	}
+	var user models.User
+	err = u.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if user, err = u.userStorage.Get(ctx, app.Id, login); err != nil {
+			return err
+		}
+		if user.Status != models.UserDeleted {
+			return ErrNotDeleted
+		}
+		return u.userStorage.UpdateStatus(ctx, app.Id, login, models.UserActive, time.Time{}, time.Time{})
+	})
+	if errors.Is(err, storageErrors.ErrUserNotFound) || errors.Is(err, ErrNotDeleted) {
+		return err
+	}
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	u.recordEvent(ctx, models.AuthEventUserRestore, user, "")
+	return nil
+}
+
+// Get returns the user, soft-deleted ones included.
+func (u *Users) Get(ctx context.Context, appKey []byte, login string) (models.User, error) {
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return models.User{}, err
+	}
+	return u.userStorage.Get(ctx, app.Id, login)
+}
+
+// Delete soft-deletes the user, see auth.DeleteUser.
+func (u *Users) Delete(ctx context.Context, appKey []byte, login string) error {
+	const op = "service.users.Delete"
+	app, user, err := u.liveUser(ctx, appKey, login)
+	if err != nil {
+		return err
+	}
+	if err := u.userStorage.UpdateStatus(ctx, app.Id, user.Login, models.UserDeleted, time.Time{}, time.Now()); err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	u.recordEvent(ctx, models.AuthEventUserDelete, user, "")
+	return nil
+}
+
+// ResetMFA turns MFA off for the user, who has to enroll again where the app requires it.
+func (u *Users) ResetMFA(ctx context.Context, appKey []byte, login string) error {
+	const op = "service.users.ResetMFA"
+	app, user, err := u.liveUser(ctx, appKey, login)
+	if err != nil {
+		return err
+	}
+	if err := u.userStorage.SetMFAEnabled(ctx, app.Id, user.Login, false); err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	u.recordEvent(ctx, models.AuthEventMFAReset, user, "")
+	return nil
+}
+
+// RequirePasswordReset refuses the user's logins until the password is changed
+// and revokes the sessions the user already has.
+func (u *Users) RequirePasswordReset(ctx context.Context, appKey []byte, login string) error {
+	const op = "service.users.RequirePasswordReset"
+	app, user, err := u.liveUser(ctx, appKey, login)
+	if err != nil {
+		return err
+	}
+	var revoked int64
+	err = u.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := u.userStorage.SetPasswordResetRequired(ctx, app.Id, user.Login, true); err != nil {
+			return err
+		}
+		revoked, err = u.sessions.RevokeAll(ctx, user.Id, time.Now())
+		return err
+	})
+	if err != nil {
+		u.l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		return err
+	}
+	u.recordEvent(ctx, models.AuthEventTokenRevoke, user, fmt.Sprintf("password reset required, %d sessions revoked", revoked))
+	return nil
+}
+
+// recordEvent audits a successful change made to user.
+func (u *Users) recordEvent(ctx context.Context, eventType string, user models.User, detail string) {
+	u.audit.Record(ctx, models.AuthEvent{
+		Type:    eventType,
+		AppId:   user.AppId,
+		UserId:  user.Id,
+		Login:   user.Login,
+		Success: true,
+		Detail:  detail,
+	})
+}
+
+// liveUser gets the app and the user by login, treating soft-deleted users as missing.
+func (u *Users) liveUser(ctx context.Context, appKey []byte, login string) (models.App, models.User, error) {
+	app, err := u.appsProvider.GetByKey(ctx, appKey)
+	if err != nil {
+		return app, models.User{}, err
+	}
+	user, err := u.userStorage.Get(ctx, app.Id, login)
+	if err != nil {
+		return app, user, err
+	}
+	if user.Status == models.UserDeleted {
+		return app, models.User{}, storageErrors.ErrUserNotFound
+	}
+	return app, user, nil
+}
+
+// cursor is the sort key of the last user of a page. It also remembers the
+// ordering and the filter so a token can't be replayed against a different query.
+type cursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	Filter string `json:"f"`
+	Value  string `json:"v,omitempty"`
+	Time   int64  `json:"t,omitempty"`
+	Id     int64  `json:"i"`
+}
+
+// filterHash identifies the users q selects, whatever their order and page size.
+func (q ListQuery) filterHash() string {
+	var created [2]int64
+	for i, t := range []time.Time{q.CreatedFrom, q.CreatedTo} {
+		if !t.IsZero() {
+			created[i] = t.UnixNano()
+		}
+	}
+	b, _ := json.Marshal(struct {
+		Search    string
+		Substring bool
+		Created   [2]int64
+		Status    string
+		MFA       *bool
+		Role      *int32
+	}{q.Search, q.Substring, created, q.Status, q.MFAEnabled, q.Role})
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	if c.Id == 0 {
+		return c, ErrInvalidPageToken
+	}
+	return c, nil
+}
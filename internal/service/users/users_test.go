@@ -0,0 +1,302 @@
+package users_test
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/service/users"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// saveUser stores login in the app of appKey and returns the user.
+func saveUser(t *testing.T, u *users.Users, s *storage.Storage, appKey []byte, login string) models.User {
+	t.Helper()
+	ctx := context.Background()
+	clientId, _, _ := strings.Cut(string(appKey), ".")
+	app, err := s.AppStorage.GetByClientId(ctx, clientId)
+	require.NoError(t, err)
+	require.NoError(t, s.UserStorage.Save(ctx, models.User{AppId: app.Id, Login: login, PasswordHash: []byte(bcryptHash(t)), CreatedAt: time.Now()}))
+	user, err := u.Get(ctx, appKey, login)
+	require.NoError(t, err)
+	return user
+}
+
+// events returns the details of the app's events of eventType, oldest first.
+func events(t *testing.T, s *storage.Storage, appId int32, eventType string) []string {
+	t.Helper()
+	list, err := s.AuthEvents.List(context.Background(), models.AuthEventFilter{AppId: appId, Type: eventType, Limit: 100})
+	require.NoError(t, err)
+	details := make([]string, len(list))
+	for i, e := range list {
+		details[len(list)-1-i] = e.Detail
+	}
+	return details
+}
+
+func TestSetStatus(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	alice := saveUser(t, u, s, appKey, "alice")
+	until := time.Date(2099, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		status         string
+		suspendedUntil time.Time
+		wantErr        error
+		wantUntil      bool
+	}{
+		{name: "disable", status: models.UserDisabled, suspendedUntil: time.Now().Add(time.Hour)},
+		{name: "suspend", status: models.UserSuspended, suspendedUntil: until, wantUntil: true},
+		{name: "suspend into the past", status: models.UserSuspended, suspendedUntil: time.Now().Add(-time.Hour), wantErr: users.ErrInvalidStatus},
+		{name: "suspend without an end", status: models.UserSuspended, wantErr: users.ErrInvalidStatus},
+		{name: "delete", status: models.UserDeleted, wantErr: users.ErrInvalidStatus},
+		{name: "unknown status", status: "banned", wantErr: users.ErrInvalidStatus},
+		{name: "activate", status: models.UserActive, suspendedUntil: time.Now().Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		before, err := u.Get(ctx, appKey, "alice")
+		require.NoError(t, err)
+		err = u.SetStatus(ctx, appKey, "alice", tt.status, tt.suspendedUntil)
+		after, getErr := u.Get(ctx, appKey, "alice")
+		require.NoError(t, getErr)
+		if tt.wantErr != nil {
+			require.ErrorIs(t, err, tt.wantErr, tt.name)
+			require.Equal(t, before.Status, after.Status, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		require.Equal(t, tt.status, after.Status, tt.name)
+		require.Equal(t, tt.wantUntil, !after.SuspendedUntil.IsZero(), tt.name)
+	}
+
+	require.ErrorIs(t, u.SetStatus(ctx, appKey, "nobody", models.UserDisabled, time.Time{}), storageErrors.ErrUserNotFound)
+	require.NoError(t, u.Delete(ctx, appKey, "alice"))
+	require.ErrorIs(t, u.SetStatus(ctx, appKey, "alice", models.UserActive, time.Time{}), storageErrors.ErrUserNotFound, "deleted users are restored instead")
+	require.Equal(t, []string{"disabled", "suspended until 2099-01-02T03:04:05Z", "active"}, events(t, s, alice.AppId, models.AuthEventStatusChange))
+}
+
+func TestDeleteRestore(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	alice := saveUser(t, u, s, appKey, "alice")
+
+	require.ErrorIs(t, u.Restore(ctx, appKey, "alice"), users.ErrNotDeleted)
+	require.NoError(t, u.Delete(ctx, appKey, "alice"))
+	require.ErrorIs(t, u.Delete(ctx, appKey, "alice"), storageErrors.ErrUserNotFound)
+	user, err := u.Get(ctx, appKey, "alice")
+	require.NoError(t, err, "deleted users can still be looked up")
+	require.Equal(t, models.UserDeleted, user.Status)
+	require.False(t, user.DeletedAt.IsZero())
+	_, err = u.Sessions(ctx, appKey, "alice")
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+
+	require.NoError(t, u.Restore(ctx, appKey, "alice"))
+	user, err = u.Get(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.Equal(t, models.UserActive, user.Status)
+	require.True(t, user.DeletedAt.IsZero())
+	require.Len(t, events(t, s, alice.AppId, models.AuthEventUserRestore), 1)
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	alice := saveUser(t, u, s, appKey, "alice")
+	bob := saveUser(t, u, s, appKey, "bob")
+	now := time.Now()
+	for _, session := range []models.UserSession{
+		{Id: "a1", UserId: alice.Id, AppId: alice.AppId, CreatedAt: now.Add(-2 * time.Minute), ExpiresAt: now.Add(time.Hour)},
+		{Id: "a2", UserId: alice.Id, AppId: alice.AppId, CreatedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)},
+		{Id: "a3", UserId: alice.Id, AppId: alice.AppId, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		{Id: "b1", UserId: bob.Id, AppId: bob.AppId, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	} {
+		require.NoError(t, s.UserSessions.Save(ctx, session))
+	}
+	ids := func(login string) []string {
+		t.Helper()
+		sessions, err := u.Sessions(ctx, appKey, login)
+		require.NoError(t, err)
+		var ids []string
+		for _, session := range sessions {
+			ids = append(ids, session.Id)
+		}
+		return ids
+	}
+
+	require.Equal(t, []string{"a2", "a1"}, ids("alice"), "active ones, newest first")
+	require.ErrorIs(t, u.RevokeSession(ctx, appKey, "alice", "b1"), storageErrors.ErrSessionNotFound, "session of another user")
+	require.NoError(t, u.RevokeSession(ctx, appKey, "alice", "a2"))
+	require.ErrorIs(t, u.RevokeSession(ctx, appKey, "alice", "a2"), storageErrors.ErrSessionNotFound, "already revoked")
+	require.Equal(t, []string{"a1"}, ids("alice"))
+
+	// Requiring a password reset signs the user out everywhere.
+	require.NoError(t, u.RequirePasswordReset(ctx, appKey, "alice"))
+	require.Empty(t, ids("alice"))
+	user, err := u.Get(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.True(t, user.PasswordResetRequired)
+	require.Equal(t, []string{"b1"}, ids("bob"))
+
+	n, err := u.RevokeSessions(ctx, appKey, "bob")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	n, err = u.RevokeSessions(ctx, appKey, "bob")
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestResetMFA(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	alice := saveUser(t, u, s, appKey, "alice")
+	require.NoError(t, s.UserStorage.SetMFAEnabled(ctx, alice.AppId, "alice", true))
+
+	require.NoError(t, u.ResetMFA(ctx, appKey, "alice"))
+	user, err := u.Get(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.False(t, user.MFAEnabled)
+	require.ErrorIs(t, u.ResetMFA(ctx, appKey, "nobody"), storageErrors.ErrUserNotFound)
+	require.Len(t, events(t, s, alice.AppId, models.AuthEventMFAReset), 1)
+}
+
+func TestProfile(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	saveUser(t, u, s, appKey, "alice")
+	saveUser(t, u, s, appKey, "bob")
+
+	require.ErrorIs(t, u.SetSchema(ctx, appKey, []models.AttributeDef{{Name: "Bad Name", Type: models.AttributeString}}), users.ErrInvalidSchema)
+	require.NoError(t, u.SetSchema(ctx, appKey, []models.AttributeDef{
+		{Name: "employee_id", Type: models.AttributeInt, Unique: true, Claim: true},
+		{Name: "team", Type: models.AttributeString, Required: true, Pattern: "[a-z]+"},
+		{Name: "contractor", Type: models.AttributeBool},
+	}))
+	require.NoError(t, u.UpdateProfile(ctx, appKey, "bob", map[string]string{"employee_id": "1", "team": "ops"}))
+
+	tests := []struct {
+		name      string
+		attrs     map[string]string
+		attribute string
+	}{
+		{name: "required missing", attrs: map[string]string{"employee_id": "2"}, attribute: "team"},
+		{name: "not an integer", attrs: map[string]string{"employee_id": "x", "team": "dev"}, attribute: "employee_id"},
+		{name: "not a boolean", attrs: map[string]string{"contractor": "maybe", "team": "dev"}, attribute: "contractor"},
+		{name: "pattern matched in part", attrs: map[string]string{"team": "dev1"}, attribute: "team"},
+		{name: "value taken", attrs: map[string]string{"employee_id": "1", "team": "dev"}, attribute: "employee_id"},
+		{name: "not in schema", attrs: map[string]string{"badge": "x", "team": "dev"}, attribute: "badge"},
+	}
+	for _, tt := range tests {
+		err := u.UpdateProfile(ctx, appKey, "alice", tt.attrs)
+		var verr *users.ValidationError
+		require.True(t, errors.As(err, &verr), "%s: %v", tt.name, err)
+		require.Equal(t, tt.attribute, verr.Attribute, tt.name)
+	}
+	profile, err := u.GetProfile(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.Empty(t, profile, "rejected updates store nothing")
+
+	require.NoError(t, u.UpdateProfile(ctx, appKey, "alice", map[string]string{"employee_id": "2", "team": "dev", "contractor": "true"}))
+	require.NoError(t, u.UpdateProfile(ctx, appKey, "alice", map[string]string{"contractor": ""}), "empty values remove optional attributes")
+	profile, err = u.GetProfile(ctx, appKey, "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"employee_id": "2", "team": "dev"}, profile)
+	var verr *users.ValidationError
+	require.True(t, errors.As(u.UpdateProfile(ctx, appKey, "alice", map[string]string{"team": ""}), &verr), "required attributes can't be removed")
+
+	alice, err := u.Get(ctx, appKey, "alice")
+	require.NoError(t, err)
+	claims, err := u.ClaimAttributes(ctx, alice.AppId, alice.Id)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"employee_id": int64(2)}, claims)
+}
+
+func TestListPages(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	logins := []string{"amy", "ann", "bea", "bob", "cal", "cid", "dan"}
+	for _, login := range logins {
+		saveUser(t, u, s, appKey, login)
+	}
+	// page lists every page of q and returns the logins in order.
+	page := func(q users.ListQuery) []string {
+		t.Helper()
+		var got []string
+		for i := 0; ; i++ {
+			require.Less(t, i, len(logins), "pages don't end")
+			list, next, err := u.List(ctx, appKey, q)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(list), q.PageSize)
+			for _, user := range list {
+				got = append(got, user.Login)
+			}
+			if next == "" {
+				return got
+			}
+			q.PageToken = next
+		}
+	}
+
+	for _, sortBy := range []string{"", models.UserSortId, models.UserSortLogin, models.UserSortEmail, models.UserSortCreatedAt} {
+		require.Equal(t, logins, page(users.ListQuery{SortBy: sortBy, PageSize: 2}), sortBy)
+	}
+	require.Equal(t, []string{"dan", "cid", "cal", "bob", "bea", "ann", "amy"}, page(users.ListQuery{Desc: true, PageSize: 3}))
+	require.Equal(t, logins, page(users.ListQuery{PageSize: 7}), "a full last page")
+	require.Equal(t, []string{"bea", "bob"}, page(users.ListQuery{Search: "b", PageSize: 1}))
+	require.Equal(t, []string{"ann", "dan"}, page(users.ListQuery{Search: "an", Substring: true, PageSize: 1}))
+}
+
+func TestListPageToken(t *testing.T) {
+	ctx := context.Background()
+	u, s, appKey := newUsers(t)
+	for _, login := range []string{"amy", "ann", "bea", "bob"} {
+		saveUser(t, u, s, appKey, login)
+	}
+	yes := true
+	role := int32(1)
+	q := users.ListQuery{Search: "a", PageSize: 1}
+	_, token, err := u.List(ctx, appKey, q)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	q.PageToken = token
+	q.PageSize = 5
+	list, _, err := u.List(ctx, appKey, q)
+	require.NoError(t, err, "the page size may change between pages")
+	require.Len(t, list, 1)
+
+	// change alters the query the token was issued for.
+	tests := []struct {
+		name   string
+		change func(q *users.ListQuery)
+	}{
+		{name: "sort", change: func(q *users.ListQuery) { q.SortBy = models.UserSortEmail }},
+		{name: "order", change: func(q *users.ListQuery) { q.Desc = true }},
+		{name: "search", change: func(q *users.ListQuery) { q.Search = "b" }},
+		{name: "no search", change: func(q *users.ListQuery) { q.Search = "" }},
+		{name: "substring", change: func(q *users.ListQuery) { q.Substring = true }},
+		{name: "created from", change: func(q *users.ListQuery) { q.CreatedFrom = time.Now().Add(-time.Hour) }},
+		{name: "created to", change: func(q *users.ListQuery) { q.CreatedTo = time.Now() }},
+		{name: "status", change: func(q *users.ListQuery) { q.Status = models.UserActive }},
+		{name: "mfa", change: func(q *users.ListQuery) { q.MFAEnabled = &yes }},
+		{name: "role", change: func(q *users.ListQuery) { q.Role = &role }},
+		{name: "garbage", change: func(q *users.ListQuery) { q.PageToken = "garbage" }},
+		{name: "not a cursor", change: func(q *users.ListQuery) { q.PageToken = "e30" }},
+	}
+	for _, tt := range tests {
+		changed := q
+		tt.change(&changed)
+		_, _, err := u.List(ctx, appKey, changed)
+		require.ErrorIs(t, err, users.ErrInvalidPageToken, tt.name)
+	}
+
+	// The default sort is the login, named or not.
+	q.SortBy = models.UserSortLogin
+	_, _, err = u.List(ctx, appKey, q)
+	require.NoError(t, err)
+}
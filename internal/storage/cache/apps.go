@@ -0,0 +1,247 @@
+// Package cache wraps storages with in-process read-through caches.
+package cache
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type AppOptions struct {
+	// TTL is how long a found app is served from the cache. Zero disables caching.
+	TTL time.Duration
+	// NegativeTTL is how long an unknown key keeps being reported as not found.
+	// Zero doesn't cache misses.
+	NegativeTTL time.Duration
+	// MaxEntries bounds the cache, the least recently used keys being evicted first.
+	MaxEntries int
+	// OnInvalidate is called with the client id of every app this instance changes or
+	// deletes, and the context of the change. Several instances can publish it to the
+	// others, see Publisher and RunFollower, so their caches don't have to wait for
+	// the TTL to catch up.
+	OnInvalidate func(ctx context.Context, clientId string)
+	// Tx is the transactor of the wrapped storage. Apps changed in one of its
+	// transactions are invalidated again once it commits, as readers may have cached
+	// them anew in the meantime. Nil only invalidates them when they are changed.
+	Tx storage.Transactor
+}
+
+// AppStats counts cache lookups since the cache was created.
+type AppStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// AppStorage caches the app lookups of the storage it wraps.
+type AppStorage struct {
+	next storage.AppsStorage
+	opts AppOptions
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits, misses, evictions atomic.Uint64
+
+	// now is the clock entries expire by.
+	now func() time.Time
+}
+
+type appEntry struct {
+	key     string
+	app     models.App
+	found   bool
+	expires time.Time
+}
+
+func NewAppStorage(next storage.AppsStorage, opts AppOptions) *AppStorage {
+	return &AppStorage{
+		next:    next,
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (a *AppStorage) GetByClientId(ctx context.Context, clientId string) (models.App, error) {
+	return a.get("id:"+clientId, func() (models.App, error) {
+		return a.next.GetByClientId(ctx, clientId)
+	})
+}
+
+func (a *AppStorage) GetBySecretHash(ctx context.Context, secretHash []byte) (models.App, error) {
+	return a.get("hash:"+string(secretHash), func() (models.App, error) {
+		return a.next.GetBySecretHash(ctx, secretHash)
+	})
+}
+
+// get serves key from the cache, loading and caching it on a miss.
+func (a *AppStorage) get(key string, load func() (models.App, error)) (models.App, error) {
+	if e, ok := a.lookup(key); ok {
+		a.hits.Add(1)
+		if !e.found {
+			return models.App{}, storageErrors.ErrAppNotFound
+		}
+		return e.app, nil
+	}
+	a.misses.Add(1)
+
+	app, err := load()
+	switch {
+	case err == nil:
+		a.store(appEntry{key: key, app: app, found: true}, a.opts.TTL)
+	case errors.Is(err, storageErrors.ErrAppNotFound):
+		a.store(appEntry{key: key}, a.opts.NegativeTTL)
+	}
+	return app, err
+}
+
+func (a *AppStorage) Save(ctx context.Context, app models.App) (int32, error) {
+	id, err := a.next.Save(ctx, app)
+	if err != nil {
+		return 0, err
+	}
+	a.changed(ctx, app.ClientId)
+	key := "hash:" + string(app.SecretHash)
+	a.afterChange(ctx, func() { a.invalidateKey(key) })
+	return id, nil
+}
+
+func (a *AppStorage) Update(ctx context.Context, app models.App) error {
+	if err := a.next.Update(ctx, app); err != nil {
+		return err
+	}
+	a.changed(ctx, app.ClientId)
+	return nil
+}
+
+func (a *AppStorage) RotateSecret(ctx context.Context, clientId string, secretHash []byte, signingKey []byte, rotatedAt time.Time, prevExpiresAt time.Time) error {
+	if err := a.next.RotateSecret(ctx, clientId, secretHash, signingKey, rotatedAt, prevExpiresAt); err != nil {
+		return err
+	}
+	a.changed(ctx, clientId)
+	return nil
+}
+
+// SetSecretUsed only invalidates the local entries: other instances may serve
+// older usage times until their TTL runs out, which only makes them record it again.
+func (a *AppStorage) SetSecretUsed(ctx context.Context, clientId string, previous bool, usedAt time.Time) error {
+	if err := a.next.SetSecretUsed(ctx, clientId, previous, usedAt); err != nil {
+		return err
+	}
+	a.Invalidate(clientId)
+	return nil
+}
+
+func (a *AppStorage) CountData(ctx context.Context, appId int32) (models.AppData, error) {
+	return a.next.CountData(ctx, appId)
+}
+
+func (a *AppStorage) DeleteByClientId(ctx context.Context, clientId string) error {
+	if err := a.next.DeleteByClientId(ctx, clientId); err != nil {
+		return err
+	}
+	a.changed(ctx, clientId)
+	return nil
+}
+
+func (a *AppStorage) GetAll(ctx context.Context) ([]*models.App, error) {
+	return a.next.GetAll(ctx)
+}
+
+// Invalidate drops every entry of the app, e.g. when another instance changed it.
+func (a *AppStorage) Invalidate(clientId string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, el := range a.entries {
+		if e := el.Value.(*appEntry); key == "id:"+clientId || (e.found && e.app.ClientId == clientId) {
+			a.remove(el)
+		}
+	}
+}
+
+func (a *AppStorage) invalidateKey(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if el, ok := a.entries[key]; ok {
+		a.remove(el)
+	}
+}
+
+func (a *AppStorage) Stats() AppStats {
+	a.mu.Lock()
+	entries := a.lru.Len()
+	a.mu.Unlock()
+	return AppStats{
+		Hits:      a.hits.Load(),
+		Misses:    a.misses.Load(),
+		Evictions: a.evictions.Load(),
+		Entries:   entries,
+	}
+}
+
+// changed invalidates an app this instance wrote and tells the other instances about it.
+func (a *AppStorage) changed(ctx context.Context, clientId string) {
+	a.afterChange(ctx, func() { a.Invalidate(clientId) })
+	if a.opts.OnInvalidate != nil {
+		a.opts.OnInvalidate(ctx, clientId)
+	}
+}
+
+// afterChange runs invalidate right away and again after the transaction of ctx
+// commits, if there is one.
+func (a *AppStorage) afterChange(ctx context.Context, invalidate func()) {
+	invalidate()
+	if a.opts.Tx != nil {
+		a.opts.Tx.AfterCommit(ctx, func(context.Context) { invalidate() })
+	}
+}
+
+func (a *AppStorage) lookup(key string) (appEntry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	el, ok := a.entries[key]
+	if !ok {
+		return appEntry{}, false
+	}
+	e := el.Value.(*appEntry)
+	if a.now().After(e.expires) {
+		a.remove(el)
+		return appEntry{}, false
+	}
+	a.lru.MoveToFront(el)
+	return *e, true
+}
+
+func (a *AppStorage) store(e appEntry, ttl time.Duration) {
+	if ttl <= 0 || a.opts.MaxEntries <= 0 {
+		return
+	}
+	e.expires = a.now().Add(ttl)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if el, ok := a.entries[e.key]; ok {
+		el.Value = &e
+		a.lru.MoveToFront(el)
+		return
+	}
+	a.entries[e.key] = a.lru.PushFront(&e)
+	for a.lru.Len() > a.opts.MaxEntries {
+		a.remove(a.lru.Back())
+		a.evictions.Add(1)
+	}
+}
+
+func (a *AppStorage) remove(el *list.Element) {
+	a.lru.Remove(el)
+	delete(a.entries, el.Value.(*appEntry).key)
+}
@@ -0,0 +1,345 @@
+package cache
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// clock is a manually advanced AppStorage.now.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newCache(opts AppOptions) (*AppStorage, storage.AppsStorage, *clock) {
+	next := storage.NewMemory().AppStorage
+	a := NewAppStorage(next, opts)
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a.now = c.now
+	return a, next, c
+}
+
+// appKey returns an app whose secret hash derives from its client id.
+func appKey(clientId string) models.App {
+	return models.App{ClientId: clientId, SecretHash: []byte("hash:" + clientId)}
+}
+
+func save(t *testing.T, s storage.AppsStorage, app models.App) {
+	t.Helper()
+	_, err := s.Save(context.Background(), app)
+	require.NoError(t, err)
+}
+
+func stats(a *AppStorage) (hits uint64, misses uint64) {
+	s := a.Stats()
+	return s.Hits, s.Misses
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	a, next, c := newCache(AppOptions{TTL: time.Minute, NegativeTTL: time.Second, MaxEntries: 10})
+	save(t, next, appKey("a"))
+
+	for i := 0; i < 3; i++ {
+		_, err := a.GetByClientId(ctx, "a")
+		require.NoError(t, err)
+	}
+	hits, misses := stats(a)
+	require.Equal(t, uint64(2), hits)
+	require.Equal(t, uint64(1), misses)
+
+	// Changes made behind the cache show once the entry expires.
+	app := appKey("a")
+	app.Name = "renamed"
+	require.NoError(t, next.Update(ctx, app))
+	c.advance(time.Minute)
+	got, err := a.GetByClientId(ctx, "a")
+	require.NoError(t, err)
+	require.Empty(t, got.Name, "served until the TTL is over")
+	c.advance(time.Nanosecond)
+	got, err = a.GetByClientId(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "renamed", got.Name)
+	hits, misses = stats(a)
+	require.Equal(t, uint64(3), hits)
+	require.Equal(t, uint64(2), misses)
+}
+
+func TestNegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	a, next, c := newCache(AppOptions{TTL: time.Minute, NegativeTTL: 5 * time.Second, MaxEntries: 10})
+
+	_, err := a.GetByClientId(ctx, "a")
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	_, err = a.GetBySecretHash(ctx, []byte("hash:a"))
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+
+	save(t, next, appKey("a"))
+	_, err = a.GetByClientId(ctx, "a")
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound, "miss is remembered")
+	hits, misses := stats(a)
+	require.Equal(t, uint64(1), hits)
+	require.Equal(t, uint64(2), misses)
+
+	c.advance(5*time.Second + time.Nanosecond)
+	_, err = a.GetByClientId(ctx, "a")
+	require.NoError(t, err)
+	_, err = a.GetBySecretHash(ctx, []byte("hash:a"))
+	require.NoError(t, err)
+
+	// Saving through the cache drops the misses of the new app at once.
+	_, err = a.GetByClientId(ctx, "b")
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	_, err = a.GetBySecretHash(ctx, []byte("hash:b"))
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	save(t, a, appKey("b"))
+	_, err = a.GetByClientId(ctx, "b")
+	require.NoError(t, err)
+	_, err = a.GetBySecretHash(ctx, []byte("hash:b"))
+	require.NoError(t, err)
+
+	// Without a negative TTL misses always reach the storage.
+	a, _, _ = newCache(AppOptions{TTL: time.Minute, MaxEntries: 10})
+	for i := 0; i < 2; i++ {
+		_, err = a.GetByClientId(ctx, "a")
+		require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	}
+	hits, misses = stats(a)
+	require.Zero(t, hits)
+	require.Equal(t, uint64(2), misses)
+	require.Zero(t, a.Stats().Entries)
+}
+
+func TestLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	a, next, _ := newCache(AppOptions{TTL: time.Minute, NegativeTTL: time.Minute, MaxEntries: 2})
+	for _, id := range []string{"a", "b", "c"} {
+		save(t, next, appKey(id))
+	}
+	get := func(clientId string) {
+		t.Helper()
+		_, err := a.GetByClientId(ctx, clientId)
+		require.NoError(t, err)
+	}
+
+	get("a")
+	get("b")
+	get("a")
+	get("c") // evicts b, the least recently used
+	s := a.Stats()
+	require.Equal(t, uint64(1), s.Evictions)
+	require.Equal(t, 2, s.Entries)
+
+	get("a")
+	get("c")
+	hits, misses := stats(a)
+	require.Equal(t, uint64(3), hits)
+	require.Equal(t, uint64(3), misses)
+	get("b")
+	hits, misses = stats(a)
+	require.Equal(t, uint64(3), hits)
+	require.Equal(t, uint64(4), misses)
+	require.Equal(t, uint64(2), a.Stats().Evictions)
+
+	// Nothing is cached without room or a TTL.
+	for _, opts := range []AppOptions{{TTL: time.Minute}, {MaxEntries: 2}} {
+		a, next, _ = newCache(opts)
+		save(t, next, appKey("a"))
+		get("a")
+		require.Zero(t, a.Stats().Entries)
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	ctx := context.WithValue(context.Background(), struct{}{}, "change")
+	var invalidated []string
+	a, next, _ := newCache(AppOptions{
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+		MaxEntries:  10,
+		OnInvalidate: func(ctx context.Context, clientId string) {
+			require.Equal(t, "change", ctx.Value(struct{}{}), "the context of the change")
+			invalidated = append(invalidated, clientId)
+		},
+	})
+	save(t, next, appKey("a"))
+	save(t, next, appKey("b"))
+	// cached loads both keys of every app into the cache.
+	cached := func() {
+		t.Helper()
+		for _, id := range []string{"a", "b"} {
+			_, err := a.GetByClientId(ctx, id)
+			require.NoError(t, err)
+			_, err = a.GetBySecretHash(ctx, []byte("hash:"+id))
+			require.NoError(t, err)
+		}
+		require.Equal(t, 4, a.Stats().Entries)
+	}
+
+	cached()
+	a.Invalidate("a")
+	require.Equal(t, 2, a.Stats().Entries, "both keys of a are dropped, those of b kept")
+	require.Empty(t, invalidated, "Invalidate doesn't publish")
+
+	changes := []struct {
+		name   string
+		change func() error
+	}{
+		{"Update", func() error {
+			app := appKey("a")
+			app.Name = "renamed"
+			return a.Update(ctx, app)
+		}},
+		{"RotateSecret", func() error {
+			return a.RotateSecret(ctx, "a", []byte("hash:a"), []byte("key"), time.Now(), time.Now().Add(time.Hour))
+		}},
+		{"DeleteByClientId", func() error { return a.DeleteByClientId(ctx, "a") }},
+	}
+	for _, ch := range changes {
+		cached()
+		invalidated = nil
+		require.NoError(t, ch.change(), ch.name)
+		require.Equal(t, []string{"a"}, invalidated, ch.name)
+		require.Equal(t, 2, a.Stats().Entries, ch.name)
+	}
+	_, err := a.GetByClientId(ctx, "a")
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound, "deleted app is not served")
+
+	invalidated = nil
+	_, err = a.Save(ctx, appKey("a"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, invalidated, "Save")
+
+	// Recording secret usage only drops the local entries.
+	cached()
+	invalidated = nil
+	require.NoError(t, a.SetSecretUsed(ctx, "a", false, time.Now()))
+	require.Empty(t, invalidated)
+	require.Equal(t, 2, a.Stats().Entries)
+}
+
+// pendingTx is a storage.Transactor whose transaction stays open until commit is called.
+type pendingTx struct {
+	hooks []func(ctx context.Context)
+}
+
+func (p *pendingTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (p *pendingTx) AfterCommit(_ context.Context, fn func(ctx context.Context)) {
+	p.hooks = append(p.hooks, fn)
+}
+
+func (p *pendingTx) commit() {
+	for _, fn := range p.hooks {
+		fn(context.Background())
+	}
+	p.hooks = nil
+}
+
+func TestInvalidationAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	tx := &pendingTx{}
+	a, next, _ := newCache(AppOptions{TTL: time.Minute, NegativeTTL: time.Minute, MaxEntries: 10, Tx: tx})
+	save(t, next, appKey("a"))
+	get := func() {
+		t.Helper()
+		_, err := a.GetByClientId(ctx, "a")
+		require.NoError(t, err)
+	}
+
+	get()
+	app := appKey("a")
+	app.Name = "renamed"
+	require.NoError(t, a.Update(ctx, app))
+	require.Zero(t, a.Stats().Entries, "invalidated when changed")
+	// A reader outside of the transaction caches the app as it was before the commit.
+	get()
+	require.Equal(t, 1, a.Stats().Entries)
+	tx.commit()
+	require.Zero(t, a.Stats().Entries, "invalidated again once committed")
+}
+
+// feed is an InvalidationFeed in memory.
+type feed struct {
+	invalidations []models.AppInvalidation
+}
+
+func (f *feed) Publish(_ context.Context, clientId string, at time.Time) error {
+	f.invalidations = append(f.invalidations, models.AppInvalidation{Id: int64(len(f.invalidations) + 1), ClientId: clientId, CreatedAt: at})
+	return nil
+}
+
+func (f *feed) Since(_ context.Context, since time.Time) ([]models.AppInvalidation, error) {
+	var res []models.AppInvalidation
+	for _, inv := range f.invalidations {
+		if !inv.CreatedAt.Before(since) {
+			res = append(res, inv)
+		}
+	}
+	return res, nil
+}
+
+func (f *feed) DeleteBefore(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestFollow(t *testing.T) {
+	ctx := context.Background()
+	a, next, c := newCache(AppOptions{TTL: time.Hour, MaxEntries: 10})
+	f := &feed{}
+	// other is another instance, sharing next and publishing to f.
+	other := NewAppStorage(next, AppOptions{OnInvalidate: func(ctx context.Context, clientId string) {
+		require.NoError(t, f.Publish(ctx, clientId, c.now()))
+	}})
+	save(t, next, appKey("a"))
+	save(t, next, appKey("b"))
+	get := func(clientId string) models.App {
+		t.Helper()
+		app, err := a.GetByClientId(ctx, clientId)
+		require.NoError(t, err)
+		return app
+	}
+	get("a")
+	get("b")
+
+	app := appKey("a")
+	app.Name = "renamed"
+	require.NoError(t, other.Update(ctx, app))
+	require.Empty(t, get("a").Name, "not followed yet")
+
+	seen := make(map[int64]time.Time)
+	require.NoError(t, a.follow(ctx, f, c.now().Add(-time.Minute), seen))
+	require.Equal(t, "renamed", get("a").Name)
+	require.Equal(t, 2, a.Stats().Entries, "b is kept")
+
+	// An invalidation is applied once, however many polls it stays in the window of.
+	c.advance(time.Second)
+	require.NoError(t, a.follow(ctx, f, c.now().Add(-time.Minute), seen))
+	require.Equal(t, 2, a.Stats().Entries)
+	require.Len(t, seen, 1)
+
+	// Invalidations published late, in a transaction still running at the previous
+	// poll, are applied as long as they are in the window.
+	f.invalidations = append(f.invalidations, models.AppInvalidation{Id: 2, ClientId: "b", CreatedAt: c.now().Add(-30 * time.Second)})
+	require.NoError(t, a.follow(ctx, f, c.now().Add(-time.Minute), seen))
+	require.Equal(t, 1, a.Stats().Entries)
+
+	// Those out of the window are forgotten.
+	c.advance(2 * time.Minute)
+	require.NoError(t, a.follow(ctx, f, c.now().Add(-time.Minute), seen))
+	require.Empty(t, seen)
+}
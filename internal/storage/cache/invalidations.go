@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// invalidationLag is how late an invalidation may show up in the feed: the
+	// transaction publishing it may still be running, and the clocks of the instances
+	// may differ. Each poll reads that far back.
+	invalidationLag = 30 * time.Second
+	// invalidationRetention is how long published invalidations are kept.
+	invalidationRetention = 10 * time.Minute
+)
+
+// InvalidationFeed carries the invalidations of apps between the instances sharing a database.
+type InvalidationFeed interface {
+	Publish(ctx context.Context, clientId string, at time.Time) error
+	Since(ctx context.Context, since time.Time) ([]models.AppInvalidation, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Publisher returns an AppOptions.OnInvalidate publishing to feed, in the transaction
+// of the change when there is one. Failures are logged, leaving the other instances
+// to the TTL.
+func Publisher(l *slog.Logger, feed InvalidationFeed) func(ctx context.Context, clientId string) {
+	const op = "cache.Publisher"
+	return func(ctx context.Context, clientId string) {
+		if err := feed.Publish(ctx, clientId, time.Now()); err != nil {
+			l.Error(fmt.Errorf("%s: %w", op, err).Error())
+		}
+	}
+}
+
+// RunFollower invalidates the apps published to feed, polling it every interval
+// until ctx is done, and deletes the invalidations past their retention.
+// The instance's own invalidations come back too, which is harmless.
+func (a *AppStorage) RunFollower(ctx context.Context, l *slog.Logger, feed InvalidationFeed, interval time.Duration) {
+	const op = "cache.AppStorage.RunFollower"
+	seen := make(map[int64]time.Time)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := a.now()
+			if err := a.follow(ctx, feed, now.Add(-interval-invalidationLag), seen); err != nil {
+				l.Error(fmt.Errorf("%s: %w", op, err).Error())
+				continue
+			}
+			if _, err := feed.DeleteBefore(ctx, now.Add(-invalidationRetention)); err != nil {
+				l.Error(fmt.Errorf("%s: %w", op, err).Error())
+			}
+		}
+	}
+}
+
+// follow invalidates the apps published since the given time but for the
+// invalidations in seen, and forgets those of seen published before.
+func (a *AppStorage) follow(ctx context.Context, feed InvalidationFeed, since time.Time, seen map[int64]time.Time) error {
+	invalidations, err := feed.Since(ctx, since)
+	if err != nil {
+		return err
+	}
+	for _, inv := range invalidations {
+		if _, ok := seen[inv.Id]; ok {
+			continue
+		}
+		seen[inv.Id] = inv.CreatedAt
+		a.Invalidate(inv.ClientId)
+	}
+	for id, at := range seen {
+		if at.Before(since) {
+			delete(seen, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type AccessRequestsStorage struct {
+	db *DB
+}
+
+func NewAccessRequestsStorage(db *DB) *AccessRequestsStorage {
+	return &AccessRequestsStorage{
+		db: db,
+	}
+}
+
+func (a *AccessRequestsStorage) Save(ctx context.Context, req models.AccessRequest) (int64, error) {
+	const op = "AccessRequestsStorage.Save"
+	defer a.db.lock(ctx)()
+	if _, ok := a.db.users[req.UserId]; !ok {
+		return 0, fmt.Errorf("%s: %w", op, storageErrors.ErrUserNotFound)
+	}
+	a.db.lastAccessRequestId++
+	req.Id = a.db.lastAccessRequestId
+	req.Login = ""
+	req.Approver = ""
+	req.DecidedAt = time.Time{}
+	a.db.accessRequests[req.Id] = req
+	return req.Id, nil
+}
+
+func (a *AccessRequestsStorage) Get(ctx context.Context, id int64) (models.AccessRequest, error) {
+	defer a.db.lock(ctx)()
+	req, ok := a.db.accessRequest(id)
+	if !ok {
+		return models.AccessRequest{}, storageErrors.ErrAccessRequestNotFound
+	}
+	return req, nil
+}
+
+func (a *AccessRequestsStorage) GetByApp(ctx context.Context, appId int32, status string) ([]models.AccessRequest, error) {
+	defer a.db.lock(ctx)()
+	var reqs []models.AccessRequest
+	for id, req := range a.db.accessRequests {
+		if req.AppId != appId || (status != "" && req.Status != status) {
+			continue
+		}
+		if req, ok := a.db.accessRequest(id); ok {
+			reqs = append(reqs, req)
+		}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Id < reqs[j].Id })
+	return reqs, nil
+}
+
+func (a *AccessRequestsStorage) Decide(ctx context.Context, id int64, status string, approver string, decidedAt time.Time) error {
+	defer a.db.lock(ctx)()
+	req, ok := a.db.accessRequests[id]
+	if !ok || req.Status != models.AccessRequestPending {
+		return storageErrors.ErrAccessRequestDecided
+	}
+	req.Status, req.Approver, req.DecidedAt = status, approver, decidedAt
+	a.db.accessRequests[id] = req
+	return nil
+}
+
+// accessRequest returns the request with the login of its user filled in.
+func (s *state) accessRequest(id int64) (models.AccessRequest, bool) {
+	req, ok := s.accessRequests[id]
+	if !ok {
+		return req, false
+	}
+	user, ok := s.users[req.UserId]
+	if !ok {
+		return models.AccessRequest{}, false
+	}
+	req.Login = user.Login
+	return req, true
+}
@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"sort"
+	"time"
+)
+
+type AdminStorage struct {
+	db *DB
+}
+
+func NewAdminStorage(db *DB) *AdminStorage {
+	return &AdminStorage{
+		db: db,
+	}
+}
+
+func (a *AdminStorage) Save(ctx context.Context, admin models.Admin) (int64, error) {
+	defer a.db.lock(ctx)()
+	for _, other := range a.db.admins {
+		if other.Login == admin.Login {
+			return 0, storageErrors.ErrAdminExists
+		}
+	}
+	a.db.lastAdminId++
+	admin.Id = a.db.lastAdminId
+	a.db.admins[admin.Id] = admin
+	return admin.Id, nil
+}
+
+func (a *AdminStorage) ClaimBootstrap(ctx context.Context, _ time.Time) error {
+	defer a.db.lock(ctx)()
+	if a.db.bootstrapped {
+		return storageErrors.ErrAdminsBootstrapped
+	}
+	a.db.bootstrapped = true
+	return nil
+}
+
+func (a *AdminStorage) GetById(ctx context.Context, id int64) (models.Admin, error) {
+	defer a.db.lock(ctx)()
+	admin, ok := a.db.admins[id]
+	if !ok {
+		return models.Admin{}, storageErrors.ErrAdminNotFound
+	}
+	return admin, nil
+}
+
+func (a *AdminStorage) GetByLogin(ctx context.Context, login string) (models.Admin, error) {
+	defer a.db.lock(ctx)()
+	for _, admin := range a.db.admins {
+		if admin.Login == login {
+			return admin, nil
+		}
+	}
+	return models.Admin{}, storageErrors.ErrAdminNotFound
+}
+
+func (a *AdminStorage) List(ctx context.Context) ([]models.Admin, error) {
+	defer a.db.lock(ctx)()
+	admins := make([]models.Admin, 0, len(a.db.admins))
+	for _, admin := range a.db.admins {
+		admins = append(admins, admin)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].Login < admins[j].Login })
+	return admins, nil
+}
+
+func (a *AdminStorage) UpdateRole(ctx context.Context, id int64, role string) error {
+	defer a.db.lock(ctx)()
+	admin, ok := a.db.admins[id]
+	if !ok {
+		return storageErrors.ErrAdminNotFound
+	}
+	admin.Role = role
+	a.db.admins[id] = admin
+	return nil
+}
+
+func (a *AdminStorage) Delete(ctx context.Context, id int64) error {
+	defer a.db.lock(ctx)()
+	if _, ok := a.db.admins[id]; !ok {
+		return storageErrors.ErrAdminNotFound
+	}
+	delete(a.db.admins, id)
+	for key, s := range a.db.adminSessions {
+		if s.AdminId == id {
+			delete(a.db.adminSessions, key)
+		}
+	}
+	return nil
+}
+
+type AdminSessionStorage struct {
+	db *DB
+}
+
+func NewAdminSessionStorage(db *DB) *AdminSessionStorage {
+	return &AdminSessionStorage{
+		db: db,
+	}
+}
+
+func (a *AdminSessionStorage) Save(ctx context.Context, s models.AdminSession) error {
+	defer a.db.lock(ctx)()
+	a.db.adminSessions[string(s.TokenHash)] = s
+	return nil
+}
+
+func (a *AdminSessionStorage) Get(ctx context.Context, tokenHash []byte) (models.AdminSession, error) {
+	defer a.db.lock(ctx)()
+	s, ok := a.db.adminSessions[string(tokenHash)]
+	if !ok {
+		return models.AdminSession{}, storageErrors.ErrAdminSessionNotFound
+	}
+	return s, nil
+}
+
+func (a *AdminSessionStorage) Delete(ctx context.Context, tokenHash []byte) error {
+	defer a.db.lock(ctx)()
+	delete(a.db.adminSessions, string(tokenHash))
+	return nil
+}
+
+func (a *AdminSessionStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	defer a.db.lock(ctx)()
+	var n int64
+	for key, s := range a.db.adminSessions {
+		if !s.ExpiresAt.After(now) {
+			delete(a.db.adminSessions, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+)
+
+type AppArchiveStorage struct {
+	db *DB
+}
+
+func NewAppArchiveStorage(db *DB) *AppArchiveStorage {
+	return &AppArchiveStorage{
+		db: db,
+	}
+}
+
+func (a *AppArchiveStorage) Save(ctx context.Context, deleted models.DeletedApp) error {
+	defer a.db.lock(ctx)()
+	a.db.lastDeletedAppId++
+	deleted.Id = a.db.lastDeletedAppId
+	deleted.App = ownLists(deleted.App)
+	deleted.App.SecretHash, deleted.App.SigningKey, deleted.App.PrevSecretHash, deleted.App.PrevSigningKey = nil, nil, nil, nil
+	a.db.deletedApps = append(a.db.deletedApps, deleted)
+	return nil
+}
+
+func (a *AppArchiveStorage) List(ctx context.Context, clientId string, limit int) ([]models.DeletedApp, error) {
+	defer a.db.lock(ctx)()
+	var list []models.DeletedApp
+	// Records are appended in id order, so walking backwards lists the newest first.
+	for i := len(a.db.deletedApps) - 1; i >= 0 && len(list) < limit; i-- {
+		if d := a.db.deletedApps[i]; clientId == "" || d.App.ClientId == clientId {
+			d.App = ownLists(d.App)
+			list = append(list, d)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,173 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type AppStorage struct {
+	db *DB
+}
+
+func NewAppStorage(db *DB) *AppStorage {
+	return &AppStorage{
+		db: db,
+	}
+}
+
+func (a *AppStorage) Save(ctx context.Context, app models.App) (int32, error) {
+	const op = "memory.AppStorage.Save"
+	defer a.db.lock(ctx)()
+	for _, other := range a.db.apps {
+		if other.ClientId == app.ClientId || bytes.Equal(other.SecretHash, app.SecretHash) {
+			return 0, fmt.Errorf("%s: app already exists", op)
+		}
+	}
+	a.db.lastAppId++
+	app.Id = int32(a.db.lastAppId)
+	a.db.apps[app.Id] = ownLists(app)
+	return app.Id, nil
+}
+
+func (a *AppStorage) GetByClientId(ctx context.Context, clientId string) (models.App, error) {
+	defer a.db.lock(ctx)()
+	for _, app := range a.db.apps {
+		if app.ClientId == clientId {
+			return app, nil
+		}
+	}
+	return models.App{}, storageErrors.ErrAppNotFound
+}
+
+func (a *AppStorage) GetBySecretHash(ctx context.Context, secretHash []byte) (models.App, error) {
+	defer a.db.lock(ctx)()
+	for _, app := range a.db.apps {
+		if bytes.Equal(app.SecretHash, secretHash) || bytes.Equal(app.PrevSecretHash, secretHash) {
+			return app, nil
+		}
+	}
+	return models.App{}, storageErrors.ErrAppNotFound
+}
+
+func (a *AppStorage) Update(ctx context.Context, app models.App) error {
+	defer a.db.lock(ctx)()
+	for id, old := range a.db.apps {
+		if old.ClientId != app.ClientId {
+			continue
+		}
+		// Credentials and their usage only change through RotateSecret and SetSecretUsed.
+		app.Id, app.SecretHash, app.SigningKey = old.Id, old.SecretHash, old.SigningKey
+		app.SecretUsedAt, app.SecretRotatedAt = old.SecretUsedAt, old.SecretRotatedAt
+		app.PrevSecretHash, app.PrevSecretExpiresAt, app.PrevSecretUsedAt = old.PrevSecretHash, old.PrevSecretExpiresAt, old.PrevSecretUsedAt
+		app.PrevSigningKey, app.PrevSigningKeyExpiresAt = old.PrevSigningKey, old.PrevSigningKeyExpiresAt
+		a.db.apps[id] = ownLists(app)
+	}
+	return nil
+}
+
+// ownLists copies the app's lists so callers can't change the stored app through them.
+func ownLists(app models.App) models.App {
+	app.RedirectURIs = append([]string(nil), app.RedirectURIs...)
+	app.AllowedOrigins = append([]string(nil), app.AllowedOrigins...)
+	return app
+}
+
+func (a *AppStorage) RotateSecret(ctx context.Context, clientId string, secretHash []byte, signingKey []byte, rotatedAt time.Time, prevExpiresAt time.Time) error {
+	defer a.db.lock(ctx)()
+	for id, app := range a.db.apps {
+		if app.ClientId != clientId {
+			continue
+		}
+		app.PrevSecretHash, app.PrevSecretExpiresAt, app.PrevSecretUsedAt = app.SecretHash, prevExpiresAt, time.Time{}
+		app.SecretHash, app.SecretRotatedAt, app.SecretUsedAt = secretHash, rotatedAt, time.Time{}
+		app.PrevSigningKey, app.PrevSigningKeyExpiresAt, app.SigningKey = app.SigningKey, prevExpiresAt, signingKey
+		a.db.apps[id] = app
+		return nil
+	}
+	return storageErrors.ErrAppNotFound
+}
+
+func (a *AppStorage) SetSecretUsed(ctx context.Context, clientId string, previous bool, usedAt time.Time) error {
+	defer a.db.lock(ctx)()
+	for id, app := range a.db.apps {
+		if app.ClientId != clientId {
+			continue
+		}
+		if previous {
+			app.PrevSecretUsedAt = usedAt
+		} else {
+			app.SecretUsedAt = usedAt
+		}
+		a.db.apps[id] = app
+	}
+	return nil
+}
+
+func (a *AppStorage) CountData(ctx context.Context, appId int32) (models.AppData, error) {
+	defer a.db.lock(ctx)()
+	var data models.AppData
+	for id, user := range a.db.users {
+		if user.AppId != appId {
+			continue
+		}
+		data.Users++
+		if _, ok := a.db.perms[id]; ok {
+			data.Permissions++
+		}
+	}
+	for _, req := range a.db.accessRequests {
+		if req.AppId == appId {
+			data.AccessRequests++
+		}
+	}
+	for _, row := range a.db.attrs {
+		if row.appId == appId {
+			data.Attributes += int64(len(row.values))
+		}
+	}
+	for _, session := range a.db.userSessions {
+		if session.AppId == appId {
+			data.Sessions++
+		}
+	}
+	return data, nil
+}
+
+// DeleteByClientId removes the app together with its users and their data.
+func (a *AppStorage) DeleteByClientId(ctx context.Context, clientId string) error {
+	defer a.db.lock(ctx)()
+	for _, app := range a.db.apps {
+		if app.ClientId != clientId {
+			continue
+		}
+		delete(a.db.apps, app.Id)
+		delete(a.db.schemas, app.Id)
+		for id, user := range a.db.users {
+			if user.AppId == app.Id {
+				a.db.deleteUser(id)
+			}
+		}
+		for id, req := range a.db.accessRequests {
+			if req.AppId == app.Id {
+				delete(a.db.accessRequests, id)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *AppStorage) GetAll(ctx context.Context) ([]*models.App, error) {
+	defer a.db.lock(ctx)()
+	apps := make([]*models.App, 0, len(a.db.apps))
+	for _, app := range a.db.apps {
+		app := app
+		apps = append(apps, &app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Id < apps[j].Id })
+	return apps, nil
+}
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+)
+
+type AuthEventStorage struct {
+	db *DB
+}
+
+func NewAuthEventStorage(db *DB) *AuthEventStorage {
+	return &AuthEventStorage{
+		db: db,
+	}
+}
+
+func (a *AuthEventStorage) Save(ctx context.Context, e models.AuthEvent) error {
+	defer a.db.lock(ctx)()
+	a.db.lastAuthEventId++
+	e.Id = a.db.lastAuthEventId
+	a.db.authEvents = append(a.db.authEvents, e)
+	return nil
+}
+
+func (a *AuthEventStorage) List(ctx context.Context, f models.AuthEventFilter) ([]models.AuthEvent, error) {
+	defer a.db.lock(ctx)()
+	var events []models.AuthEvent
+	// Events are appended in id order, so walking backwards lists the newest first.
+	for i := len(a.db.authEvents) - 1; i >= 0 && len(events) < f.Limit; i-- {
+		e := a.db.authEvents[i]
+		ofUser := f.UserId != 0 && e.UserId == f.UserId || f.Login != "" && e.Login == f.Login
+		switch {
+		case e.AppId != f.AppId,
+			(f.UserId != 0 || f.Login != "") && !ofUser,
+			f.Type != "" && e.Type != f.Type,
+			!f.From.IsZero() && e.CreatedAt.Before(f.From),
+			!f.To.IsZero() && !e.CreatedAt.Before(f.To),
+			f.BeforeId != 0 && e.Id >= f.BeforeId:
+			continue
+		}
+		if user, ok := a.db.users[e.UserId]; ok && e.Login == "" {
+			e.Login = user.Login
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,183 @@
+// Package memory keeps all storage in process memory. It is meant for tests and
+// demos: nothing survives a restart.
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"sync"
+)
+
+// DB holds the tables of every storage of this package. A single mutex guards
+// them, and transactions hold it from start to end.
+type DB struct {
+	mu sync.Mutex
+	state
+}
+
+type state struct {
+	apps           map[int32]models.App
+	users          map[int64]models.User
+	perms          map[int64]models.Permission
+	audit          []models.PermissionAuditEntry
+	accessRequests map[int64]models.AccessRequest
+	schemas        map[int32][]models.AttributeDef
+	attrs          map[int64]attrRow
+	deletedApps    []models.DeletedApp
+	admins         map[int64]models.Admin
+	// adminSessions is keyed by the token hash.
+	adminSessions map[string]models.AdminSession
+	userSessions  map[string]models.UserSession
+	authEvents    []models.AuthEvent
+	// bootstrapped is set once the first admin was bootstrapped.
+	bootstrapped bool
+
+	lastAppId, lastUserId, lastAuditId, lastAccessRequestId, lastDeletedAppId, lastAdminId, lastAuthEventId int64
+}
+
+// attrRow is a user's profile attributes together with the app they were set in.
+type attrRow struct {
+	appId  int32
+	values map[string]string
+}
+
+func New() *DB {
+	return &DB{
+		state: state{
+			apps:           make(map[int32]models.App),
+			users:          make(map[int64]models.User),
+			perms:          make(map[int64]models.Permission),
+			accessRequests: make(map[int64]models.AccessRequest),
+			schemas:        make(map[int32][]models.AttributeDef),
+			attrs:          make(map[int64]attrRow),
+			admins:         make(map[int64]models.Admin),
+			adminSessions:  make(map[string]models.AdminSession),
+			userSessions:   make(map[string]models.UserSession),
+		},
+	}
+}
+
+type txKey struct{}
+
+// lock locks the DB unless ctx belongs to one of its transactions, which already holds the lock.
+func (d *DB) lock(ctx context.Context) (unlock func()) {
+	if d.inTx(ctx) {
+		return func() {}
+	}
+	d.mu.Lock()
+	return d.mu.Unlock
+}
+
+func (d *DB) inTx(ctx context.Context) bool {
+	tx, _ := ctx.Value(txKey{}).(*DB)
+	return tx == d
+}
+
+// withinTx runs fn holding the lock, or in the transaction ctx already carries.
+// When fn fails the tables are restored to what they were before it ran. Once it
+// succeeds, the functions registered with afterCommit run without the lock.
+func (d *DB) withinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if d.inTx(ctx) {
+		return fn(ctx)
+	}
+	var hooks []func()
+	if err := d.locked(context.WithValue(context.WithValue(ctx, txKey{}, d), hooksKey{}, &hooks), fn); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+func (d *DB) locked(ctx context.Context, fn func(ctx context.Context) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	snapshot := d.state.clone()
+	if err := fn(ctx); err != nil {
+		d.state = snapshot
+		return err
+	}
+	return nil
+}
+
+// hooksKey holds the functions to run once the transaction commits.
+type hooksKey struct{}
+
+func (d *DB) afterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	hooks, ok := ctx.Value(hooksKey{}).(*[]func())
+	if !ok {
+		fn(ctx)
+		return
+	}
+	*hooks = append(*hooks, func() {
+		fn(context.WithValue(context.WithValue(ctx, txKey{}, nil), hooksKey{}, nil))
+	})
+}
+
+func (s *state) clone() state {
+	c := *s
+	c.apps = cloneMap(s.apps)
+	c.users = cloneMap(s.users)
+	c.perms = cloneMap(s.perms)
+	c.audit = append([]models.PermissionAuditEntry(nil), s.audit...)
+	c.accessRequests = cloneMap(s.accessRequests)
+	c.deletedApps = append([]models.DeletedApp(nil), s.deletedApps...)
+	c.admins = cloneMap(s.admins)
+	c.adminSessions = cloneMap(s.adminSessions)
+	c.userSessions = cloneMap(s.userSessions)
+	c.authEvents = append([]models.AuthEvent(nil), s.authEvents...)
+	c.schemas = make(map[int32][]models.AttributeDef, len(s.schemas))
+	for appId, defs := range s.schemas {
+		c.schemas[appId] = append([]models.AttributeDef(nil), defs...)
+	}
+	c.attrs = make(map[int64]attrRow, len(s.attrs))
+	for userId, row := range s.attrs {
+		c.attrs[userId] = attrRow{appId: row.appId, values: cloneMap(row.values)}
+	}
+	return c
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// deleteUser removes the user and everything that references it.
+func (s *state) deleteUser(id int64) {
+	delete(s.users, id)
+	delete(s.perms, id)
+	delete(s.attrs, id)
+	for reqId, req := range s.accessRequests {
+		if req.UserId == id {
+			delete(s.accessRequests, reqId)
+		}
+	}
+	for sessionId, session := range s.userSessions {
+		if session.UserId == id {
+			delete(s.userSessions, sessionId)
+		}
+	}
+}
+
+type Transactor struct {
+	db *DB
+}
+
+func NewTransactor(db *DB) *Transactor {
+	return &Transactor{
+		db: db,
+	}
+}
+
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return t.db.withinTx(ctx, fn)
+}
+
+func (t *Transactor) AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	t.db.afterCommit(ctx, fn)
+}
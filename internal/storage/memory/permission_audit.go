@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+)
+
+type PermissionAuditStorage struct {
+	db *DB
+}
+
+func NewPermissionAuditStorage(db *DB) *PermissionAuditStorage {
+	return &PermissionAuditStorage{
+		db: db,
+	}
+}
+
+func (p *PermissionAuditStorage) Save(ctx context.Context, e models.PermissionAuditEntry) error {
+	defer p.db.lock(ctx)()
+	p.db.lastAuditId++
+	e.Id = p.db.lastAuditId
+	e.Login = ""
+	p.db.audit = append(p.db.audit, e)
+	return nil
+}
+
+func (p *PermissionAuditStorage) List(ctx context.Context, f models.PermissionAuditFilter) ([]models.PermissionAuditEntry, error) {
+	defer p.db.lock(ctx)()
+	var entries []models.PermissionAuditEntry
+	// Entries are appended in id order, so walking backwards lists the newest first.
+	for i := len(p.db.audit) - 1; i >= 0 && len(entries) < f.Limit; i-- {
+		e := p.db.audit[i]
+		switch {
+		case e.AppId != f.AppId,
+			f.UserId != 0 && e.UserId != f.UserId,
+			f.Actor != "" && e.Actor != f.Actor,
+			!f.From.IsZero() && e.CreatedAt.Before(f.From),
+			!f.To.IsZero() && !e.CreatedAt.Before(f.To),
+			f.BeforeId != 0 && e.Id >= f.BeforeId:
+			continue
+		}
+		if user, ok := p.db.users[e.UserId]; ok {
+			e.Login = user.Login
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"fmt"
+	"time"
+)
+
+type PermissionsStorage struct {
+	db *DB
+}
+
+func NewPermissionsStorage(db *DB) *PermissionsStorage {
+	return &PermissionsStorage{
+		db: db,
+	}
+}
+
+func (p *PermissionsStorage) Save(ctx context.Context, userId int64, value int32, expiresAt time.Time) error {
+	const op = "PermissionsStorage.Save"
+	defer p.db.lock(ctx)()
+	if _, ok := p.db.perms[userId]; ok {
+		return fmt.Errorf("%s: user %d already has a permission", op, userId)
+	}
+	if _, ok := p.db.users[userId]; !ok {
+		return fmt.Errorf("%s: %w", op, storageErrors.ErrUserNotFound)
+	}
+	p.db.perms[userId] = models.Permission{UserId: userId, Value: value, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (p *PermissionsStorage) Get(ctx context.Context, userId int64) (models.Permission, error) {
+	defer p.db.lock(ctx)()
+	perm, ok := p.db.perms[userId]
+	if !ok {
+		return models.Permission{UserId: userId}, storageErrors.ErrPermissionNotFound
+	}
+	return perm, nil
+}
+
+func (p *PermissionsStorage) Update(ctx context.Context, userId int64, value int32, expiresAt time.Time) error {
+	defer p.db.lock(ctx)()
+	if _, ok := p.db.perms[userId]; ok {
+		p.db.perms[userId] = models.Permission{UserId: userId, Value: value, ExpiresAt: expiresAt}
+	}
+	return nil
+}
+
+func (p *PermissionsStorage) Delete(ctx context.Context, userId int64) error {
+	defer p.db.lock(ctx)()
+	delete(p.db.perms, userId)
+	return nil
+}
+
+func (p *PermissionsStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	defer p.db.lock(ctx)()
+	var n int64
+	for userId, perm := range p.db.perms {
+		if !perm.ExpiresAt.IsZero() && !perm.ExpiresAt.After(now) {
+			delete(p.db.perms, userId)
+			n++
+		}
+	}
+	return n, nil
+}
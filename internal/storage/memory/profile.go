@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"sort"
+)
+
+type ProfileStorage struct {
+	db *DB
+}
+
+func NewProfileStorage(db *DB) *ProfileStorage {
+	return &ProfileStorage{
+		db: db,
+	}
+}
+
+func (p *ProfileStorage) GetSchema(ctx context.Context, appId int32) ([]models.AttributeDef, error) {
+	defer p.db.lock(ctx)()
+	defs := append([]models.AttributeDef(nil), p.db.schemas[appId]...)
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs, nil
+}
+
+func (p *ProfileStorage) SaveSchema(ctx context.Context, appId int32, defs []models.AttributeDef) error {
+	defer p.db.lock(ctx)()
+	if len(defs) == 0 {
+		delete(p.db.schemas, appId)
+		return nil
+	}
+	p.db.schemas[appId] = append([]models.AttributeDef(nil), defs...)
+	return nil
+}
+
+func (p *ProfileStorage) GetAttributes(ctx context.Context, userId int64) (map[string]string, error) {
+	defer p.db.lock(ctx)()
+	return cloneMap(p.db.attrs[userId].values), nil
+}
+
+func (p *ProfileStorage) SetAttributes(ctx context.Context, appId int32, userId int64, attrs map[string]string) error {
+	defer p.db.lock(ctx)()
+	row, ok := p.db.attrs[userId]
+	if !ok {
+		row = attrRow{appId: appId, values: make(map[string]string)}
+	}
+	for name, value := range attrs {
+		if value == "" {
+			delete(row.values, name)
+		} else {
+			row.values[name] = value
+		}
+	}
+	if len(row.values) == 0 {
+		delete(p.db.attrs, userId)
+		return nil
+	}
+	p.db.attrs[userId] = row
+	return nil
+}
+
+func (p *ProfileStorage) ValueTaken(ctx context.Context, appId int32, name string, value string, userId int64) (bool, error) {
+	defer p.db.lock(ctx)()
+	for id, row := range p.db.attrs {
+		if v, ok := row.values[name]; ok && v == value && id != userId && row.appId == appId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"sort"
+	"time"
+)
+
+type UserSessionStorage struct {
+	db *DB
+}
+
+func NewUserSessionStorage(db *DB) *UserSessionStorage {
+	return &UserSessionStorage{
+		db: db,
+	}
+}
+
+func (u *UserSessionStorage) Save(ctx context.Context, session models.UserSession) error {
+	defer u.db.lock(ctx)()
+	u.db.userSessions[session.Id] = session
+	return nil
+}
+
+func (u *UserSessionStorage) Get(ctx context.Context, id string) (models.UserSession, error) {
+	defer u.db.lock(ctx)()
+	session, ok := u.db.userSessions[id]
+	if !ok {
+		return models.UserSession{}, storageErrors.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (u *UserSessionStorage) ListActive(ctx context.Context, userId int64, now time.Time) ([]models.UserSession, error) {
+	defer u.db.lock(ctx)()
+	var sessions []models.UserSession
+	for _, session := range u.db.userSessions {
+		if session.UserId == userId && session.Active(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+		}
+		return sessions[i].Id > sessions[j].Id
+	})
+	return sessions, nil
+}
+
+func (u *UserSessionStorage) Revoke(ctx context.Context, userId int64, id string, at time.Time) error {
+	defer u.db.lock(ctx)()
+	session, ok := u.db.userSessions[id]
+	if !ok || session.UserId != userId || !session.RevokedAt.IsZero() {
+		return storageErrors.ErrSessionNotFound
+	}
+	session.RevokedAt = at
+	u.db.userSessions[id] = session
+	return nil
+}
+
+func (u *UserSessionStorage) RevokeAll(ctx context.Context, userId int64, at time.Time) (int64, error) {
+	defer u.db.lock(ctx)()
+	var n int64
+	for id, session := range u.db.userSessions {
+		if session.UserId == userId && session.RevokedAt.IsZero() {
+			session.RevokedAt = at
+			u.db.userSessions[id] = session
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (u *UserSessionStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	defer u.db.lock(ctx)()
+	var n int64
+	for id, session := range u.db.userSessions {
+		if !session.ExpiresAt.After(now) {
+			delete(u.db.userSessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
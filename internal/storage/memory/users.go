@@ -0,0 +1,303 @@
+package memory
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type UserStorage struct {
+	db *DB
+}
+
+func NewUserStorage(db *DB) *UserStorage {
+	return &UserStorage{
+		db: db,
+	}
+}
+
+func (u *UserStorage) Save(ctx context.Context, user models.User) error {
+	const op = "userStorage.Save"
+	defer u.db.lock(ctx)()
+	if _, err := u.db.insertUser(user); err != nil {
+		if err == storageErrors.ErrUserExists {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserStorage) SaveBatch(ctx context.Context, records []models.UserRecord) ([]int64, error) {
+	const op = "userStorage.SaveBatch"
+	ids := make([]int64, 0, len(records))
+	err := u.db.withinTx(ctx, func(ctx context.Context) error {
+		for _, r := range records {
+			id, err := u.db.insertUser(r.User)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", op, r.User.Login, err)
+			}
+			if r.Role != nil {
+				u.db.perms[id] = models.Permission{UserId: id, Value: *r.Role}
+			}
+			if len(r.Attributes) != 0 {
+				u.db.attrs[id] = attrRow{appId: r.User.AppId, values: cloneMap(r.Attributes)}
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// insertUser adds an active user, the caller holding the lock.
+func (s *state) insertUser(user models.User) (int64, error) {
+	if _, ok := s.apps[user.AppId]; !ok {
+		return 0, storageErrors.ErrAppNotFound
+	}
+	if _, ok := s.userByLogin(user.AppId, user.Login); ok {
+		return 0, storageErrors.ErrUserExists
+	}
+	s.lastUserId++
+	user.Id = s.lastUserId
+	user.Status = models.UserActive
+	user.SuspendedUntil = time.Time{}
+	user.DeletedAt = time.Time{}
+	s.users[user.Id] = user
+	return user.Id, nil
+}
+
+func (u *UserStorage) Get(ctx context.Context, appId int32, login string) (models.User, error) {
+	defer u.db.lock(ctx)()
+	user, ok := u.db.userByLogin(appId, login)
+	if !ok {
+		return models.User{}, storageErrors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (u *UserStorage) List(ctx context.Context, f models.UserFilter) ([]models.User, error) {
+	const op = "userStorage.List"
+	key, ok := userSortKeys[f.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown sort field %q", op, f.SortBy)
+	}
+	defer u.db.lock(ctx)()
+
+	now := time.Now()
+	var users []models.User
+	for _, user := range u.db.users {
+		if u.db.matches(user, f, now) {
+			users = append(users, user)
+		}
+	}
+	// less orders users by the sort key and then by id, in the requested direction.
+	less := func(a, b models.User) bool {
+		c := compareKeys(key(a), key(b))
+		if c == 0 {
+			c = compareKeys(a.Id, b.Id)
+		}
+		if f.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(users, func(i, j int) bool { return less(users[i], users[j]) })
+
+	if f.AfterId != 0 {
+		after := models.User{Id: f.AfterId}
+		switch f.SortBy {
+		case models.UserSortLogin:
+			after.Login, _ = f.AfterValue.(string)
+		case models.UserSortEmail:
+			after.Email, _ = f.AfterValue.(string)
+		case models.UserSortCreatedAt:
+			after.CreatedAt, _ = f.AfterValue.(time.Time)
+		}
+		i := sort.Search(len(users), func(i int) bool { return less(after, users[i]) })
+		users = users[i:]
+	}
+	if f.Limit >= 0 && len(users) > f.Limit {
+		users = users[:f.Limit]
+	}
+	return users, nil
+}
+
+var userSortKeys = map[string]func(models.User) any{
+	models.UserSortId:        func(u models.User) any { return u.Id },
+	models.UserSortLogin:     func(u models.User) any { return u.Login },
+	models.UserSortEmail:     func(u models.User) any { return u.Email },
+	models.UserSortCreatedAt: func(u models.User) any { return u.CreatedAt },
+}
+
+func compareKeys(a, b any) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		b := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	}
+	return 0
+}
+
+// matches reports whether user passes every filter of f except the page bounds.
+func (s *state) matches(user models.User, f models.UserFilter, now time.Time) bool {
+	if user.AppId != f.AppId {
+		return false
+	}
+	if f.Role != nil {
+		perm, ok := s.perms[user.Id]
+		if !ok || perm.Value != *f.Role || perm.Expired(now) {
+			return false
+		}
+	}
+	if f.Search != "" && !matchSearch(user.Login, f.Search, f.Substring) && !matchSearch(user.Email, f.Search, f.Substring) {
+		return false
+	}
+	if !f.CreatedFrom.IsZero() && user.CreatedAt.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !user.CreatedAt.Before(f.CreatedTo) {
+		return false
+	}
+	switch f.Status {
+	case "":
+		if user.Status == models.UserDeleted {
+			return false
+		}
+	case models.UserActive, models.UserSuspended:
+		if user.StatusAt(now) != f.Status {
+			return false
+		}
+	default:
+		if user.Status != f.Status {
+			return false
+		}
+	}
+	if f.MFAEnabled != nil && user.MFAEnabled != *f.MFAEnabled {
+		return false
+	}
+	return true
+}
+
+// matchSearch matches like the SQL backends' case-insensitive LIKE.
+func matchSearch(s, search string, substring bool) bool {
+	s, search = strings.ToLower(s), strings.ToLower(search)
+	if substring {
+		return strings.Contains(s, search)
+	}
+	return strings.HasPrefix(s, search)
+}
+
+// Delete removes the user together with its permission, profile, sessions and access requests.
+func (u *UserStorage) Delete(ctx context.Context, appId int32, login string) error {
+	defer u.db.lock(ctx)()
+	if user, ok := u.db.userByLogin(appId, login); ok {
+		u.db.deleteUser(user.Id)
+	}
+	return nil
+}
+
+func (u *UserStorage) UpdateStatus(ctx context.Context, appId int32, login string, status string, suspendedUntil time.Time, deletedAt time.Time) error {
+	defer u.db.lock(ctx)()
+	if user, ok := u.db.userByLogin(appId, login); ok {
+		user.Status, user.SuspendedUntil, user.DeletedAt = status, suspendedUntil, deletedAt
+		u.db.users[user.Id] = user
+	}
+	return nil
+}
+
+func (u *UserStorage) ListDeleted(ctx context.Context, before time.Time, limit int) ([]models.User, error) {
+	defer u.db.lock(ctx)()
+	var users []models.User
+	for _, user := range u.db.users {
+		if user.Status == models.UserDeleted && user.DeletedAt.Before(before) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (u *UserStorage) UpdateLogin(ctx context.Context, appId int32, login string, newLogin string) error {
+	defer u.db.lock(ctx)()
+	user, ok := u.db.userByLogin(appId, login)
+	if !ok {
+		return nil
+	}
+	if other, ok := u.db.userByLogin(appId, newLogin); ok && other.Id != user.Id {
+		return storageErrors.ErrUserExists
+	}
+	user.Login = newLogin
+	u.db.users[user.Id] = user
+	return nil
+}
+
+func (u *UserStorage) UpdatePassword(ctx context.Context, appId int32, login string, passwordHash []byte) error {
+	defer u.db.lock(ctx)()
+	if user, ok := u.db.userByLogin(appId, login); ok {
+		user.PasswordHash = append([]byte(nil), passwordHash...)
+		user.PasswordResetRequired = false
+		u.db.users[user.Id] = user
+	}
+	return nil
+}
+
+func (u *UserStorage) SetMFAEnabled(ctx context.Context, appId int32, login string, enabled bool) error {
+	defer u.db.lock(ctx)()
+	if user, ok := u.db.userByLogin(appId, login); ok {
+		user.MFAEnabled = enabled
+		u.db.users[user.Id] = user
+	}
+	return nil
+}
+
+func (u *UserStorage) SetPasswordResetRequired(ctx context.Context, appId int32, login string, required bool) error {
+	defer u.db.lock(ctx)()
+	if user, ok := u.db.userByLogin(appId, login); ok {
+		user.PasswordResetRequired = required
+		u.db.users[user.Id] = user
+	}
+	return nil
+}
+
+func (u *UserStorage) TestOnExist(ctx context.Context, appId int32, login string) (bool, error) {
+	defer u.db.lock(ctx)()
+	_, ok := u.db.userByLogin(appId, login)
+	return ok, nil
+}
+
+func (s *state) userByLogin(appId int32, login string) (models.User, bool) {
+	for _, user := range s.users {
+		if user.AppId == appId && user.Login == login {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
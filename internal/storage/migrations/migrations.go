@@ -0,0 +1,275 @@
+// Package migrations applies the versioned schema of each SQL storage backend.
+//
+// Migrations are embedded files named <dialect>/<version>_<name>.up.sql and
+// .down.sql. Statements in a file end with a semicolon at the end of a line.
+// Applied versions are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql postgres sqlite
+var files embed.FS
+
+var ErrSchemaOutdated = errors.New("schema version doesn't match the binary")
+
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// Status is a migration together with whether and when it was applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New returns the migrator of db. dialect is one of mysql, postgres and sqlite.
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	const op = "migrations.New"
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+func load(dialect string) ([]Migration, error) {
+	names, err := fs.Glob(files, dialect+"/*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimSuffix(strings.TrimPrefix(name, dialect+"/"), ".up.sql")
+		version, title, _ := strings.Cut(base, "_")
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration name %s: %w", name, err)
+		}
+		up, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		down, err := files.ReadFile(strings.TrimSuffix(name, ".up.sql") + ".down.sql")
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: v, Name: title, up: string(up), down: string(down)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the version the binary expects.
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the latest applied version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	const op = "migrations.Version"
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	var version sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return int(version.Int64), nil
+}
+
+// Check returns ErrSchemaOutdated unless the database is at the latest version.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version != m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, binary expects %d", ErrSchemaOutdated, version, m.Latest())
+	}
+	return nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the latest applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	target := 0
+	for _, mig := range m.migrations {
+		if mig.Version < version {
+			target = mig.Version
+		}
+	}
+	return m.To(ctx, target)
+}
+
+// To migrates up or down to version, 0 reverting everything.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	const op = "migrations.To"
+	if version != 0 && m.find(version) < 0 {
+		return fmt.Errorf("%s: unknown version %d", op, version)
+	}
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range m.migrations {
+		if mig.Version > current && mig.Version <= version {
+			if err := m.apply(ctx, mig, true); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version <= current && mig.Version > version {
+			if err := m.apply(ctx, mig, false); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Status lists every known migration, oldest first.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	const op = "migrations.Status"
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		appliedAt, ok := applied[mig.Version]
+		statuses = append(statuses, Status{Migration: mig, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) find(version int) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, applied_at "+m.timestampType()+" NOT NULL)")
+	return err
+}
+
+func (m *Migrator) timestampType() string {
+	switch m.dialect {
+	case "mysql":
+		return "DATETIME(6)"
+	case "postgres":
+		return "TIMESTAMPTZ"
+	}
+	return "DATETIME"
+}
+
+// apply runs one migration in a transaction and records it. MySQL commits DDL
+// statements implicitly, so a migration failing there halfway has to be fixed by hand.
+func (m *Migrator) apply(ctx context.Context, mig Migration, up bool) error {
+	script, record, args := mig.up, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", []any{mig.Version, time.Now()}
+	if !up {
+		script, record, args = mig.down, "DELETE FROM schema_migrations WHERE version=?", []any{mig.Version}
+	}
+	if m.dialect == "postgres" {
+		record = strings.Replace(strings.Replace(record, "?", "$1", 1), "?", "$2", 1)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, stmt := range statements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// statements splits a script on semicolons ending a line.
+func statements(script string) []string {
+	var (
+		stmts []string
+		b     strings.Builder
+	)
+	for _, line := range strings.Split(script, "\n") {
+		b.WriteString(line)
+		b.WriteByte('\n')
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if stmt := strings.TrimSpace(b.String()); stmt != ";" {
+				stmts = append(stmts, stmt)
+			}
+			b.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(b.String()); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
@@ -0,0 +1,22 @@
+-- The schema before versioned migrations. Databases created back then already
+-- have these tables and are adopted as they are.
+CREATE TABLE IF NOT EXISTS apps (
+    id         INT            NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    secret_key VARBINARY(255) NOT NULL,
+    UNIQUE KEY apps_secret_key (secret_key)
+) ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS users (
+    id       BIGINT         NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    app_id   INT            NOT NULL,
+    login    VARCHAR(255)   NOT NULL,
+    password VARBINARY(255) NOT NULL,
+    UNIQUE KEY users_app_login (app_id, login),
+    CONSTRAINT users_app FOREIGN KEY (app_id) REFERENCES apps (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS permissions (
+    user_id    BIGINT NOT NULL PRIMARY KEY,
+    permission INT    NOT NULL,
+    CONSTRAINT permissions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
@@ -0,0 +1,5 @@
+DROP TABLE access_requests;
+DROP TABLE permission_audit;
+ALTER TABLE permissions
+    DROP KEY permissions_expires_at,
+    DROP COLUMN expires_at;
@@ -0,0 +1,34 @@
+-- Grants made before keep no expiry.
+ALTER TABLE permissions
+    ADD COLUMN expires_at DATETIME(6) NULL,
+    ADD KEY permissions_expires_at (expires_at);
+
+CREATE TABLE permission_audit (
+    id             BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    app_id         INT          NOT NULL,
+    user_id        BIGINT       NOT NULL,
+    actor          VARCHAR(255) NOT NULL DEFAULT '',
+    action         VARCHAR(16)  NOT NULL,
+    old_value      INT          NOT NULL DEFAULT 0,
+    new_value      INT          NOT NULL DEFAULT 0,
+    new_expires_at DATETIME(6)  NULL,
+    request_id     VARCHAR(64)  NOT NULL DEFAULT '',
+    created_at     DATETIME(6)  NOT NULL,
+    KEY permission_audit_app (app_id, id)
+) ENGINE = InnoDB;
+
+CREATE TABLE access_requests (
+    id         BIGINT        NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    app_id     INT           NOT NULL,
+    user_id    BIGINT        NOT NULL,
+    permission INT           NOT NULL,
+    duration   BIGINT        NOT NULL,
+    reason     VARCHAR(1024) NOT NULL DEFAULT '',
+    status     VARCHAR(16)   NOT NULL,
+    approver   VARCHAR(255)  NOT NULL DEFAULT '',
+    created_at DATETIME(6)   NOT NULL,
+    decided_at DATETIME(6)   NULL,
+    KEY access_requests_app_status (app_id, status),
+    CONSTRAINT access_requests_app FOREIGN KEY (app_id) REFERENCES apps (id) ON DELETE CASCADE,
+    CONSTRAINT access_requests_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
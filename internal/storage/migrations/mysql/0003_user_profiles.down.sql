@@ -0,0 +1,12 @@
+DROP TABLE user_attributes;
+DROP TABLE attribute_schemas;
+ALTER TABLE users
+    DROP KEY users_app_email,
+    DROP KEY users_app_created_at,
+    DROP KEY users_status_deleted_at,
+    DROP COLUMN email,
+    DROP COLUMN created_at,
+    DROP COLUMN mfa_enabled,
+    DROP COLUMN status,
+    DROP COLUMN suspended_until,
+    DROP COLUMN deleted_at;
@@ -0,0 +1,34 @@
+-- Users created before get the time of the upgrade as creation time.
+ALTER TABLE users
+    ADD COLUMN email           VARCHAR(255) NOT NULL DEFAULT '' AFTER login,
+    ADD COLUMN created_at      DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6) AFTER password,
+    ADD COLUMN mfa_enabled     BOOLEAN      NOT NULL DEFAULT FALSE AFTER created_at,
+    ADD COLUMN status          VARCHAR(16)  NOT NULL DEFAULT 'active' AFTER mfa_enabled,
+    ADD COLUMN suspended_until DATETIME(6)  NULL AFTER status,
+    ADD COLUMN deleted_at      DATETIME(6)  NULL AFTER suspended_until,
+    ADD KEY users_app_email (app_id, email),
+    ADD KEY users_app_created_at (app_id, created_at),
+    ADD KEY users_status_deleted_at (status, deleted_at);
+ALTER TABLE users ALTER COLUMN created_at DROP DEFAULT;
+
+CREATE TABLE attribute_schemas (
+    app_id    INT           NOT NULL,
+    name      VARCHAR(64)   NOT NULL,
+    type      VARCHAR(16)   NOT NULL,
+    required  BOOLEAN       NOT NULL DEFAULT FALSE,
+    is_unique BOOLEAN       NOT NULL DEFAULT FALSE,
+    pattern   VARCHAR(1024) NOT NULL DEFAULT '',
+    claim     BOOLEAN       NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (app_id, name),
+    CONSTRAINT attribute_schemas_app FOREIGN KEY (app_id) REFERENCES apps (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
+
+CREATE TABLE user_attributes (
+    user_id BIGINT        NOT NULL,
+    app_id  INT           NOT NULL,
+    name    VARCHAR(64)   NOT NULL,
+    value   VARCHAR(1024) NOT NULL,
+    PRIMARY KEY (user_id, name),
+    KEY user_attributes_app_name_value (app_id, name, value(255)),
+    CONSTRAINT user_attributes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
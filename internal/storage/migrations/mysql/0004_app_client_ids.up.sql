@@ -0,0 +1,13 @@
+-- Existing apps keep working with their old key as credential: it is hashed in
+-- place. They get a fresh signing key, and the old key only verifies the tokens
+-- it signed before the upgrade, as the previous signing key, for a week.
+ALTER TABLE apps
+    ADD COLUMN client_id                   VARCHAR(64)    NOT NULL DEFAULT '',
+    ADD COLUMN signing_key                 VARBINARY(255) NOT NULL DEFAULT '',
+    ADD COLUMN prev_signing_key            VARBINARY(255) NULL,
+    ADD COLUMN prev_signing_key_expires_at DATETIME(6)    NULL;
+UPDATE apps SET client_id = CONCAT('legacy-', id), signing_key = RANDOM_BYTES(32),
+    prev_signing_key = secret_key, prev_signing_key_expires_at = UTC_TIMESTAMP(6) + INTERVAL 7 DAY;
+ALTER TABLE apps RENAME COLUMN secret_key TO secret_hash;
+UPDATE apps SET secret_hash = UNHEX(SHA2(secret_hash, 256));
+ALTER TABLE apps ADD UNIQUE KEY apps_client_id (client_id);
@@ -0,0 +1,7 @@
+ALTER TABLE apps
+    ADD COLUMN secret_used_at         DATETIME(6)    NULL,
+    ADD COLUMN secret_rotated_at      DATETIME(6)    NULL,
+    ADD COLUMN prev_secret_hash       VARBINARY(255) NULL,
+    ADD COLUMN prev_secret_expires_at DATETIME(6)    NULL,
+    ADD COLUMN prev_secret_used_at    DATETIME(6)    NULL,
+    ADD KEY apps_prev_secret_hash (prev_secret_hash);
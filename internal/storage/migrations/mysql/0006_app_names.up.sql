@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN name VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,17 @@
+-- Lists are stored as JSON arrays. Apps created before keep no creation time.
+ALTER TABLE apps
+    ADD COLUMN description             VARCHAR(1024) NOT NULL DEFAULT '',
+    ADD COLUMN owner                   VARCHAR(255)  NOT NULL DEFAULT '',
+    ADD COLUMN logo_url                VARCHAR(1024) NOT NULL DEFAULT '',
+    ADD COLUMN redirect_uris           TEXT          NULL,
+    ADD COLUMN allowed_origins         TEXT          NULL,
+    ADD COLUMN created_at              DATETIME(6)   NULL,
+    ADD COLUMN updated_at              DATETIME(6)   NULL,
+    ADD COLUMN token_ttl               BIGINT        NOT NULL DEFAULT 0,
+    ADD COLUMN registration_closed     BOOLEAN       NOT NULL DEFAULT FALSE,
+    ADD COLUMN require_mfa             BOOLEAN       NOT NULL DEFAULT FALSE,
+    ADD COLUMN password_min_length     INT           NOT NULL DEFAULT 0,
+    ADD COLUMN password_require_upper  BOOLEAN       NOT NULL DEFAULT FALSE,
+    ADD COLUMN password_require_lower  BOOLEAN       NOT NULL DEFAULT FALSE,
+    ADD COLUMN password_require_digit  BOOLEAN       NOT NULL DEFAULT FALSE,
+    ADD COLUMN password_require_symbol BOOLEAN       NOT NULL DEFAULT FALSE;
@@ -0,0 +1,18 @@
+-- Archive of deleted apps. app is the app as it was, as JSON without its credentials.
+CREATE TABLE IF NOT EXISTS deleted_apps (
+    id              BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    app_id          INT          NOT NULL,
+    client_id       VARCHAR(64)  NOT NULL,
+    name            VARCHAR(255) NOT NULL DEFAULT '',
+    app             TEXT         NOT NULL,
+    users           BIGINT       NOT NULL DEFAULT 0,
+    permissions     BIGINT       NOT NULL DEFAULT 0,
+    access_requests BIGINT       NOT NULL DEFAULT 0,
+    attributes      BIGINT       NOT NULL DEFAULT 0,
+    cascaded        BOOLEAN      NOT NULL DEFAULT FALSE,
+    deleted_at      DATETIME(6)  NOT NULL,
+    deleted_by      VARCHAR(255) NOT NULL DEFAULT '',
+    request_id      VARCHAR(64)  NOT NULL DEFAULT '',
+    KEY deleted_apps_client_id (client_id),
+    KEY deleted_apps_deleted_at (deleted_at)
+) ENGINE = InnoDB;
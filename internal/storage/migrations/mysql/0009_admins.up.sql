@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS admins (
+    id            BIGINT         NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    login         VARCHAR(255)   NOT NULL,
+    password_hash VARBINARY(255) NOT NULL,
+    role          VARCHAR(16)    NOT NULL,
+    created_at    DATETIME(6)    NOT NULL,
+    UNIQUE KEY admins_login (login)
+) ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS admin_sessions (
+    token_hash VARBINARY(32) NOT NULL PRIMARY KEY,
+    admin_id   BIGINT        NOT NULL,
+    csrf_token VARCHAR(64)   NOT NULL,
+    created_at DATETIME(6)   NOT NULL,
+    expires_at DATETIME(6)   NOT NULL,
+    KEY admin_sessions_expires_at (expires_at),
+    CONSTRAINT admin_sessions_admin FOREIGN KEY (admin_id) REFERENCES admins (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
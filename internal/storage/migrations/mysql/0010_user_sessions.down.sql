@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_sessions;
+ALTER TABLE users DROP COLUMN password_reset_required;
@@ -0,0 +1,14 @@
+-- Tokens issued before this migration carry no session and can't be revoked.
+ALTER TABLE users ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id         VARCHAR(64) NOT NULL PRIMARY KEY,
+    app_id     INT         NOT NULL,
+    user_id    BIGINT      NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    expires_at DATETIME(6) NOT NULL,
+    revoked_at DATETIME(6) NULL,
+    KEY user_sessions_user_id (user_id),
+    KEY user_sessions_expires_at (expires_at),
+    CONSTRAINT user_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE = InnoDB;
@@ -0,0 +1,18 @@
+-- Events outlive their users and apps, so neither is referenced.
+CREATE TABLE IF NOT EXISTS auth_events (
+    id         BIGINT        NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    type       VARCHAR(32)   NOT NULL,
+    app_id     INT           NOT NULL,
+    user_id    BIGINT        NOT NULL DEFAULT 0,
+    login      VARCHAR(255)  NOT NULL DEFAULT '',
+    success    BOOLEAN       NOT NULL,
+    detail     VARCHAR(1024) NOT NULL DEFAULT '',
+    actor      VARCHAR(255)  NOT NULL DEFAULT '',
+    ip         VARCHAR(64)   NOT NULL DEFAULT '',
+    user_agent VARCHAR(512)  NOT NULL DEFAULT '',
+    request_id VARCHAR(64)   NOT NULL DEFAULT '',
+    created_at DATETIME(6)   NOT NULL,
+    KEY auth_events_app (app_id, id),
+    KEY auth_events_user (user_id),
+    KEY auth_events_login (app_id, login)
+) ENGINE = InnoDB;
@@ -0,0 +1,8 @@
+-- Instances sharing the database publish the apps they change here, for the
+-- others to drop them from their caches.
+CREATE TABLE IF NOT EXISTS app_invalidations (
+    id         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    client_id  VARCHAR(64)  NOT NULL,
+    created_at DATETIME(6)  NOT NULL,
+    KEY app_invalidations_created_at (created_at)
+) ENGINE = InnoDB;
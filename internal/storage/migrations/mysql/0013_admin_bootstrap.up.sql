@@ -0,0 +1,7 @@
+-- Holds one row once the first admin was bootstrapped, so concurrent bootstraps
+-- collide on its primary key rather than both finding no admins.
+CREATE TABLE IF NOT EXISTS admin_bootstrap (
+    id         TINYINT     NOT NULL PRIMARY KEY,
+    created_at DATETIME(6) NOT NULL
+) ENGINE = InnoDB;
+INSERT INTO admin_bootstrap (id, created_at) SELECT 1, created_at FROM admins ORDER BY created_at LIMIT 1;
@@ -0,0 +1,4 @@
+-- Who the caller said it acted for, kept apart from the authenticated actor.
+ALTER TABLE auth_events ADD COLUMN on_behalf_of VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE permission_audit ADD COLUMN on_behalf_of VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE deleted_apps ADD COLUMN on_behalf_of VARCHAR(255) NOT NULL DEFAULT '';
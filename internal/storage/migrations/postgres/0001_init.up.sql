@@ -0,0 +1,19 @@
+-- The schema before versioned migrations. Databases created back then already
+-- have these tables and are adopted as they are.
+CREATE TABLE IF NOT EXISTS apps (
+    id         SERIAL PRIMARY KEY,
+    secret_key BYTEA  NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id       BIGSERIAL PRIMARY KEY,
+    app_id   INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    login    TEXT    NOT NULL,
+    password BYTEA   NOT NULL,
+    UNIQUE (app_id, login)
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    user_id    BIGINT  PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    permission INTEGER NOT NULL
+);
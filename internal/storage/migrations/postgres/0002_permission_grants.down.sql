@@ -0,0 +1,4 @@
+DROP TABLE access_requests;
+DROP TABLE permission_audit;
+DROP INDEX permissions_expires_at;
+ALTER TABLE permissions DROP COLUMN expires_at;
@@ -0,0 +1,31 @@
+-- Grants made before keep no expiry.
+ALTER TABLE permissions ADD COLUMN expires_at TIMESTAMPTZ;
+CREATE INDEX permissions_expires_at ON permissions (expires_at);
+
+CREATE TABLE permission_audit (
+    id             BIGSERIAL PRIMARY KEY,
+    app_id         INTEGER     NOT NULL,
+    user_id        BIGINT      NOT NULL,
+    actor          TEXT        NOT NULL DEFAULT '',
+    action         TEXT        NOT NULL,
+    old_value      INTEGER     NOT NULL DEFAULT 0,
+    new_value      INTEGER     NOT NULL DEFAULT 0,
+    new_expires_at TIMESTAMPTZ,
+    request_id     TEXT        NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX permission_audit_app ON permission_audit (app_id, id);
+
+CREATE TABLE access_requests (
+    id         BIGSERIAL PRIMARY KEY,
+    app_id     INTEGER     NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    user_id    BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    permission INTEGER     NOT NULL,
+    duration   BIGINT      NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '',
+    status     TEXT        NOT NULL,
+    approver   TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    decided_at TIMESTAMPTZ
+);
+CREATE INDEX access_requests_app_status ON access_requests (app_id, status);
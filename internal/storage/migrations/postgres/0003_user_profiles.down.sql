@@ -0,0 +1,9 @@
+DROP TABLE user_attributes;
+DROP TABLE attribute_schemas;
+ALTER TABLE users
+    DROP COLUMN email,
+    DROP COLUMN created_at,
+    DROP COLUMN mfa_enabled,
+    DROP COLUMN status,
+    DROP COLUMN suspended_until,
+    DROP COLUMN deleted_at;
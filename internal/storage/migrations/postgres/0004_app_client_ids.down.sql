@@ -0,0 +1,11 @@
+-- The secrets can't be recovered: apps created before client ids get their
+-- original key back from the previous signing key while it is kept, the others
+-- their signing key as key.
+DROP INDEX apps_client_id;
+UPDATE apps SET secret_hash = COALESCE(prev_signing_key, signing_key);
+ALTER TABLE apps RENAME COLUMN secret_hash TO secret_key;
+ALTER TABLE apps
+    DROP COLUMN client_id,
+    DROP COLUMN signing_key,
+    DROP COLUMN prev_signing_key,
+    DROP COLUMN prev_signing_key_expires_at;
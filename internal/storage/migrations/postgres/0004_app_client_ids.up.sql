@@ -0,0 +1,16 @@
+-- Existing apps keep working with their old key as credential: it is hashed in
+-- place. They get a fresh signing key, and the old key only verifies the tokens
+-- it signed before the upgrade, as the previous signing key, for a week.
+-- gen_random_uuid is a strong random source in core since PostgreSQL 13, two
+-- make 32 bytes.
+ALTER TABLE apps
+    ADD COLUMN client_id                   TEXT  NOT NULL DEFAULT '',
+    ADD COLUMN signing_key                 BYTEA NOT NULL DEFAULT '',
+    ADD COLUMN prev_signing_key            BYTEA,
+    ADD COLUMN prev_signing_key_expires_at TIMESTAMPTZ;
+UPDATE apps SET client_id = 'legacy-' || id,
+    signing_key = decode(replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', ''), 'hex'),
+    prev_signing_key = secret_key, prev_signing_key_expires_at = now() + INTERVAL '7 days';
+ALTER TABLE apps RENAME COLUMN secret_key TO secret_hash;
+UPDATE apps SET secret_hash = sha256(secret_hash);
+CREATE UNIQUE INDEX apps_client_id ON apps (client_id);
@@ -0,0 +1,7 @@
+DROP INDEX apps_prev_secret_hash;
+ALTER TABLE apps
+    DROP COLUMN secret_used_at,
+    DROP COLUMN secret_rotated_at,
+    DROP COLUMN prev_secret_hash,
+    DROP COLUMN prev_secret_expires_at,
+    DROP COLUMN prev_secret_used_at;
@@ -0,0 +1,7 @@
+ALTER TABLE apps
+    ADD COLUMN secret_used_at         TIMESTAMPTZ,
+    ADD COLUMN secret_rotated_at      TIMESTAMPTZ,
+    ADD COLUMN prev_secret_hash       BYTEA,
+    ADD COLUMN prev_secret_expires_at TIMESTAMPTZ,
+    ADD COLUMN prev_secret_used_at    TIMESTAMPTZ;
+CREATE INDEX apps_prev_secret_hash ON apps (prev_secret_hash);
@@ -0,0 +1,16 @@
+ALTER TABLE apps
+    DROP COLUMN description,
+    DROP COLUMN owner,
+    DROP COLUMN logo_url,
+    DROP COLUMN redirect_uris,
+    DROP COLUMN allowed_origins,
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at,
+    DROP COLUMN token_ttl,
+    DROP COLUMN registration_closed,
+    DROP COLUMN require_mfa,
+    DROP COLUMN password_min_length,
+    DROP COLUMN password_require_upper,
+    DROP COLUMN password_require_lower,
+    DROP COLUMN password_require_digit,
+    DROP COLUMN password_require_symbol;
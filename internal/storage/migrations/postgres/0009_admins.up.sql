@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS admins (
+    id            BIGSERIAL   PRIMARY KEY,
+    login         TEXT        NOT NULL UNIQUE,
+    password_hash BYTEA       NOT NULL,
+    role          TEXT        NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS admin_sessions (
+    token_hash BYTEA       PRIMARY KEY,
+    admin_id   BIGINT      NOT NULL REFERENCES admins (id) ON DELETE CASCADE,
+    csrf_token TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS admin_sessions_expires_at ON admin_sessions (expires_at);
@@ -0,0 +1,13 @@
+-- Tokens issued before this migration carry no session and can't be revoked.
+ALTER TABLE users ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id         TEXT        PRIMARY KEY,
+    app_id     INTEGER     NOT NULL,
+    user_id    BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS user_sessions_user_id ON user_sessions (user_id);
+CREATE INDEX IF NOT EXISTS user_sessions_expires_at ON user_sessions (expires_at);
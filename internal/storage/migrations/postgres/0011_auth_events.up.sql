@@ -0,0 +1,18 @@
+-- Events outlive their users and apps, so neither is referenced.
+CREATE TABLE IF NOT EXISTS auth_events (
+    id         BIGSERIAL PRIMARY KEY,
+    type       TEXT        NOT NULL,
+    app_id     INTEGER     NOT NULL,
+    user_id    BIGINT      NOT NULL DEFAULT 0,
+    login      TEXT        NOT NULL DEFAULT '',
+    success    BOOLEAN     NOT NULL,
+    detail     TEXT        NOT NULL DEFAULT '',
+    actor      TEXT        NOT NULL DEFAULT '',
+    ip         TEXT        NOT NULL DEFAULT '',
+    user_agent TEXT        NOT NULL DEFAULT '',
+    request_id TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS auth_events_app ON auth_events (app_id, id);
+CREATE INDEX IF NOT EXISTS auth_events_user ON auth_events (user_id);
+CREATE INDEX IF NOT EXISTS auth_events_login ON auth_events (app_id, login);
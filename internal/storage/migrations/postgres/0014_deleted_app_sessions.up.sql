@@ -0,0 +1 @@
+ALTER TABLE deleted_apps ADD COLUMN sessions BIGINT NOT NULL DEFAULT 0;
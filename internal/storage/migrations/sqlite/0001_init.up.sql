@@ -0,0 +1,19 @@
+-- The schema before versioned migrations. Databases created back then already
+-- have these tables and are adopted as they are.
+CREATE TABLE IF NOT EXISTS apps (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    secret_key BLOB    NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_id   INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    login    TEXT    NOT NULL,
+    password BLOB    NOT NULL,
+    UNIQUE (app_id, login)
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    user_id    INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    permission INTEGER NOT NULL
+);
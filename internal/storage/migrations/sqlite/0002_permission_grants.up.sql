@@ -0,0 +1,31 @@
+-- Grants made before keep no expiry.
+ALTER TABLE permissions ADD COLUMN expires_at DATETIME;
+CREATE INDEX permissions_expires_at ON permissions (expires_at);
+
+CREATE TABLE permission_audit (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_id         INTEGER  NOT NULL,
+    user_id        INTEGER  NOT NULL,
+    actor          TEXT     NOT NULL DEFAULT '',
+    action         TEXT     NOT NULL,
+    old_value      INTEGER  NOT NULL DEFAULT 0,
+    new_value      INTEGER  NOT NULL DEFAULT 0,
+    new_expires_at DATETIME,
+    request_id     TEXT     NOT NULL DEFAULT '',
+    created_at     DATETIME NOT NULL
+);
+CREATE INDEX permission_audit_app ON permission_audit (app_id, id);
+
+CREATE TABLE access_requests (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_id     INTEGER  NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    permission INTEGER  NOT NULL,
+    duration   INTEGER  NOT NULL,
+    reason     TEXT     NOT NULL DEFAULT '',
+    status     TEXT     NOT NULL,
+    approver   TEXT     NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    decided_at DATETIME
+);
+CREATE INDEX access_requests_app_status ON access_requests (app_id, status);
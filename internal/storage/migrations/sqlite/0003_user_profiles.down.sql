@@ -0,0 +1,11 @@
+DROP TABLE user_attributes;
+DROP TABLE attribute_schemas;
+DROP INDEX users_status_deleted_at;
+DROP INDEX users_app_created_at;
+DROP INDEX users_app_email;
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN suspended_until;
+ALTER TABLE users DROP COLUMN status;
+ALTER TABLE users DROP COLUMN mfa_enabled;
+ALTER TABLE users DROP COLUMN created_at;
+ALTER TABLE users DROP COLUMN email;
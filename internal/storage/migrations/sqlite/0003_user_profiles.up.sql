@@ -0,0 +1,32 @@
+-- Users created before get the time of the upgrade as creation time. SQLite
+-- can't add a column defaulting to the current time, hence the update.
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+ALTER TABLE users ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN suspended_until DATETIME;
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+UPDATE users SET created_at = datetime('now');
+CREATE INDEX users_app_email ON users (app_id, email);
+CREATE INDEX users_app_created_at ON users (app_id, created_at);
+CREATE INDEX users_status_deleted_at ON users (status, deleted_at);
+
+CREATE TABLE attribute_schemas (
+    app_id    INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    name      TEXT    NOT NULL,
+    type      TEXT    NOT NULL,
+    required  BOOLEAN NOT NULL DEFAULT FALSE,
+    is_unique BOOLEAN NOT NULL DEFAULT FALSE,
+    pattern   TEXT    NOT NULL DEFAULT '',
+    claim     BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (app_id, name)
+);
+
+CREATE TABLE user_attributes (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id  INTEGER NOT NULL,
+    name    TEXT    NOT NULL,
+    value   TEXT    NOT NULL,
+    PRIMARY KEY (user_id, name)
+);
+CREATE INDEX user_attributes_app_name_value ON user_attributes (app_id, name, value);
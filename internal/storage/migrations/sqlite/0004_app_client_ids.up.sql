@@ -0,0 +1,13 @@
+-- Existing apps keep working with their old key as credential: it is hashed in
+-- place. They get a fresh signing key, and the old key only verifies the tokens
+-- it signed before the upgrade, as the previous signing key, for a week.
+-- sha256 is registered by the sqlite storage package.
+ALTER TABLE apps ADD COLUMN client_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN signing_key BLOB NOT NULL DEFAULT x'';
+ALTER TABLE apps ADD COLUMN prev_signing_key BLOB;
+ALTER TABLE apps ADD COLUMN prev_signing_key_expires_at DATETIME;
+UPDATE apps SET client_id = 'legacy-' || id, signing_key = randomblob(32),
+    prev_signing_key = secret_key, prev_signing_key_expires_at = datetime('now', '+7 days');
+ALTER TABLE apps RENAME COLUMN secret_key TO secret_hash;
+UPDATE apps SET secret_hash = sha256(secret_hash);
+CREATE UNIQUE INDEX apps_client_id ON apps (client_id);
@@ -0,0 +1,6 @@
+DROP INDEX apps_prev_secret_hash;
+ALTER TABLE apps DROP COLUMN secret_used_at;
+ALTER TABLE apps DROP COLUMN secret_rotated_at;
+ALTER TABLE apps DROP COLUMN prev_secret_hash;
+ALTER TABLE apps DROP COLUMN prev_secret_expires_at;
+ALTER TABLE apps DROP COLUMN prev_secret_used_at;
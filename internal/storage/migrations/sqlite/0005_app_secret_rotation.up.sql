@@ -0,0 +1,6 @@
+ALTER TABLE apps ADD COLUMN secret_used_at DATETIME;
+ALTER TABLE apps ADD COLUMN secret_rotated_at DATETIME;
+ALTER TABLE apps ADD COLUMN prev_secret_hash BLOB;
+ALTER TABLE apps ADD COLUMN prev_secret_expires_at DATETIME;
+ALTER TABLE apps ADD COLUMN prev_secret_used_at DATETIME;
+CREATE INDEX apps_prev_secret_hash ON apps (prev_secret_hash);
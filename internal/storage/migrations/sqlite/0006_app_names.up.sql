@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+ALTER TABLE apps DROP COLUMN description;
+ALTER TABLE apps DROP COLUMN owner;
+ALTER TABLE apps DROP COLUMN logo_url;
+ALTER TABLE apps DROP COLUMN redirect_uris;
+ALTER TABLE apps DROP COLUMN allowed_origins;
+ALTER TABLE apps DROP COLUMN created_at;
+ALTER TABLE apps DROP COLUMN updated_at;
+ALTER TABLE apps DROP COLUMN token_ttl;
+ALTER TABLE apps DROP COLUMN registration_closed;
+ALTER TABLE apps DROP COLUMN require_mfa;
+ALTER TABLE apps DROP COLUMN password_min_length;
+ALTER TABLE apps DROP COLUMN password_require_upper;
+ALTER TABLE apps DROP COLUMN password_require_lower;
+ALTER TABLE apps DROP COLUMN password_require_digit;
+ALTER TABLE apps DROP COLUMN password_require_symbol;
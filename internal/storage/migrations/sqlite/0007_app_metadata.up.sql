@@ -0,0 +1,16 @@
+-- Lists are stored as JSON arrays. Apps created before keep no creation time.
+ALTER TABLE apps ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN logo_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN redirect_uris TEXT;
+ALTER TABLE apps ADD COLUMN allowed_origins TEXT;
+ALTER TABLE apps ADD COLUMN created_at DATETIME;
+ALTER TABLE apps ADD COLUMN updated_at DATETIME;
+ALTER TABLE apps ADD COLUMN token_ttl INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps ADD COLUMN registration_closed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE apps ADD COLUMN require_mfa BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE apps ADD COLUMN password_min_length INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps ADD COLUMN password_require_upper BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE apps ADD COLUMN password_require_lower BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE apps ADD COLUMN password_require_digit BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE apps ADD COLUMN password_require_symbol BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,18 @@
+-- Archive of deleted apps. app is the app as it was, as JSON without its credentials.
+CREATE TABLE IF NOT EXISTS deleted_apps (
+    id              INTEGER  PRIMARY KEY AUTOINCREMENT,
+    app_id          INTEGER  NOT NULL,
+    client_id       TEXT     NOT NULL,
+    name            TEXT     NOT NULL DEFAULT '',
+    app             TEXT     NOT NULL,
+    users           INTEGER  NOT NULL DEFAULT 0,
+    permissions     INTEGER  NOT NULL DEFAULT 0,
+    access_requests INTEGER  NOT NULL DEFAULT 0,
+    attributes      INTEGER  NOT NULL DEFAULT 0,
+    cascaded        BOOLEAN  NOT NULL DEFAULT FALSE,
+    deleted_at      DATETIME NOT NULL,
+    deleted_by      TEXT     NOT NULL DEFAULT '',
+    request_id      TEXT     NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS deleted_apps_client_id ON deleted_apps (client_id);
+CREATE INDEX IF NOT EXISTS deleted_apps_deleted_at ON deleted_apps (deleted_at);
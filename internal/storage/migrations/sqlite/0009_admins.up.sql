@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS admins (
+    id            INTEGER  PRIMARY KEY AUTOINCREMENT,
+    login         TEXT     NOT NULL UNIQUE,
+    password_hash BLOB     NOT NULL,
+    role          TEXT     NOT NULL,
+    created_at    DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS admin_sessions (
+    token_hash BLOB     PRIMARY KEY,
+    admin_id   INTEGER  NOT NULL REFERENCES admins (id) ON DELETE CASCADE,
+    csrf_token TEXT     NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS admin_sessions_expires_at ON admin_sessions (expires_at);
@@ -0,0 +1,8 @@
+-- Instances sharing the database publish the apps they change here, for the
+-- others to drop them from their caches.
+CREATE TABLE IF NOT EXISTS app_invalidations (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    client_id  TEXT     NOT NULL,
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS app_invalidations_created_at ON app_invalidations (created_at);
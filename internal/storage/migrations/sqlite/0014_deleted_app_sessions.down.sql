@@ -0,0 +1 @@
+ALTER TABLE deleted_apps DROP COLUMN sessions;
@@ -0,0 +1 @@
+ALTER TABLE deleted_apps ADD COLUMN sessions INTEGER NOT NULL DEFAULT 0;
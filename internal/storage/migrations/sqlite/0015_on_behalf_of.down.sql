@@ -0,0 +1,3 @@
+ALTER TABLE auth_events DROP COLUMN on_behalf_of;
+ALTER TABLE permission_audit DROP COLUMN on_behalf_of;
+ALTER TABLE deleted_apps DROP COLUMN on_behalf_of;
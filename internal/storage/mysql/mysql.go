@@ -0,0 +1,34 @@
+// Package mysql is the MySQL dialect of the SQL storage.
+package mysql
+
+import (
+	"SSO/internal/pkg/tracing"
+	"SSO/internal/storage/sqlstore"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+)
+
+// mysqlDuplicateEntry is the MySQL error number of unique key violations.
+const mysqlDuplicateEntry = 1062
+
+var Dialect = sqlstore.Dialect{
+	System:      tracing.DBMySQL,
+	Upsert:      upsert,
+	IsDuplicate: isDuplicate,
+}
+
+// upsert updates the columns on a conflict with any unique key, MySQL can't name one.
+func upsert(_ []string, columns []string) string {
+	set := make([]string, len(columns))
+	for i, c := range columns {
+		set[i] = fmt.Sprintf("%s=VALUES(%s)", c, c)
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+}
+
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
@@ -0,0 +1,25 @@
+// Package postgres is the PostgreSQL dialect of the SQL storage.
+package postgres
+
+import (
+	"SSO/internal/pkg/tracing"
+	"SSO/internal/storage/sqlstore"
+	"errors"
+	"github.com/lib/pq"
+)
+
+// pgUniqueViolation is the SQLSTATE of unique key violations.
+const pgUniqueViolation = "23505"
+
+var Dialect = sqlstore.Dialect{
+	System:      tracing.DBPostgres,
+	Rebind:      rebind,
+	Returning:   true,
+	Upsert:      sqlstore.OnConflictUpdate,
+	IsDuplicate: isDuplicate,
+}
+
+func isDuplicate(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation
+}
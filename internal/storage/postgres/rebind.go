@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+)
+
+// rebind turns the ? placeholders of a query into Postgres' $1, $2, ...
+// Queries passed to it must not contain a literal question mark.
+func rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+// Package sqlite is the SQLite dialect of the SQL storage, with the driver to open
+// its databases.
+package sqlite
+
+import (
+	"SSO/internal/pkg/tracing"
+	"SSO/internal/storage/sqlstore"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"net/url"
+)
+
+// DriverName is the database/sql driver to open databases with. It is go-sqlite3
+// with the SQL functions the migrations need: sha256(blob) returning the raw digest.
+const DriverName = "sqlite3_sso"
+
+func init() {
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("sha256", func(b []byte) []byte {
+				sum := sha256.Sum256(b)
+				return sum[:]
+			}, true)
+		},
+	})
+}
+
+// DSN returns the data source name of the database file at path. It turns on WAL
+// journaling and foreign keys, waits for locks instead of failing at once and
+// takes the write lock when a transaction begins, so concurrent transactions
+// queue up rather than deadlock when upgrading from a read.
+func DSN(path string) string {
+	params := url.Values{
+		"_journal_mode": {"WAL"},
+		"_foreign_keys": {"on"},
+		"_busy_timeout": {"5000"},
+		"_txlock":       {"immediate"},
+	}
+	return "file:" + path + "?" + params.Encode()
+}
+
+var Dialect = sqlstore.Dialect{
+	System:      tracing.DBSQLite,
+	Upsert:      sqlstore.OnConflictUpdate,
+	LikeEscape:  ` ESCAPE '\'`,
+	IsDuplicate: isDuplicate,
+}
+
+func isDuplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
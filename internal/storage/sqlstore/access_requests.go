@@ -0,0 +1,107 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type AccessRequestsStorage struct {
+	db *DB
+}
+
+func NewAccessRequestsStorage(db *DB) *AccessRequestsStorage {
+	return &AccessRequestsStorage{
+		db: db,
+	}
+}
+
+const accessRequestSelect = "SELECT ar.id, ar.app_id, ar.user_id, u.login, ar.permission, ar.duration, ar.reason, ar.status, ar.approver, ar.created_at, ar.decided_at " +
+	"FROM access_requests ar JOIN users u ON u.id=ar.user_id"
+
+func (a *AccessRequestsStorage) Save(ctx context.Context, req models.AccessRequest) (int64, error) {
+	const op = "AccessRequestsStorage.Save"
+	id, err := insert(ctx, a.db,
+		"INSERT INTO access_requests (app_id, user_id, permission, duration, reason, status, approver, created_at) VALUES (?, ?, ?, ?, ?, ?, '', ?)",
+		req.AppId, req.UserId, req.Permission, int64(req.Duration/time.Second), req.Reason, req.Status, req.CreatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (a *AccessRequestsStorage) Get(ctx context.Context, id int64) (models.AccessRequest, error) {
+	const op = "AccessRequestsStorage.Get"
+	req, err := scanAccessRequest(conn(ctx, a.db).QueryRowContext(ctx, accessRequestSelect+" WHERE ar.id=?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return req, storageErrors.ErrAccessRequestNotFound
+		}
+		return req, fmt.Errorf("%s: %w", op, err)
+	}
+	return req, nil
+}
+
+func (a *AccessRequestsStorage) GetByApp(ctx context.Context, appId int32, status string) ([]models.AccessRequest, error) {
+	const op = "AccessRequestsStorage.GetByApp"
+	query := accessRequestSelect + " WHERE ar.app_id=?"
+	args := []any{appId}
+	if status != "" {
+		query += " AND ar.status=?"
+		args = append(args, status)
+	}
+	rows, err := conn(ctx, a.db).QueryContext(ctx, query+" ORDER BY ar.id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var reqs []models.AccessRequest
+	for rows.Next() {
+		req, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, rows.Err()
+}
+
+func (a *AccessRequestsStorage) Decide(ctx context.Context, id int64, status string, approver string, decidedAt time.Time) error {
+	const op = "AccessRequestsStorage.Decide"
+	res, err := conn(ctx, a.db).ExecContext(ctx, "UPDATE access_requests SET status=?, approver=?, decided_at=? WHERE id=? AND status=?",
+		status, approver, decidedAt, id, models.AccessRequestPending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storageErrors.ErrAccessRequestDecided
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAccessRequest(row rowScanner) (models.AccessRequest, error) {
+	var (
+		req       models.AccessRequest
+		duration  int64
+		decidedAt sql.NullTime
+	)
+	err := row.Scan(&req.Id, &req.AppId, &req.UserId, &req.Login, &req.Permission, &duration, &req.Reason,
+		&req.Status, &req.Approver, &req.CreatedAt, &decidedAt)
+	req.Duration = time.Duration(duration) * time.Second
+	req.DecidedAt = decidedAt.Time
+	return req, err
+}
@@ -0,0 +1,173 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type AdminStorage struct {
+	db *DB
+}
+
+func NewAdminStorage(db *DB) *AdminStorage {
+	return &AdminStorage{
+		db: db,
+	}
+}
+
+const adminColumns = "id, login, password_hash, role, created_at"
+
+func (a *AdminStorage) Save(ctx context.Context, admin models.Admin) (int64, error) {
+	const op = "AdminStorage.Save"
+	id, err := insert(ctx, a.db, "INSERT INTO admins (login, password_hash, role, created_at) VALUES (?, ?, ?, ?)",
+		admin.Login, admin.PasswordHash, admin.Role, admin.CreatedAt)
+	if err != nil {
+		if isDuplicate(a.db, err) {
+			return 0, storageErrors.ErrAdminExists
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (a *AdminStorage) ClaimBootstrap(ctx context.Context, at time.Time) error {
+	const op = "AdminStorage.ClaimBootstrap"
+	if _, err := conn(ctx, a.db).ExecContext(ctx, "INSERT INTO admin_bootstrap (id, created_at) VALUES (1, ?)", at); err != nil {
+		if isDuplicate(a.db, err) {
+			return storageErrors.ErrAdminsBootstrapped
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AdminStorage) GetById(ctx context.Context, id int64) (models.Admin, error) {
+	const op = "AdminStorage.GetById"
+	return a.get(ctx, op, "SELECT "+adminColumns+" FROM admins WHERE id=?", id)
+}
+
+func (a *AdminStorage) GetByLogin(ctx context.Context, login string) (models.Admin, error) {
+	const op = "AdminStorage.GetByLogin"
+	return a.get(ctx, op, "SELECT "+adminColumns+" FROM admins WHERE login=?", login)
+}
+
+func (a *AdminStorage) get(ctx context.Context, op string, query string, arg any) (models.Admin, error) {
+	var admin models.Admin
+	if err := conn(ctx, a.db).QueryRowContext(ctx, query, arg).Scan(
+		&admin.Id, &admin.Login, &admin.PasswordHash, &admin.Role, &admin.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return admin, storageErrors.ErrAdminNotFound
+		}
+		return admin, fmt.Errorf("%s: %w", op, err)
+	}
+	return admin, nil
+}
+
+func (a *AdminStorage) List(ctx context.Context) ([]models.Admin, error) {
+	const op = "AdminStorage.List"
+	rows, err := conn(ctx, a.db).QueryContext(ctx, "SELECT "+adminColumns+" FROM admins ORDER BY login")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var admins []models.Admin
+	for rows.Next() {
+		var admin models.Admin
+		if err := rows.Scan(&admin.Id, &admin.Login, &admin.PasswordHash, &admin.Role, &admin.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		admins = append(admins, admin)
+	}
+	return admins, rows.Err()
+}
+
+func (a *AdminStorage) UpdateRole(ctx context.Context, id int64, role string) error {
+	const op = "AdminStorage.UpdateRole"
+	res, err := conn(ctx, a.db).ExecContext(ctx, "UPDATE admins SET role=? WHERE id=?", role, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storageErrors.ErrAdminNotFound
+	}
+	return nil
+}
+
+func (a *AdminStorage) Delete(ctx context.Context, id int64) error {
+	const op = "AdminStorage.Delete"
+	res, err := conn(ctx, a.db).ExecContext(ctx, "DELETE FROM admins WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storageErrors.ErrAdminNotFound
+	}
+	return nil
+}
+
+type AdminSessionStorage struct {
+	db *DB
+}
+
+func NewAdminSessionStorage(db *DB) *AdminSessionStorage {
+	return &AdminSessionStorage{
+		db: db,
+	}
+}
+
+func (a *AdminSessionStorage) Save(ctx context.Context, s models.AdminSession) error {
+	const op = "AdminSessionStorage.Save"
+	if _, err := conn(ctx, a.db).ExecContext(ctx, "INSERT INTO admin_sessions (token_hash, admin_id, csrf_token, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		s.TokenHash, s.AdminId, s.CSRFToken, s.CreatedAt, s.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AdminSessionStorage) Get(ctx context.Context, tokenHash []byte) (models.AdminSession, error) {
+	const op = "AdminSessionStorage.Get"
+	var s models.AdminSession
+	if err := conn(ctx, a.db).QueryRowContext(ctx, "SELECT token_hash, admin_id, csrf_token, created_at, expires_at FROM admin_sessions WHERE token_hash=?", tokenHash).Scan(
+		&s.TokenHash, &s.AdminId, &s.CSRFToken, &s.CreatedAt, &s.ExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s, storageErrors.ErrAdminSessionNotFound
+		}
+		return s, fmt.Errorf("%s: %w", op, err)
+	}
+	return s, nil
+}
+
+func (a *AdminSessionStorage) Delete(ctx context.Context, tokenHash []byte) error {
+	const op = "AdminSessionStorage.Delete"
+	if _, err := conn(ctx, a.db).ExecContext(ctx, "DELETE FROM admin_sessions WHERE token_hash=?", tokenHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AdminSessionStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	const op = "AdminSessionStorage.DeleteExpired"
+	res, err := conn(ctx, a.db).ExecContext(ctx, "DELETE FROM admin_sessions WHERE expires_at<=?", now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type AppArchiveStorage struct {
+	db *DB
+}
+
+func NewAppArchiveStorage(db *DB) *AppArchiveStorage {
+	return &AppArchiveStorage{
+		db: db,
+	}
+}
+
+func (a *AppArchiveStorage) Save(ctx context.Context, d models.DeletedApp) error {
+	const op = "AppArchiveStorage.Save"
+	// The credentials are left out of the JSON by the App type itself.
+	app, err := json.Marshal(d.App)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := conn(ctx, a.db).ExecContext(ctx, "INSERT INTO deleted_apps (app_id, client_id, name, app, users, permissions, access_requests, attributes, sessions, cascaded, deleted_at, deleted_by, request_id, on_behalf_of) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		d.App.Id, d.App.ClientId, d.App.Name, string(app), d.Data.Users, d.Data.Permissions, d.Data.AccessRequests, d.Data.Attributes, d.Data.Sessions,
+		d.Cascade, d.DeletedAt, d.DeletedBy, d.RequestId, d.OnBehalfOf,
+	); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AppArchiveStorage) List(ctx context.Context, clientId string, limit int) ([]models.DeletedApp, error) {
+	const op = "AppArchiveStorage.List"
+	query := "SELECT id, app, users, permissions, access_requests, attributes, sessions, cascaded, deleted_at, deleted_by, request_id, on_behalf_of FROM deleted_apps"
+	var args []any
+	if clientId != "" {
+		query += " WHERE client_id=?"
+		args = append(args, clientId)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := conn(ctx, a.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var list []models.DeletedApp
+	for rows.Next() {
+		var (
+			d   models.DeletedApp
+			app string
+		)
+		if err := rows.Scan(&d.Id, &app, &d.Data.Users, &d.Data.Permissions, &d.Data.AccessRequests, &d.Data.Attributes, &d.Data.Sessions,
+			&d.Cascade, &d.DeletedAt, &d.DeletedBy, &d.RequestId, &d.OnBehalfOf); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal([]byte(app), &d.App); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
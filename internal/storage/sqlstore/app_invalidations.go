@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"fmt"
+	"time"
+)
+
+type AppInvalidationStorage struct {
+	db *DB
+}
+
+func NewAppInvalidationStorage(db *DB) *AppInvalidationStorage {
+	return &AppInvalidationStorage{
+		db: db,
+	}
+}
+
+func (a *AppInvalidationStorage) Publish(ctx context.Context, clientId string, at time.Time) error {
+	const op = "AppInvalidationStorage.Publish"
+	if _, err := conn(ctx, a.db).ExecContext(ctx,
+		"INSERT INTO app_invalidations (client_id, created_at) VALUES (?, ?)", clientId, at,
+	); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AppInvalidationStorage) Since(ctx context.Context, since time.Time) ([]models.AppInvalidation, error) {
+	const op = "AppInvalidationStorage.Since"
+	rows, err := conn(ctx, a.db).QueryContext(ctx,
+		"SELECT id, client_id, created_at FROM app_invalidations WHERE created_at>=? ORDER BY id", since)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var invalidations []models.AppInvalidation
+	for rows.Next() {
+		var inv models.AppInvalidation
+		if err := rows.Scan(&inv.Id, &inv.ClientId, &inv.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		invalidations = append(invalidations, inv)
+	}
+	return invalidations, rows.Err()
+}
+
+func (a *AppInvalidationStorage) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	const op = "AppInvalidationStorage.DeleteBefore"
+	res, err := conn(ctx, a.db).ExecContext(ctx, "DELETE FROM app_invalidations WHERE created_at<?", before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,247 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type AppStorage struct {
+	db *DB
+}
+
+func NewAppStorage(db *DB) *AppStorage {
+	return &AppStorage{
+		db: db,
+	}
+}
+
+const appColumns = "id, client_id, secret_hash, signing_key, " +
+	"name, description, owner, logo_url, redirect_uris, allowed_origins, created_at, updated_at, " +
+	"token_ttl, registration_closed, require_mfa, password_min_length, " +
+	"password_require_upper, password_require_lower, password_require_digit, password_require_symbol, " +
+	"secret_used_at, secret_rotated_at, prev_secret_hash, prev_secret_expires_at, prev_secret_used_at, " +
+	"prev_signing_key, prev_signing_key_expires_at"
+
+func (a *AppStorage) Save(ctx context.Context, app models.App) (int32, error) {
+	const op = "AppStorage.Save"
+	args, err := appArgs(app)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	id, err := insert(ctx, a.db, "INSERT INTO apps (client_id, secret_hash, signing_key, name, description, owner, logo_url, redirect_uris, allowed_origins, created_at, updated_at, token_ttl, registration_closed, require_mfa, password_min_length, password_require_upper, password_require_lower, password_require_digit, password_require_symbol) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		append([]any{app.ClientId, app.SecretHash, app.SigningKey}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return int32(id), nil
+}
+
+func (a *AppStorage) GetByClientId(ctx context.Context, clientId string) (models.App, error) {
+	const op = "AppStorage.GetByClientId"
+	app, err := scanApp(conn(ctx, a.db).QueryRowContext(ctx, "SELECT "+appColumns+" FROM apps WHERE client_id=?", clientId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return app, storageErrors.ErrAppNotFound
+		}
+		return app, fmt.Errorf("%s: %w", op, err)
+	}
+	return app, nil
+}
+
+func (a *AppStorage) GetBySecretHash(ctx context.Context, secretHash []byte) (models.App, error) {
+	const op = "AppStorage.GetBySecretHash"
+	app, err := scanApp(conn(ctx, a.db).QueryRowContext(ctx, "SELECT "+appColumns+" FROM apps WHERE secret_hash=? OR prev_secret_hash=?", secretHash, secretHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return app, storageErrors.ErrAppNotFound
+		}
+		return app, fmt.Errorf("%s: %w", op, err)
+	}
+	return app, nil
+}
+
+func (a *AppStorage) Update(ctx context.Context, app models.App) error {
+	const op = "AppStorage.Update"
+	args, err := appArgs(app)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := conn(ctx, a.db).ExecContext(ctx, `UPDATE apps SET name=?, description=?, owner=?, logo_url=?,
+		redirect_uris=?, allowed_origins=?, created_at=?, updated_at=?, token_ttl=?, registration_closed=?, require_mfa=?,
+		password_min_length=?, password_require_upper=?, password_require_lower=?, password_require_digit=?, password_require_symbol=?
+		WHERE client_id=?`, append(args, app.ClientId)...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AppStorage) RotateSecret(ctx context.Context, clientId string, secretHash []byte, signingKey []byte, rotatedAt time.Time, prevExpiresAt time.Time) error {
+	const op = "AppStorage.RotateSecret"
+	// The previous secret and key are assigned before the current ones: MySQL evaluates
+	// SET left to right, where the other databases read the row as it was before the update.
+	res, err := conn(ctx, a.db).ExecContext(ctx, `UPDATE apps SET prev_secret_hash=secret_hash, prev_secret_expires_at=?, prev_secret_used_at=NULL,
+		prev_signing_key=signing_key, prev_signing_key_expires_at=?,
+		secret_hash=?, signing_key=?, secret_rotated_at=?, secret_used_at=NULL WHERE client_id=?`,
+		prevExpiresAt, prevExpiresAt, secretHash, signingKey, rotatedAt, clientId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storageErrors.ErrAppNotFound
+	}
+	return nil
+}
+
+func (a *AppStorage) SetSecretUsed(ctx context.Context, clientId string, previous bool, usedAt time.Time) error {
+	const op = "AppStorage.SetSecretUsed"
+	column := "secret_used_at"
+	if previous {
+		column = "prev_secret_used_at"
+	}
+	if _, err := conn(ctx, a.db).ExecContext(ctx, "UPDATE apps SET "+column+"=? WHERE client_id=?", usedAt, clientId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AppStorage) CountData(ctx context.Context, appId int32) (models.AppData, error) {
+	const op = "AppStorage.CountData"
+	var data models.AppData
+	if err := conn(ctx, a.db).QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM users WHERE app_id=?),
+		(SELECT COUNT(*) FROM permissions p JOIN users u ON u.id=p.user_id WHERE u.app_id=?),
+		(SELECT COUNT(*) FROM access_requests WHERE app_id=?),
+		(SELECT COUNT(*) FROM user_attributes WHERE app_id=?),
+		(SELECT COUNT(*) FROM user_sessions WHERE app_id=?)`, appId, appId, appId, appId, appId,
+	).Scan(&data.Users, &data.Permissions, &data.AccessRequests, &data.Attributes, &data.Sessions); err != nil {
+		return data, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// appDependents deletes what belongs to the app with id ?, children first. Databases
+// adopted from before versioned migrations have no foreign keys to cascade along.
+var appDependents = []string{
+	"DELETE FROM user_sessions WHERE user_id IN (SELECT id FROM users WHERE app_id=?)",
+	"DELETE FROM user_attributes WHERE user_id IN (SELECT id FROM users WHERE app_id=?)",
+	"DELETE FROM permissions WHERE user_id IN (SELECT id FROM users WHERE app_id=?)",
+	"DELETE FROM access_requests WHERE app_id=?",
+	"DELETE FROM users WHERE app_id=?",
+	"DELETE FROM attribute_schemas WHERE app_id=?",
+}
+
+// DeleteByClientId removes the app together with its users and their data.
+func (a *AppStorage) DeleteByClientId(ctx context.Context, clientId string) error {
+	const op = "AppStorage.DeleteByClientId"
+	return withinTx(ctx, a.db, func(ctx context.Context) error {
+		tx := conn(ctx, a.db)
+		var id int32
+		err := tx.QueryRowContext(ctx, "SELECT id FROM apps WHERE client_id=?", clientId).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		for _, query := range appDependents {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM apps WHERE id=?", id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	})
+}
+
+func (a *AppStorage) GetAll(ctx context.Context) ([]*models.App, error) {
+	const op = "AppStorage.GetAll"
+	rows, err := conn(ctx, a.db).QueryContext(ctx, "SELECT "+appColumns+" FROM apps ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []*models.App
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		apps = append(apps, &app)
+	}
+	return apps, rows.Err()
+}
+
+// appArgs are the descriptive columns in the order Save and Update write them.
+func appArgs(app models.App) ([]any, error) {
+	redirectURIs, err := json.Marshal(app.RedirectURIs)
+	if err != nil {
+		return nil, err
+	}
+	allowedOrigins, err := json.Marshal(app.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+	s := app.Settings
+	return []any{
+		app.Name, app.Description, app.Owner, app.LogoURL, string(redirectURIs), string(allowedOrigins),
+		nullTime(app.CreatedAt), nullTime(app.UpdatedAt), int64(s.TokenTTL / time.Second), s.RegistrationClosed, s.RequireMFA,
+		s.PasswordPolicy.MinLength, s.PasswordPolicy.RequireUpper, s.PasswordPolicy.RequireLower,
+		s.PasswordPolicy.RequireDigit, s.PasswordPolicy.RequireSymbol,
+	}, nil
+}
+
+func scanApp(row rowScanner) (models.App, error) {
+	var (
+		app                                          models.App
+		redirectURIs, allowedOrigins                 sql.NullString
+		createdAt, updatedAt                         sql.NullTime
+		tokenTTL                                     int64
+		usedAt, rotatedAt, prevExpiresAt, prevUsedAt sql.NullTime
+		prevKeyExpiresAt                             sql.NullTime
+	)
+	policy := &app.Settings.PasswordPolicy
+	if err := row.Scan(&app.Id, &app.ClientId, &app.SecretHash, &app.SigningKey,
+		&app.Name, &app.Description, &app.Owner, &app.LogoURL, &redirectURIs, &allowedOrigins, &createdAt, &updatedAt,
+		&tokenTTL, &app.Settings.RegistrationClosed, &app.Settings.RequireMFA, &policy.MinLength,
+		&policy.RequireUpper, &policy.RequireLower, &policy.RequireDigit, &policy.RequireSymbol,
+		&usedAt, &rotatedAt, &app.PrevSecretHash, &prevExpiresAt, &prevUsedAt,
+		&app.PrevSigningKey, &prevKeyExpiresAt); err != nil {
+		return app, err
+	}
+	if err := decodeList(redirectURIs, &app.RedirectURIs); err != nil {
+		return app, err
+	}
+	if err := decodeList(allowedOrigins, &app.AllowedOrigins); err != nil {
+		return app, err
+	}
+	app.CreatedAt = createdAt.Time
+	app.UpdatedAt = updatedAt.Time
+	app.Settings.TokenTTL = time.Duration(tokenTTL) * time.Second
+	app.SecretUsedAt = usedAt.Time
+	app.SecretRotatedAt = rotatedAt.Time
+	app.PrevSecretExpiresAt = prevExpiresAt.Time
+	app.PrevSecretUsedAt = prevUsedAt.Time
+	app.PrevSigningKeyExpiresAt = prevKeyExpiresAt.Time
+	return app, nil
+}
+
+func decodeList(s sql.NullString, list *[]string) error {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.String), list)
+}
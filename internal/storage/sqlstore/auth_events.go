@@ -0,0 +1,82 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"fmt"
+)
+
+type AuthEventStorage struct {
+	db *DB
+}
+
+func NewAuthEventStorage(db *DB) *AuthEventStorage {
+	return &AuthEventStorage{
+		db: db,
+	}
+}
+
+func (a *AuthEventStorage) Save(ctx context.Context, e models.AuthEvent) error {
+	const op = "AuthEventStorage.Save"
+	if _, err := conn(ctx, a.db).ExecContext(ctx,
+		"INSERT INTO auth_events (type, app_id, user_id, login, success, detail, actor, on_behalf_of, ip, user_agent, request_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.Type, e.AppId, e.UserId, e.Login, e.Success, e.Detail, e.Actor, e.OnBehalfOf, e.IP, e.UserAgent, e.RequestId, e.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (a *AuthEventStorage) List(ctx context.Context, f models.AuthEventFilter) ([]models.AuthEvent, error) {
+	const op = "AuthEventStorage.List"
+	query := "SELECT e.id, e.type, e.app_id, e.user_id, CASE WHEN e.login<>'' THEN e.login ELSE COALESCE(u.login, '') END, " +
+		"e.success, e.detail, e.actor, e.on_behalf_of, e.ip, e.user_agent, e.request_id, e.created_at " +
+		"FROM auth_events e LEFT JOIN users u ON u.id=e.user_id WHERE e.app_id=?"
+	args := []any{f.AppId}
+	switch {
+	case f.UserId != 0 && f.Login != "":
+		query += " AND (e.user_id=? OR e.login=?)"
+		args = append(args, f.UserId, f.Login)
+	case f.UserId != 0:
+		query += " AND e.user_id=?"
+		args = append(args, f.UserId)
+	case f.Login != "":
+		query += " AND e.login=?"
+		args = append(args, f.Login)
+	}
+	if f.Type != "" {
+		query += " AND e.type=?"
+		args = append(args, f.Type)
+	}
+	if !f.From.IsZero() {
+		query += " AND e.created_at>=?"
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		query += " AND e.created_at<?"
+		args = append(args, f.To)
+	}
+	if f.BeforeId != 0 {
+		query += " AND e.id<?"
+		args = append(args, f.BeforeId)
+	}
+	query += " ORDER BY e.id DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := conn(ctx, a.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.AuthEvent
+	for rows.Next() {
+		var e models.AuthEvent
+		if err := rows.Scan(&e.Id, &e.Type, &e.AppId, &e.UserId, &e.Login, &e.Success, &e.Detail, &e.Actor, &e.OnBehalfOf,
+			&e.IP, &e.UserAgent, &e.RequestId, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,164 @@
+// Package sqlstore implements the storages on database/sql. Queries are written
+// once with ? placeholders, what differs between databases is left to a Dialect.
+package sqlstore
+
+import (
+	"SSO/internal/pkg/tracing"
+	"context"
+	"database/sql"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"strings"
+)
+
+// Dialect is what the storages need to know about the database they run on.
+type Dialect struct {
+	// System names the database in traces, one of tracing.DB*.
+	System attribute.KeyValue
+	// Rebind rewrites the ? placeholders into the driver's own, nil when the driver takes them as is.
+	Rebind func(query string) string
+	// Returning makes inserts read the new id with RETURNING id instead of sql.Result.LastInsertId.
+	Returning bool
+	// Upsert returns the clause that turns an INSERT conflicting on the key columns
+	// into an update of the given columns.
+	Upsert func(key []string, columns []string) string
+	// LikeEscape follows LIKE patterns to make the backslash their escape, empty
+	// when it already is by default.
+	LikeEscape string
+	// IsDuplicate reports whether err is a unique key violation.
+	IsDuplicate func(err error) bool
+}
+
+// OnConflictUpdate is the Upsert of databases supporting INSERT ... ON CONFLICT.
+func OnConflictUpdate(key []string, columns []string) string {
+	set := make([]string, len(columns))
+	for i, c := range columns {
+		set[i] = c + "=excluded." + c
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(key, ", "), strings.Join(set, ", "))
+}
+
+// DB is a connection pool with the dialect of its database.
+type DB struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func New(db *sql.DB, dialect Dialect) *DB {
+	return &DB{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+type txKey struct{}
+
+// executor is what *sql.DB and *sql.Tx have in common.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction carried by ctx, or db when there is none,
+// rebinding and tracing each query.
+func conn(ctx context.Context, db *DB) executor {
+	var e executor = db.db
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		e = tx
+	}
+	e = tracing.SQL(db.dialect.System, e)
+	if db.dialect.Rebind != nil {
+		e = rebinder{rebind: db.dialect.Rebind, next: e}
+	}
+	return e
+}
+
+type rebinder struct {
+	rebind func(string) string
+	next   executor
+}
+
+func (r rebinder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return r.next.ExecContext(ctx, r.rebind(query), args...)
+}
+
+func (r rebinder) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return r.next.QueryContext(ctx, r.rebind(query), args...)
+}
+
+func (r rebinder) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return r.next.QueryRowContext(ctx, r.rebind(query), args...)
+}
+
+// insert runs an INSERT into a table with an id column and returns the id of the new row.
+func insert(ctx context.Context, db *DB, query string, args ...any) (int64, error) {
+	var id int64
+	if db.dialect.Returning {
+		err := conn(ctx, db).QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	res, err := conn(ctx, db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func isDuplicate(db *DB, err error) bool {
+	return db.dialect.IsDuplicate(err)
+}
+
+type Transactor struct {
+	db *DB
+}
+
+func NewTransactor(db *DB) *Transactor {
+	return &Transactor{
+		db: db,
+	}
+}
+
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withinTx(ctx, t.db, fn)
+}
+
+func (t *Transactor) AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	hooks, ok := ctx.Value(hooksKey{}).(*[]func())
+	if !ok {
+		fn(ctx)
+		return
+	}
+	*hooks = append(*hooks, func() {
+		fn(context.WithValue(context.WithValue(ctx, txKey{}, nil), hooksKey{}, nil))
+	})
+}
+
+// hooksKey holds the functions to run once the transaction commits.
+type hooksKey struct{}
+
+// withinTx runs fn in a new transaction, or in the one ctx already carries.
+// The transaction is rolled back when fn returns an error and committed otherwise.
+func withinTx(ctx context.Context, db *DB, fn func(ctx context.Context) error) error {
+	const op = "sqlstore.withinTx"
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var hooks []func()
+	if err := fn(context.WithValue(context.WithValue(ctx, txKey{}, tx), hooksKey{}, &hooks)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type PermissionAuditStorage struct {
+	db *DB
+}
+
+func NewPermissionAuditStorage(db *DB) *PermissionAuditStorage {
+	return &PermissionAuditStorage{
+		db: db,
+	}
+}
+
+func (p *PermissionAuditStorage) Save(ctx context.Context, e models.PermissionAuditEntry) error {
+	const op = "PermissionAuditStorage.Save"
+	if _, err := conn(ctx, p.db).ExecContext(ctx,
+		"INSERT INTO permission_audit (app_id, user_id, actor, on_behalf_of, action, old_value, new_value, new_expires_at, request_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.AppId, e.UserId, e.Actor, e.OnBehalfOf, e.Action, e.OldValue, e.NewValue, nullTime(e.NewExpiresAt), e.RequestId, e.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (p *PermissionAuditStorage) List(ctx context.Context, f models.PermissionAuditFilter) ([]models.PermissionAuditEntry, error) {
+	const op = "PermissionAuditStorage.List"
+	query := "SELECT pa.id, pa.app_id, pa.user_id, COALESCE(u.login, ''), pa.actor, pa.on_behalf_of, pa.action, pa.old_value, pa.new_value, pa.new_expires_at, pa.request_id, pa.created_at " +
+		"FROM permission_audit pa LEFT JOIN users u ON u.id=pa.user_id WHERE pa.app_id=?"
+	args := []any{f.AppId}
+	if f.UserId != 0 {
+		query += " AND pa.user_id=?"
+		args = append(args, f.UserId)
+	}
+	if f.Actor != "" {
+		query += " AND pa.actor=?"
+		args = append(args, f.Actor)
+	}
+	if !f.From.IsZero() {
+		query += " AND pa.created_at>=?"
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		query += " AND pa.created_at<?"
+		args = append(args, f.To)
+	}
+	if f.BeforeId != 0 {
+		query += " AND pa.id<?"
+		args = append(args, f.BeforeId)
+	}
+	query += " ORDER BY pa.id DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := conn(ctx, p.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var entries []models.PermissionAuditEntry
+	for rows.Next() {
+		var (
+			e         models.PermissionAuditEntry
+			expiresAt sql.NullTime
+		)
+		if err := rows.Scan(&e.Id, &e.AppId, &e.UserId, &e.Login, &e.Actor, &e.OnBehalfOf, &e.Action, &e.OldValue, &e.NewValue,
+			&expiresAt, &e.RequestId, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		e.NewExpiresAt = expiresAt.Time
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,72 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type PermissionsStorage struct {
+	db *DB
+}
+
+func NewPermissionsStorage(db *DB) *PermissionsStorage {
+	return &PermissionsStorage{
+		db: db,
+	}
+}
+
+func (p *PermissionsStorage) Save(ctx context.Context, userId int64, value int32, expiresAt time.Time) error {
+	const op = "PermissionsStorage.Save"
+	if _, err := conn(ctx, p.db).ExecContext(ctx, "INSERT INTO permissions (user_id, permission, expires_at) VALUES (?, ?, ?)", userId, value, nullTime(expiresAt)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (p *PermissionsStorage) Get(ctx context.Context, userId int64) (models.Permission, error) {
+	const op = "PermissionsStorage.Get"
+	perm := models.Permission{UserId: userId}
+	var expiresAt sql.NullTime
+	if err := conn(ctx, p.db).QueryRowContext(ctx, "SELECT permission, expires_at FROM permissions WHERE user_id=?", userId).Scan(&perm.Value, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return perm, storageErrors.ErrPermissionNotFound
+		}
+		return perm, fmt.Errorf("%s: %w", op, err)
+	}
+	perm.ExpiresAt = expiresAt.Time
+	return perm, nil
+}
+
+func (p *PermissionsStorage) Update(ctx context.Context, userId int64, value int32, expiresAt time.Time) error {
+	const op = "PermissionsStorage.Update"
+	if _, err := conn(ctx, p.db).ExecContext(ctx, "UPDATE permissions SET permission=?, expires_at=? WHERE user_id=?", value, nullTime(expiresAt), userId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (p *PermissionsStorage) Delete(ctx context.Context, userId int64) error {
+	const op = "PermissionsStorage.Delete"
+	if _, err := conn(ctx, p.db).ExecContext(ctx, "DELETE FROM permissions WHERE user_id=?", userId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (p *PermissionsStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	const op = "PermissionsStorage.DeleteExpired"
+	res, err := conn(ctx, p.db).ExecContext(ctx, "DELETE FROM permissions WHERE expires_at IS NOT NULL AND expires_at<=?", now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return res.RowsAffected()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
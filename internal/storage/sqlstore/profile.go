@@ -0,0 +1,108 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"context"
+	"fmt"
+)
+
+type ProfileStorage struct {
+	db *DB
+}
+
+func NewProfileStorage(db *DB) *ProfileStorage {
+	return &ProfileStorage{
+		db: db,
+	}
+}
+
+func (p *ProfileStorage) GetSchema(ctx context.Context, appId int32) ([]models.AttributeDef, error) {
+	const op = "ProfileStorage.GetSchema"
+	rows, err := conn(ctx, p.db).QueryContext(ctx,
+		"SELECT name, type, required, is_unique, pattern, claim FROM attribute_schemas WHERE app_id=? ORDER BY name", appId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var defs []models.AttributeDef
+	for rows.Next() {
+		var d models.AttributeDef
+		if err := rows.Scan(&d.Name, &d.Type, &d.Required, &d.Unique, &d.Pattern, &d.Claim); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defs = append(defs, d)
+	}
+	return defs, rows.Err()
+}
+
+func (p *ProfileStorage) SaveSchema(ctx context.Context, appId int32, defs []models.AttributeDef) error {
+	const op = "ProfileStorage.SaveSchema"
+	return withinTx(ctx, p.db, func(ctx context.Context) error {
+		tx := conn(ctx, p.db)
+		if _, err := tx.ExecContext(ctx, "DELETE FROM attribute_schemas WHERE app_id=?", appId); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		for _, d := range defs {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO attribute_schemas (app_id, name, type, required, is_unique, pattern, claim) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				appId, d.Name, d.Type, d.Required, d.Unique, d.Pattern, d.Claim,
+			); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (p *ProfileStorage) GetAttributes(ctx context.Context, userId int64) (map[string]string, error) {
+	const op = "ProfileStorage.GetAttributes"
+	rows, err := conn(ctx, p.db).QueryContext(ctx, "SELECT name, value FROM user_attributes WHERE user_id=?", userId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	attrs := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		attrs[name] = value
+	}
+	return attrs, rows.Err()
+}
+
+func (p *ProfileStorage) SetAttributes(ctx context.Context, appId int32, userId int64, attrs map[string]string) error {
+	const op = "ProfileStorage.SetAttributes"
+	return withinTx(ctx, p.db, func(ctx context.Context) error {
+		tx := conn(ctx, p.db)
+		var err error
+		for name, value := range attrs {
+			if value == "" {
+				_, err = tx.ExecContext(ctx, "DELETE FROM user_attributes WHERE user_id=? AND name=?", userId, name)
+			} else {
+				_, err = tx.ExecContext(ctx,
+					"INSERT INTO user_attributes (user_id, app_id, name, value) VALUES (?, ?, ?, ?) "+p.db.dialect.Upsert([]string{"user_id", "name"}, []string{"value"}),
+					userId, appId, name, value)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (p *ProfileStorage) ValueTaken(ctx context.Context, appId int32, name string, value string, userId int64) (bool, error) {
+	const op = "ProfileStorage.ValueTaken"
+	var count int
+	if err := conn(ctx, p.db).QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM user_attributes WHERE app_id=? AND name=? AND value=? AND user_id<>?",
+		appId, name, value, userId,
+	).Scan(&count); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return count != 0, nil
+}
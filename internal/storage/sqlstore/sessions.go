@@ -0,0 +1,116 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type UserSessionStorage struct {
+	db *DB
+}
+
+func NewUserSessionStorage(db *DB) *UserSessionStorage {
+	return &UserSessionStorage{
+		db: db,
+	}
+}
+
+const userSessionColumns = "id, app_id, user_id, created_at, expires_at, revoked_at"
+
+func (u *UserSessionStorage) Save(ctx context.Context, s models.UserSession) error {
+	const op = "UserSessionStorage.Save"
+	if _, err := conn(ctx, u.db).ExecContext(ctx, "INSERT INTO user_sessions (id, app_id, user_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		s.Id, s.AppId, s.UserId, s.CreatedAt, s.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserSessionStorage) Get(ctx context.Context, id string) (models.UserSession, error) {
+	const op = "UserSessionStorage.Get"
+	s, err := scanUserSession(conn(ctx, u.db).QueryRowContext(ctx, "SELECT "+userSessionColumns+" FROM user_sessions WHERE id=?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s, storageErrors.ErrSessionNotFound
+		}
+		return s, fmt.Errorf("%s: %w", op, err)
+	}
+	return s, nil
+}
+
+func (u *UserSessionStorage) ListActive(ctx context.Context, userId int64, now time.Time) ([]models.UserSession, error) {
+	const op = "UserSessionStorage.ListActive"
+	rows, err := conn(ctx, u.db).QueryContext(ctx, "SELECT "+userSessionColumns+" FROM user_sessions WHERE user_id=? AND revoked_at IS NULL AND expires_at>? ORDER BY created_at DESC, id DESC",
+		userId, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.UserSession
+	for rows.Next() {
+		s, err := scanUserSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (u *UserSessionStorage) Revoke(ctx context.Context, userId int64, id string, at time.Time) error {
+	const op = "UserSessionStorage.Revoke"
+	res, err := conn(ctx, u.db).ExecContext(ctx, "UPDATE user_sessions SET revoked_at=? WHERE id=? AND user_id=? AND revoked_at IS NULL", at, id, userId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storageErrors.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (u *UserSessionStorage) RevokeAll(ctx context.Context, userId int64, at time.Time) (int64, error) {
+	const op = "UserSessionStorage.RevokeAll"
+	res, err := conn(ctx, u.db).ExecContext(ctx, "UPDATE user_sessions SET revoked_at=? WHERE user_id=? AND revoked_at IS NULL", at, userId)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
+
+func (u *UserSessionStorage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	const op = "UserSessionStorage.DeleteExpired"
+	res, err := conn(ctx, u.db).ExecContext(ctx, "DELETE FROM user_sessions WHERE expires_at<=?", now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
+
+func scanUserSession(row rowScanner) (models.UserSession, error) {
+	var (
+		s         models.UserSession
+		revokedAt sql.NullTime
+	)
+	err := row.Scan(&s.Id, &s.AppId, &s.UserId, &s.CreatedAt, &s.ExpiresAt, &revokedAt)
+	s.RevokedAt = revokedAt.Time
+	return s, err
+}
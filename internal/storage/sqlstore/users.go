@@ -0,0 +1,306 @@
+package sqlstore
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type UserStorage struct {
+	db *DB
+}
+
+func NewUserStorage(db *DB) *UserStorage {
+	return &UserStorage{
+		db: db,
+	}
+}
+
+const userColumns = "u.id, u.app_id, u.login, u.email, u.password, u.created_at, u.mfa_enabled, u.password_reset_required, u.status, u.suspended_until, u.deleted_at"
+
+func (u *UserStorage) Save(ctx context.Context, user models.User) error {
+	const op = "userStorage.Save"
+	if _, err := conn(ctx, u.db).ExecContext(ctx, "INSERT INTO users (login, email, password, app_id, created_at, status) VALUES (?, ?, ?, ?, ?, ?)",
+		user.Login, user.Email, user.PasswordHash, user.AppId, user.CreatedAt, models.UserActive); err != nil {
+		if isDuplicate(u.db, err) {
+			return storageErrors.ErrUserExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserStorage) SaveBatch(ctx context.Context, records []models.UserRecord) ([]int64, error) {
+	const op = "userStorage.SaveBatch"
+	ids := make([]int64, 0, len(records))
+	err := withinTx(ctx, u.db, func(ctx context.Context) error {
+		tx := conn(ctx, u.db)
+		for _, r := range records {
+			id, err := insert(ctx, u.db, "INSERT INTO users (login, email, password, app_id, created_at, status) VALUES (?, ?, ?, ?, ?, ?)",
+				r.User.Login, r.User.Email, r.User.PasswordHash, r.User.AppId, r.User.CreatedAt, models.UserActive)
+			if err != nil {
+				if isDuplicate(u.db, err) {
+					return fmt.Errorf("%s: %s: %w", op, r.User.Login, storageErrors.ErrUserExists)
+				}
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if r.Role != nil {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO permissions (user_id, permission) VALUES (?, ?)", id, *r.Role); err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
+			for name, value := range r.Attributes {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO user_attributes (user_id, app_id, name, value) VALUES (?, ?, ?, ?)",
+					id, r.User.AppId, name, value); err != nil {
+					return fmt.Errorf("%s: %w", op, err)
+				}
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (u *UserStorage) Get(ctx context.Context, appId int32, login string) (models.User, error) {
+	const op = "userStorage.Get"
+
+	user, err := scanUser(conn(ctx, u.db).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users u WHERE u.app_id=? AND u.login=?", appId, login))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, storageErrors.ErrUserNotFound
+		}
+		return user, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+var userSortColumns = map[string]string{
+	models.UserSortId:        "u.id",
+	models.UserSortLogin:     "u.login",
+	models.UserSortEmail:     "u.email",
+	models.UserSortCreatedAt: "u.created_at",
+}
+
+func (u *UserStorage) List(ctx context.Context, f models.UserFilter) ([]models.User, error) {
+	const op = "userStorage.List"
+	sortColumn, ok := userSortColumns[f.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown sort field %q", op, f.SortBy)
+	}
+
+	now := time.Now()
+	query := "SELECT " + userColumns + " FROM users u"
+	where := []string{"u.app_id=?"}
+	args := []any{f.AppId}
+	if f.Role != nil {
+		query += " JOIN permissions p ON p.user_id=u.id"
+		where = append(where, "p.permission=?", "(p.expires_at IS NULL OR p.expires_at>?)")
+		args = append(args, *f.Role, now)
+	}
+	if f.Search != "" {
+		pattern := escapeLike(f.Search) + "%"
+		if f.Substring {
+			pattern = "%" + pattern
+		}
+		where = append(where, "(u.login LIKE ?"+u.db.dialect.LikeEscape+" OR u.email LIKE ?"+u.db.dialect.LikeEscape+")")
+		args = append(args, pattern, pattern)
+	}
+	if !f.CreatedFrom.IsZero() {
+		where = append(where, "u.created_at>=?")
+		args = append(args, f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		where = append(where, "u.created_at<?")
+		args = append(args, f.CreatedTo)
+	}
+	switch f.Status {
+	case "":
+		where = append(where, "u.status<>?")
+		args = append(args, models.UserDeleted)
+	case models.UserActive:
+		where = append(where, "(u.status=? OR (u.status=? AND u.suspended_until<=?))")
+		args = append(args, models.UserActive, models.UserSuspended, now)
+	case models.UserSuspended:
+		where = append(where, "u.status=? AND u.suspended_until>?")
+		args = append(args, models.UserSuspended, now)
+	default:
+		where = append(where, "u.status=?")
+		args = append(args, f.Status)
+	}
+	if f.MFAEnabled != nil {
+		where = append(where, "u.mfa_enabled=?")
+		args = append(args, *f.MFAEnabled)
+	}
+
+	cmp, order := ">", "ASC"
+	if f.Desc {
+		cmp, order = "<", "DESC"
+	}
+	if f.AfterId != 0 {
+		if sortColumn == "u.id" {
+			where = append(where, "u.id"+cmp+"?")
+			args = append(args, f.AfterId)
+		} else {
+			where = append(where, fmt.Sprintf("(%[1]s%[2]s? OR (%[1]s=? AND u.id%[2]s?))", sortColumn, cmp))
+			args = append(args, f.AfterValue, f.AfterValue, f.AfterId)
+		}
+	}
+	query += " WHERE " + strings.Join(where, " AND ")
+	if sortColumn != "u.id" {
+		query += fmt.Sprintf(" ORDER BY %s %s, u.id %s", sortColumn, order, order)
+	} else {
+		query += " ORDER BY u.id " + order
+	}
+	query += " LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := conn(ctx, u.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// userDependents deletes what belongs to the user with id ?, before the user itself.
+// Databases adopted from before versioned migrations have no foreign keys to cascade along.
+var userDependents = []string{
+	"DELETE FROM user_sessions WHERE user_id=?",
+	"DELETE FROM user_attributes WHERE user_id=?",
+	"DELETE FROM permissions WHERE user_id=?",
+	"DELETE FROM access_requests WHERE user_id=?",
+	"DELETE FROM users WHERE id=?",
+}
+
+// Delete removes the user together with its permission, profile, sessions and access requests.
+func (u *UserStorage) Delete(ctx context.Context, appId int32, login string) error {
+	const op = "userStorage.Delete"
+	return withinTx(ctx, u.db, func(ctx context.Context) error {
+		tx := conn(ctx, u.db)
+		var id int64
+		err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE app_id=? AND login=?", appId, login).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		for _, query := range userDependents {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (u *UserStorage) UpdateStatus(ctx context.Context, appId int32, login string, status string, suspendedUntil time.Time, deletedAt time.Time) error {
+	const op = "userStorage.UpdateStatus"
+	if _, err := conn(ctx, u.db).ExecContext(ctx, "UPDATE users SET status=?, suspended_until=?, deleted_at=? WHERE app_id=? AND login=?",
+		status, nullTime(suspendedUntil), nullTime(deletedAt), appId, login); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserStorage) ListDeleted(ctx context.Context, before time.Time, limit int) ([]models.User, error) {
+	const op = "userStorage.ListDeleted"
+	rows, err := conn(ctx, u.db).QueryContext(ctx, "SELECT "+userColumns+" FROM users u WHERE u.status=? AND u.deleted_at<? ORDER BY u.id LIMIT ?",
+		models.UserDeleted, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (u *UserStorage) UpdateLogin(ctx context.Context, appId int32, login string, newLogin string) error {
+	const op = "userStorage.UpdateLogin"
+	if _, err := conn(ctx, u.db).ExecContext(ctx, "UPDATE users SET login=? WHERE app_id=? AND login=?", newLogin, appId, login); err != nil {
+		if isDuplicate(u.db, err) {
+			return storageErrors.ErrUserExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserStorage) UpdatePassword(ctx context.Context, appId int32, login string, passwordHash []byte) error {
+	const op = "userStorage.UpdatePassword"
+	if _, err := conn(ctx, u.db).ExecContext(ctx, "UPDATE users SET password=?, password_reset_required=FALSE WHERE app_id=? AND login=?", passwordHash, appId, login); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserStorage) SetMFAEnabled(ctx context.Context, appId int32, login string, enabled bool) error {
+	const op = "userStorage.SetMFAEnabled"
+	if _, err := conn(ctx, u.db).ExecContext(ctx, "UPDATE users SET mfa_enabled=? WHERE app_id=? AND login=?", enabled, appId, login); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserStorage) SetPasswordResetRequired(ctx context.Context, appId int32, login string, required bool) error {
+	const op = "userStorage.SetPasswordResetRequired"
+	if _, err := conn(ctx, u.db).ExecContext(ctx, "UPDATE users SET password_reset_required=? WHERE app_id=? AND login=?", required, appId, login); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (u *UserStorage) TestOnExist(ctx context.Context, appId int32, login string) (bool, error) {
+	const op = "userStorage.TestOnExist"
+	var count int
+	if err := conn(ctx, u.db).QueryRowContext(ctx, "SELECT COUNT(id) FROM users WHERE app_id=? AND login=?", appId, login).Scan(&count); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return count != 0, nil
+}
+
+func scanUser(row rowScanner) (models.User, error) {
+	var (
+		user                      models.User
+		suspendedUntil, deletedAt sql.NullTime
+	)
+	err := row.Scan(&user.Id, &user.AppId, &user.Login, &user.Email, &user.PasswordHash,
+		&user.CreatedAt, &user.MFAEnabled, &user.PasswordResetRequired, &user.Status, &suspendedUntil, &deletedAt)
+	user.SuspendedUntil = suspendedUntil.Time
+	user.DeletedAt = deletedAt.Time
+	return user, err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -3,56 +3,299 @@ package storage
 import (
 	"SSO/internal/config"
 	"SSO/internal/domain/models"
+	"SSO/internal/storage/memory"
+	"SSO/internal/storage/migrations"
 	"SSO/internal/storage/mysql"
+	"SSO/internal/storage/postgres"
+	"SSO/internal/storage/sqlite"
+	"SSO/internal/storage/sqlstore"
 	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"net/url"
+	"time"
 )
 
+// Transactor runs fn in a transaction, committing it when fn returns nil and rolling it back otherwise.
+// Storage calls made with the ctx passed to fn join the transaction, and so do nested WithinTx calls.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// AfterCommit runs fn once the outermost transaction ctx carries commits, and not at
+	// all when it rolls back. fn gets a ctx outside of the transaction. Outside of one,
+	// fn runs right away.
+	AfterCommit(ctx context.Context, fn func(ctx context.Context))
+}
+
 type UserStorage interface {
-	Save(ctx context.Context, appId int32, login string, passwordHash []byte) error
+	// Save returns storageErrors.ErrUserExists when the login is taken.
+	Save(ctx context.Context, user models.User) error
+	// SaveBatch inserts the users with their roles and attributes in one transaction
+	// and returns their ids in the order of records.
+	SaveBatch(ctx context.Context, records []models.UserRecord) ([]int64, error)
 	Get(ctx context.Context, appId int32, login string) (models.User, error)
+	List(ctx context.Context, filter models.UserFilter) ([]models.User, error)
 	Delete(ctx context.Context, appId int32, login string) error
+	// UpdateStatus sets the status; suspendedUntil and deletedAt are stored as NULL when zero.
+	UpdateStatus(ctx context.Context, appId int32, login string, status string, suspendedUntil time.Time, deletedAt time.Time) error
+	// ListDeleted returns up to limit soft-deleted users of every app deleted before the given time.
+	ListDeleted(ctx context.Context, before time.Time, limit int) ([]models.User, error)
 	UpdateLogin(ctx context.Context, appId int32, login string, newLogin string) error
+	// UpdatePassword also clears a pending password reset.
 	UpdatePassword(ctx context.Context, appId int32, login string, passwordHash []byte) error
+	SetMFAEnabled(ctx context.Context, appId int32, login string, enabled bool) error
+	SetPasswordResetRequired(ctx context.Context, appId int32, login string, required bool) error
 	TestOnExist(ctx context.Context, appId int32, login string) (bool, error)
 }
 
+type ProfileStorage interface {
+	GetSchema(ctx context.Context, appId int32) ([]models.AttributeDef, error)
+	// SaveSchema replaces the app's schema with defs.
+	SaveSchema(ctx context.Context, appId int32, defs []models.AttributeDef) error
+	GetAttributes(ctx context.Context, userId int64) (map[string]string, error)
+	// SetAttributes upserts attrs, deleting the attributes whose value is empty.
+	SetAttributes(ctx context.Context, appId int32, userId int64, attrs map[string]string) error
+	// ValueTaken reports whether a user of the app other than userId has the attribute set to value.
+	ValueTaken(ctx context.Context, appId int32, name string, value string, userId int64) (bool, error)
+}
+
 type AppsStorage interface {
-	Save(ctx context.Context, key []byte) error
-	GetByKey(ctx context.Context, key []byte) (models.App, error)
-	DeleteByKey(ctx context.Context, key []byte) error
-	TestOnExist(ctx context.Context, key []byte) bool
+	// Save stores the app and returns its id.
+	Save(ctx context.Context, app models.App) (int32, error)
+	GetByClientId(ctx context.Context, clientId string) (models.App, error)
+	// Update writes the app's descriptive fields. Credentials only change through RotateSecret.
+	Update(ctx context.Context, app models.App) error
+	// GetBySecretHash finds apps created before client ids, whose credential is the bare secret.
+	// It matches the current as well as the previous secret.
+	GetBySecretHash(ctx context.Context, secretHash []byte) (models.App, error)
+	// RotateSecret replaces the secret with secretHash and the signing key with signingKey.
+	// The replaced secret and key become the previous ones, valid until prevExpiresAt,
+	// and the usage times of both secrets start over.
+	RotateSecret(ctx context.Context, clientId string, secretHash []byte, signingKey []byte, rotatedAt time.Time, prevExpiresAt time.Time) error
+	// SetSecretUsed records when the current secret, or the previous one, last authenticated.
+	SetSecretUsed(ctx context.Context, clientId string, previous bool, usedAt time.Time) error
+	// CountData counts what DeleteByClientId deletes together with the app.
+	CountData(ctx context.Context, appId int32) (models.AppData, error)
+	// DeleteByClientId deletes the app with its users and everything that references them.
+	// The permission audit trail is kept.
+	DeleteByClientId(ctx context.Context, clientId string) error
 	GetAll(ctx context.Context) ([]*models.App, error)
 }
 
+// AppInvalidationStorage is the feed the instances sharing a database publish the
+// apps they change to, see cache.AppStorage.
+type AppInvalidationStorage interface {
+	Publish(ctx context.Context, clientId string, at time.Time) error
+	// Since returns the invalidations published at or after since, oldest first.
+	Since(ctx context.Context, since time.Time) ([]models.AppInvalidation, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// AppArchiveStorage keeps the records of deleted apps.
+type AppArchiveStorage interface {
+	Save(ctx context.Context, deleted models.DeletedApp) error
+	// List returns up to limit records, newest first, only those of clientId when it is set.
+	List(ctx context.Context, clientId string, limit int) ([]models.DeletedApp, error)
+}
+
+// AdminStorage keeps the accounts of the admin console.
+type AdminStorage interface {
+	// Save returns storageErrors.ErrAdminExists when the login is taken.
+	Save(ctx context.Context, admin models.Admin) (int64, error)
+	GetById(ctx context.Context, id int64) (models.Admin, error)
+	GetByLogin(ctx context.Context, login string) (models.Admin, error)
+	// List returns every admin ordered by login.
+	List(ctx context.Context) ([]models.Admin, error)
+	UpdateRole(ctx context.Context, id int64, role string) error
+	// Delete deletes the admin together with its sessions.
+	Delete(ctx context.Context, id int64) error
+	// ClaimBootstrap marks the first admin as created, once: later claims return
+	// storageErrors.ErrAdminsBootstrapped. Concurrent claims wait for each other.
+	ClaimBootstrap(ctx context.Context, at time.Time) error
+}
+
+type AdminSessionStorage interface {
+	Save(ctx context.Context, session models.AdminSession) error
+	Get(ctx context.Context, tokenHash []byte) (models.AdminSession, error)
+	Delete(ctx context.Context, tokenHash []byte) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// UserSessionStorage keeps the sessions of the tokens issued at login.
+type UserSessionStorage interface {
+	Save(ctx context.Context, session models.UserSession) error
+	Get(ctx context.Context, id string) (models.UserSession, error)
+	// ListActive returns the user's sessions neither revoked nor expired at now, newest first.
+	ListActive(ctx context.Context, userId int64, now time.Time) ([]models.UserSession, error)
+	// Revoke returns storageErrors.ErrSessionNotFound unless the user has an unrevoked session with the id.
+	Revoke(ctx context.Context, userId int64, id string, at time.Time) error
+	// RevokeAll revokes the user's unrevoked sessions and returns how many there were.
+	RevokeAll(ctx context.Context, userId int64, at time.Time) (int64, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// AuthEventStorage keeps the append-only authentication audit log.
+type AuthEventStorage interface {
+	Save(ctx context.Context, event models.AuthEvent) error
+	// List returns events matching filter, newest first.
+	List(ctx context.Context, filter models.AuthEventFilter) ([]models.AuthEvent, error)
+}
+
 type PermissionsStorage interface {
-	Save(ctx context.Context, userId int64, value int32) error
-	Get(ctx context.Context, userId int64) (int32, error)
-	Update(ctx context.Context, userId int64, value int32) error
+	Save(ctx context.Context, userId int64, value int32, expiresAt time.Time) error
+	Get(ctx context.Context, userId int64) (models.Permission, error)
+	Update(ctx context.Context, userId int64, value int32, expiresAt time.Time) error
 	Delete(ctx context.Context, userId int64) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type PermissionAuditStorage interface {
+	Save(ctx context.Context, entry models.PermissionAuditEntry) error
+	List(ctx context.Context, filter models.PermissionAuditFilter) ([]models.PermissionAuditEntry, error)
+}
+
+type AccessRequestsStorage interface {
+	Save(ctx context.Context, req models.AccessRequest) (int64, error)
+	Get(ctx context.Context, id int64) (models.AccessRequest, error)
+	GetByApp(ctx context.Context, appId int32, status string) ([]models.AccessRequest, error)
+	// Decide sets the status of a pending request. Requests decided already are left
+	// as they are and reported as storageErrors.ErrAccessRequestDecided.
+	Decide(ctx context.Context, id int64, status string, approver string, decidedAt time.Time) error
 }
 
 type Storage struct {
+	// Migrator manages the schema and DB is the connection pool. Both are nil
+	// for the memory driver, which has neither, and so is AppInvalidations, as
+	// its data can't be shared by several instances.
+	Migrator           *migrations.Migrator
+	DB                 *sql.DB
+	AppInvalidations   AppInvalidationStorage
+	Tx                 Transactor
 	UserStorage        UserStorage
+	UserSessions       UserSessionStorage
+	ProfileStorage     ProfileStorage
 	AppStorage         AppsStorage
+	AppArchive         AppArchiveStorage
 	PermissionsStorage PermissionsStorage
+	PermissionAudit    PermissionAuditStorage
+	AuthEvents         AuthEventStorage
+	AccessRequests     AccessRequestsStorage
+	Admins             AdminStorage
+	AdminSessions      AdminSessionStorage
+}
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	// DriverMemory keeps everything in process memory and loses it on restart.
+	DriverMemory = "memory"
+)
+
+// sqlDrivers maps config drivers to the database/sql drivers they use.
+var sqlDrivers = map[string]string{
+	DriverMySQL:    "mysql",
+	DriverPostgres: "postgres",
+	DriverSQLite:   sqlite.DriverName,
 }
 
+// dialects maps config drivers to the SQL dialects of their databases.
+var dialects = map[string]sqlstore.Dialect{
+	DriverMySQL:    mysql.Dialect,
+	DriverPostgres: postgres.Dialect,
+	DriverSQLite:   sqlite.Dialect,
+}
+
+// New connects to the database described by cnf and returns the storage of its driver.
 func New(cnf *config.DBConfig) (*Storage, error) {
 	const op = "storage.New"
-	db, err := sql.Open("mysql",
-		fmt.Sprintf("%s:%s@tcp(%s)/%s", cnf.User, cnf.Password, cnf.Server, cnf.DBName))
+	if cnf.Driver == DriverMemory {
+		return NewMemory(), nil
+	}
+	var dsn string
+	switch cnf.Driver {
+	case DriverMySQL, "":
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", cnf.User, cnf.Password, cnf.Server, cnf.DBName)
+	case DriverPostgres:
+		dsn = (&url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cnf.User, cnf.Password),
+			Host:     cnf.Server,
+			Path:     cnf.DBName,
+			RawQuery: url.Values{"sslmode": {cnf.SSLMode}}.Encode(),
+		}).String()
+	case DriverSQLite:
+		dsn = sqlite.DSN(cnf.DBName)
+	default:
+		return nil, fmt.Errorf("%s: unknown driver %q", op, cnf.Driver)
+	}
+	s, err := Open(cnf.Driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return s, nil
+}
+
+// NewMemory returns an empty in-memory storage.
+func NewMemory() *Storage {
+	db := memory.New()
+	return &Storage{
+		Tx:                 memory.NewTransactor(db),
+		UserStorage:        memory.NewUserStorage(db),
+		UserSessions:       memory.NewUserSessionStorage(db),
+		ProfileStorage:     memory.NewProfileStorage(db),
+		AppStorage:         memory.NewAppStorage(db),
+		AppArchive:         memory.NewAppArchiveStorage(db),
+		PermissionsStorage: memory.NewPermissionsStorage(db),
+		PermissionAudit:    memory.NewPermissionAuditStorage(db),
+		AuthEvents:         memory.NewAuthEventStorage(db),
+		AccessRequests:     memory.NewAccessRequestsStorage(db),
+		Admins:             memory.NewAdminStorage(db),
+		AdminSessions:      memory.NewAdminSessionStorage(db),
+	}
+}
+
+// Open connects to dsn with the given driver. MySQL DSNs must set parseTime=true,
+// SQLite ones should come from sqlite.DSN. The schema isn't checked, see Storage.Migrator.
+func Open(driver string, dsn string) (*Storage, error) {
+	const op = "storage.Open"
+	if driver == "" {
+		driver = DriverMySQL
+	}
+	sqlDriver, ok := sqlDrivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown driver %q", op, driver)
+	}
+	db, err := sql.Open(sqlDriver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	migrator, err := migrations.New(db, driver)
+	if err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	sdb := sqlstore.New(db, dialects[driver])
 	return &Storage{
-		UserStorage:        mysql.NewUserStorage(db),
-		AppStorage:         mysql.NewAppStorage(db),
-		PermissionsStorage: mysql.NewPermissionsStorage(db),
+		Migrator:           migrator,
+		DB:                 db,
+		AppInvalidations:   sqlstore.NewAppInvalidationStorage(sdb),
+		Tx:                 sqlstore.NewTransactor(sdb),
+		UserStorage:        sqlstore.NewUserStorage(sdb),
+		UserSessions:       sqlstore.NewUserSessionStorage(sdb),
+		ProfileStorage:     sqlstore.NewProfileStorage(sdb),
+		AppStorage:         sqlstore.NewAppStorage(sdb),
+		AppArchive:         sqlstore.NewAppArchiveStorage(sdb),
+		PermissionsStorage: sqlstore.NewPermissionsStorage(sdb),
+		PermissionAudit:    sqlstore.NewPermissionAuditStorage(sdb),
+		AuthEvents:         sqlstore.NewAuthEventStorage(sdb),
+		AccessRequests:     sqlstore.NewAccessRequestsStorage(sdb),
+		Admins:             sqlstore.NewAdminStorage(sdb),
+		AdminSessions:      sqlstore.NewAdminSessionStorage(sdb),
 	}, nil
 }
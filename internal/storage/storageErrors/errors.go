@@ -3,7 +3,15 @@ package storageErrors
 import "errors"
 
 var (
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
-	ErrAppNotFound  = errors.New("app not found")
+	ErrUserExists            = errors.New("user already exists")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrAppNotFound           = errors.New("app not found")
+	ErrPermissionNotFound    = errors.New("permission not found")
+	ErrAccessRequestNotFound = errors.New("access request not found")
+	ErrAccessRequestDecided  = errors.New("access request already decided")
+	ErrAdminExists           = errors.New("admin already exists")
+	ErrAdminsBootstrapped    = errors.New("admins already bootstrapped")
+	ErrAdminNotFound         = errors.New("admin not found")
+	ErrAdminSessionNotFound  = errors.New("admin session not found")
+	ErrSessionNotFound       = errors.New("session not found")
 )
@@ -0,0 +1,635 @@
+// Package storagetest is a conformance suite every storage backend must pass.
+// It only adds rows with random keys, so it can run against a shared, already migrated database.
+package storagetest
+
+import (
+	"SSO/internal/domain/models"
+	"SSO/internal/storage"
+	"SSO/internal/storage/storageErrors"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the suite against s.
+func Run(t *testing.T, s *storage.Storage) {
+	t.Run("Apps", func(t *testing.T) { testApps(t, s) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, s) })
+	t.Run("Permissions", func(t *testing.T) { testPermissions(t, s) })
+	t.Run("AccessRequests", func(t *testing.T) { testAccessRequests(t, s) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, s) })
+	t.Run("AppDeletion", func(t *testing.T) { testAppDeletion(t, s) })
+	t.Run("Admins", func(t *testing.T) { testAdmins(t, s) })
+	t.Run("UserSessions", func(t *testing.T) { testUserSessions(t, s) })
+	t.Run("AuthEvents", func(t *testing.T) { testAuthEvents(t, s) })
+	if s.AppInvalidations != nil {
+		t.Run("AppInvalidations", func(t *testing.T) { testAppInvalidations(t, s) })
+	}
+}
+
+func testApps(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+
+	_, err := s.AppStorage.GetByClientId(ctx, randomString(t))
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+	_, err = s.AppStorage.GetBySecretHash(ctx, []byte(randomString(t)))
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+
+	app := newApp(t, s)
+	require.NotZero(t, app.Id)
+	byHash, err := s.AppStorage.GetBySecretHash(ctx, app.SecretHash)
+	require.NoError(t, err)
+	require.Equal(t, app, byHash)
+
+	require.Equal(t, []string{"https://example.com/callback"}, app.RedirectURIs)
+	require.Equal(t, 8, app.Settings.PasswordPolicy.MinLength)
+	app.Name = "renamed " + app.ClientId
+	app.AllowedOrigins = []string{"https://example.com", "https://example.org"}
+	app.UpdatedAt = app.CreatedAt.Add(time.Minute)
+	app.Settings = models.AppSettings{
+		TokenTTL:           time.Hour,
+		RegistrationClosed: true,
+		RequireMFA:         true,
+		PasswordPolicy:     models.PasswordPolicy{MinLength: 12, RequireDigit: true, RequireSymbol: true},
+	}
+	require.NoError(t, s.AppStorage.Update(ctx, app))
+	updated, err := s.AppStorage.GetByClientId(ctx, app.ClientId)
+	require.NoError(t, err)
+	require.WithinDuration(t, app.UpdatedAt, updated.UpdatedAt, 0)
+	updated.CreatedAt, updated.UpdatedAt = app.CreatedAt, app.UpdatedAt
+	require.Equal(t, app, updated)
+
+	apps, err := s.AppStorage.GetAll(ctx)
+	require.NoError(t, err)
+	require.Contains(t, appClientIds(apps), app.ClientId)
+
+	now := time.Now().Truncate(time.Second)
+	require.NoError(t, s.AppStorage.SetSecretUsed(ctx, app.ClientId, false, now))
+	newHash, newKey := []byte(randomString(t)), []byte(randomString(t))
+	require.NoError(t, s.AppStorage.RotateSecret(ctx, app.ClientId, newHash, newKey, now, now.Add(time.Hour)))
+	require.ErrorIs(t, s.AppStorage.RotateSecret(ctx, randomString(t), newHash, newKey, now, now), storageErrors.ErrAppNotFound)
+	rotated, err := s.AppStorage.GetBySecretHash(ctx, app.SecretHash)
+	require.NoError(t, err)
+	require.Equal(t, newHash, rotated.SecretHash)
+	require.Equal(t, app.SecretHash, rotated.PrevSecretHash)
+	require.WithinDuration(t, now, rotated.SecretRotatedAt, 0)
+	require.WithinDuration(t, now.Add(time.Hour), rotated.PrevSecretExpiresAt, 0)
+	require.Equal(t, newKey, rotated.SigningKey)
+	require.Equal(t, app.SigningKey, rotated.PrevSigningKey)
+	require.WithinDuration(t, now.Add(time.Hour), rotated.PrevSigningKeyExpiresAt, 0)
+	require.True(t, rotated.SecretUsedAt.IsZero())
+	require.False(t, rotated.PrevSecretInUse())
+	require.NoError(t, s.AppStorage.SetSecretUsed(ctx, app.ClientId, true, now))
+	rotated, err = s.AppStorage.GetBySecretHash(ctx, newHash)
+	require.NoError(t, err)
+	require.WithinDuration(t, now, rotated.PrevSecretUsedAt, 0)
+	require.True(t, rotated.PrevSecretInUse())
+
+	require.NoError(t, s.AppStorage.DeleteByClientId(ctx, app.ClientId))
+	_, err = s.AppStorage.GetByClientId(ctx, app.ClientId)
+	require.ErrorIs(t, err, storageErrors.ErrAppNotFound)
+}
+
+func testUsers(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	app := newApp(t, s)
+	login := randomString(t)
+
+	_, err := s.UserStorage.Get(ctx, app.Id, login)
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+
+	user := newUser(t, s, app.Id, login)
+	require.NotZero(t, user.Id)
+	require.Equal(t, login, user.Login)
+	require.Equal(t, models.UserActive, user.Status)
+	exist, err := s.UserStorage.TestOnExist(ctx, app.Id, login)
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	err = s.UserStorage.Save(ctx, models.User{AppId: app.Id, Login: login, PasswordHash: []byte("hash"), CreatedAt: time.Now()})
+	require.ErrorIs(t, err, storageErrors.ErrUserExists)
+
+	other := newUser(t, s, app.Id, randomString(t))
+	err = s.UserStorage.UpdateLogin(ctx, app.Id, other.Login, login)
+	require.ErrorIs(t, err, storageErrors.ErrUserExists)
+
+	newLogin := randomString(t)
+	require.NoError(t, s.UserStorage.UpdateLogin(ctx, app.Id, login, newLogin))
+	_, err = s.UserStorage.Get(ctx, app.Id, login)
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+
+	users, err := s.UserStorage.List(ctx, models.UserFilter{AppId: app.Id, SortBy: models.UserSortLogin, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	require.LessOrEqual(t, users[0].Login, users[1].Login)
+
+	deletedAt := time.Now().Add(-time.Hour)
+	require.NoError(t, s.UserStorage.UpdateStatus(ctx, app.Id, newLogin, models.UserDeleted, time.Time{}, deletedAt))
+	users, err = s.UserStorage.List(ctx, models.UserFilter{AppId: app.Id, SortBy: models.UserSortId, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	deleted, err := s.UserStorage.ListDeleted(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+	require.True(t, containsUser(deleted, user.Id))
+
+	require.NoError(t, s.UserStorage.Delete(ctx, app.Id, newLogin))
+	_, err = s.UserStorage.Get(ctx, app.Id, newLogin)
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+
+	role := int32(2)
+	records := []models.UserRecord{
+		{User: models.User{AppId: app.Id, Login: randomString(t), PasswordHash: []byte("hash"), CreatedAt: time.Now()}, Role: &role},
+		{User: models.User{AppId: app.Id, Login: randomString(t), PasswordHash: []byte("hash"), CreatedAt: time.Now()}},
+	}
+	ids, err := s.UserStorage.SaveBatch(ctx, records)
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+	for i, r := range records {
+		got, err := s.UserStorage.Get(ctx, app.Id, r.User.Login)
+		require.NoError(t, err)
+		require.Equal(t, ids[i], got.Id)
+	}
+	perm, err := s.PermissionsStorage.Get(ctx, ids[0])
+	require.NoError(t, err)
+	require.Equal(t, role, perm.Value)
+	_, err = s.UserStorage.SaveBatch(ctx, []models.UserRecord{
+		{User: models.User{AppId: app.Id, Login: randomString(t), PasswordHash: []byte("hash"), CreatedAt: time.Now()}},
+		records[0],
+	})
+	require.ErrorIs(t, err, storageErrors.ErrUserExists)
+}
+
+func testPermissions(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	app := newApp(t, s)
+	user := newUser(t, s, app.Id, randomString(t))
+
+	_, err := s.PermissionsStorage.Get(ctx, user.Id)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound)
+
+	require.NoError(t, s.PermissionsStorage.Save(ctx, user.Id, 3, time.Time{}))
+	perm, err := s.PermissionsStorage.Get(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), perm.Value)
+	require.True(t, perm.ExpiresAt.IsZero())
+
+	expiresAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	require.NoError(t, s.PermissionsStorage.Update(ctx, user.Id, 5, expiresAt))
+	perm, err = s.PermissionsStorage.Get(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, int32(5), perm.Value)
+	require.True(t, perm.ExpiresAt.Equal(expiresAt), "expires at %v, want %v", perm.ExpiresAt, expiresAt)
+
+	n, err := s.PermissionsStorage.DeleteExpired(ctx, time.Now())
+	require.NoError(t, err)
+	require.NotZero(t, n)
+	_, err = s.PermissionsStorage.Get(ctx, user.Id)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound)
+
+	require.NoError(t, s.PermissionsStorage.Save(ctx, user.Id, 1, time.Time{}))
+	require.NoError(t, s.PermissionsStorage.Delete(ctx, user.Id))
+	_, err = s.PermissionsStorage.Get(ctx, user.Id)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound)
+}
+
+func testAppInvalidations(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	old, recent := randomString(t), randomString(t)
+	require.NoError(t, s.AppInvalidations.Publish(ctx, old, now.Add(-time.Hour)))
+	require.NoError(t, s.AppInvalidations.Publish(ctx, recent, now))
+	require.NoError(t, s.AppInvalidations.Publish(ctx, recent, now))
+
+	// clientIds keeps those of this test, the feed being shared with other runs.
+	clientIds := func(since time.Time) []string {
+		invalidations, err := s.AppInvalidations.Since(ctx, since)
+		require.NoError(t, err)
+		var ids []string
+		lastId := int64(0)
+		for _, inv := range invalidations {
+			require.Greater(t, inv.Id, lastId, "oldest first")
+			lastId = inv.Id
+			if inv.ClientId == old || inv.ClientId == recent {
+				ids = append(ids, inv.ClientId)
+			}
+		}
+		return ids
+	}
+	require.Equal(t, []string{old, recent, recent}, clientIds(now.Add(-2*time.Hour)))
+	require.Equal(t, []string{recent, recent}, clientIds(now))
+
+	n, err := s.AppInvalidations.DeleteBefore(ctx, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, n, int64(1))
+	require.Equal(t, []string{recent, recent}, clientIds(now.Add(-2*time.Hour)))
+}
+
+func testAccessRequests(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	app := newApp(t, s)
+	user := newUser(t, s, app.Id, randomString(t))
+
+	id, err := s.AccessRequests.Save(ctx, models.AccessRequest{
+		AppId:      app.Id,
+		UserId:     user.Id,
+		Permission: 2,
+		Duration:   time.Hour,
+		Reason:     "on call",
+		Status:     models.AccessRequestPending,
+		CreatedAt:  time.Now(),
+	})
+	require.NoError(t, err)
+	pending, err := s.AccessRequests.GetByApp(ctx, app.Id, models.AccessRequestPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, user.Login, pending[0].Login)
+
+	decidedAt := time.Now().Truncate(time.Second)
+	require.NoError(t, s.AccessRequests.Decide(ctx, id, models.AccessRequestApproved, "admin:root", decidedAt))
+	// Only pending requests are decided, so concurrent decisions can't both succeed.
+	require.ErrorIs(t, s.AccessRequests.Decide(ctx, id, models.AccessRequestDenied, "admin:other", decidedAt), storageErrors.ErrAccessRequestDecided)
+	require.ErrorIs(t, s.AccessRequests.Decide(ctx, id+1000, models.AccessRequestDenied, "admin:other", decidedAt), storageErrors.ErrAccessRequestDecided)
+	req, err := s.AccessRequests.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, models.AccessRequestApproved, req.Status)
+	require.Equal(t, "admin:root", req.Approver)
+	require.WithinDuration(t, decidedAt, req.DecidedAt, 0)
+	require.Equal(t, time.Hour, req.Duration)
+
+	_, err = s.AccessRequests.Get(ctx, id+1000)
+	require.ErrorIs(t, err, storageErrors.ErrAccessRequestNotFound)
+}
+
+func testTransactions(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	app := newApp(t, s)
+	errAbort := errors.New("abort")
+
+	login := randomString(t)
+	err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.UserStorage.Save(ctx, models.User{AppId: app.Id, Login: login, PasswordHash: []byte("hash"), CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+		if _, err := s.UserStorage.Get(ctx, app.Id, login); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+	_, err = s.UserStorage.Get(ctx, app.Id, login)
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.UserStorage.Save(ctx, models.User{AppId: app.Id, Login: login, PasswordHash: []byte("hash"), CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+		user, err := s.UserStorage.Get(ctx, app.Id, login)
+		if err != nil {
+			return err
+		}
+		return s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			return s.PermissionsStorage.Save(ctx, user.Id, 1, time.Time{})
+		})
+	})
+	require.NoError(t, err)
+	user, err := s.UserStorage.Get(ctx, app.Id, login)
+	require.NoError(t, err)
+	_, err = s.PermissionsStorage.Get(ctx, user.Id)
+	require.NoError(t, err)
+
+	var ran []string
+	s.Tx.AfterCommit(ctx, func(context.Context) { ran = append(ran, "no tx") })
+	require.Equal(t, []string{"no tx"}, ran, "runs right away outside of a transaction")
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		s.Tx.AfterCommit(ctx, func(context.Context) { ran = append(ran, "rolled back") })
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			s.Tx.AfterCommit(ctx, func(ctx context.Context) {
+				// The hook is outside of the committed transaction and may start another.
+				require.NoError(t, s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+					return s.PermissionsStorage.Update(ctx, user.Id, 2, time.Time{})
+				}))
+				ran = append(ran, "committed")
+			})
+			return nil
+		}); err != nil {
+			return err
+		}
+		require.Equal(t, []string{"no tx"}, ran, "waits for the outermost commit")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"no tx", "committed"}, ran)
+	perm, err := s.PermissionsStorage.Get(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), perm.Value)
+}
+
+func testAppDeletion(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	app := newApp(t, s)
+	user := newUser(t, s, app.Id, randomString(t))
+	newUser(t, s, app.Id, randomString(t))
+	require.NoError(t, s.PermissionsStorage.Save(ctx, user.Id, 1, time.Time{}))
+	require.NoError(t, s.ProfileStorage.SetAttributes(ctx, app.Id, user.Id, map[string]string{"city": "Paris", "team": "core"}))
+	now := time.Now()
+	session := models.UserSession{Id: randomString(t), AppId: app.Id, UserId: user.Id, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, s.UserSessions.Save(ctx, session))
+	reqId, err := s.AccessRequests.Save(ctx, models.AccessRequest{
+		AppId: app.Id, UserId: user.Id, Permission: 2, Duration: time.Hour, Status: models.AccessRequestPending, CreatedAt: now,
+	})
+	require.NoError(t, err)
+
+	data, err := s.AppStorage.CountData(ctx, app.Id)
+	require.NoError(t, err)
+	require.Equal(t, models.AppData{Users: 2, Permissions: 1, AccessRequests: 1, Attributes: 2, Sessions: 1}, data)
+
+	require.NoError(t, s.AppStorage.DeleteByClientId(ctx, app.ClientId))
+	_, err = s.UserStorage.Get(ctx, app.Id, user.Login)
+	require.ErrorIs(t, err, storageErrors.ErrUserNotFound)
+	_, err = s.PermissionsStorage.Get(ctx, user.Id)
+	require.ErrorIs(t, err, storageErrors.ErrPermissionNotFound)
+	_, err = s.UserSessions.Get(ctx, session.Id)
+	require.ErrorIs(t, err, storageErrors.ErrSessionNotFound)
+	_, err = s.AccessRequests.Get(ctx, reqId)
+	require.ErrorIs(t, err, storageErrors.ErrAccessRequestNotFound)
+	data, err = s.AppStorage.CountData(ctx, app.Id)
+	require.NoError(t, err)
+	require.Zero(t, data)
+
+	deletedAt := time.Now().Truncate(time.Second)
+	archived := models.DeletedApp{App: app, Data: models.AppData{Users: 2, Sessions: 1}, Cascade: true, DeletedAt: deletedAt, DeletedBy: "storagetest", OnBehalfOf: "alice"}
+	require.NoError(t, s.AppArchive.Save(ctx, archived))
+	require.NoError(t, s.AppArchive.Save(ctx, archived))
+	list, err := s.AppArchive.List(ctx, app.ClientId, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Greater(t, list[0].Id, list[1].Id)
+	got := list[0]
+	require.WithinDuration(t, deletedAt, got.DeletedAt, 0)
+	require.Equal(t, app.Name, got.App.Name)
+	require.Equal(t, app.RedirectURIs, got.App.RedirectURIs)
+	require.Empty(t, got.App.SecretHash)
+	require.Equal(t, archived.Data, got.Data)
+	require.True(t, got.Cascade)
+	require.Equal(t, "storagetest", got.DeletedBy)
+	require.Equal(t, "alice", got.OnBehalfOf)
+	list, err = s.AppArchive.List(ctx, "", 1)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+}
+
+func testAdmins(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	login := randomString(t)
+	_, err := s.Admins.GetByLogin(ctx, login)
+	require.ErrorIs(t, err, storageErrors.ErrAdminNotFound)
+
+	admin := models.Admin{Login: login, PasswordHash: []byte("hash"), Role: models.AdminViewer, CreatedAt: time.Now().Truncate(time.Second)}
+	admin.Id, err = s.Admins.Save(ctx, admin)
+	require.NoError(t, err)
+	_, err = s.Admins.Save(ctx, admin)
+	require.ErrorIs(t, err, storageErrors.ErrAdminExists)
+	got, err := s.Admins.GetByLogin(ctx, login)
+	require.NoError(t, err)
+	require.WithinDuration(t, admin.CreatedAt, got.CreatedAt, 0)
+	got.CreatedAt = admin.CreatedAt
+	require.Equal(t, admin, got)
+
+	require.NoError(t, s.Admins.UpdateRole(ctx, admin.Id, models.AdminOwner))
+	got, err = s.Admins.GetById(ctx, admin.Id)
+	require.NoError(t, err)
+	require.Equal(t, models.AdminOwner, got.Role)
+	list, err := s.Admins.List(ctx)
+	require.NoError(t, err)
+	require.True(t, containsAdmin(list, admin.Id))
+
+	now := time.Now().Truncate(time.Second)
+	session := models.AdminSession{TokenHash: []byte(randomString(t)), AdminId: admin.Id, CSRFToken: "csrf", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	expired := models.AdminSession{TokenHash: []byte(randomString(t)), AdminId: admin.Id, CSRFToken: "csrf", CreatedAt: now, ExpiresAt: now.Add(-time.Hour)}
+	require.NoError(t, s.AdminSessions.Save(ctx, session))
+	require.NoError(t, s.AdminSessions.Save(ctx, expired))
+	gotSession, err := s.AdminSessions.Get(ctx, session.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, admin.Id, gotSession.AdminId)
+	require.Equal(t, "csrf", gotSession.CSRFToken)
+	require.WithinDuration(t, session.ExpiresAt, gotSession.ExpiresAt, 0)
+	n, err := s.AdminSessions.DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	require.NotZero(t, n)
+	_, err = s.AdminSessions.Get(ctx, expired.TokenHash)
+	require.ErrorIs(t, err, storageErrors.ErrAdminSessionNotFound)
+
+	require.NoError(t, s.Admins.Delete(ctx, admin.Id))
+	require.ErrorIs(t, s.Admins.Delete(ctx, admin.Id), storageErrors.ErrAdminNotFound)
+	_, err = s.AdminSessions.Get(ctx, session.TokenHash)
+	require.ErrorIs(t, err, storageErrors.ErrAdminSessionNotFound)
+
+	// The bootstrap is claimed once, unless the claiming transaction rolls back.
+	// A database the suite ran against before is bootstrapped already.
+	rollback := errors.New("rollback")
+	err = s.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.Admins.ClaimBootstrap(ctx, now); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, storageErrors.ErrAdminsBootstrapped) {
+		require.ErrorIs(t, err, rollback)
+		require.NoError(t, s.Admins.ClaimBootstrap(ctx, now))
+	}
+	require.ErrorIs(t, s.Admins.ClaimBootstrap(ctx, now), storageErrors.ErrAdminsBootstrapped)
+}
+
+func testUserSessions(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	app := newApp(t, s)
+	user := newUser(t, s, app.Id, randomString(t))
+	require.False(t, user.PasswordResetRequired)
+
+	require.NoError(t, s.UserStorage.SetPasswordResetRequired(ctx, app.Id, user.Login, true))
+	require.NoError(t, s.UserStorage.SetMFAEnabled(ctx, app.Id, user.Login, true))
+	got, err := s.UserStorage.Get(ctx, app.Id, user.Login)
+	require.NoError(t, err)
+	require.True(t, got.PasswordResetRequired)
+	require.True(t, got.MFAEnabled)
+	require.NoError(t, s.UserStorage.UpdatePassword(ctx, app.Id, user.Login, []byte("new hash")))
+	got, err = s.UserStorage.Get(ctx, app.Id, user.Login)
+	require.NoError(t, err)
+	require.False(t, got.PasswordResetRequired)
+
+	now := time.Now().Truncate(time.Second)
+	older := models.UserSession{Id: randomString(t), AppId: app.Id, UserId: user.Id, CreatedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)}
+	newer := models.UserSession{Id: randomString(t), AppId: app.Id, UserId: user.Id, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	expired := models.UserSession{Id: randomString(t), AppId: app.Id, UserId: user.Id, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	for _, session := range []models.UserSession{older, newer, expired} {
+		require.NoError(t, s.UserSessions.Save(ctx, session))
+	}
+	list, err := s.UserSessions.ListActive(ctx, user.Id, now)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, newer.Id, list[0].Id)
+	require.WithinDuration(t, newer.ExpiresAt, list[0].ExpiresAt, 0)
+
+	require.NoError(t, s.UserSessions.Revoke(ctx, user.Id, older.Id, now))
+	require.ErrorIs(t, s.UserSessions.Revoke(ctx, user.Id, older.Id, now), storageErrors.ErrSessionNotFound)
+	require.ErrorIs(t, s.UserSessions.Revoke(ctx, user.Id+1, newer.Id, now), storageErrors.ErrSessionNotFound)
+	gotSession, err := s.UserSessions.Get(ctx, older.Id)
+	require.NoError(t, err)
+	require.WithinDuration(t, now, gotSession.RevokedAt, 0)
+	n, err := s.UserSessions.RevokeAll(ctx, user.Id, now)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+	list, err = s.UserSessions.ListActive(ctx, user.Id, now)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	n, err = s.UserSessions.DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	require.NotZero(t, n)
+	_, err = s.UserSessions.Get(ctx, expired.Id)
+	require.ErrorIs(t, err, storageErrors.ErrSessionNotFound)
+
+	require.NoError(t, s.UserStorage.Delete(ctx, app.Id, user.Login))
+	_, err = s.UserSessions.Get(ctx, newer.Id)
+	require.ErrorIs(t, err, storageErrors.ErrSessionNotFound)
+}
+
+func newApp(t *testing.T, s *storage.Storage) models.App {
+	t.Helper()
+	ctx := context.Background()
+	clientId := randomString(t)
+	id, err := s.AppStorage.Save(ctx, models.App{
+		ClientId:     clientId,
+		Name:         "app " + clientId,
+		Description:  "conformance test app",
+		Owner:        "storagetest",
+		LogoURL:      "https://example.com/logo.png",
+		RedirectURIs: []string{"https://example.com/callback"},
+		CreatedAt:    time.Now().Truncate(time.Second),
+		Settings:     models.AppSettings{PasswordPolicy: models.PasswordPolicy{MinLength: 8}},
+		SecretHash:   []byte(randomString(t)),
+		SigningKey:   []byte(randomString(t)),
+	})
+	require.NoError(t, err)
+	app, err := s.AppStorage.GetByClientId(ctx, clientId)
+	require.NoError(t, err)
+	require.Equal(t, id, app.Id)
+	return app
+}
+
+func newUser(t *testing.T, s *storage.Storage, appId int32, login string) models.User {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, s.UserStorage.Save(ctx, models.User{
+		AppId:        appId,
+		Login:        login,
+		Email:        login + "@example.com",
+		PasswordHash: []byte("hash"),
+		CreatedAt:    time.Now(),
+	}))
+	user, err := s.UserStorage.Get(ctx, appId, login)
+	require.NoError(t, err)
+	return user
+}
+
+func appClientIds(apps []*models.App) []string {
+	ids := make([]string, 0, len(apps))
+	for _, app := range apps {
+		ids = append(ids, app.ClientId)
+	}
+	return ids
+}
+
+func containsAdmin(admins []models.Admin, id int64) bool {
+	for _, a := range admins {
+		if a.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsUser(users []models.User, id int64) bool {
+	for _, u := range users {
+		if u.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return hex.EncodeToString(b)
+}
+
+func testAuthEvents(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	app := newApp(t, s)
+	user := newUser(t, s, app.Id, randomString(t))
+	now := time.Now().Truncate(time.Second)
+
+	unknown := randomString(t)
+	events := []models.AuthEvent{
+		{Type: models.AuthEventLogin, AppId: app.Id, Login: unknown, Detail: "unknown login", CreatedAt: now.Add(-time.Hour)},
+		{Type: models.AuthEventLogin, AppId: app.Id, UserId: user.Id, Login: user.Login, Success: true,
+			IP: "10.0.0.1", UserAgent: "test", RequestId: "req", CreatedAt: now.Add(-time.Minute)},
+		// Recorded by user id only, the login comes from the user.
+		{Type: models.AuthEventPermissionChange, AppId: app.Id, UserId: user.Id, Success: true, Actor: "app:storagetest", OnBehalfOf: "alice", CreatedAt: now},
+		{Type: models.AuthEventLogin, AppId: app.Id + 1, UserId: user.Id, Login: user.Login, Success: true, CreatedAt: now},
+	}
+	for _, e := range events {
+		require.NoError(t, s.AuthEvents.Save(ctx, e))
+	}
+
+	list, err := s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	require.Equal(t, models.AuthEventPermissionChange, list[0].Type)
+	require.Equal(t, user.Login, list[0].Login)
+	require.Equal(t, "app:storagetest", list[0].Actor)
+	require.Equal(t, "alice", list[0].OnBehalfOf)
+	require.True(t, list[1].Success)
+	require.Equal(t, "10.0.0.1", list[1].IP)
+	require.Equal(t, "test", list[1].UserAgent)
+	require.Equal(t, "req", list[1].RequestId)
+	require.WithinDuration(t, now.Add(-time.Minute), list[1].CreatedAt, 0)
+	require.False(t, list[2].Success)
+	require.Equal(t, "unknown login", list[2].Detail)
+
+	list, err = s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, UserId: user.Id, Login: user.Login, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	list, err = s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Login: unknown, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	list, err = s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Type: models.AuthEventLogin, From: now.Add(-2 * time.Minute), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	page, err := s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	page, err = s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, BeforeId: page[1].Id, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, unknown, page[0].Login)
+
+	// Events outlive their users.
+	require.NoError(t, s.UserStorage.Delete(ctx, app.Id, user.Login))
+	list, err = s.AuthEvents.List(ctx, models.AuthEventFilter{AppId: app.Id, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+}
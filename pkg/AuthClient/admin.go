@@ -0,0 +1,111 @@
+package AuthClient
+
+import (
+	ssoV1 "SSO/pkg/proto/sso"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"net"
+	"time"
+)
+
+// AdminClient manages apps with the server's admin key.
+type AdminClient struct {
+	adminKey   string
+	appsClient ssoV1.AppsClient
+}
+
+func NewAdmin(host string, port string, adminKey string) (*AdminClient, error) {
+	addr := net.JoinHostPort(host, port)
+	cc, err := grpc.DialContext(context.Background(),
+		addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &AdminClient{
+		adminKey:   adminKey,
+		appsClient: ssoV1.NewAppsClient(cc),
+	}, nil
+}
+
+// CreateApp creates an app and returns it with its credential, which can't be read later.
+func (c *AdminClient) CreateApp(ctx context.Context, name string) (*ssoV1.App, string, error) {
+	req, err := c.appsClient.CreateApp(c.ctx(ctx), &ssoV1.CreateAppRequest{
+		Name: name,
+	})
+	return req.GetApp(), req.GetCredential(), err
+}
+
+func (c *AdminClient) GetApp(ctx context.Context, clientId string) (*ssoV1.App, error) {
+	req, err := c.appsClient.GetApp(c.ctx(ctx), &ssoV1.GetAppRequest{
+		ClientId: clientId,
+	})
+	return req.GetApp(), err
+}
+
+func (c *AdminClient) ListApps(ctx context.Context) ([]*ssoV1.App, error) {
+	req, err := c.appsClient.ListApps(c.ctx(ctx), &ssoV1.ListAppsRequest{})
+	return req.GetApps(), err
+}
+
+func (c *AdminClient) RenameApp(ctx context.Context, clientId string, name string) (*ssoV1.App, error) {
+	req, err := c.appsClient.UpdateApp(c.ctx(ctx), &ssoV1.UpdateAppRequest{
+		ClientId: clientId,
+		Name:     &name,
+	})
+	return req.GetApp(), err
+}
+
+// UpdateApp changes the fields set in req, e.g. the app's settings, of the app req.ClientId names.
+func (c *AdminClient) UpdateApp(ctx context.Context, req *ssoV1.UpdateAppRequest) (*ssoV1.App, error) {
+	resp, err := c.appsClient.UpdateApp(c.ctx(ctx), req)
+	return resp.GetApp(), err
+}
+
+// DeleteApp deletes the app, refusing with codes.FailedPrecondition while it has users
+// unless cascade is set, which deletes them with it. It returns the archived record,
+// which tells what was deleted.
+func (c *AdminClient) DeleteApp(ctx context.Context, clientId string, cascade bool) (*ssoV1.DeletedApp, error) {
+	req, err := c.appsClient.DeleteApp(c.ctx(ctx), &ssoV1.DeleteAppRequest{
+		ClientId: clientId,
+		Cascade:  cascade,
+	})
+	return req.GetDeleted(), err
+}
+
+// PreviewDeleteApp tells what deleting the app with cascade would delete, without deleting it.
+func (c *AdminClient) PreviewDeleteApp(ctx context.Context, clientId string) (*ssoV1.AppData, error) {
+	req, err := c.appsClient.DeleteApp(c.ctx(ctx), &ssoV1.DeleteAppRequest{
+		ClientId: clientId,
+		DryRun:   true,
+	})
+	return req.GetDeleted().GetData(), err
+}
+
+// DeletedApps returns the archived records of deleted apps, newest first, only those of
+// clientId when it isn't empty. A limit of zero uses the server default.
+func (c *AdminClient) DeletedApps(ctx context.Context, clientId string, limit int32) ([]*ssoV1.DeletedApp, error) {
+	req, err := c.appsClient.ListDeletedApps(c.ctx(ctx), &ssoV1.ListDeletedAppsRequest{
+		ClientId: clientId,
+		Limit:    limit,
+	})
+	return req.GetApps(), err
+}
+
+// RotateSecret gives the app a new secret and returns its new credential. The old one
+// works for gracePeriod, zero for the server default, unless revoke is set.
+func (c *AdminClient) RotateSecret(ctx context.Context, clientId string, gracePeriod time.Duration, revoke bool) (string, error) {
+	req, err := c.appsClient.RotateSecret(c.ctx(ctx), &ssoV1.RotateSecretRequest{
+		ClientId:    clientId,
+		GracePeriod: int64(gracePeriod / time.Second),
+		Revoke:      revoke,
+	})
+	return req.GetCredential(), err
+}
+
+func (c *AdminClient) ctx(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.adminKey)
+}
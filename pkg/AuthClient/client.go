@@ -6,14 +6,19 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"net"
+	"time"
 )
 
 type Client struct {
 	appKey           []byte
 	authClient       ssoV1.AuthClient
 	permissionClient ssoV1.PermissionsClient
+	usersClient      ssoV1.UsersClient
+	appsClient       ssoV1.AppsClient
 }
 
+// New connects to the SSO server at host:port. appKey is the app credential
+// "<client id>.<secret>" returned when the app was created.
 func New(host string, port string, appKey string) (*Client, error) {
 	addr := net.JoinHostPort(host, port)
 	cc, err := grpc.DialContext(context.Background(),
@@ -28,27 +33,37 @@ func New(host string, port string, appKey string) (*Client, error) {
 		appKey:           []byte(appKey),
 		authClient:       ssoV1.NewAuthClient(cc),
 		permissionClient: ssoV1.NewPermissionsClient(cc),
+		usersClient:      ssoV1.NewUsersClient(cc),
+		appsClient:       ssoV1.NewAppsClient(cc),
 	}
 	return client, nil
 
 }
 
 func (c *Client) Register(ctx context.Context, login string, password string) error {
+	return c.RegisterWithEmail(ctx, login, password, "")
+}
+
+func (c *Client) RegisterWithEmail(ctx context.Context, login string, password string, email string) error {
 	_, err := c.authClient.Register(ctx, &ssoV1.RegisterRequest{
 		AppKey:   c.appKey,
 		Login:    login,
 		Password: password,
+		Email:    email,
 	})
 	return err
 }
 
-func (c *Client) Login(ctx context.Context, login string, password string) (string, error) {
+// Login returns a token for the user. Requested scopes the user isn't allowed are silently left out of it,
+// use HasScopes on the parsed token to check what was granted.
+func (c *Client) Login(ctx context.Context, login string, password string, scopes ...string) (string, error) {
 	req, err := c.authClient.Login(ctx, &ssoV1.LoginRequest{
 		AppKey:   c.appKey,
 		Login:    login,
 		Password: password,
+		Scopes:   scopes,
 	})
-	return req.Token, err
+	return req.GetToken(), err
 }
 
 func (c *Client) DeleteUser(ctx context.Context, login string) error {
@@ -82,7 +97,7 @@ func (c *Client) ParseToken(ctx context.Context, token string) (login string, er
 		AppKey: c.appKey,
 		Token:  token,
 	})
-	return req.Login, err
+	return req.GetLogin(), err
 }
 
 func (c *Client) TestUserOnExist(ctx context.Context, login string) (bool, error) {
@@ -109,3 +124,102 @@ func (c *Client) SetPermission(ctx context.Context, login string, permission int
 	})
 	return err
 }
+
+// SetTemporaryPermission grants permission that expires after ttl.
+func (c *Client) SetTemporaryPermission(ctx context.Context, login string, permission int32, ttl time.Duration) error {
+	_, err := c.permissionClient.SetUserPermission(ctx, &ssoV1.SetUserPermissionRequest{
+		AppKey:     c.appKey,
+		Login:      login,
+		Permission: permission,
+		ExpiresAt:  time.Now().Add(ttl).Unix(),
+	})
+	return err
+}
+
+func (c *Client) RequestAccess(ctx context.Context, login string, permission int32, duration time.Duration, reason string) (int64, error) {
+	req, err := c.permissionClient.RequestAccess(ctx, &ssoV1.RequestAccessRequest{
+		AppKey:     c.appKey,
+		Login:      login,
+		Permission: permission,
+		Duration:   int64(duration / time.Second),
+		Reason:     reason,
+	})
+	return req.GetRequestId(), err
+}
+
+// ApproveAccess approves the request on behalf of the client's app, which is recorded as the approver.
+func (c *Client) ApproveAccess(ctx context.Context, requestId int64) (time.Time, error) {
+	req, err := c.permissionClient.ApproveAccess(ctx, &ssoV1.ApproveAccessRequest{
+		AppKey:    c.appKey,
+		RequestId: requestId,
+	})
+	return time.Unix(req.GetExpiresAt(), 0), err
+}
+
+// DenyAccess denies the request on behalf of the client's app, which is recorded as the approver.
+func (c *Client) DenyAccess(ctx context.Context, requestId int64) error {
+	_, err := c.permissionClient.DenyAccess(ctx, &ssoV1.DenyAccessRequest{
+		AppKey:    c.appKey,
+		RequestId: requestId,
+	})
+	return err
+}
+
+func (c *Client) ListAccessRequests(ctx context.Context, status string) ([]*ssoV1.AccessRequest, error) {
+	req, err := c.permissionClient.ListAccessRequests(ctx, &ssoV1.ListAccessRequestsRequest{
+		AppKey: c.appKey,
+		Status: status,
+	})
+	return req.GetRequests(), err
+}
+
+// PermissionHistory returns one page of permission changes, newest first.
+// Pass the returned token back to get the next page; an empty token means there are no more.
+func (c *Client) PermissionHistory(ctx context.Context, login string, pageSize int32, pageToken string) ([]*ssoV1.PermissionChange, string, error) {
+	req, err := c.permissionClient.History(ctx, &ssoV1.HistoryRequest{
+		AppKey:    c.appKey,
+		Login:     login,
+		PageSize:  pageSize,
+		PageToken: pageToken,
+	})
+	return req.GetChanges(), req.GetNextPageToken(), err
+}
+
+func (c *Client) GetProfile(ctx context.Context, login string) (map[string]string, error) {
+	req, err := c.usersClient.GetProfile(ctx, &ssoV1.GetProfileRequest{
+		AppKey: c.appKey,
+		Login:  login,
+	})
+	return req.GetAttributes(), err
+}
+
+// UpdateProfile merges attrs into the user's profile, an empty value removes the attribute.
+func (c *Client) UpdateProfile(ctx context.Context, login string, attrs map[string]string) error {
+	_, err := c.usersClient.UpdateProfile(ctx, &ssoV1.UpdateProfileRequest{
+		AppKey:     c.appKey,
+		Login:      login,
+		Attributes: attrs,
+	})
+	return err
+}
+
+// RotateSecret gives the app a new secret and returns its new credential. This client keeps
+// using the old one, which works for gracePeriod (zero for the server default) unless revoke
+// is set: create a new client with the returned credential.
+func (c *Client) RotateSecret(ctx context.Context, gracePeriod time.Duration, revoke bool) (string, error) {
+	req, err := c.appsClient.RotateSecret(ctx, &ssoV1.RotateSecretRequest{
+		AppKey:      c.appKey,
+		GracePeriod: int64(gracePeriod / time.Second),
+		Revoke:      revoke,
+	})
+	return req.GetCredential(), err
+}
+
+// SecretUsage reports when the app's secrets were last used, e.g. to tell whether
+// every client moved to the new secret after a rotation.
+func (c *Client) SecretUsage(ctx context.Context) (*ssoV1.SecretUsage, error) {
+	req, err := c.appsClient.GetSecretUsage(ctx, &ssoV1.GetSecretUsageRequest{
+		AppKey: c.appKey,
+	})
+	return req.GetUsage(), err
+}
@@ -0,0 +1,30 @@
+package AuthClient
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+)
+
+// Scopes returns the scopes granted in a parsed token.
+func Scopes(token *jwt.Token) []string {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	scope, _ := claims["scope"].(string)
+	return strings.Fields(scope)
+}
+
+// HasScopes reports whether a parsed token was granted every one of scopes.
+func HasScopes(token *jwt.Token, scopes ...string) bool {
+	granted := make(map[string]bool)
+	for _, s := range Scopes(token) {
+		granted[s] = true
+	}
+	for _, s := range scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+	return true
+}
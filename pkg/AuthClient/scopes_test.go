@@ -0,0 +1,38 @@
+package AuthClient_test
+
+import (
+	"SSO/pkg/AuthClient"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestHasScopes(t *testing.T) {
+	token := func(claims jwt.MapClaims) *jwt.Token {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	}
+	tests := []struct {
+		name   string
+		token  *jwt.Token
+		scopes []string
+		want   bool
+	}{
+		{name: "nothing asked", token: token(jwt.MapClaims{}), want: true},
+		{name: "subset", token: token(jwt.MapClaims{"scope": "read write"}), scopes: []string{"write"}, want: true},
+		{name: "all", token: token(jwt.MapClaims{"scope": "read write"}), scopes: []string{"write", "read"}, want: true},
+		{name: "duplicates", token: token(jwt.MapClaims{"scope": "read"}), scopes: []string{"read", "read"}, want: true},
+		{name: "one missing", token: token(jwt.MapClaims{"scope": "read"}), scopes: []string{"read", "write"}},
+		{name: "no scope claim", token: token(jwt.MapClaims{}), scopes: []string{"read"}},
+		{name: "empty scope claim", token: token(jwt.MapClaims{"scope": ""}), scopes: []string{"read"}},
+		{name: "scope claim not a string", token: token(jwt.MapClaims{"scope": []string{"read"}}), scopes: []string{"read"}},
+		{name: "prefix of a granted scope", token: token(jwt.MapClaims{"scope": "readonly"}), scopes: []string{"read"}},
+		{name: "other claims type", token: jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{}), scopes: []string{"read"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, AuthClient.HasScopes(tt.token, tt.scopes...))
+		})
+	}
+	require.Equal(t, []string{"read", "write"}, AuthClient.Scopes(token(jwt.MapClaims{"scope": " read  write "})))
+}
@@ -4,6 +4,8 @@ import (
 	ssoV1 "SSO/pkg/proto/sso"
 	"SSO/tests/sute"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"testing"
 )
 
@@ -14,14 +16,15 @@ func TestNewAppDelete(t *testing.T) {
 
 	var keys []string
 
+	ctx = st.AdminContext(ctx)
 	for i := 0; i < countCases; i++ {
 		// Add app
-		req, err := st.AppsClient.NewApp(ctx, &ssoV1.NewAppRequest{})
+		req, err := st.AppsClient.CreateApp(ctx, &ssoV1.CreateAppRequest{Name: "test"})
 		require.NoError(t, err)
-		keys = append(keys, string(req.Key))
+		keys = append(keys, req.Credential)
 
 		// Delete app
-		_, err = st.AppsClient.DeleteApp(ctx, &ssoV1.DeleteAppRequest{Key: req.Key})
+		_, err = st.AppsClient.DeleteApp(ctx, &ssoV1.DeleteAppRequest{ClientId: req.App.ClientId})
 		require.NoError(t, err)
 
 	}
@@ -31,6 +34,37 @@ func TestNewAppDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteAppWithUsers(t *testing.T) {
+	ctx, st := sute.New(t)
+
+	adminCtx := st.AdminContext(ctx)
+	app, err := st.AppsClient.CreateApp(adminCtx, &ssoV1.CreateAppRequest{Name: "test"})
+	require.NoError(t, err)
+	_, err = st.AuthClient.Register(ctx, &ssoV1.RegisterRequest{
+		Login:    "login",
+		Password: "password",
+		AppKey:   []byte(app.Credential),
+	})
+	require.NoError(t, err)
+
+	preview, err := st.AppsClient.DeleteApp(adminCtx, &ssoV1.DeleteAppRequest{ClientId: app.App.ClientId, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), preview.Deleted.Data.Users)
+	require.Zero(t, preview.Deleted.DeletedAt)
+
+	_, err = st.AppsClient.DeleteApp(adminCtx, &ssoV1.DeleteAppRequest{ClientId: app.App.ClientId})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	resp, err := st.AppsClient.DeleteApp(adminCtx, &ssoV1.DeleteAppRequest{ClientId: app.App.ClientId, Cascade: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), resp.Deleted.Data.Users)
+
+	archived, err := st.AppsClient.ListDeletedApps(adminCtx, &ssoV1.ListDeletedAppsRequest{ClientId: app.App.ClientId})
+	require.NoError(t, err)
+	require.Len(t, archived.Apps, 1)
+	require.True(t, archived.Apps[0].Cascade)
+}
+
 func testUniqueStrings(strings []string) bool {
 	for i, s := range strings {
 		for j, sub := range strings {
@@ -12,19 +12,19 @@ func TestSetGetPermission(t *testing.T) {
 	ctx, st := sute.New(t)
 
 	var (
-		userId int64 = 1
-		perm   int32 = 1
+		login       = "login"
+		perm  int32 = 1
 	)
 
 	_, err := st.PermClient.SetUserPermission(ctx, &ssoV1.SetUserPermissionRequest{
-		UserId:     userId,
+		Login:      login,
 		Permission: perm,
 		AppKey:     appKey,
 	})
 	require.NoError(t, err)
 
 	resp, err := st.PermClient.GetUserPermission(ctx, &ssoV1.GetUserPermissionRequest{
-		UserId: userId,
+		Login:  login,
 		AppKey: appKey,
 	})
 	require.NoError(t, err)
@@ -6,7 +6,9 @@ import (
 	"context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"net"
+	"os"
 	"testing"
 	"time"
 )
@@ -24,6 +26,10 @@ type Suite struct {
 func New(t *testing.T) (context.Context, *Suite) {
 	t.Helper()
 	t.Parallel()
+	// The suite talks to a running server configured by configPath.
+	if _, err := os.Stat(configPath); err != nil {
+		t.Skipf("no server config: %v", err)
+	}
 	cnf, err := config.GetConfig(configPath)
 	t.Logf("%+v", cnf)
 	if err != nil {
@@ -37,7 +43,7 @@ func New(t *testing.T) (context.Context, *Suite) {
 			cancelCtx()
 		})
 
-	grpcAddress := net.JoinHostPort(cnf.BindConfig.Addr, cnf.BindConfig.Port)
+	grpcAddress := net.JoinHostPort(cnf.GRPCBindConfig.Addr, cnf.GRPCBindConfig.Port)
 
 	cc, err := grpc.DialContext(context.Background(),
 		grpcAddress,
@@ -59,3 +65,8 @@ func New(t *testing.T) (context.Context, *Suite) {
 		PermClient: permClient,
 	}
 }
+
+// AdminContext authorizes the app management calls made with ctx by the configured admin key.
+func (s *Suite) AdminContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+s.Cnf.AdminKey)
+}
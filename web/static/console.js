@@ -0,0 +1,514 @@
+// The console page defines csrfToken, canOperate and isOwner before loading this script.
+
+// Post opens a POST request carrying the session's CSRF token. Requests the
+// server refuses for want of a session send the admin to the login page.
+function Post(url) {
+    const request = new XMLHttpRequest();
+    request.open("POST", url, true);
+    request.setRequestHeader("X-CSRF-Token", csrfToken);
+    request.addEventListener("load", () => {
+        if (request.status === 401) {
+            window.location = "/login";
+        }
+    });
+    return request;
+}
+
+function GetApps() {
+    const request = Post(`/get_apps`);
+    request.send();
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при получении списка приложений");
+            return
+        }
+
+        let apps = JSON.parse(request.responseText);
+        let htmlList = "";
+        for (let app of apps) {
+            htmlList += `<p>${app.id}: ${Escape(app.name)} (${app.client_id})</p><p>${SecretUsage(app)}</p>` +
+                `<a href="javascript:ShowUsers('${app.client_id}')">Пользователи</a> ` +
+                `<a href="javascript:ShowAudit('${app.client_id}', '')">Журнал прав</a> `;
+            if (canOperate) {
+                htmlList += `<a href="javascript:RotateSecret('${app.client_id}')">Сменить ключ</a> `;
+            }
+            if (isOwner) {
+                htmlList += `<a href="javascript:DeleteApp('${app.client_id}')">Удалить</a>`;
+            }
+        }
+        document.getElementById("apps").innerHTML = htmlList;
+    }
+
+}
+function DeleteApp(clientId) {
+    const preview = new URLSearchParams();
+    preview.append("client_id", clientId);
+    preview.append("dry_run", "true");
+    const request = Post(`/delete_app`);
+    request.send(preview);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при удалении приложения");
+            return
+        }
+        let data = JSON.parse(request.responseText).data;
+        let question = "Удалить приложение?";
+        if (data.users > 0) {
+            question = `Вместе с приложением будут удалены пользователи: ${data.users}, ` +
+                `права: ${data.permissions}, запросы доступа: ${data.access_requests}, ` +
+                `атрибуты профилей: ${data.attributes}. Удалить?`;
+        }
+        if (!confirm(question)) {
+            return
+        }
+        const form = new URLSearchParams();
+        form.append("client_id", clientId);
+        form.append("cascade", data.users > 0);
+        const del = Post(`/delete_app`);
+        del.send(form);
+        del.onload = () => {
+            if (del.status === 409) {
+                alert("У приложения появились новые пользователи, попробуйте ещё раз");
+            } else if (del.responseText === "error") {
+                alert("Произошла ошибка при удалении приложения");
+            }
+            GetApps()
+        }
+    }
+}
+function NewApp() {
+    let name = prompt("Название приложения", "");
+    if (name === null) {
+        return
+    }
+    const form = new URLSearchParams();
+    form.append("name", name);
+    const request = Post(`/new_app`);
+    request.send(form);
+    if (request.responseText === "error") {
+        alert("Произошла ошибка создании приложения");
+        return
+    }
+    request.onload = () => {
+        console.log(request.responseText)
+        let app = JSON.parse(request.responseText);
+        GetApps()
+        alert(`Ключ приложения (показывается один раз): ${app.credential}`)
+    }
+
+}
+
+function FormatTime(unix) {
+    return unix === 0 ? "никогда" : new Date(unix * 1000).toLocaleString();
+}
+
+function SecretUsage(app) {
+    let usage = `Ключ использовался: ${FormatTime(app.secret_used_at)}`;
+    if (app.prev_secret_valid) {
+        usage += `. Старый ключ действует до ${FormatTime(app.prev_secret_expires_at)}, ` +
+            `после смены использовался: ${FormatTime(app.prev_secret_used_at)}`;
+    }
+    return usage;
+}
+
+function RotateSecret(clientId) {
+    let grace = prompt("Сколько старый ключ будет действовать (например 24h, пусто - по умолчанию, 0s - отозвать сразу)?", "");
+    if (grace === null) {
+        return
+    }
+    const form = new URLSearchParams();
+    form.append("client_id", clientId);
+    if (grace === "0s") {
+        form.append("revoke", "true");
+    } else {
+        form.append("grace_period", grace);
+    }
+    const request = Post(`/rotate_secret`);
+    request.send(form);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при смене ключа");
+            return
+        }
+        let app = JSON.parse(request.responseText);
+        GetApps()
+        alert(`Новый ключ приложения (показывается один раз): ${app.credential}`)
+    }
+}
+
+let usersApp = "";
+let usersPages = [""];
+
+function ShowUsers(clientId) {
+    usersApp = clientId;
+    usersPages = [""];
+    document.getElementById("users").hidden = false;
+    document.getElementById("user").hidden = true;
+    GetUsers();
+}
+
+function SearchUsers() {
+    usersPages = [""];
+    GetUsers();
+}
+
+function NextUsersPage() {
+    GetUsers();
+}
+
+function PrevUsersPage() {
+    if (usersPages.length > 2) {
+        usersPages.splice(-2, 1);
+        usersPages.pop();
+        GetUsers();
+    }
+}
+
+function GetUsers() {
+    const form = new URLSearchParams();
+    form.append("client_id", usersApp);
+    form.append("search", document.getElementById("users-search").value);
+    form.append("substring", document.getElementById("users-substring").checked);
+    form.append("sort_by", document.getElementById("users-sort").value);
+    form.append("page_token", usersPages[usersPages.length - 1]);
+
+    const request = Post(`/get_users`);
+    request.send(form);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при получении списка пользователей");
+            return
+        }
+        let page = JSON.parse(request.responseText);
+        let rows = "";
+        for (let user of page.users) {
+            let created = new Date(user.created_at * 1000).toLocaleString();
+            rows += `<tr><td>${user.id}</td><td><a href="javascript:ShowUser(${Quote(user.login)})">${Escape(user.login)}</a></td>` +
+                `<td>${Escape(user.email)}</td><td>${created}</td>` +
+                `<td>${user.status}</td><td>${user.mfa_enabled ? "да" : "нет"}</td></tr>`;
+        }
+        document.getElementById("users-rows").innerHTML = rows;
+        usersPages.push(page.next_page_token);
+        document.getElementById("users-next").hidden = page.next_page_token === "";
+        document.getElementById("users-prev").hidden = usersPages.length <= 2;
+    }
+}
+
+function Escape(s) {
+    const div = document.createElement("div");
+    div.textContent = s;
+    return div.innerHTML;
+}
+
+// Quote makes s a JavaScript string literal that is safe inside an HTML attribute.
+function Quote(s) {
+    return Escape(JSON.stringify(s)).replaceAll('"', "&quot;");
+}
+
+const statuses = {active: "активен", disabled: "отключён", suspended: "приостановлен", deleted: "удалён"};
+let userLogin = "";
+
+function UserForm() {
+    const form = new URLSearchParams();
+    form.append("client_id", usersApp);
+    form.append("login", userLogin);
+    return form;
+}
+
+function ShowUser(login) {
+    userLogin = login;
+    document.getElementById("user").hidden = false;
+    GetUser();
+}
+
+function GetUser() {
+    const request = Post(`/get_user`);
+    request.send(UserForm());
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при получении пользователя");
+            return
+        }
+        let user = JSON.parse(request.responseText);
+        let status = statuses[user.status];
+        if (user.status === "suspended") {
+            status += ` до ${FormatTime(user.suspended_until)}`;
+        }
+        let info = `<p>ID: ${user.id}, логин: ${Escape(user.login)}, email: ${Escape(user.email)}</p>` +
+            `<p>Создан: ${FormatTime(user.created_at)}. Статус: ${status}. MFA: ${user.mfa_enabled ? "да" : "нет"}` +
+            `${user.password_reset_required ? ". Требуется смена пароля" : ""}</p>` +
+            `<p>Права: ${user.permission === null ? "нет" : user.permission}</p>`;
+        for (let name in user.profile) {
+            info += `<p>${Escape(name)}: ${Escape(user.profile[name])}</p>`;
+        }
+        document.getElementById("user-info").innerHTML = info;
+
+        let actions = "";
+        if (canOperate && user.status === "deleted") {
+            actions = `<a href="javascript:UserAction('/restore_user', '')">Восстановить</a>`;
+        } else if (canOperate) {
+            actions = (user.status === "active" ?
+                    `<a href="javascript:SetUserStatus('disabled')">Отключить</a> ` +
+                    `<a href="javascript:SuspendUser()">Приостановить</a> ` :
+                    `<a href="javascript:SetUserStatus('active')">Включить</a> `) +
+                `<a href="javascript:UserAction('/reset_user_mfa', 'Сбросить MFA?')">Сбросить MFA</a> ` +
+                `<a href="javascript:UserAction('/require_password_reset', 'Завершить все сессии и потребовать смену пароля?')">Сбросить пароль</a> ` +
+                `<a href="javascript:SetUserPermission()">Выдать права</a> ` +
+                `<a href="javascript:UserAction('/revoke_user_permission', 'Отозвать права?')">Отозвать права</a> ` +
+                `<a href="javascript:UserAction('/revoke_sessions', 'Завершить все сессии?')">Завершить все сессии</a> ` +
+                `<a href="javascript:UserAction('/delete_user', 'Удалить пользователя?')">Удалить</a> `;
+        }
+        actions += `<a href="javascript:ShowAudit(usersApp, userLogin)">Журнал прав</a>`;
+        document.getElementById("user-actions").innerHTML = actions;
+
+        let rows = "";
+        for (let session of user.sessions) {
+            rows += `<tr><td>${session.id}</td><td>${FormatTime(session.created_at)}</td><td>${FormatTime(session.expires_at)}</td>` +
+                `<td>${canOperate ? `<a href="javascript:RevokeSession('${session.id}')">Завершить</a>` : ""}</td></tr>`;
+        }
+        document.getElementById("user-sessions").innerHTML = rows;
+    }
+}
+
+// UserAction posts the user to url once the admin agrees to question, if there is one.
+function UserAction(url, question) {
+    if (question !== "" && !confirm(question)) {
+        return
+    }
+    const request = Post(url);
+    request.send(UserForm());
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка");
+        }
+        GetUser();
+        GetUsers();
+    }
+}
+
+function SetUserStatus(status, until) {
+    const form = UserForm();
+    form.append("status", status);
+    if (until !== undefined) {
+        form.append("suspended_until", until);
+    }
+    const request = Post(`/set_user_status`);
+    request.send(form);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при смене статуса");
+        }
+        GetUser();
+        GetUsers();
+    }
+}
+
+function SuspendUser() {
+    let hours = prompt("На сколько часов приостановить?", "24");
+    if (hours === null) {
+        return
+    }
+    SetUserStatus("suspended", Math.floor(Date.now() / 1000 + Number(hours) * 3600));
+}
+
+function SetUserPermission() {
+    let permission = prompt("Права (число)", "");
+    if (permission === null) {
+        return
+    }
+    let hours = prompt("На сколько часов (пусто - бессрочно)?", "");
+    if (hours === null) {
+        return
+    }
+    const form = UserForm();
+    form.append("permission", permission);
+    if (hours !== "") {
+        form.append("expires_at", Math.floor(Date.now() / 1000 + Number(hours) * 3600));
+    }
+    const request = Post(`/set_user_permission`);
+    request.send(form);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при выдаче прав");
+        }
+        GetUser();
+    }
+}
+
+function RevokeSession(id) {
+    const form = UserForm();
+    form.append("session_id", id);
+    const request = Post(`/revoke_session`);
+    request.send(form);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при завершении сессии");
+        }
+        GetUser();
+    }
+}
+
+const auditActions = {grant: "выдача", change: "изменение", revoke: "отзыв"};
+let auditApp = "";
+let auditPages = [""];
+
+function ShowAudit(clientId, login) {
+    auditApp = clientId;
+    auditPages = [""];
+    document.getElementById("audit-login").value = login;
+    document.getElementById("audit").hidden = false;
+    GetAudit();
+}
+
+function SearchAudit() {
+    auditPages = [""];
+    GetAudit();
+}
+
+function PrevAuditPage() {
+    if (auditPages.length > 2) {
+        auditPages.splice(-2, 1);
+        auditPages.pop();
+        GetAudit();
+    }
+}
+
+function GetAudit() {
+    const form = new URLSearchParams();
+    form.append("client_id", auditApp);
+    form.append("login", document.getElementById("audit-login").value);
+    form.append("actor", document.getElementById("audit-actor").value);
+    form.append("page_token", auditPages[auditPages.length - 1]);
+    const request = Post(`/get_audit`);
+    request.send(form);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при получении журнала");
+            return
+        }
+        let page = JSON.parse(request.responseText);
+        let rows = "";
+        for (let e of page.entries) {
+            let change = e.action === "grant" ? `${e.new_value}` :
+                e.action === "revoke" ? `${e.old_value}` : `${e.old_value} → ${e.new_value}`;
+            if (e.action !== "revoke" && e.new_expires_at !== 0) {
+                change += ` до ${FormatTime(e.new_expires_at)}`;
+            }
+            rows += `<tr><td>${FormatTime(e.created_at)}</td><td>${Escape(e.login)}</td><td>${auditActions[e.action]}</td>` +
+                `<td>${change}</td><td>${Escape(e.actor)}</td><td>${Escape(e.request_id)}</td></tr>`;
+        }
+        document.getElementById("audit-rows").innerHTML = rows;
+        auditPages.push(page.next_page_token);
+        document.getElementById("audit-next").hidden = page.next_page_token === "";
+        document.getElementById("audit-prev").hidden = auditPages.length <= 2;
+    }
+}
+
+function GetDeletedApps() {
+    const request = Post(`/get_deleted_apps`);
+    request.send();
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при получении удалённых приложений");
+            return
+        }
+        let rows = "";
+        for (let app of JSON.parse(request.responseText)) {
+            rows += `<tr><td>${FormatTime(app.deleted_at)}</td><td>${Escape(app.name)} (${app.client_id})</td>` +
+                `<td>${app.data.users}</td><td>${Escape(app.deleted_by)}</td><td>${Escape(app.request_id)}</td></tr>`;
+        }
+        document.getElementById("deleted-apps-rows").innerHTML = rows;
+        document.getElementById("deleted-apps").hidden = false;
+    }
+}
+
+const roles = {viewer: "наблюдатель", operator: "оператор", owner: "владелец"};
+
+function GetAdmins() {
+    const request = Post(`/get_admins`);
+    request.send();
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при получении списка администраторов");
+            return
+        }
+        let rows = "";
+        for (let admin of JSON.parse(request.responseText)) {
+            let options = "";
+            for (let role in roles) {
+                options += `<option value="${role}" ${role === admin.role ? "selected" : ""}>${roles[role]}</option>`;
+            }
+            rows += `<tr><td>${Escape(admin.login)}</td>` +
+                `<td><select class="form-select" onchange="SetAdminRole(${admin.id}, this.value)">${options}</select></td>` +
+                `<td>${new Date(admin.created_at * 1000).toLocaleString()}</td>` +
+                `<td><a href="javascript:DeleteAdmin(${admin.id})">Удалить</a></td></tr>`;
+        }
+        document.getElementById("admins-rows").innerHTML = rows;
+    }
+}
+
+function NewAdmin() {
+    let login = prompt("Логин администратора", "");
+    if (login === null) {
+        return
+    }
+    let password = prompt("Пароль (не короче 8 символов)", "");
+    if (password === null) {
+        return
+    }
+    let role = prompt("Роль: viewer, operator или owner", "viewer");
+    if (role === null) {
+        return
+    }
+    const form = new URLSearchParams();
+    form.append("login", login);
+    form.append("password", password);
+    form.append("role", role);
+    const request = Post(`/new_admin`);
+    request.send(form);
+    request.onload = () => {
+        if (request.responseText === "error") {
+            alert("Произошла ошибка при создании администратора");
+        }
+        GetAdmins()
+    }
+}
+
+function SetAdminRole(id, role) {
+    const form = new URLSearchParams();
+    form.append("id", id);
+    form.append("role", role);
+    const request = Post(`/set_admin_role`);
+    request.send(form);
+    request.onload = () => {
+        if (request.status === 409) {
+            alert("Нельзя понизить последнего владельца");
+        } else if (request.responseText === "error") {
+            alert("Произошла ошибка при смене роли");
+        }
+        GetAdmins()
+    }
+}
+
+function DeleteAdmin(id) {
+    if (!confirm("Удалить администратора?")) {
+        return
+    }
+    const form = new URLSearchParams();
+    form.append("id", id);
+    const request = Post(`/delete_admin`);
+    request.send(form);
+    request.onload = () => {
+        if (request.status === 409) {
+            alert("Нельзя удалить последнего владельца");
+        } else if (request.responseText === "error") {
+            alert("Произошла ошибка при удалении администратора");
+        }
+        GetAdmins()
+    }
+}
+
+GetApps()
+if (isOwner) {
+    GetAdmins()
+}
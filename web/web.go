@@ -0,0 +1,80 @@
+// Package web holds the admin console's templates and static assets, embedded into the binary.
+package web
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+//go:embed templates static
+var files embed.FS
+
+// Site renders the console's pages and serves its static assets.
+type Site struct {
+	files fs.FS
+	// templates is nil in dev mode, where they are parsed on every render.
+	templates *template.Template
+}
+
+// New creates a site from the embedded files, parsing the templates once. A
+// non-empty devDir is read instead, on every request, so that edits to its
+// templates and static directories show up on reload.
+func New(devDir string) (*Site, error) {
+	const op = "web.New"
+
+	if devDir != "" {
+		s := &Site{files: os.DirFS(devDir)}
+		// Refuse to start on a directory that wouldn't render anyway.
+		if _, err := s.parse(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return s, nil
+	}
+	s := &Site{files: files}
+	t, err := s.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	s.templates = t
+	return s, nil
+}
+
+func (s *Site) parse() (*template.Template, error) {
+	return template.ParseFS(s.files, "templates/*.html")
+}
+
+// Render executes the template named name, e.g. "index.html", into w. Nothing is
+// written when it fails, so the caller can still answer with an error.
+func (s *Site) Render(w io.Writer, name string, data any) error {
+	const op = "web.Site.Render"
+
+	t := s.templates
+	if t == nil {
+		var err error
+		if t, err = s.parse(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Static serves the files of the static directory, to be mounted with http.StripPrefix.
+func (s *Site) Static() http.Handler {
+	static, err := fs.Sub(s.files, "static")
+	if err != nil {
+		// Only returned for invalid paths.
+		panic(err)
+	}
+	return http.FileServer(http.FS(static))
+}